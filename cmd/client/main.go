@@ -1 +1,216 @@
-package signaller
+// Command udpie shares, downloads and serves files and runs the signaller from a single binary
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	consumercommands "udpie/cmd/consumer/commands"
+	"udpie/cmd/internal/cli"
+	"udpie/cmd/internal/server"
+	producercommands "udpie/cmd/producer/commands"
+	"udpie/internal/config"
+)
+
+const signallerCommand = "signaller"
+
+// globalFlags are accepted by every subcommand
+type globalFlags struct {
+	configFile string
+	logLevel   string
+	signaller  string
+	token      string
+}
+
+func main() {
+	flags, command := parseGlobalFlags(os.Args[1:])
+	if flags.configFile != "" {
+		config.UseConfigFile(flags.configFile)
+	}
+
+	// The signaller reads its own config, loading the client one first would make viper keep its file
+	cfg := &config.ProducerConfig{}
+	if command != signallerCommand {
+		cfg = cli.LoadConfig()
+		if flags.logLevel != "" {
+			cfg.Log.Level = flags.logLevel
+		}
+		// Applied before the commands are built, their flags default to the config
+		if flags.signaller != "" {
+			cfg.Signaller.URL = flags.signaller
+		}
+		if flags.token != "" {
+			cfg.Signaller.Token = flags.token
+		}
+		cli.InitLogger(&cfg.Log)
+	}
+
+	if err := newRootCommand(cfg, flags).Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// parseGlobalFlags reads the global flags and the subcommand before the commands are built,
+// the config they point to provides the defaults of the command flags
+func parseGlobalFlags(args []string) (globalFlags, string) {
+	var flags globalFlags
+	fs := pflag.NewFlagSet("udpie", pflag.ContinueOnError)
+	fs.ParseErrorsAllowlist.UnknownFlags = true
+	fs.SetOutput(io.Discard)
+	addGlobalFlags(fs, &flags)
+	_ = fs.Parse(args) // cobra reports flag errors once the commands are built
+	return flags, fs.Arg(0)
+}
+
+func addGlobalFlags(fs *pflag.FlagSet, flags *globalFlags) {
+	fs.StringVar(&flags.configFile, "config", "", "Config file (default config.producer.toml, config.toml for the signaller)")
+	fs.StringVar(&flags.logLevel, "log-level", "", "Log level overriding the config (debug, info, warn, error)")
+	fs.StringVar(&flags.signaller, "signaller", "", "Signaller server URL overriding the config")
+	fs.StringVar(&flags.token, "token", "", "Consumer token for the signaller overriding the config")
+}
+
+func newRootCommand(cfg *config.ProducerConfig, flags globalFlags) *cobra.Command {
+	root := &cobra.Command{
+		Use:          "udpie",
+		Short:        "Peer to peer file transfers over UDP",
+		SilenceUsage: true,
+	}
+	addGlobalFlags(root.PersistentFlags(), &flags)
+
+	root.AddGroup(
+		&cobra.Group{ID: "producer", Title: "Sharing files:"},
+		&cobra.Group{ID: "consumer", Title: "Downloading files:"},
+		&cobra.Group{ID: "server", Title: "Running the signaller:"},
+	)
+	for _, cmd := range producerCommands(cfg) {
+		cmd.GroupID = "producer"
+		root.AddCommand(cmd)
+	}
+	for _, cmd := range append(consumerCommands(cfg), newStatusCommand(cfg)) {
+		cmd.GroupID = "consumer"
+		root.AddCommand(cmd)
+	}
+	signaller := newSignallerCommand(flags)
+	signaller.GroupID = "server"
+	root.AddCommand(signaller)
+
+	return root
+}
+
+func producerCommands(cfg *config.ProducerConfig) []*cobra.Command {
+	queue := wrap("queue", "Show running and queued transfers of the producer",
+		producercommands.NewQueueCommand(cfg))
+	queue.AddCommand(
+		wrap("cancel [transfer-id]", "Cancel a running or queued transfer", producercommands.NewCancelCommand(cfg)),
+		wrap("pause [transfer-id]", "Pause a running transfer", producercommands.NewPauseCommand(cfg)),
+		wrap("resume [transfer-id]", "Resume a paused transfer", producercommands.NewResumeCommand(cfg)),
+	)
+
+	return []*cobra.Command{
+		wrap("register", "Register a producer and save its ID", producercommands.NewRegisterCommand(cfg)),
+		wrap("share [path]", "Register a file or a directory on the signaller",
+			producercommands.NewRegisterFileCommand(cfg)),
+		wrap("unshare [file-id]", "Remove a registered file from the signaller",
+			producercommands.NewUnregisterFileCommand(cfg)),
+		wrap("deregister", "Remove the producer and its files from the signaller",
+			producercommands.NewDeregisterCommand(cfg)),
+		wrap("serve", "Serve registered files to consumers", producercommands.NewListenCommand(cfg)),
+		queue,
+		wrap("limits", "Show or change the limits of the serving producer", producercommands.NewLimitsCommand(cfg)),
+		wrap("stats", "Show a summary of the serving producer", producercommands.NewStatsCommand(cfg)),
+	}
+}
+
+func consumerCommands(cfg *config.ProducerConfig) []*cobra.Command {
+	list := wrap("list", "List files (or producers with --producers) registered on the signaller",
+		consumercommands.NewListCommand(cfg))
+	list.Aliases = []string{"ls"}
+
+	return []*cobra.Command{
+		wrap("get [file-id]", "Download a file or a directory", consumercommands.NewDownloadCommand(cfg)),
+		list,
+		wrap("search <name>", "Search files by name", consumercommands.NewSearchCommand(cfg)),
+		wrap("pause [transfer-id]", "Pause a running download", consumercommands.NewPauseCommand(cfg)),
+		wrap("resume [transfer-id]", "Resume a paused download", consumercommands.NewResumeCommand(cfg)),
+	}
+}
+
+// newStatusCommand shows a transfer when given its ID and the transfers of the producer otherwise
+func newStatusCommand(cfg *config.ProducerConfig) *cobra.Command {
+	transfer := consumercommands.NewStatusCommand(cfg)
+	queue := producercommands.NewQueueCommand(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "status [transfer-id]",
+		Short: "Show a transfer, or the transfers of the producer without an ID",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) > 0 || cmd.Flags().Changed("transfer-id") {
+				transfer.Run(args)
+				return
+			}
+			queue.Run(args)
+		},
+	}
+	addCommandFlags(cmd, transfer.FlagSet())
+	addCommandFlags(cmd, queue.FlagSet())
+	return cmd
+}
+
+func newSignallerCommand(flags globalFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   signallerCommand,
+		Short: "Run the signaller server",
+		Args:  cobra.NoArgs,
+		Run: func(*cobra.Command, []string) {
+			cfg, err := config.LoadSignallerConfig()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+				os.Exit(1)
+			}
+			if flags.logLevel != "" {
+				cfg.Log.Level = flags.logLevel
+			}
+			if err := server.InitLogger(&cfg.Log); err != nil {
+				fmt.Fprintf(os.Stderr, "Error initializing logger: %v\n", err)
+				os.Exit(1)
+			}
+
+			server.Run(cfg)
+		},
+	}
+}
+
+// wrap turns a command of the producer or consumer tool into a subcommand,
+// its flags become long flags and its usage is the generated help
+func wrap(use, short string, command cli.Command) *cobra.Command {
+	fs := command.FlagSet()
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Run: func(_ *cobra.Command, args []string) {
+			command.Run(args)
+		},
+	}
+	addCommandFlags(cmd, fs)
+	fs.Usage = func() {
+		_ = cmd.Usage()
+	}
+	return cmd
+}
+
+// addCommandFlags adds the flags of a producer or consumer tool command, except those
+// the global flags replace. Their defaults already carry the global values.
+func addCommandFlags(cmd *cobra.Command, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "signaller" {
+			return
+		}
+		cmd.Flags().AddGoFlag(f)
+	})
+}
@@ -2,83 +2,157 @@ package commands
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/google/uuid"
 
+	"udpie/cmd/internal/cli"
 	"udpie/internal/config"
+	"udpie/internal/handler"
+	"udpie/internal/metrics"
 	"udpie/internal/model"
 	"udpie/internal/service/common"
 	"udpie/internal/service/consumer"
+	"udpie/internal/service/producer"
+)
+
+const (
+	dirPerm           = 0755
+	defaultMaxSources = 4
+	queuePollInterval = 2 * time.Second
 )
 
 // DownloadCommand handles the download command
 type DownloadCommand struct {
-	cfg *config.ProducerConfig
+	cfg         *config.ProducerConfig
+	compression []string // accepted block codecs in order of preference
+	maxRate     uint64   // bandwidth producers are asked to respect, 0 for unlimited
+	tlsConfig   *tls.Config
+	events      *consumer.TransferEvents               // live transfer events, nil when the signaller can not be followed
+	receiving   sync.Map                               // transfer ID -> *consumer.ActiveTransfer of single file downloads
+	swarm       atomic.Pointer[consumer.SwarmDownload] // running multi-source download, nil otherwise
+	fs          *flag.FlagSet
+	flags       downloadFlags
+}
+
+// downloadFlags holds the command line flags of the download command until it runs
+type downloadFlags struct {
+	fileIdStr   *string
+	outputPath  *string
+	include     *string
+	list        *bool
+	compression *string
+	maxSources  *int
+	maxRate     *uint64
+	seed        *bool
+	stateFile   *string
+	metrics     *string
 }
 
 func NewDownloadCommand(cfg *config.ProducerConfig) *DownloadCommand {
 	return &DownloadCommand{cfg: cfg}
 }
 
-// nolint:gocyclo,funlen // complex download logic with multiple error handling paths
-func (c *DownloadCommand) Execute() {
+func (c *DownloadCommand) FlagSet() *flag.FlagSet {
 	fs := flag.NewFlagSet("download", flag.ExitOnError)
-	fileIdStr := fs.String("file-id", "", "File ID to download (required)")
-	outputPath := fs.String("output", "", "Output file path (optional, defaults to file name)")
-
-	if err := fs.Parse(os.Args[2:]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing flags: %v\n", err)
-		os.Exit(1)
+	c.fs = fs
+	c.flags = downloadFlags{
+		fileIdStr:  fs.String("file-id", "", "File ID to download (required, may be given as an argument)"),
+		outputPath: fs.String("output", "", "Output file or directory path (optional, defaults to file name)"),
+		include: fs.String("include", "",
+			"Comma-separated paths or glob patterns to download from a directory (optional)"),
+		list: fs.Bool("list", false, "List files of a directory without downloading"),
+		compression: fs.String("compression", strings.Join(c.cfg.Transfer.Compression, ","),
+			"Comma-separated accepted block compression codecs (zstd, flate), or 'none'"),
+		maxSources: fs.Int("max-sources", defaultMaxSources,
+			"Maximum number of producers to download a file from at once"),
+		maxRate: fs.Uint64("max-rate", c.cfg.Limits.DownloadRate,
+			"Maximum download rate in bytes per second producers are asked to respect, 0 for unlimited"),
+		seed: fs.Bool("seed", false, "Keep serving the file to other consumers after the download is verified"),
+		stateFile: fs.String("state-file", cli.DefaultStateFile,
+			"Path to producer state file used when seeding"),
+		metrics: fs.String("metrics-listen", "",
+			"Address to serve Prometheus metrics on while downloading, e.g. 127.0.0.1:9465, empty to disable"),
 	}
+	return fs
+}
 
-	if *fileIdStr == "" {
+func (c *DownloadCommand) Run(args []string) {
+	flags := &c.flags
+	fileIdStr := *flags.fileIdStr
+	if fileIdStr == "" && len(args) > 0 {
+		fileIdStr = args[0]
+	}
+	if fileIdStr == "" {
 		fmt.Fprintf(os.Stderr, "Error: -file-id is required\n")
-		fs.Usage()
+		c.fs.Usage()
 		os.Exit(1)
 	}
 
-	fileId, err := uuid.Parse(*fileIdStr)
+	fileId, err := uuid.Parse(fileIdStr)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: invalid file ID format: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Always use STUN to detect external address
-	udpOptions, err := c.detectUDPOptions()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if *flags.seed && *flags.list {
+		fmt.Fprintf(os.Stderr, "Error: -seed can not be used with -list\n")
 		os.Exit(1)
 	}
 
+	if *flags.compression != "none" {
+		c.compression = splitPatterns(*flags.compression)
+	}
+	c.maxRate = *flags.maxRate
+
+	c.tlsConfig = cli.SignallerTLS(c.cfg)
+	if *flags.metrics != "" {
+		go serveMetrics(*flags.metrics)
+	}
+
 	// Initialize consumer service using signaller URL from config
-	consumerService := consumer.NewConsumerService(c.cfg.Signaller.URL)
+	consumerService := consumer.NewConsumerService(c.cfg.Signaller.URL, c.cfg.Signaller.Token, c.tlsConfig)
 
-	// Initiate download
-	fmt.Printf("Initiating download for file ID: %s\n", fileId.String())
-	transferResult, err := consumerService.InitDownload(fileId, udpOptions)
+	// Fetch the manifest first to know whether the item is a directory
+	item, err := consumerService.GetManifest(fileId)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error initiating download: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error getting file manifest: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Download initiated successfully\n")
-	fmt.Printf("Transfer ID: %s\n", transferResult.TransferId.String())
-	fmt.Printf("Producer: %s:%d\n", transferResult.ProducerUdpOptions.ExternalIp, transferResult.ProducerUdpOptions.ExternalPort)
-	fmt.Printf("Block Size: %d bytes\n", transferResult.BlockSize)
-	fmt.Printf("Total Blocks: %d\n", transferResult.TotalBlocks)
+	if *flags.list {
+		printManifest(item)
+		return
+	}
+
+	// Always use STUN to detect external address
+	udpOptions, err := cli.DetectUDPOptions(c.cfg.STUN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Determine output file path
-	outputFilePath := *outputPath
+	// Determine output path
+	outputFilePath := *flags.outputPath
 	if outputFilePath == "" {
-		// Use file ID as default name
-		outputFilePath = fileId.String()
+		// The name comes from the signaller, it must not point outside the working directory
+		if err := model.ValidateFileName(item.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v, choose a name with -output\n", err)
+			os.Exit(1)
+		}
+		outputFilePath = item.Name
 	}
 
 	// Make path absolute
@@ -88,85 +162,476 @@ func (c *DownloadCommand) Execute() {
 		os.Exit(1)
 	}
 
-	// Create directory if needed
-	dir := filepath.Dir(absPath)
-	const dirPerm = 0755
-	if mkdirErr := os.MkdirAll(dir, dirPerm); mkdirErr != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to create directory: %v\n", mkdirErr)
+	downloadContext, downloadContextCancel := context.WithCancel(context.Background())
+	defer downloadContextCancel()
+
+	// Setup interrupt handler
+	interruptChan := make(chan os.Signal, 1)
+	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interruptChan
+		downloadContextCancel()
+	}()
+
+	// Follow transfers over the consumer websocket, the queue is polled without it
+	c.events, err = consumerService.OpenEvents()
+	if err != nil {
+		fmt.Printf("Live transfer events unavailable: %v\n", err)
+	} else {
+		defer c.events.Close()
+		go c.followEvents(consumerService)
+	}
+
+	fmt.Println("Press Ctrl+C to cancel")
+
+	if item.Manifest == nil {
+		err = c.downloadSingle(downloadContext, consumerService, fileId, absPath, udpOptions, *flags.maxSources)
+	} else {
+		err = c.downloadDirectory(downloadContext, consumerService, item, splitPatterns(*flags.include), absPath, udpOptions)
+	}
+
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("\nDownload canceled by user")
+		} else {
+			fmt.Fprintf(os.Stderr, "\nFile download failed: %v\n", err)
+		}
 		os.Exit(1)
 	}
 
+	fmt.Println("\nFile download completed successfully!")
+
+	if *flags.seed {
+		if err := c.seed(consumerService, item, absPath, udpOptions, *flags.stateFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error seeding file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// seed verifies the downloaded file against the content hash known to the signaller,
+// registers it as a new copy of the same content and serves it until interrupted
+func (c *DownloadCommand) seed(
+	consumerService *consumer.ConsumerService,
+	item *handler.FileManifestResponse,
+	absPath string,
+	udpOptions model.UdpOptions,
+	stateFile string,
+) error {
+	if item.Manifest != nil {
+		return errors.New("seeding is only supported for single files")
+	}
+
+	hash, err := contentHash(consumerService, item.Id)
+	if err != nil {
+		return err
+	}
+	if err := common.VerifyFile(absPath, hash); err != nil {
+		return err
+	}
+	fmt.Println("Downloaded file verified")
+
+	stateService := producer.NewStateService(stateFile)
+	if err := stateService.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", err)
+	}
+
+	producerService := producer.NewProducerService(c.cfg.Signaller.URL, c.cfg.Signaller.RegistrationToken, c.tlsConfig,
+		stateService)
+
+	// Reuse the saved producer identity or register a new one
+	producerId, exists := stateService.GetProducerId()
+	if !exists {
+		if producerId, err = producerService.Register(udpOptions); err != nil {
+			return err
+		}
+		fmt.Printf("Producer registered: %s\n", producerId.String())
+	}
+
+	fileId, err := producerService.RegisterFile(item.Name, item.Size, producerId, absPath, nil, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Seeding file as FileId: %s\n", fileId.String())
+
+	stunService := common.NewSTUNService(c.cfg.STUN.Servers, c.cfg.STUN.LocalPort, c.cfg.STUN.Timeout)
+	transferService := producer.NewTransferService(stateService, c.cfg.Transfer.Compression,
+		producer.NewRateLimits(c.cfg.Limits))
+	transferService.SetQueueLimits(c.cfg.Limits.MaxTransfers, c.cfg.Limits.QueueSize)
+	policy, err := producer.NewPolicyLoader(stateService).Load(c.cfg.Policy)
+	if err != nil {
+		return fmt.Errorf("error loading policy: %w", err)
+	}
+
+	listener := producer.NewWebsocketListener(producerId, c.cfg.Signaller.URL, c.tlsConfig, stateService, transferService,
+		stunService)
+	listener.SetPolicy(policy)
+	return listener.Listen()
+}
+
+// contentHash returns the content hash the signaller knows for the file
+func contentHash(consumerService *consumer.ConsumerService, fileId uuid.UUID) ([]byte, error) {
+	sources, err := consumerService.GetSources(fileId)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file sources: %w", err)
+	}
+
+	for i := range sources {
+		if sources[i].FileId == fileId && len(sources[i].Hash) > 0 {
+			return sources[i].Hash, nil
+		}
+	}
+
+	return nil, errors.New("file has no content hash, it can not be verified for seeding")
+}
+
+// downloadSingle downloads a single file, from several producers at once when they hold the same content
+func (c *DownloadCommand) downloadSingle(
+	ctx context.Context,
+	consumerService *consumer.ConsumerService,
+	fileId uuid.UUID,
+	absPath string,
+	udpOptions model.UdpOptions,
+	maxSources int,
+) error {
+	sources, err := consumerService.GetSources(fileId)
+	if err != nil {
+		return fmt.Errorf("error getting file sources: %w", err)
+	}
+
+	if maxSources < 2 || len(sources) < 2 || sources[0].TotalBlocks == 0 {
+		return c.downloadFile(ctx, consumerService, fileId, "", absPath, udpOptions)
+	}
+
+	// Prefer the requested file, then the other copies
+	for i := range sources {
+		if sources[i].FileId == fileId {
+			sources[0], sources[i] = sources[i], sources[0]
+			break
+		}
+	}
+	if len(sources) > maxSources {
+		sources = sources[:maxSources]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(absPath), dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	swarm, err := consumer.NewSwarmDownload(consumerService, sources, absPath, handler.InitDownloadRequest{
+		ClientUdpOptions: udpOptions,
+		Compression:      c.compression,
+		MaxRate:          c.maxRate,
+		SessionId:        c.sessionId(),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.swarm.Store(swarm)
+	defer c.swarm.Store(nil)
+	return swarm.Run(ctx)
+}
+
+// downloadDirectory downloads selected manifest entries one by one recreating the tree under root
+func (c *DownloadCommand) downloadDirectory(
+	ctx context.Context,
+	consumerService *consumer.ConsumerService,
+	item *handler.FileManifestResponse,
+	patterns []string,
+	root string,
+	udpOptions model.UdpOptions,
+) error {
+	entries, err := item.Manifest.Select(patterns)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Downloading %d of %d files into %s\n", len(entries), len(item.Manifest.Entries), root)
+
+	for i := range entries {
+		entry := &entries[i]
+		// Never trust paths coming from the network
+		if err := model.ValidateEntryPath(entry.Path); err != nil {
+			return err
+		}
+
+		targetPath := filepath.Join(root, filepath.FromSlash(entry.Path))
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(entries), entry.Path)
+
+		if entry.Size == 0 {
+			if err := createEmptyFile(targetPath); err != nil {
+				return err
+			}
+		} else if err := c.downloadFile(ctx, consumerService, item.Id, entry.Path, targetPath, udpOptions); err != nil {
+			return fmt.Errorf("failed to download %s: %w", entry.Path, err)
+		}
+
+		if len(entry.Hash) > 0 {
+			if err := common.VerifyFile(targetPath, entry.Hash); err != nil {
+				return err
+			}
+		}
+
+		if entry.Mode != 0 {
+			if err := os.Chmod(targetPath, os.FileMode(entry.Mode).Perm()); err != nil {
+				return fmt.Errorf("failed to set mode of %s: %w", targetPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// downloadFile downloads a single file or a single manifest entry to absPath
+func (c *DownloadCommand) downloadFile(
+	ctx context.Context,
+	consumerService *consumer.ConsumerService,
+	fileId uuid.UUID,
+	entryPath string,
+	absPath string,
+	udpOptions model.UdpOptions,
+) error {
+	// Initiate download
+	fmt.Printf("Initiating download for file ID: %s\n", fileId.String())
+	transferResult, err := consumerService.InitDownload(&handler.InitDownloadRequest{
+		Id:               fileId,
+		Path:             entryPath,
+		ClientUdpOptions: udpOptions,
+		Compression:      c.compression,
+		MaxRate:          c.maxRate,
+		SessionId:        c.sessionId(),
+	})
+	if err != nil {
+		return fmt.Errorf("error initiating download: %w", err)
+	}
+
+	fmt.Printf("Download initiated successfully\n")
+	fmt.Printf("Transfer ID: %s\n", transferResult.TransferId.String())
+	fmt.Printf("Producer: %s:%d\n", transferResult.ProducerUdpOptions.ExternalIp, transferResult.ProducerUdpOptions.ExternalPort)
+	fmt.Printf("Block Size: %d bytes\n", transferResult.BlockSize)
+	fmt.Printf("Total Blocks: %d\n", transferResult.TotalBlocks)
+	if transferResult.Compression != "" {
+		fmt.Printf("Compression: %s\n", transferResult.Compression)
+	}
+	if transferResult.QueuePosition > 0 {
+		fmt.Printf("Producer is busy, transfer queued at position %d\n", transferResult.QueuePosition)
+		if c.events == nil {
+			go watchQueue(ctx, consumerService, transferResult.TransferId, transferResult.QueuePosition)
+		}
+	}
+
+	// Create directory if needed
+	if err := os.MkdirAll(filepath.Dir(absPath), dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
 	// Resolve producer address
 	producerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
 		transferResult.ProducerUdpOptions.ExternalIp,
 		transferResult.ProducerUdpOptions.ExternalPort))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error resolving producer address: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error resolving producer address: %w", err)
 	}
 
-	downloadContext, downloadContextCancel := context.WithCancel(context.Background())
-	defer downloadContextCancel()
-
 	// Start receiving file
 	transferService := consumer.NewTransferService()
 	doneChan, err := transferService.StartTransfer(
-		downloadContext,
+		ctx,
 		transferResult.TransferId,
 		absPath,
 		transferResult.BlockSize,
 		transferResult.TotalBlocks,
 		producerAddr,
+		transferResult.Compression,
 	)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error starting transfer: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("error starting transfer: %w", err)
+	}
+	if transfer, exists := transferService.GetTransferStatus(transferResult.TransferId); exists {
+		c.receiving.Store(transferResult.TransferId, transfer)
+		defer c.receiving.Delete(transferResult.TransferId)
+		// A producer cancelling the transfer may not reach the receiver over UDP, the signaller knows
+		if c.events == nil {
+			go consumerService.WatchTransfer(ctx, transfer, queuePollInterval)
+		}
 	}
 
-	// Setup interrupt handler
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
-
-	// Wait for transfer to complete
 	fmt.Println("\nWaiting for file transfer to complete...")
-	fmt.Println("Press Ctrl+C to cancel")
 
 	// Wait for completion or interrupt
 	select {
 	case <-doneChan:
-		transfer, exists := transferService.GetTransferStatus(transferResult.TransferId)
-		if exists {
-			status := transfer.GetStatus()
-			if status == "complete" {
-				fmt.Println("\nFile download completed successfully!")
-				os.Exit(0)
-			} else {
-				fmt.Fprintf(os.Stderr, "\nFile download failed!\n")
-				os.Exit(1)
-			}
+	case <-ctx.Done():
+	}
+
+	if ctx.Err() != nil {
+		// The receiver tells the producer over UDP, the signaller records the cancellation
+		// and reaches the producer when the packet is lost
+		<-doneChan
+		if err := consumerService.CancelTransfer(transferResult.TransferId, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cancelling transfer on the signaller: %v\n", err)
 		}
-	case <-interruptChan:
-		downloadContextCancel()
-		fmt.Println("\nDownload canceled by user")
-		os.Exit(1)
+		return ctx.Err()
+	}
+
+	transfer, exists := transferService.GetTransferStatus(transferResult.TransferId)
+	if exists && transfer.GetStatus() == "cancelled" {
+		return fmt.Errorf("transfer %s was cancelled by the producer", transferResult.TransferId.String())
+	}
+	if !exists || transfer.GetStatus() != "complete" {
+		return fmt.Errorf("transfer %s failed", transferResult.TransferId.String())
 	}
+
+	return nil
 }
 
-func (c *DownloadCommand) detectUDPOptions() (model.UdpOptions, error) {
-	// Always use STUN to detect external IP and port
-	fmt.Println("Detecting external IP and port via STUN...")
+func printManifest(item *handler.FileManifestResponse) {
+	fmt.Printf("%s (%d bytes)\n", item.Name, item.Size)
+	if item.Manifest == nil {
+		fmt.Println("Not a directory")
+		return
+	}
 
-	stunService := common.NewSTUNService(c.cfg.STUN.Servers, c.cfg.STUN.LocalPort, c.cfg.STUN.Timeout)
-	extAddr, err := stunService.Query()
+	for i := range item.Manifest.Entries {
+		entry := &item.Manifest.Entries[i]
+		fmt.Printf("  %s  %d  %s\n", os.FileMode(entry.Mode).Perm().String(), entry.Size, entry.Path)
+	}
+}
+
+func createEmptyFile(filePath string) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), dirPerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.Create(filePath)
 	if err != nil {
-		return model.UdpOptions{}, fmt.Errorf("failed to detect external address via STUN: %w", err)
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	return file.Close()
+}
+
+// splitPatterns splits a comma-separated flag value
+func splitPatterns(value string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// sessionId returns the consumer websocket session transfers are followed by, empty without one
+func (c *DownloadCommand) sessionId() string {
+	if c.events == nil {
+		return ""
+	}
+	return c.events.SessionId
+}
+
+// followEvents reports what happens to the followed transfers until the connection is closed.
+// When a transfer is paused the blocks received so far are reported, the producer skips them on resume.
+func (c *DownloadCommand) followEvents(consumerService *consumer.ConsumerService) {
+	for event := range c.events.Events() {
+		switch event.Type {
+		case model.TransferEventQueued:
+			fmt.Printf("Transfer %s queued at position %d\n", event.TransferId.String(), event.QueuePosition)
+		case model.TransferEventRejected:
+			fmt.Printf("Transfer %s rejected: %s\n", event.TransferId.String(), event.Reason)
+		case model.TransferEventProducerAddress:
+			if event.ProducerUdpOptions != nil {
+				fmt.Printf("Producer of transfer %s moved to %s:%d\n", event.TransferId.String(),
+					event.ProducerUdpOptions.ExternalIp, event.ProducerUdpOptions.ExternalPort)
+			}
+		case model.TransferEventCancelled:
+			fmt.Printf("Transfer %s cancelled: %s\n", event.TransferId.String(), event.Reason)
+			c.finishReceiving(event.TransferId, model.TransferStatusCancelled)
+		case model.TransferEventPaused:
+			fmt.Printf("Transfer %s paused\n", event.TransferId.String())
+			c.reportReceived(consumerService, event.TransferId)
+		case model.TransferEventResumed:
+			fmt.Printf("Transfer %s resumed\n", event.TransferId.String())
+		case model.TransferEventStatus:
+			fmt.Printf("Transfer %s: %s\n", event.TransferId.String(), event.Status)
+			if event.Reason != "" {
+				fmt.Printf("Reason: %s\n", event.Reason)
+			}
+			c.finishReceiving(event.TransferId, event.Status)
+		}
+	}
+	if err := c.events.Err(); err != nil {
+		fmt.Printf("Live transfer events lost: %v\n", err)
 	}
+}
+
+// transfer returns a transfer being received by a single file or a multi-source download
+func (c *DownloadCommand) transfer(transferId uuid.UUID) (*consumer.ActiveTransfer, bool) {
+	if value, ok := c.receiving.Load(transferId); ok {
+		transfer, _ := value.(*consumer.ActiveTransfer)
+		return transfer, true
+	}
+	if swarm := c.swarm.Load(); swarm != nil {
+		return swarm.Transfer(transferId)
+	}
+	return nil, false
+}
 
-	udpAddr := extAddr.(*net.UDPAddr)
-	fmt.Printf("Detected external address: %s:%d\n", udpAddr.IP.String(), udpAddr.Port)
+// finishReceiving stops receiving a transfer the signaller reported ended
+func (c *DownloadCommand) finishReceiving(transferId uuid.UUID, status model.TransferStatus) {
+	if transfer, ok := c.transfer(transferId); ok {
+		transfer.Finish(status)
+	}
+}
+
+// reportReceived uploads the received blocks bitmap of a running download
+func (c *DownloadCommand) reportReceived(consumerService *consumer.ConsumerService, transferId uuid.UUID) {
+	transfer, ok := c.transfer(transferId)
+	if !ok {
+		return
+	}
+	if err := consumerService.ReportReceived(transferId, transfer.ReceivedBitmap()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reporting received blocks: %v\n", err)
+	}
+}
 
-	return model.UdpOptions{
-		ExternalIp:   udpAddr.IP.String(),
-		ExternalPort: udpAddr.Port,
-	}, nil
+// watchQueue reports queue position changes until the producer starts sending
+func watchQueue(ctx context.Context, consumerService *consumer.ConsumerService, transferId uuid.UUID, position int) {
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		status, err := consumerService.GetTransfer(transferId)
+		if err != nil {
+			fmt.Printf("Error getting transfer status: %v\n", err)
+			continue
+		}
+
+		if status.Status != model.TransferStatusQueued {
+			fmt.Printf("Producer started the transfer\n")
+			return
+		}
+		if status.QueuePosition != position {
+			position = status.QueuePosition
+			fmt.Printf("Queue position: %d\n", position)
+		}
+	}
+}
+
+// serveMetrics serves Prometheus metrics of the consumer until the process exits
+func serveMetrics(addr string) {
+	registry := metrics.NewRegistry()
+	metrics.RegisterConsumer(registry)
+
+	fmt.Printf("Serving metrics on http://%s/metrics\n", addr)
+	if err := metrics.ListenAndServe(addr, registry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving metrics: %v\n", err)
+	}
 }
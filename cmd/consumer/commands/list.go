@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/handler"
+	"udpie/internal/model/contract"
+	"udpie/internal/service/consumer"
+)
+
+// ListCommand lists files or producers registered on the signaller.
+// As "search" it takes a name to look for.
+type ListCommand struct {
+	cfg           *config.ProducerConfig
+	search        bool
+	fs            *flag.FlagSet
+	producerIdStr *string
+	online        *bool
+	minSize       *uint64
+	maxSize       *uint64
+	offset        *int
+	limit         *int
+	producers     bool
+}
+
+func NewListCommand(cfg *config.ProducerConfig) *ListCommand {
+	return &ListCommand{cfg: cfg}
+}
+
+func NewSearchCommand(cfg *config.ProducerConfig) *ListCommand {
+	return &ListCommand{cfg: cfg, search: true}
+}
+
+func (c *ListCommand) FlagSet() *flag.FlagSet {
+	name := "list"
+	if c.search {
+		name = "search"
+	}
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	c.fs = fs
+	c.producerIdStr = fs.String("producer", "", "Only files of this producer ID")
+	c.online = fs.Bool("online", false, "Only files of connected producers")
+	c.minSize = fs.Uint64("min-size", 0, "Minimum size in bytes")
+	c.maxSize = fs.Uint64("max-size", 0, "Maximum size in bytes, 0 for no limit")
+	c.offset = fs.Int("offset", 0, "Entries to skip")
+	c.limit = fs.Int("limit", contract.DefaultPageSize, "Entries to show")
+	if !c.search {
+		fs.BoolVar(&c.producers, "producers", false, "List producers instead of files")
+	} else {
+		fs.Usage = func() {
+			fmt.Fprintf(os.Stderr, "Usage: %s search [options] <name>\n", os.Args[0])
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+func (c *ListCommand) Run(args []string) {
+	query := strings.Join(args, " ")
+	if c.search && query == "" {
+		fmt.Fprintf(os.Stderr, "Error: a name to search for is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	var onlineFilter *bool
+	if *c.online {
+		onlineFilter = c.online
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	consumerService := consumer.NewConsumerService(c.cfg.Signaller.URL, c.cfg.Signaller.Token, tlsConfig)
+
+	if c.producers {
+		result, err := consumerService.ListProducers(contract.ListProducersOptions{
+			Online: onlineFilter,
+			Offset: *c.offset,
+			Limit:  *c.limit,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing producers: %v\n", err)
+			os.Exit(1)
+		}
+		printProducers(result)
+		return
+	}
+
+	options := contract.ListFilesOptions{
+		Name:    query,
+		MinSize: *c.minSize,
+		MaxSize: *c.maxSize,
+		Online:  onlineFilter,
+		Offset:  *c.offset,
+		Limit:   *c.limit,
+	}
+	if *c.producerIdStr != "" {
+		var err error
+		if options.ProducerId, err = uuid.Parse(*c.producerIdStr); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid producer ID format: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	result, err := consumerService.ListFiles(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error listing files: %v\n", err)
+		os.Exit(1)
+	}
+	printFiles(result)
+}
+
+func printFiles(result *handler.FileListResponse) {
+	if len(result.Files) == 0 {
+		fmt.Printf("No files found (%d matching)\n", result.Total)
+		return
+	}
+
+	fmt.Printf("Files %d-%d of %d:\n", result.Offset+1, result.Offset+len(result.Files), result.Total)
+	for i := range result.Files {
+		file := &result.Files[i]
+		kind := "file"
+		if file.Directory {
+			kind = fmt.Sprintf("dir(%d)", file.Entries)
+		}
+		fmt.Printf("  %s  %-8s %12d  %-7s %s\n", file.Id.String(), kind, file.Size, presence(file.Online), file.Name)
+	}
+}
+
+func printProducers(result *handler.ProducerListResponse) {
+	if len(result.Producers) == 0 {
+		fmt.Printf("No producers found (%d matching)\n", result.Total)
+		return
+	}
+
+	fmt.Printf("Producers %d-%d of %d:\n", result.Offset+1, result.Offset+len(result.Producers), result.Total)
+	for i := range result.Producers {
+		producer := &result.Producers[i]
+		fmt.Printf("  %s  %-7s registered %s%s\n", producer.Id.String(), presence(producer.Online),
+			producer.CreatedAt.Format("2006-01-02 15:04"), connection(producer))
+	}
+}
+
+// connection describes the uptime of an online producer or when an offline one was last seen
+func connection(producer *handler.ProducerResponse) string {
+	if producer.Online {
+		// nolint:gosec // uptime in seconds is far below the int64 range
+		uptime := time.Duration(producer.Uptime) * time.Second
+		return fmt.Sprintf(", up %s", uptime)
+	}
+	if !producer.LastSeen.IsZero() {
+		return fmt.Sprintf(", last seen %s", producer.LastSeen.Format("2006-01-02 15:04"))
+	}
+	return ""
+}
+
+func presence(online bool) string {
+	if online {
+		return "online"
+	}
+	return "offline"
+}
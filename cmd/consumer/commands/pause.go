@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/consumer"
+)
+
+// PauseCommand pauses a running download. As "resume" it continues a paused one,
+// the producer skips the blocks the download reported while paused.
+type PauseCommand struct {
+	cfg           *config.ProducerConfig
+	resume        bool
+	fs            *flag.FlagSet
+	transferIdStr *string
+}
+
+func NewPauseCommand(cfg *config.ProducerConfig) *PauseCommand {
+	return &PauseCommand{cfg: cfg}
+}
+
+func NewResumeCommand(cfg *config.ProducerConfig) *PauseCommand {
+	return &PauseCommand{cfg: cfg, resume: true}
+}
+
+func (c *PauseCommand) FlagSet() *flag.FlagSet {
+	name := "pause"
+	if c.resume {
+		name = "resume"
+	}
+
+	c.fs = flag.NewFlagSet(name, flag.ExitOnError)
+	c.transferIdStr = c.fs.String("transfer-id", "",
+		"Transfer ID (required, may be given as an argument), printed by the download command")
+	return c.fs
+}
+
+func (c *PauseCommand) Run(args []string) {
+	transferIdStr := *c.transferIdStr
+	if transferIdStr == "" && len(args) > 0 {
+		transferIdStr = args[0]
+	}
+	if transferIdStr == "" {
+		fmt.Fprintf(os.Stderr, "Error: -transfer-id is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	transferId, err := uuid.Parse(transferIdStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid transfer ID format: %v\n", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	consumerService := consumer.NewConsumerService(c.cfg.Signaller.URL, c.cfg.Signaller.Token, tlsConfig)
+
+	if c.resume {
+		err = consumerService.ResumeTransfer(transferId)
+	} else {
+		err = consumerService.PauseTransfer(transferId)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if c.resume {
+		fmt.Printf("Transfer resumed: %s\n", transferId.String())
+	} else {
+		fmt.Printf("Transfer paused: %s\n", transferId.String())
+	}
+}
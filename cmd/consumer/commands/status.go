@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/model"
+	"udpie/internal/service/consumer"
+)
+
+// StatusCommand shows the status of a transfer known to the signaller
+type StatusCommand struct {
+	cfg           *config.ProducerConfig
+	fs            *flag.FlagSet
+	transferIdStr *string
+}
+
+func NewStatusCommand(cfg *config.ProducerConfig) *StatusCommand {
+	return &StatusCommand{cfg: cfg}
+}
+
+func (c *StatusCommand) FlagSet() *flag.FlagSet {
+	c.fs = flag.NewFlagSet("status", flag.ExitOnError)
+	c.transferIdStr = c.fs.String("transfer-id", "",
+		"Transfer ID (required, may be given as an argument), printed by the download command")
+	return c.fs
+}
+
+func (c *StatusCommand) Run(args []string) {
+	transferIdStr := *c.transferIdStr
+	if transferIdStr == "" && len(args) > 0 {
+		transferIdStr = args[0]
+	}
+	if transferIdStr == "" {
+		fmt.Fprintf(os.Stderr, "Error: -transfer-id is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	transferId, err := uuid.Parse(transferIdStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid transfer ID format: %v\n", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	consumerService := consumer.NewConsumerService(c.cfg.Signaller.URL, c.cfg.Signaller.Token, tlsConfig)
+	transfer, err := consumerService.GetTransfer(transferId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Transfer: %s\n", transfer.Id.String())
+	fmt.Printf("Status: %s\n", transfer.Status)
+	if transfer.Status == model.TransferStatusQueued {
+		fmt.Printf("Queue position: %d\n", transfer.QueuePosition)
+	}
+	fmt.Printf("FileId: %s\n", transfer.FileId.String())
+	fmt.Printf("ProducerId: %s\n", transfer.ProducerId.String())
+	fmt.Printf("Blocks: %d of %d bytes\n", transfer.TotalBlocks, transfer.BlockSize)
+	if transfer.Compression != "" {
+		fmt.Printf("Compression: %s\n", transfer.Compression)
+	}
+}
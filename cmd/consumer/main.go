@@ -5,10 +5,12 @@ import (
 	"os"
 
 	"udpie/cmd/consumer/commands"
+	"udpie/cmd/internal/cli"
 )
 
 func main() {
-	cfg := loadConfig()
+	cfg := cli.LoadConfig()
+	cli.InitLogger(&cfg.Log)
 
 	if len(os.Args) < 2 {
 		printUsage()
@@ -17,29 +19,39 @@ func main() {
 
 	command := os.Args[1]
 
-	var cmd Command
+	var cmd cli.Command
 	switch command {
 	case "download":
 		cmd = commands.NewDownloadCommand(cfg)
+	case "list":
+		cmd = commands.NewListCommand(cfg)
+	case "search":
+		cmd = commands.NewSearchCommand(cfg)
+	case "status":
+		cmd = commands.NewStatusCommand(cfg)
+	case "pause":
+		cmd = commands.NewPauseCommand(cfg)
+	case "resume":
+		cmd = commands.NewResumeCommand(cfg)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		printUsage()
 		os.Exit(1)
 	}
 
-	cmd.Execute()
-}
-
-// Command interface for all commands
-type Command interface {
-	Execute()
+	cli.Execute(cmd, os.Args[2:])
 }
 
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `Usage: %s <command> [options]
 
 Commands:
-  download        Download a file by file ID
+  download        Download a file or a directory by file ID
+  list            List files (or producers with -producers) registered on the signaller
+  search          Search files by name
+  status          Show the status of a transfer
+  pause           Pause a running download
+  resume          Resume a paused download
 
 Use '%s <command> -help' for command-specific help.
 `, os.Args[0], os.Args[0])
@@ -0,0 +1,141 @@
+// Package cli holds what the producer, consumer and udpie command line tools share:
+// loading the config, setting up logging, the signaller TLS config and resolving the producer identity.
+package cli
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/client"
+	"udpie/internal/config"
+	"udpie/internal/model"
+	"udpie/internal/service/common"
+	"udpie/internal/service/producer"
+	"udpie/pkg/logutils"
+)
+
+// DefaultStateFile is where producer commands keep the producer identity and registered files
+const DefaultStateFile = ".udpie-producer-state.json"
+
+// LoadConfig loads the producer and consumer config with defaults
+func LoadConfig() *config.ProducerConfig {
+	cfg, err := config.LoadProducerConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load config, using defaults: %v\n", err)
+		// Use defaults if config file not found
+		cfg = &config.ProducerConfig{
+			Signaller: config.ProducerSignallerConfig{
+				URL: "http://localhost:8080",
+			},
+			STUN: config.STUNConfig{
+				Servers:   []string{"stun.nextcloud.com:3478", "global.stun.twilio.com:3478", "stun.l.google.com:19302"},
+				LocalPort: 50000,
+				Timeout:   5,
+			},
+			Transfer: config.TransferConfig{
+				Compression: config.DefaultCompression,
+			},
+			Limits: config.LimitsConfig{
+				MaxTransfers: config.DefaultMaxTransfers,
+				QueueSize:    config.DefaultQueueSize,
+				QueueTimeout: config.DefaultQueueTimeout,
+			},
+			Policy: config.PolicyConfig{
+				Default:         "allow",
+				ApprovalTimeout: config.DefaultApprovalTimeout,
+			},
+			Control: config.ControlConfig{
+				Socket: config.DefaultControlSocket,
+			},
+			Log: config.LogConfig{
+				Level:     "info",
+				Format:    "text",
+				OutputStd: true,
+			},
+		}
+	}
+	return cfg
+}
+
+// InitLogger sets up logging of the services, logs go to stderr and the log file while
+// command output stays on stdout
+func InitLogger(cfg *config.LogConfig) {
+	err := logutils.SetupLogger(&logutils.LogConfig{
+		Level:      cfg.Level,
+		File:       cfg.File,
+		Format:     cfg.Format,
+		OutputFile: cfg.OutputFile,
+		OutputStd:  cfg.OutputStd,
+		Stderr:     true,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to set up logging: %v\n", err)
+	}
+}
+
+// ProducerID parses the producer ID given on the command line, the ID saved in the state is used without one
+func ProducerID(producerIdStr string, stateService *producer.StateService) (uuid.UUID, error) {
+	if producerIdStr != "" {
+		producerId, err := uuid.Parse(producerIdStr)
+		if err != nil {
+			return uuid.Nil, fmt.Errorf("invalid producer ID format: %w", err)
+		}
+		return producerId, nil
+	}
+
+	// Try to get from state
+	savedId, exists := stateService.GetProducerId()
+	if !exists {
+		return uuid.Nil, fmt.Errorf("producer ID not found. Please provide --producer-id or register a producer first")
+	}
+
+	return savedId, nil
+}
+
+// DetectUDPOptions queries STUN servers for the external address UDP traffic arrives at
+func DetectUDPOptions(cfg config.STUNConfig) (model.UdpOptions, error) {
+	// Always use STUN to detect external IP and port
+	fmt.Println("Detecting external IP and port via STUN...")
+
+	stunService := common.NewSTUNService(cfg.Servers, cfg.LocalPort, cfg.Timeout)
+	extAddr, err := stunService.Query()
+	if err != nil {
+		return model.UdpOptions{}, fmt.Errorf("failed to detect external address via STUN: %w", err)
+	}
+
+	udpAddr := extAddr.(*net.UDPAddr)
+	fmt.Printf("Detected external address: %s:%d\n", udpAddr.IP.String(), udpAddr.Port)
+
+	return model.UdpOptions{
+		ExternalIp:   udpAddr.IP.String(),
+		ExternalPort: udpAddr.Port,
+	}, nil
+}
+
+// Daemon returns a client of the producer listening on the control socket, nil when none is listening
+func Daemon(socketPath string) *producer.ControlClient {
+	control, err := producer.DialControl(socketPath)
+	if err != nil {
+		return nil
+	}
+	return control
+}
+
+// SignallerTLS returns the TLS config for connections to the signaller, nil for the defaults.
+// An invalid config is fatal.
+func SignallerTLS(cfg *config.ProducerConfig) *tls.Config {
+	tlsConfig, err := client.NewTLSConfig(cfg.Signaller.TLS)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring signaller TLS: %v\n", err)
+		os.Exit(1)
+	}
+	return tlsConfig
+}
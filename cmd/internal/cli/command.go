@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Command is a subcommand with its own flags
+type Command interface {
+	// FlagSet defines the flags of the command, Run reads their values once they are parsed
+	FlagSet() *flag.FlagSet
+	// Run executes the command with the arguments left after the flags
+	Run(args []string)
+}
+
+// Execute parses the flags of the command from args and runs it
+func Execute(cmd Command, args []string) {
+	fs := cmd.FlagSet()
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing flags: %v\n", err)
+		os.Exit(1)
+	}
+	cmd.Run(fs.Args())
+}
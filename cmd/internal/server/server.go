@@ -0,0 +1,231 @@
+// Package server runs the signaller, it is shared by the signaller binary and the udpie command line tool.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+
+	_ "udpie/docs" // swagger docs
+	"udpie/internal/config"
+	"udpie/internal/handler"
+	"udpie/internal/metrics"
+	"udpie/internal/service/signaller"
+	"udpie/internal/storage"
+	"udpie/pkg/logutils"
+)
+
+const (
+	shutdownTimeout = 2 * time.Second
+)
+
+// Run starts the signaller and serves until SIGINT or SIGTERM is received
+func Run(cfg *config.SignallerConfig) {
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		logutils.WithError(err).Fatal("Failed to open storage")
+	}
+	logutils.WithFields(logutils.Fields{
+		"type": cfg.Storage.Type,
+		"path": cfg.Storage.Path,
+	}).Info("Storage opened")
+
+	producerService := signaller.NewProducerService(store)
+	wsService := signaller.NewWebsocketService(producerService)
+	producerService.SetPresence(wsService)
+	fileService, err := signaller.NewFileService(store, producerService, wsService)
+	if err != nil {
+		logutils.WithError(err).Fatal("Failed to load files")
+	}
+	fileService.SetTTL(time.Duration(cfg.Files.DefaultTTL)*time.Second, time.Duration(cfg.Files.MaxTTL)*time.Second)
+	if cfg.Files.ExpiryInterval > 0 {
+		// Expired files are removed for as long as the server runs
+		fileService.StartExpiry(context.Background(), time.Duration(cfg.Files.ExpiryInterval)*time.Second)
+	}
+	transferService, err := signaller.NewTransferService(store, fileService, producerService, wsService)
+	if err != nil {
+		logutils.WithError(err).Fatal("Failed to load transfers")
+	}
+	if cfg.Transfers.Retention > 0 && cfg.Transfers.ExpiryInterval > 0 {
+		transferService.StartExpiry(context.Background(), time.Duration(cfg.Transfers.ExpiryInterval)*time.Second,
+			time.Duration(cfg.Transfers.Retention)*time.Second)
+	}
+	consumerWsService := signaller.NewConsumerWebsocketService(transferService)
+	transferService.SetEvents(consumerWsService)
+
+	if len(cfg.Auth.RegistrationTokens) == 0 {
+		logutils.Warn("No registration tokens configured, anyone can register producers")
+	}
+	if len(cfg.Auth.ConsumerTokens) == 0 && len(cfg.Auth.Consumers) == 0 {
+		logutils.Warn("No consumer tokens configured, anyone can look up and download files")
+	}
+	auth := handler.NewAuthenticator(producerService, cfg.Auth.RegistrationTokens, cfg.Auth.ConsumerTokens,
+		cfg.Auth.ConsumerIdentities())
+
+	appRouter := handler.NewRouter(producerService, fileService, transferService, wsService, consumerWsService,
+		auth)
+	fastRouter := router.New()
+	// Request latencies are recorded by route, the path has to be saved when routes are added
+	fastRouter.SaveMatchedRoutePath = cfg.Metrics.Enabled
+	appRouter.SetupRoutes(fastRouter)
+	requestHandler := fastRouter.Handler
+	if cfg.Metrics.Enabled {
+		requestHandler = serveMetrics(&cfg.Metrics, fastRouter, metrics.SignallerSources{
+			Producers:           producerService.CountProducers,
+			ProducerConnections: wsService.ConnectionCount,
+			ConsumerConnections: consumerWsService.SessionCount,
+			PendingRequests:     wsService.PendingRequestCount,
+			Transfers:           transferService.CountByStatus,
+		})
+	}
+
+	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
+	logutils.WithFields(logutils.Fields{
+		"host": cfg.Server.Host,
+		"port": cfg.Server.Port,
+	}).Info("Signaller server starting")
+
+	server := &fasthttp.Server{
+		Handler:            requestHandler,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       10 * time.Second,
+		IdleTimeout:        30 * time.Second,
+		CloseOnShutdown:    true,
+		DisableKeepalive:   false,
+		TCPKeepalive:       true,
+		TCPKeepalivePeriod: 30 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logutils.WithError(err).Fatal("Failed to create listener")
+	}
+
+	if cfg.Server.TLS.Enabled() {
+		// The certificate is watched for as long as the server runs
+		tlsConfig, tlsErr := newTLSConfig(context.Background(), &cfg.Server.TLS)
+		if tlsErr != nil {
+			logutils.WithError(tlsErr).Fatal("Failed to configure TLS")
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+		logutils.WithField("client_auth", cfg.Server.TLS.ClientAuth).Info("Serving HTTPS")
+	}
+
+	serverErrChan := make(chan error, 1)
+	go func() {
+		if err := server.Serve(ln); err != nil {
+			serverErrChan <- err
+		}
+	}()
+
+	logutils.Info("Server started successfully")
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErrChan:
+		if err != nil {
+			logutils.WithError(err).Error("Server error")
+		}
+	case sig := <-sigChan:
+		gracefulShutdown(ln, serverErrChan, shutdownTimeout, sig)
+	}
+
+	if err := store.Close(); err != nil {
+		logutils.WithError(err).Error("Error closing storage")
+	}
+}
+
+// serveMetrics serves the metrics on their own address or adds their route to the API and returns
+// the router handler recording request latencies. The router has to save matched route paths.
+func serveMetrics(cfg *config.MetricsConfig, fastRouter *router.Router,
+	sources metrics.SignallerSources) fasthttp.RequestHandler {
+	registry := metrics.NewRegistry()
+	metrics.RegisterSignaller(registry, sources)
+
+	if cfg.Listen == "" {
+		fastRouter.GET(cfg.Path, metrics.FastHTTPHandler(registry))
+		logutils.WithField("path", cfg.Path).Warn("Serving metrics on the API port without authentication")
+		return metrics.InstrumentHandler(fastRouter.Handler)
+	}
+
+	metricsRouter := router.New()
+	metricsRouter.GET(cfg.Path, metrics.FastHTTPHandler(registry))
+	go func() {
+		logutils.WithFields(logutils.Fields{
+			"listen": cfg.Listen,
+			"path":   cfg.Path,
+		}).Info("Serving metrics")
+		if err := fasthttp.ListenAndServe(cfg.Listen, metricsRouter.Handler); err != nil {
+			logutils.WithError(err).Error("Failed to serve metrics")
+		}
+	}()
+	return metrics.InstrumentHandler(fastRouter.Handler)
+}
+
+func gracefulShutdown(ln net.Listener, serverErrChan chan error, timeout time.Duration, sig os.Signal) {
+	logutils.WithField("signal", sig.String()).Info("Received shutdown signal, initiating graceful shutdown")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := ln.Close(); err != nil {
+		logutils.WithError(err).Error("Error closing listener")
+	} else {
+		logutils.Info("Listener closed, no longer accepting new connections")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case err := <-serverErrChan:
+			if err != nil {
+				logutils.Debug("Server stopped after listener close")
+			}
+		case <-shutdownCtx.Done():
+			// Timeout reached
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logutils.Info("Server shutdown completed successfully")
+	case <-shutdownCtx.Done():
+		if shutdownCtx.Err() == context.DeadlineExceeded {
+			logutils.Warn("Shutdown timeout exceeded, some connections may not have finished gracefully")
+		}
+	}
+}
+
+// InitLogger sets up logging of the signaller
+func InitLogger(cfg *config.LogConfig) error {
+	logConfig := logutils.LogConfig{
+		Level:      cfg.Level,
+		File:       cfg.File,
+		Format:     cfg.Format,
+		OutputFile: cfg.OutputFile,
+		OutputStd:  cfg.OutputStd,
+		MaxSize:    cfg.MaxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Compress:   cfg.Compress,
+	}
+
+	err := logutils.SetupLogger(&logConfig)
+	if err != nil {
+		return err
+	}
+
+	logutils.Info("Logger initialized successfully")
+	return nil
+}
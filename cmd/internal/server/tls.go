@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"udpie/internal/config"
+	"udpie/pkg/logutils"
+	"udpie/utils"
+)
+
+// newTLSConfig builds the server TLS config and starts reloading the certificate when configured
+func newTLSConfig(ctx context.Context, cfg *config.ServerTLSConfig) (*tls.Config, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, fmt.Errorf("both cert_file and key_file are required for TLS")
+	}
+
+	reloader, err := utils.NewCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	clientAuth := strings.ToLower(cfg.ClientAuth)
+	switch clientAuth {
+	case "", config.ClientAuthNone:
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case config.ClientAuthRequest:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("invalid client_auth %q, expected none, request or require", cfg.ClientAuth)
+	}
+
+	if tlsConfig.ClientAuth != tls.NoClientCert {
+		if cfg.ClientCAFile == "" {
+			return nil, fmt.Errorf("client_ca_file is required for client_auth %s", clientAuth)
+		}
+		pool, err := loadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	if cfg.ReloadInterval > 0 {
+		go reloader.Watch(ctx, time.Duration(cfg.ReloadInterval)*time.Second, func(err error) {
+			if err != nil {
+				logutils.WithError(err).Error("Failed to reload TLS certificate, keeping the previous one")
+				return
+			}
+			logutils.Info("TLS certificate reloaded")
+		})
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file) // nolint:gosec // path comes from the operator's config
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/producer"
+)
+
+// CancelCommand handles the cancel command
+type CancelCommand struct {
+	cfg           *config.ProducerConfig
+	fs            *flag.FlagSet
+	producerIdStr *string
+	transferIdStr *string
+	reason        *string
+	stateFile     *string
+	controlSocket *string
+}
+
+func NewCancelCommand(cfg *config.ProducerConfig) *CancelCommand {
+	return &CancelCommand{cfg: cfg}
+}
+
+func (c *CancelCommand) FlagSet() *flag.FlagSet {
+	c.fs = flag.NewFlagSet("cancel", flag.ExitOnError)
+	c.producerIdStr = c.fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.transferIdStr = c.fs.String("transfer-id", "",
+		"Transfer ID (required, may be given as an argument), see the queue command")
+	c.reason = c.fs.String("reason", "", "Reason shown to the consumer (optional)")
+	c.stateFile = c.fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.controlSocket = c.fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket of a listening producer, the command goes through it when one listens")
+	return c.fs
+}
+
+func (c *CancelCommand) Run(args []string) {
+	transferIdStr := *c.transferIdStr
+	if transferIdStr == "" && len(args) > 0 {
+		transferIdStr = args[0]
+	}
+	if transferIdStr == "" {
+		fmt.Fprintf(os.Stderr, "Error: -transfer-id is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	transferId, err := uuid.Parse(transferIdStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid transfer ID format: %v\n", err)
+		os.Exit(1)
+	}
+
+	if control := cli.Daemon(*c.controlSocket); control != nil {
+		if err := control.CancelTransfer(transferId, *c.reason); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Transfer cancelled: %s\n", transferId.String())
+		return
+	}
+
+	stateService := producer.NewStateService(*c.stateFile)
+	if err := stateService.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", err)
+	}
+
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(c.cfg.Signaller.URL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+	if err := producerService.CancelTransfer(producerId, transferId, *c.reason); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Transfer cancelled: %s\n", transferId.String())
+}
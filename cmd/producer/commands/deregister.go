@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/producer"
+)
+
+// DeregisterCommand handles the deregister command
+type DeregisterCommand struct {
+	cfg           *config.ProducerConfig
+	signallerURL  *string
+	producerIdStr *string
+	stateFile     *string
+}
+
+func NewDeregisterCommand(cfg *config.ProducerConfig) *DeregisterCommand {
+	return &DeregisterCommand{cfg: cfg}
+}
+
+func (c *DeregisterCommand) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("deregister", flag.ExitOnError)
+	c.signallerURL = fs.String("signaller", c.cfg.Signaller.URL, "Signaller server URL")
+	c.producerIdStr = fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.stateFile = fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	return fs
+}
+
+func (c *DeregisterCommand) Run([]string) {
+	// Initialize state service
+	stateService := producer.NewStateService(*c.stateFile)
+	if loadErr := stateService.Load(); loadErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", loadErr)
+	}
+
+	// Get producer ID
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *c.producerIdStr == "" {
+		fmt.Printf("Using saved ProducerId: %s\n", producerId.String())
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(*c.signallerURL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+	files, err := producerService.Deregister(producerId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error deregistering producer: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Producer deregistered successfully\n")
+	fmt.Printf("ProducerId: %s\n", producerId.String())
+	fmt.Printf("Files removed: %d\n", files)
+	fmt.Printf("State saved to: %s\n", *c.stateFile)
+}
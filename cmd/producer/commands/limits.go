@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/producer"
+)
+
+// LimitsCommand shows or changes the limits of a listening producer
+type LimitsCommand struct {
+	cfg           *config.ProducerConfig
+	fs            *flag.FlagSet
+	rate          *uint64
+	burst         *uint64
+	transferRate  *uint64
+	transferBurst *uint64
+	maxTransfers  *int
+	queueSize     *int
+	controlSocket *string
+}
+
+func NewLimitsCommand(cfg *config.ProducerConfig) *LimitsCommand {
+	return &LimitsCommand{cfg: cfg}
+}
+
+func (c *LimitsCommand) FlagSet() *flag.FlagSet {
+	c.fs = flag.NewFlagSet("limits", flag.ExitOnError)
+	c.rate = c.fs.Uint64("rate-limit", 0, "Bandwidth limit for all transfers in bytes per second, 0 for unlimited")
+	c.burst = c.fs.Uint64("rate-burst", 0, "Burst size for all transfers in bytes, 0 for one second of rate")
+	c.transferRate = c.fs.Uint64("transfer-rate-limit", 0,
+		"Bandwidth limit for a single transfer in bytes per second, 0 for unlimited")
+	c.transferBurst = c.fs.Uint64("transfer-rate-burst", 0,
+		"Burst size for a single transfer in bytes, 0 for one second of rate")
+	c.maxTransfers = c.fs.Int("max-transfers", 0, "Maximum concurrent outgoing transfers, 0 for unlimited")
+	c.queueSize = c.fs.Int("queue-size", 0, "Maximum transfers waiting for a free slot, 0 to reject them as busy")
+	c.controlSocket = c.fs.String("control-socket", c.cfg.Control.Socket, "Unix socket of the listening producer")
+	return c.fs
+}
+
+// Run changes the limits given as flags and keeps the others, without flags it shows the limits.
+// Changes last until the producer stops or reloads its config.
+func (c *LimitsCommand) Run([]string) {
+	control := cli.Daemon(*c.controlSocket)
+	if control == nil {
+		fmt.Fprintf(os.Stderr, "Error: no producer is listening on %s, start one with the listen command\n",
+			*c.controlSocket)
+		os.Exit(1)
+	}
+
+	limits, err := control.Limits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	changed := false
+	c.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rate-limit":
+			limits.Rate = *c.rate
+		case "rate-burst":
+			limits.Burst = *c.burst
+		case "transfer-rate-limit":
+			limits.TransferRate = *c.transferRate
+		case "transfer-rate-burst":
+			limits.TransferBurst = *c.transferBurst
+		case "max-transfers":
+			limits.MaxTransfers = *c.maxTransfers
+		case "queue-size":
+			limits.QueueSize = *c.queueSize
+		default:
+			return
+		}
+		changed = true
+	})
+	if changed {
+		if limits, err = control.SetLimits(*limits); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Limits updated")
+	}
+
+	printLimits(limits)
+}
+
+func printLimits(limits *producer.ControlLimits) {
+	fmt.Printf("Rate: %s, burst %d bytes\n", rate(limits.Rate), limits.Burst)
+	fmt.Printf("Transfer rate: %s, burst %d bytes\n", rate(limits.TransferRate), limits.TransferBurst)
+	fmt.Printf("Transfers at once: %d, queue of %d\n", limits.MaxTransfers, limits.QueueSize)
+}
+
+func rate(bytesPerSecond uint64) string {
+	if bytesPerSecond == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d bytes/s", bytesPerSecond)
+}
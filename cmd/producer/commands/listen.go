@@ -4,75 +4,173 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/google/uuid"
-
+	"udpie/cmd/internal/cli"
 	"udpie/internal/config"
+	"udpie/internal/metrics"
 	"udpie/internal/service/common"
 	"udpie/internal/service/producer"
 )
 
 // ListenCommand handles the listen command
 type ListenCommand struct {
-	cfg *config.ProducerConfig
+	cfg           *config.ProducerConfig
+	producerIdStr *string
+	stateFile     *string
+	rate          *uint64
+	burst         *uint64
+	transferRate  *uint64
+	transferBurst *uint64
+	maxTransfers  *int
+	queueSize     *int
+	interactive   *bool
+	metricsListen *string
+	controlSocket *string
 }
 
 func NewListenCommand(cfg *config.ProducerConfig) *ListenCommand {
 	return &ListenCommand{cfg: cfg}
 }
 
-func (c *ListenCommand) Execute() {
+func (c *ListenCommand) FlagSet() *flag.FlagSet {
 	fs := flag.NewFlagSet("listen", flag.ExitOnError)
-	producerIdStr := fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
-	stateFile := fs.String("state-file", ".udpie-producer-state.json", "Path to state file")
-
-	if err := fs.Parse(os.Args[2:]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing flags: %v\n", err)
-		os.Exit(1)
-	}
+	c.producerIdStr = fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.stateFile = fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.rate = fs.Uint64("rate-limit", c.cfg.Limits.Rate,
+		"Bandwidth limit for all transfers in bytes per second, 0 for unlimited")
+	c.burst = fs.Uint64("rate-burst", c.cfg.Limits.Burst, "Burst size for all transfers in bytes, 0 for one second of rate")
+	c.transferRate = fs.Uint64("transfer-rate-limit", c.cfg.Limits.TransferRate,
+		"Bandwidth limit for a single transfer in bytes per second, 0 for unlimited")
+	c.transferBurst = fs.Uint64("transfer-rate-burst", c.cfg.Limits.TransferBurst,
+		"Burst size for a single transfer in bytes, 0 for one second of rate")
+	c.maxTransfers = fs.Int("max-transfers", c.cfg.Limits.MaxTransfers,
+		"Maximum concurrent outgoing transfers, 0 for unlimited")
+	c.queueSize = fs.Int("queue-size", c.cfg.Limits.QueueSize,
+		"Maximum transfers waiting for a free slot, 0 to reject them as busy")
+	c.interactive = fs.Bool("interactive", c.cfg.Policy.Interactive,
+		"Ask the operator to approve every transfer request not denied by policy rules")
+	c.metricsListen = fs.String("metrics-listen", c.cfg.Metrics.Listen,
+		"Address to serve Prometheus metrics on, e.g. 127.0.0.1:9464, empty to disable")
+	c.controlSocket = fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket to serve the control API used by the other producer commands on, empty to disable")
+	return fs
+}
 
+func (c *ListenCommand) Run([]string) {
 	// Initialize STUN service using config
 	stunService := common.NewSTUNService(c.cfg.STUN.Servers, c.cfg.STUN.LocalPort, c.cfg.STUN.Timeout)
 
 	// Initialize state service
-	stateService := producer.NewStateService(*stateFile)
+	stateService := producer.NewStateService(*c.stateFile)
 	if err := stateService.Load(); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", err)
 	}
 
 	// Get producer ID
-	producerId, err := c.getProducerID(*producerIdStr, stateService)
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if *c.producerIdStr == "" {
+		fmt.Printf("Using saved ProducerId: %s\n", producerId.String())
+	}
 
 	// Create transfer service
-	transferService := producer.NewTransferService(stateService)
+	transferService := producer.NewTransferService(stateService, c.cfg.Transfer.Compression, producer.RateLimits{
+		Rate:          *c.rate,
+		Burst:         *c.burst,
+		TransferRate:  *c.transferRate,
+		TransferBurst: *c.transferBurst,
+	})
+	transferService.SetQueueLimits(*c.maxTransfers, *c.queueSize)
+	transferService.SetQueueTimeout(time.Duration(c.cfg.Limits.QueueTimeout) * time.Second)
+	if *c.metricsListen != "" {
+		go serveMetrics(*c.metricsListen, transferService)
+	}
+
+	// Accept policy
+	policyLoader := producer.NewPolicyLoader(stateService)
+	policyConfig := c.cfg.Policy
+	policyConfig.Interactive = *c.interactive
+	policy, err := policyLoader.Load(policyConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading policy: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Start websocket listener using signaller URL from config
-	listener := producer.NewWebsocketListener(producerId, c.cfg.Signaller.URL, stateService, transferService, stunService)
-	if err := listener.Listen(); err != nil {
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	listener := producer.NewWebsocketListener(producerId, c.cfg.Signaller.URL, tlsConfig, stateService, transferService,
+		stunService)
+	listener.SetPolicy(policy)
+	go reloadConfig(transferService, listener, policyLoader)
+
+	// Files registered through the control API are served right away
+	var control *producer.ControlServer
+	if *c.controlSocket != "" {
+		producerService := producer.NewProducerService(c.cfg.Signaller.URL, c.cfg.Signaller.RegistrationToken,
+			tlsConfig, stateService)
+		control = producer.NewControlServer(producerId, producerService, stateService, transferService)
+		if err := control.Listen(*c.controlSocket); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	err = listener.Listen()
+	if control != nil {
+		_ = control.Close()
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func (*ListenCommand) getProducerID(producerIdStr string, stateService *producer.StateService) (uuid.UUID, error) {
-	if producerIdStr != "" {
-		producerId, err := uuid.Parse(producerIdStr)
+// serveMetrics serves Prometheus metrics of the producer until the process exits
+func serveMetrics(addr string, transferService *producer.TransferService) {
+	registry := metrics.NewRegistry()
+	metrics.RegisterProducer(registry, metrics.ProducerSources{
+		ActiveTransfers: func() int { return len(transferService.GetQueueState().Running) },
+		QueuedTransfers: func() int { return len(transferService.GetQueueState().Queued) },
+	})
+
+	fmt.Printf("Serving metrics on http://%s/metrics\n", addr)
+	if err := metrics.ListenAndServe(addr, registry); err != nil {
+		fmt.Fprintf(os.Stderr, "Error serving metrics: %v\n", err)
+	}
+}
+
+// reloadConfig applies limits and the accept policy from the config file every time SIGHUP is received
+func reloadConfig(transferService *producer.TransferService, listener *producer.WebsocketListener,
+	policyLoader *producer.PolicyLoader) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+
+	for range sigChan {
+		cfg, err := config.LoadProducerConfig()
 		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid producer ID format: %w", err)
+			fmt.Fprintf(os.Stderr, "Error reloading config: %v\n", err)
+			continue
 		}
-		return producerId, nil
-	}
 
-	// Try to get from state
-	savedId, exists := stateService.GetProducerId()
-	if !exists {
-		return uuid.Nil, fmt.Errorf("producer ID not found. Please provide -producer-id or register a producer first")
-	}
+		limits := producer.NewRateLimits(cfg.Limits)
+		transferService.SetLimits(limits)
+		transferService.SetQueueLimits(cfg.Limits.MaxTransfers, cfg.Limits.QueueSize)
+		transferService.SetQueueTimeout(time.Duration(cfg.Limits.QueueTimeout) * time.Second)
+		fmt.Printf("Limits updated: %d bytes/s total, %d bytes/s per transfer, %d transfers at once, queue of %d\n",
+			limits.Rate, limits.TransferRate, cfg.Limits.MaxTransfers, cfg.Limits.QueueSize)
 
-	fmt.Printf("Using saved ProducerId: %s\n", savedId.String())
-	return savedId, nil
+		policy, err := policyLoader.Load(cfg.Policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reloading policy, keeping the previous one: %v\n", err)
+			continue
+		}
+		listener.SetPolicy(policy)
+		fmt.Printf("Policy updated: %d rules, default %s\n", len(cfg.Policy.Rules), cfg.Policy.Default)
+	}
 }
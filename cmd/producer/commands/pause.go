@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/producer"
+)
+
+// PauseCommand pauses a running transfer of the producer. As "resume" it continues a paused one.
+type PauseCommand struct {
+	cfg           *config.ProducerConfig
+	resume        bool
+	fs            *flag.FlagSet
+	producerIdStr *string
+	transferIdStr *string
+	stateFile     *string
+	controlSocket *string
+}
+
+func NewPauseCommand(cfg *config.ProducerConfig) *PauseCommand {
+	return &PauseCommand{cfg: cfg}
+}
+
+func NewResumeCommand(cfg *config.ProducerConfig) *PauseCommand {
+	return &PauseCommand{cfg: cfg, resume: true}
+}
+
+func (c *PauseCommand) FlagSet() *flag.FlagSet {
+	name := "pause"
+	if c.resume {
+		name = "resume"
+	}
+
+	c.fs = flag.NewFlagSet(name, flag.ExitOnError)
+	c.producerIdStr = c.fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.transferIdStr = c.fs.String("transfer-id", "",
+		"Transfer ID (required, may be given as an argument), see the queue command")
+	c.stateFile = c.fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.controlSocket = c.fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket of a listening producer, the command goes through it when one listens")
+	return c.fs
+}
+
+func (c *PauseCommand) Run(args []string) {
+	transferIdStr := *c.transferIdStr
+	if transferIdStr == "" && len(args) > 0 {
+		transferIdStr = args[0]
+	}
+	if transferIdStr == "" {
+		fmt.Fprintf(os.Stderr, "Error: -transfer-id is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	transferId, err := uuid.Parse(transferIdStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid transfer ID format: %v\n", err)
+		os.Exit(1)
+	}
+
+	if control := cli.Daemon(*c.controlSocket); control != nil {
+		c.report(transferId, c.control(control, transferId))
+		return
+	}
+
+	stateService := producer.NewStateService(*c.stateFile)
+	if err := stateService.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", err)
+	}
+
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(c.cfg.Signaller.URL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+
+	if c.resume {
+		err = producerService.ResumeTransfer(producerId, transferId)
+	} else {
+		err = producerService.PauseTransfer(producerId, transferId)
+	}
+	c.report(transferId, err)
+}
+
+// control pauses or resumes the transfer through a listening producer
+func (c *PauseCommand) control(control *producer.ControlClient, transferId uuid.UUID) error {
+	if c.resume {
+		return control.ResumeTransfer(transferId)
+	}
+	return control.PauseTransfer(transferId)
+}
+
+func (c *PauseCommand) report(transferId uuid.UUID, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if c.resume {
+		fmt.Printf("Transfer resumed: %s\n", transferId.String())
+	} else {
+		fmt.Printf("Transfer paused: %s\n", transferId.String())
+	}
+}
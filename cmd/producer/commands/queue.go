@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/model"
+	"udpie/internal/service/producer"
+)
+
+// QueueCommand handles the queue command
+type QueueCommand struct {
+	cfg           *config.ProducerConfig
+	producerIdStr *string
+	stateFile     *string
+	controlSocket *string
+}
+
+func NewQueueCommand(cfg *config.ProducerConfig) *QueueCommand {
+	return &QueueCommand{cfg: cfg}
+}
+
+func (c *QueueCommand) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("queue", flag.ExitOnError)
+	c.producerIdStr = fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.stateFile = fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.controlSocket = fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket of a listening producer, the command goes through it when one listens")
+	return fs
+}
+
+func (c *QueueCommand) Run([]string) {
+	// A listening producer knows the progress of its transfers
+	if control := cli.Daemon(*c.controlSocket); control != nil {
+		printProducerTransfers(control)
+		return
+	}
+
+	stateService := producer.NewStateService(*c.stateFile)
+	if err := stateService.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", err)
+	}
+
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(c.cfg.Signaller.URL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+	transfers, err := producerService.GetTransfers(producerId)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	running, queued := 0, 0
+	for i := range transfers {
+		if transfers[i].Status == model.TransferStatusQueued {
+			queued++
+		} else {
+			running++
+		}
+	}
+
+	fmt.Printf("Running: %d, queued: %d (configured limits: %d at once, queue of %d)\n",
+		running, queued, c.cfg.Limits.MaxTransfers, c.cfg.Limits.QueueSize)
+	for i := range transfers {
+		transfer := &transfers[i]
+		position := "-"
+		if transfer.Status == model.TransferStatusQueued {
+			position = fmt.Sprintf("#%d", transfer.QueuePosition)
+		}
+		fmt.Printf("  %-5s %s  %-17s file %s, %d blocks\n",
+			position, transfer.Id.String(), transfer.Status, transfer.FileId.String(), transfer.TotalBlocks)
+	}
+}
+
+// printProducerTransfers shows the transfers of a listening producer with their progress
+func printProducerTransfers(control *producer.ControlClient) {
+	transfers, err := control.Transfers()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	limits, err := control.Limits()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	running, queued := 0, 0
+	for i := range transfers {
+		switch transfers[i].Status {
+		case "queued":
+			queued++
+		case "sending", "paused":
+			running++
+		}
+	}
+
+	fmt.Printf("Running: %d, queued: %d (limits: %d at once, queue of %d)\n",
+		running, queued, limits.MaxTransfers, limits.QueueSize)
+	for i := range transfers {
+		transfer := &transfers[i]
+		position := "-"
+		if transfer.QueuePosition > 0 {
+			position = fmt.Sprintf("#%d", transfer.QueuePosition)
+		}
+		fmt.Printf("  %-5s %s  %-9s file %s, %d/%d blocks, %d bytes sent\n", position, transfer.Id.String(),
+			transfer.Status, transfer.FileId.String(), transfer.SentBlocks, transfer.TotalBlocks, transfer.DataBytes)
+	}
+}
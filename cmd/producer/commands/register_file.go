@@ -4,64 +4,87 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
-
-	"github.com/google/uuid"
+	"time"
 
+	"udpie/cmd/internal/cli"
 	"udpie/internal/config"
 	"udpie/internal/service/producer"
 )
 
 // RegisterFileCommand handles the register-file command
 type RegisterFileCommand struct {
-	cfg *config.ProducerConfig
+	cfg           *config.ProducerConfig
+	fs            *flag.FlagSet
+	signallerURL  *string
+	producerIdStr *string
+	filePath      *string
+	stateFile     *string
+	controlSocket *string
+	ttl           *time.Duration
 }
 
 func NewRegisterFileCommand(cfg *config.ProducerConfig) *RegisterFileCommand {
 	return &RegisterFileCommand{cfg: cfg}
 }
 
-func (c *RegisterFileCommand) Execute() {
-	fs := flag.NewFlagSet("register-file", flag.ExitOnError)
-	signallerURL := fs.String("signaller", c.cfg.Signaller.URL, "Signaller server URL")
-	producerIdStr := fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
-	filePath := fs.String("path", "", "Path to file (required)")
-	stateFile := fs.String("state-file", ".udpie-producer-state.json", "Path to state file")
+func (c *RegisterFileCommand) FlagSet() *flag.FlagSet {
+	c.fs = flag.NewFlagSet("register-file", flag.ExitOnError)
+	c.signallerURL = c.fs.String("signaller", c.cfg.Signaller.URL, "Signaller server URL")
+	c.producerIdStr = c.fs.String("producer-id", "", "Producer ID (optional, will use saved ID if not provided)")
+	c.filePath = c.fs.String("path", "", "Path to file or directory (required, may be given as an argument)")
+	c.stateFile = c.fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.ttl = c.fs.Duration("ttl", 0,
+		"Time after which the signaller forgets the file, e.g. 24h (0 uses the signaller default)")
+	c.controlSocket = c.fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket of a listening producer, the command goes through it when one listens")
+	return c.fs
+}
 
-	if err := fs.Parse(os.Args[2:]); err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing flags: %v\n", err)
-		os.Exit(1)
+func (c *RegisterFileCommand) Run(args []string) {
+	filePath := *c.filePath
+	if filePath == "" && len(args) > 0 {
+		filePath = args[0]
 	}
-
-	if *filePath == "" {
+	if filePath == "" {
 		fmt.Fprintf(os.Stderr, "Error: -path is required\n")
-		fs.Usage()
+		c.fs.Usage()
 		os.Exit(1)
 	}
 
+	// A listening producer registers the file itself and serves it right away
+	if control := cli.Daemon(*c.controlSocket); control != nil {
+		c.registerWithProducer(control, filePath)
+		return
+	}
+
 	// Validate and get file info
-	absPath, fileName, fileSize, err := c.validateFile(*filePath)
+	absPath, fileName, fileSize, manifest, err := producer.DescribeFile(filePath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Initialize state service
-	stateService := producer.NewStateService(*stateFile)
+	stateService := producer.NewStateService(*c.stateFile)
 	if loadErr := stateService.Load(); loadErr != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", loadErr)
 	}
 
 	// Get producer ID
-	producerId, err := c.getProducerID(*producerIdStr, stateService)
+	producerId, err := cli.ProducerID(*c.producerIdStr, stateService)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if *c.producerIdStr == "" {
+		fmt.Printf("Using saved ProducerId: %s\n", producerId.String())
+	}
 
 	// Register file
-	producerService := producer.NewProducerService(*signallerURL, stateService)
-	fileId, err := producerService.RegisterFile(fileName, fileSize, producerId, absPath)
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(*c.signallerURL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+	fileId, err := producerService.RegisterFile(fileName, fileSize, producerId, absPath, manifest, *c.ttl)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error registering file: %v\n", err)
 		os.Exit(1)
@@ -70,51 +93,23 @@ func (c *RegisterFileCommand) Execute() {
 	fmt.Printf("File registered successfully\n")
 	fmt.Printf("FileId: %s\n", fileId.String())
 	fmt.Printf("FilePath: %s\n", absPath)
-	fmt.Printf("State saved to: %s\n", *stateFile)
-}
-
-func (*RegisterFileCommand) validateFile(filePath string) (absPath, fileName string, fileSize uint64, err error) {
-	// Get absolute path
-	absPath, err = filepath.Abs(filePath)
-	if err != nil {
-		return "", "", 0, fmt.Errorf("failed to get absolute path: %w", err)
+	if manifest != nil {
+		fmt.Printf("Files in directory: %d\n", len(manifest.Entries))
 	}
-
-	// Check if file exists
-	fileInfo, err := os.Stat(absPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", "", 0, fmt.Errorf("file does not exist: %s", absPath)
-		}
-		return "", "", 0, fmt.Errorf("failed to access file: %w", err)
-	}
-
-	if fileInfo.IsDir() {
-		return "", "", 0, fmt.Errorf("path is a directory, not a file: %s", absPath)
-	}
-
-	fileName = fileInfo.Name()
-	// nolint:gosec // fileInfo.Size() returns int64, safe to convert to uint64 for file sizes
-	fileSize = uint64(fileInfo.Size())
-
-	return absPath, fileName, fileSize, nil
+	fmt.Printf("State saved to: %s\n", *c.stateFile)
 }
 
-func (*RegisterFileCommand) getProducerID(producerIdStr string, stateService *producer.StateService) (uuid.UUID, error) {
-	if producerIdStr != "" {
-		producerId, err := uuid.Parse(producerIdStr)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid producer ID format: %w", err)
-		}
-		return producerId, nil
+func (c *RegisterFileCommand) registerWithProducer(control *producer.ControlClient, filePath string) {
+	file, err := control.RegisterFile(filePath, *c.ttl)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error registering file: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Try to get from state
-	savedId, exists := stateService.GetProducerId()
-	if !exists {
-		return uuid.Nil, fmt.Errorf("producer ID not found. Please provide -producer-id or register a producer first")
+	fmt.Printf("File registered with the listening producer\n")
+	fmt.Printf("FileId: %s\n", file.Id.String())
+	fmt.Printf("FilePath: %s\n", file.Path)
+	if file.Entries > 0 {
+		fmt.Printf("Files in directory: %d\n", file.Entries)
 	}
-
-	fmt.Printf("Using saved ProducerId: %s\n", savedId.String())
-	return savedId, nil
 }
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+)
+
+// StatsCommand shows a summary of a listening producer
+type StatsCommand struct {
+	cfg           *config.ProducerConfig
+	controlSocket *string
+}
+
+func NewStatsCommand(cfg *config.ProducerConfig) *StatsCommand {
+	return &StatsCommand{cfg: cfg}
+}
+
+func (c *StatsCommand) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	c.controlSocket = fs.String("control-socket", c.cfg.Control.Socket, "Unix socket of the listening producer")
+	return fs
+}
+
+func (c *StatsCommand) Run([]string) {
+	control := cli.Daemon(*c.controlSocket)
+	if control == nil {
+		fmt.Fprintf(os.Stderr, "Error: no producer is listening on %s, start one with the listen command\n",
+			*c.controlSocket)
+		os.Exit(1)
+	}
+
+	stats, err := control.Stats()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// nolint:gosec // uptime in seconds is far below the int64 range
+	uptime := time.Duration(stats.Uptime) * time.Second
+	fmt.Printf("ProducerId: %s\n", stats.ProducerId.String())
+	fmt.Printf("Up: %s\n", uptime)
+	fmt.Printf("Files shared: %d\n", stats.Files)
+	fmt.Printf("Transfers: %d running, %d paused, %d queued, %d finished\n",
+		stats.Running, stats.Paused, stats.Queued, stats.Finished)
+	fmt.Printf("Sent: %d bytes of files, %d bytes on the wire\n", stats.DataBytes, stats.WireBytes)
+}
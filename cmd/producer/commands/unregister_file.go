@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+
+	"udpie/cmd/internal/cli"
+	"udpie/internal/config"
+	"udpie/internal/service/producer"
+)
+
+// UnregisterFileCommand handles the unregister-file command
+type UnregisterFileCommand struct {
+	cfg           *config.ProducerConfig
+	fs            *flag.FlagSet
+	signallerURL  *string
+	fileIdStr     *string
+	stateFile     *string
+	controlSocket *string
+}
+
+func NewUnregisterFileCommand(cfg *config.ProducerConfig) *UnregisterFileCommand {
+	return &UnregisterFileCommand{cfg: cfg}
+}
+
+func (c *UnregisterFileCommand) FlagSet() *flag.FlagSet {
+	c.fs = flag.NewFlagSet("unregister-file", flag.ExitOnError)
+	c.signallerURL = c.fs.String("signaller", c.cfg.Signaller.URL, "Signaller server URL")
+	c.fileIdStr = c.fs.String("file-id", "", "File ID (required, may be given as an argument)")
+	c.stateFile = c.fs.String("state-file", cli.DefaultStateFile, "Path to state file")
+	c.controlSocket = c.fs.String("control-socket", c.cfg.Control.Socket,
+		"Unix socket of a listening producer, the command goes through it when one listens")
+	return c.fs
+}
+
+func (c *UnregisterFileCommand) Run(args []string) {
+	fileIdStr := *c.fileIdStr
+	if fileIdStr == "" && len(args) > 0 {
+		fileIdStr = args[0]
+	}
+	if fileIdStr == "" {
+		fmt.Fprintf(os.Stderr, "Error: -file-id is required\n")
+		c.fs.Usage()
+		os.Exit(1)
+	}
+
+	fileId, err := uuid.Parse(fileIdStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid file ID format: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A listening producer stops serving the file right away
+	if control := cli.Daemon(*c.controlSocket); control != nil {
+		if err := control.UnregisterFile(fileId); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unregistering file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("File unregistered from the listening producer\n")
+		fmt.Printf("FileId: %s\n", fileId.String())
+		return
+	}
+
+	// Initialize state service
+	stateService := producer.NewStateService(*c.stateFile)
+	if loadErr := stateService.Load(); loadErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to load state: %v\n", loadErr)
+	}
+
+	tlsConfig := cli.SignallerTLS(c.cfg)
+	producerService := producer.NewProducerService(*c.signallerURL, c.cfg.Signaller.RegistrationToken, tlsConfig,
+		stateService)
+	if err := producerService.UnregisterFile(fileId); err != nil {
+		fmt.Fprintf(os.Stderr, "Error unregistering file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("File unregistered successfully\n")
+	fmt.Printf("FileId: %s\n", fileId.String())
+	fmt.Printf("State saved to: %s\n", *c.stateFile)
+}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"os"
 
+	"udpie/cmd/internal/cli"
 	"udpie/cmd/producer/commands"
 )
 
 func main() {
-	cfg := loadConfig()
+	cfg := cli.LoadConfig()
+	cli.InitLogger(&cfg.Log)
 
 	if len(os.Args) < 2 {
 		printUsage()
@@ -17,26 +19,37 @@ func main() {
 
 	command := os.Args[1]
 
-	var cmd Command
+	var cmd cli.Command
 	switch command {
 	case "register":
 		cmd = commands.NewRegisterCommand(cfg)
 	case "register-file":
 		cmd = commands.NewRegisterFileCommand(cfg)
+	case "unregister-file":
+		cmd = commands.NewUnregisterFileCommand(cfg)
+	case "deregister":
+		cmd = commands.NewDeregisterCommand(cfg)
 	case "listen":
 		cmd = commands.NewListenCommand(cfg)
+	case "queue":
+		cmd = commands.NewQueueCommand(cfg)
+	case "limits":
+		cmd = commands.NewLimitsCommand(cfg)
+	case "stats":
+		cmd = commands.NewStatsCommand(cfg)
+	case "cancel":
+		cmd = commands.NewCancelCommand(cfg)
+	case "pause":
+		cmd = commands.NewPauseCommand(cfg)
+	case "resume":
+		cmd = commands.NewResumeCommand(cfg)
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", command)
 		printUsage()
 		os.Exit(1)
 	}
 
-	cmd.Execute()
-}
-
-// Command interface for all commands
-type Command interface {
-	Execute()
+	cli.Execute(cmd, os.Args[2:])
 }
 
 func printUsage() {
@@ -44,8 +57,16 @@ func printUsage() {
 
 Commands:
   register          Register a producer and get ProducerId
-  register-file     Register a file
-  listen            Start websocket listener
+  register-file     Register a file or a directory
+  unregister-file   Remove a registered file from the signaller
+  deregister        Remove the producer and its files from the signaller
+  listen            Start websocket listener and the local control API
+  queue             Show running and queued transfers
+  limits            Show or change the limits of the listening producer
+  stats             Show a summary of the listening producer
+  cancel            Cancel a running or queued transfer
+  pause             Pause a running transfer
+  resume            Resume a paused transfer
 
 Use '%s <command> -help' for command-specific help.
 `, os.Args[0], os.Args[0])
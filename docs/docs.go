@@ -16,6 +16,87 @@ const docTemplate = `{
     "basePath": "{{.BasePath}}",
     "paths": {
         "/files": {
+            "get": {
+                "description": "List registered files ordered by registration time, optionally filtered",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "List files",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only files of this producer",
+                        "name": "producer_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Case-insensitive substring of the name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Minimum size in bytes",
+                        "name": "min_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum size in bytes",
+                        "name": "max_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only files whose producer is (or is not) connected",
+                        "name": "online",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Files to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 50 by default, at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of files",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.FileListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
             "post": {
                 "description": "Register a new file with metadata and associate it with a producer",
                 "consumes": [
@@ -35,7 +116,7 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.RegisterFileRequest"
+                            "$ref": "#/definitions/internal_handler.RegisterFileRequest"
                         }
                     }
                 ],
@@ -54,6 +135,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "401": {
+                        "description": "Missing or invalid producer secret",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -61,6 +149,195 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/files/{id}": {
+            "get": {
+                "description": "Get metadata of a registered file or directory item",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File metadata",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.FileResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
+            "delete": {
+                "description": "Remove a file from the signaller, only its producer may do so",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Unregister a file",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Success response with file ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid producer secret, or unknown file",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/files/{id}/manifest": {
+            "get": {
+                "description": "Get the manifest of a directory item. The manifest is null for single files",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get file manifest",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File manifest",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.FileManifestResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/files/{id}/sources": {
+            "get": {
+                "description": "Get all registered files with the same content hash, each served by its own producer",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "files"
+                ],
+                "summary": "Get file sources",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "File ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "File sources",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/internal_handler.FileSourceResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid file ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "File not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
                 }
             }
         },
@@ -83,7 +360,7 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.InitDownloadRequest"
+                            "$ref": "#/definitions/internal_handler.InitDownloadRequest"
                         }
                     }
                 ],
@@ -108,11 +385,75 @@ const docTemplate = `{
                             "type": "object",
                             "additionalProperties": true
                         }
+                    },
+                    "503": {
+                        "description": "Producer is busy or offline, see the code",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
                     }
                 }
             }
         },
         "/producers": {
+            "get": {
+                "description": "List registered producers ordered by registration time",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "producers"
+                ],
+                "summary": "List producers",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Only producers which are (or are not) connected",
+                        "name": "online",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Producers to skip",
+                        "name": "offset",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size, 50 by default, at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Page of producers",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ProducerListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid query",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
             "post": {
                 "description": "Register a new producer with UDP options for file transfer",
                 "consumes": [
@@ -132,16 +473,15 @@ const docTemplate = `{
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/contract.RegisterProducerOptions"
+                            "$ref": "#/definitions/udpie_internal_model_contract.RegisterProducerOptions"
                         }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Success response with producer ID",
+                        "description": "Producer ID and the secret it authenticates with",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/udpie_internal_model_contract.RegisterProducerResult"
                         }
                     },
                     "400": {
@@ -151,6 +491,13 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
+                    "401": {
+                        "description": "Missing or invalid registration token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -158,28 +505,39 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         },
-        "/ws": {
+        "/producers/{id}": {
             "get": {
-                "description": "Establishes a WebSocket connection for a producer to receive transfer notifications",
+                "description": "Get metadata of a registered producer",
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "websocket"
+                    "producers"
                 ],
-                "summary": "WebSocket connection for producers",
+                "summary": "Get producer",
                 "parameters": [
                     {
                         "type": "string",
                         "description": "Producer ID",
-                        "name": "producer_id",
-                        "in": "query",
+                        "name": "id",
+                        "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "101": {
-                        "description": "Switching Protocols"
+                    "200": {
+                        "description": "Producer metadata",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ProducerResponse"
+                        }
                     },
                     "400": {
                         "description": "Invalid producer ID",
@@ -188,52 +546,1013 @@ const docTemplate = `{
                             "additionalProperties": true
                         }
                     },
-                    "500": {
-                        "description": "Internal server error",
+                    "404": {
+                        "description": "Producer not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": true
                         }
                     }
-                }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            },
+            "delete": {
+                "description": "Remove a producer and all of its files, the producer authenticates itself",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "producers"
+                ],
+                "summary": "Deregister a producer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Producer ID and the number of files removed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid producer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid producer secret",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/producers/{id}/transfers": {
+            "get": {
+                "description": "Get unfinished transfers of a producer, queued ones ordered by queue position",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Get producer transfers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transfers of the producer",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid producer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/producers/{id}/transfers/{transferId}/cancel": {
+            "post": {
+                "description": "Record a transfer of the producer as cancelled, its consumer is told to stop receiving",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Cancel producer transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "transferId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Cancel reason",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.CancelTransferRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cancelled transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID or request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer already finished",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/producers/{id}/transfers/{transferId}/pause": {
+            "post": {
+                "description": "Suspend sending a transfer of the producer until it is resumed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Pause producer transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "transferId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Paused transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not sending, or its producer can not pause",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Producer is offline",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/producers/{id}/transfers/{transferId}/resume": {
+            "post": {
+                "description": "Continue sending a paused transfer of the producer",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Resume producer transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "transferId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Resumed transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not paused, or its producer can not resume",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Producer is offline",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/transfers/{id}": {
+            "get": {
+                "description": "Get the status of a transfer by the transfer ID shared by signaller, producer and consumer",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Get transfer status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Transfer status",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid transfer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/transfers/{id}/cancel": {
+            "post": {
+                "description": "Record the transfer as cancelled and tell its producer to stop sending",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Cancel transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Cancel reason",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.CancelTransferRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Cancelled transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid transfer ID or request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer already finished",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/transfers/{id}/pause": {
+            "post": {
+                "description": "Ask the producer to suspend sending, the transfer keeps its producer slot until resumed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Pause transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Paused transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid transfer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not sending, or its producer can not pause",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Producer is offline",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/transfers/{id}/received": {
+            "put": {
+                "description": "Merge a bitmap of received blocks into the transfer, bit i of byte i/8 marks block i",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Report received blocks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Received blocks",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.ReportReceivedRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Blocks saved"
+                    },
+                    "400": {
+                        "description": "Invalid transfer ID or request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer already finished",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/transfers/{id}/resume": {
+            "post": {
+                "description": "Continue a paused transfer, the producer skips blocks reported as received",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "transfers"
+                ],
+                "summary": "Resume transfer",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transfer ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Resumed transfer",
+                        "schema": {
+                            "$ref": "#/definitions/internal_handler.TransferStatusResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid transfer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Transfer not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "409": {
+                        "description": "Transfer is not paused, or its producer can not resume",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "503": {
+                        "description": "Producer is offline",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/ws": {
+            "get": {
+                "description": "Establishes a WebSocket connection for a producer to receive transfer notifications",
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "WebSocket connection for producers",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Producer ID",
+                        "name": "producer_id",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols"
+                    },
+                    "400": {
+                        "description": "Invalid producer ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid producer secret",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
+            }
+        },
+        "/ws/consumer": {
+            "get": {
+                "description": "Establishes a WebSocket connection for a consumer to follow transfers. The welcome message\ncarries a session ID, downloads initiated with it report their events on the connection.",
+                "tags": [
+                    "websocket"
+                ],
+                "summary": "WebSocket connection for consumers",
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols"
+                    },
+                    "400": {
+                        "description": "Failed to upgrade",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "401": {
+                        "description": "Missing or invalid consumer token",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                },
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ]
             }
         }
     },
     "definitions": {
-        "contract.RegisterProducerOptions": {
+        "internal_handler.CancelTransferRequest": {
             "type": "object",
             "properties": {
-                "udp_options": {
-                    "$ref": "#/definitions/model.UdpOptions"
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "internal_handler.FileListResponse": {
+            "type": "object",
+            "properties": {
+                "files": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.FileResponse"
+                    }
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "total": {
+                    "description": "files matching the filters",
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.FileManifestResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "manifest": {
+                    "description": "null for single files",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/udpie_internal_model.Manifest"
+                        }
+                    ]
+                },
+                "name": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.FileResponse": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "directory": {
+                    "type": "boolean"
+                },
+                "entries": {
+                    "description": "files in a directory item",
+                    "type": "integer"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_seen": {
+                    "description": "last time the producer was heard from",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "online": {
+                    "description": "whether the producer is connected",
+                    "type": "boolean"
+                },
+                "producer_id": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.FileSourceResponse": {
+            "type": "object",
+            "properties": {
+                "block_size": {
+                    "type": "integer"
+                },
+                "file_id": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "producer_id": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "total_blocks": {
+                    "type": "integer"
                 }
             }
         },
-        "handler.InitDownloadRequest": {
+        "internal_handler.InitDownloadRequest": {
             "type": "object",
             "properties": {
                 "client_udp_options": {
-                    "$ref": "#/definitions/model.UdpOptions"
+                    "$ref": "#/definitions/udpie_internal_model.UdpOptions"
+                },
+                "compression": {
+                    "description": "accepted codecs in order of preference",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "max_rate": {
+                    "description": "bytes per second the producer may send at most, 0 for unlimited",
+                    "type": "integer"
+                },
+                "path": {
+                    "description": "manifest entry path for directory items",
+                    "type": "string"
+                },
+                "range": {
+                    "description": "part of the file to download, nil for the whole file",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/udpie_internal_model.BlockRange"
+                        }
+                    ]
+                },
+                "session_id": {
+                    "description": "consumer websocket session receiving the transfer events",
+                    "type": "string"
+                }
+            }
+        },
+        "internal_handler.ProducerListResponse": {
+            "type": "object",
+            "properties": {
+                "offset": {
+                    "type": "integer"
+                },
+                "producers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/internal_handler.ProducerResponse"
+                    }
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.ProducerResponse": {
+            "type": "object",
+            "properties": {
+                "connected_at": {
+                    "description": "start of the current connection",
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
                 },
                 "id": {
                     "type": "string"
+                },
+                "last_seen": {
+                    "description": "zero when not seen since the signaller started",
+                    "type": "string"
+                },
+                "online": {
+                    "type": "boolean"
+                },
+                "uptime": {
+                    "description": "seconds connected",
+                    "type": "integer"
                 }
             }
         },
-        "handler.RegisterFileRequest": {
+        "internal_handler.RegisterFileRequest": {
             "type": "object",
             "properties": {
+                "hash": {
+                    "description": "sha256 of the content, files with equal hashes can be downloaded together",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "manifest": {
+                    "description": "set when registering a directory",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/udpie_internal_model.Manifest"
+                        }
+                    ]
+                },
                 "name": {
                     "type": "string"
                 },
                 "producer_id": {
                     "type": "string"
                 },
+                "size": {
+                    "type": "integer"
+                },
+                "ttl": {
+                    "description": "seconds until the file expires, 0 for the signaller default",
+                    "type": "integer"
+                }
+            }
+        },
+        "internal_handler.ReportReceivedRequest": {
+            "type": "object",
+            "properties": {
+                "received": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "internal_handler.TransferStatusResponse": {
+            "type": "object",
+            "properties": {
+                "block_size": {
+                    "type": "integer"
+                },
+                "compression": {
+                    "type": "string"
+                },
+                "file_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "producer_id": {
+                    "type": "string"
+                },
+                "queue_position": {
+                    "description": "position in the producer queue while queued",
+                    "type": "integer"
+                },
+                "status": {
+                    "$ref": "#/definitions/udpie_internal_model.TransferStatus"
+                },
+                "total_blocks": {
+                    "type": "integer"
+                }
+            }
+        },
+        "udpie_internal_model.BlockRange": {
+            "type": "object",
+            "properties": {
+                "end": {
+                    "type": "integer"
+                },
+                "start": {
+                    "type": "integer"
+                }
+            }
+        },
+        "udpie_internal_model.Manifest": {
+            "type": "object",
+            "properties": {
+                "entries": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/udpie_internal_model.ManifestEntry"
+                    }
+                }
+            }
+        },
+        "udpie_internal_model.ManifestEntry": {
+            "type": "object",
+            "properties": {
+                "hash": {
+                    "description": "sha256 of the file content",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "mode": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                },
                 "size": {
                     "type": "integer"
                 }
             }
         },
-        "model.UdpOptions": {
+        "udpie_internal_model.TransferStatus": {
+            "type": "string",
+            "enum": [
+                "created",
+                "failed",
+                "producer_accepted",
+                "producer_rejected",
+                "queued",
+                "data_sending",
+                "complete",
+                "cancelled",
+                "paused"
+            ],
+            "x-enum-varnames": [
+                "TransferStatusCreated",
+                "TransferStatusFailed",
+                "TransferStatusProducerAccepted",
+                "TransferStatusProducerRejected",
+                "TransferStatusQueued",
+                "TransferStatusDataSending",
+                "TransferStatusComplete",
+                "TransferStatusCancelled",
+                "TransferStatusPaused"
+            ]
+        },
+        "udpie_internal_model.UdpOptions": {
             "type": "object",
             "properties": {
                 "external_ip": {
@@ -243,6 +1562,33 @@ const docTemplate = `{
                     "type": "integer"
                 }
             }
+        },
+        "udpie_internal_model_contract.RegisterProducerOptions": {
+            "type": "object",
+            "properties": {
+                "udp_options": {
+                    "$ref": "#/definitions/udpie_internal_model.UdpOptions"
+                }
+            }
+        },
+        "udpie_internal_model_contract.RegisterProducerResult": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "description": "\"Bearer \u003ctoken\u003e\": producer secret, registration or consumer token",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CompressionNone  = ""
+	CompressionZstd  = "zstd"
+	CompressionFlate = "flate"
+)
+
+// SupportedCompressions lists codecs in order of preference
+var SupportedCompressions = []string{CompressionZstd, CompressionFlate}
+
+// Codec compresses single blocks of a transfer
+type Codec interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	// Decompress fails if the decompressed data is larger than maxSize
+	Decompress(src []byte, maxSize uint64) ([]byte, error)
+}
+
+// NewCodec returns a codec by name. CompressionNone returns nil codec.
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case CompressionNone:
+		return nil, nil
+	case CompressionZstd:
+		return newZstdCodec()
+	case CompressionFlate:
+		return &flateCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", name)
+	}
+}
+
+// NegotiateCompression picks the first offered codec which is also supported.
+// Returns CompressionNone if there is no common codec.
+func NegotiateCompression(offered, supported []string) string {
+	for _, name := range offered {
+		for _, s := range supported {
+			if name == s && name != CompressionNone {
+				return name
+			}
+		}
+	}
+	return CompressionNone
+}
+
+// zstdMaxDecoderMemory bounds allocations for malformed or hostile frames
+const zstdMaxDecoderMemory = 4 << 20
+
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCodec() (*zstdCodec, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(zstdMaxDecoderMemory))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %w", err)
+	}
+
+	return &zstdCodec{encoder: encoder, decoder: decoder}, nil
+}
+
+func (*zstdCodec) Name() string {
+	return CompressionZstd
+}
+
+func (c *zstdCodec) Compress(src []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(src, nil), nil
+}
+
+func (c *zstdCodec) Decompress(src []byte, maxSize uint64) ([]byte, error) {
+	data, err := c.decoder.DecodeAll(src, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress zstd block: %w", err)
+	}
+	if uint64(len(data)) > maxSize {
+		return nil, errors.New("decompressed block too large")
+	}
+	return data, nil
+}
+
+type flateCodec struct{}
+
+func (*flateCodec) Name() string {
+	return CompressionFlate
+}
+
+func (*flateCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create flate writer: %w", err)
+	}
+	if _, err := writer.Write(src); err != nil {
+		return nil, fmt.Errorf("failed to compress flate block: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress flate block: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (*flateCodec) Decompress(src []byte, maxSize uint64) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(src))
+	defer reader.Close()
+
+	// Read one byte over the limit to detect oversized blocks
+	// nolint:gosec // maxSize is a block size, far below int64 limits
+	data, err := io.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress flate block: %w", err)
+	}
+	if uint64(len(data)) > maxSize {
+		return nil, errors.New("decompressed block too large")
+	}
+	return data, nil
+}
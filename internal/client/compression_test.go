@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	compressible := bytes.Repeat([]byte("timestamp=2025-01-01 level=info msg=ok\n"), 30)
+
+	for _, name := range SupportedCompressions {
+		t.Run(name, func(t *testing.T) {
+			codec, err := NewCodec(name)
+			if err != nil {
+				t.Fatalf("NewCodec() error = %v", err)
+			}
+			if codec.Name() != name {
+				t.Errorf("Name() = %s, want %s", codec.Name(), name)
+			}
+
+			compressed, err := codec.Compress(compressible)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if len(compressed) >= len(compressible) {
+				t.Errorf("Compress() did not shrink compressible data: %d >= %d", len(compressed), len(compressible))
+			}
+
+			decompressed, err := codec.Decompress(compressed, uint64(len(compressible)))
+			if err != nil {
+				t.Fatalf("Decompress() error = %v", err)
+			}
+			if !bytes.Equal(decompressed, compressible) {
+				t.Error("Decompress() returned different data")
+			}
+
+			if _, err := codec.Decompress(compressed, uint64(len(compressible)-1)); err == nil {
+				t.Error("Decompress() expected error for block larger than maxSize")
+			}
+		})
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	codec, err := NewCodec(CompressionNone)
+	if err != nil || codec != nil {
+		t.Errorf("NewCodec(none) = %v, %v, want nil, nil", codec, err)
+	}
+
+	if _, err := NewCodec("lz4"); err == nil {
+		t.Error("NewCodec() expected error for unsupported codec")
+	}
+}
+
+func TestNegotiateCompression(t *testing.T) {
+	tests := []struct {
+		name      string
+		offered   []string
+		supported []string
+		want      string
+	}{
+		{name: "first offered wins", offered: []string{"flate", "zstd"}, supported: []string{"zstd", "flate"}, want: "flate"},
+		{name: "skip unsupported", offered: []string{"lz4", "zstd"}, supported: []string{"zstd"}, want: "zstd"},
+		{name: "nothing offered", offered: nil, supported: []string{"zstd"}, want: CompressionNone},
+		{name: "disabled on producer", offered: []string{"zstd"}, supported: nil, want: CompressionNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NegotiateCompression(tt.offered, tt.supported); got != tt.want {
+				t.Errorf("NegotiateCompression() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUdpPacket_CompressedFlag(t *testing.T) {
+	transferStartTime := time.UnixMilli(1000000000)
+	packet := &UdpPacket{
+		ContentType:  ContentTypeData | FlagCompressed,
+		SerialNumber: 7,
+		TransferId:   uuid.New(),
+		Timestamp:    transferStartTime,
+		Data:         []byte("payload"),
+	}
+
+	data, err := packet.Marshal(transferStartTime)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got UdpPacket
+	if err := got.Unmarshal(data, transferStartTime); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	if got.Kind() != ContentTypeData {
+		t.Errorf("Kind() = %#x, want %#x", got.Kind(), ContentTypeData)
+	}
+	if !got.Compressed() {
+		t.Error("Compressed() = false, want true")
+	}
+}
@@ -3,79 +3,91 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/google/uuid"
 
+	"udpie/internal/handler"
 	"udpie/internal/model"
 	"udpie/internal/model/contract"
 )
 
 type SignallerClient struct {
 	baseURL string
+	token   string
 	client  *http.Client
 }
 
-func NewSignallerClient(baseURL string) *SignallerClient {
+// NewSignallerClient creates a client sending the token as bearer credentials,
+// the registration token for RegisterProducer and the producer secret otherwise. tlsConfig may be nil.
+func NewSignallerClient(baseURL, token string, tlsConfig *tls.Config) *SignallerClient {
 	return &SignallerClient{
 		baseURL: baseURL,
-		client:  &http.Client{},
+		token:   token,
+		client:  NewHTTPClient(tlsConfig),
 	}
 }
 
-// RegisterProducer registers a producer and returns the producer ID
-func (c *SignallerClient) RegisterProducer(udpOptions model.UdpOptions) (uuid.UUID, error) {
+// RegisterProducer registers a producer and returns the producer ID with its secret
+func (c *SignallerClient) RegisterProducer(udpOptions model.UdpOptions) (*contract.RegisterProducerResult, error) {
 	reqBody := contract.RegisterProducerOptions{
 		UdpOptions: udpOptions,
 	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/api/producers", c.baseURL)
 	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return uuid.Nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return uuid.Nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var result struct {
-		ID string `json:"id"`
-	}
+	var result contract.RegisterProducerResult
 	if decodeErr := json.NewDecoder(resp.Body).Decode(&result); decodeErr != nil {
-		return uuid.Nil, fmt.Errorf("failed to decode response: %w", decodeErr)
-	}
-
-	producerId, err := uuid.Parse(result.ID)
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid producer ID format: %w", err)
+		return nil, fmt.Errorf("failed to decode response: %w", decodeErr)
 	}
 
-	return producerId, nil
+	return &result, nil
 }
 
-// RegisterFile registers a file and returns the file ID
-func (c *SignallerClient) RegisterFile(name string, size uint64, producerId uuid.UUID) (uuid.UUID, error) {
+// RegisterFile registers a file and returns the file ID. Hash is the sha256 of a single file content,
+// manifest is set for directories. Zero ttl uses the signaller default.
+func (c *SignallerClient) RegisterFile(name string, size uint64, hash []byte, producerId uuid.UUID,
+	manifest *model.Manifest, ttl time.Duration) (uuid.UUID, error) {
 	reqBody := map[string]any{
 		"name":        name,
 		"size":        size,
 		"producer_id": producerId.String(),
 	}
+	if ttl > 0 {
+		reqBody["ttl"] = uint64(ttl / time.Second)
+	}
+	if len(hash) > 0 {
+		reqBody["hash"] = hash
+	}
+	if manifest != nil {
+		reqBody["manifest"] = manifest
+	}
 
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
@@ -88,6 +100,7 @@ func (c *SignallerClient) RegisterFile(name string, size uint64, producerId uuid
 		return uuid.Nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	c.authorize(req)
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to send request: %w", err)
@@ -113,3 +126,138 @@ func (c *SignallerClient) RegisterFile(name string, size uint64, producerId uuid
 
 	return fileId, nil
 }
+
+// GetProducerTransfers returns running and queued transfers of a producer as seen by the signaller
+func (c *SignallerClient) GetProducerTransfers(producerId uuid.UUID) ([]handler.TransferStatusResponse, error) {
+	url := fmt.Sprintf("%s/api/producers/%s/transfers", c.baseURL, producerId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result []handler.TransferStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result, nil
+}
+
+// CancelTransfer cancels a transfer of the producer, its consumer is told to stop receiving
+func (c *SignallerClient) CancelTransfer(producerId, transferId uuid.UUID, reason string) error {
+	jsonData, err := json.Marshal(handler.CancelTransferRequest{Reason: reason})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/producers/%s/transfers/%s/cancel", c.baseURL, producerId.String(), transferId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.authorize(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// PauseTransfer suspends sending a transfer of the producer
+func (c *SignallerClient) PauseTransfer(producerId, transferId uuid.UUID) error {
+	return c.controlTransfer(producerId, transferId, "pause")
+}
+
+// ResumeTransfer continues sending a paused transfer of the producer
+func (c *SignallerClient) ResumeTransfer(producerId, transferId uuid.UUID) error {
+	return c.controlTransfer(producerId, transferId, "resume")
+}
+
+func (c *SignallerClient) controlTransfer(producerId, transferId uuid.UUID, action string) error {
+	url := fmt.Sprintf("%s/api/producers/%s/transfers/%s/%s",
+		c.baseURL, producerId.String(), transferId.String(), action)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// DeleteFile unregisters a file of the producer
+func (c *SignallerClient) DeleteFile(fileId uuid.UUID) error {
+	url := fmt.Sprintf("%s/api/files/%s", c.baseURL, fileId.String())
+	return c.delete(url, nil)
+}
+
+// DeleteProducer deregisters the producer with all of its files and returns how many files were removed
+func (c *SignallerClient) DeleteProducer(producerId uuid.UUID) (int, error) {
+	url := fmt.Sprintf("%s/api/producers/%s", c.baseURL, producerId.String())
+	var result struct {
+		Files int `json:"files"`
+	}
+	if err := c.delete(url, &result); err != nil {
+		return 0, err
+	}
+	return result.Files, nil
+}
+
+func (c *SignallerClient) delete(url string, result any) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodDelete, url, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (c *SignallerClient) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
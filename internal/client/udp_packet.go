@@ -16,6 +16,27 @@ const (
 	timestampSize    = 4
 	dataSizeSize     = 2
 	headerSize       = contentTypeSize + serialNumberSize + transferIdSize + timestampSize + dataSizeSize
+
+	maxDatagramSize = 65507 // largest UDP payload over IPv4
+	// MaxBlockSize is the largest block fitting into a single datagram with the packet header
+	MaxBlockSize = maxDatagramSize - headerSize
+)
+
+// Content types of UDP packets. The high bit of ContentType is reserved for flags.
+const (
+	ContentTypeData byte = 0x01
+	ContentTypePing byte = 0x02
+	// ContentTypeCancel tells the other side of a transfer to stop, it carries no data
+	ContentTypeCancel byte = 0x03
+	// ContentTypePriority asks the producer to send the block in SerialNumber next, it carries no data
+	ContentTypePriority byte = 0x04
+	// ContentTypeRangeEnd tells the producer to stop its range before the block in SerialNumber,
+	// another source took over the rest. It carries no data.
+	ContentTypeRangeEnd byte = 0x05
+
+	// FlagCompressed marks data packets whose payload is compressed with the codec negotiated for the transfer
+	FlagCompressed  byte = 0x80
+	contentTypeMask byte = 0x7F
 )
 
 type UdpPacket struct {
@@ -26,6 +47,16 @@ type UdpPacket struct {
 	Data         []byte
 }
 
+// Kind returns the content type without flags
+func (u *UdpPacket) Kind() byte {
+	return u.ContentType & contentTypeMask
+}
+
+// Compressed reports whether the payload is compressed
+func (u *UdpPacket) Compressed() bool {
+	return u.ContentType&FlagCompressed != 0
+}
+
 // Marshal serializes the UdpPacket into a byte slice.
 // Format: [1 byte: ContentType] [4 bytes: SerialNumber (big-endian)] [16 bytes: TransferId]
 // [4 bytes: Timestamp (relative to transferStartTime, big-endian)] [2 bytes: DataSize (big-endian)] [variable: Data]
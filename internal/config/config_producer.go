@@ -12,10 +12,36 @@ const (
 type ProducerConfig struct {
 	Signaller ProducerSignallerConfig `mapstructure:"signaller"`
 	STUN      STUNConfig              `mapstructure:"stun"`
+	Transfer  TransferConfig          `mapstructure:"transfer"`
+	Limits    LimitsConfig            `mapstructure:"limits"`
+	Policy    PolicyConfig            `mapstructure:"policy"`
+	Metrics   ProducerMetricsConfig   `mapstructure:"metrics"`
+	Control   ControlConfig           `mapstructure:"control"`
+	Log       LogConfig               `mapstructure:"log"`
+}
+
+// ControlConfig sets where the listen command serves the local control API used by the other producer commands
+type ControlConfig struct {
+	Socket string `mapstructure:"socket"` // Unix socket path, empty disables the control API
+}
+
+// ProducerMetricsConfig sets where the listen command serves Prometheus metrics
+type ProducerMetricsConfig struct {
+	Listen string `mapstructure:"listen"` // address like "127.0.0.1:9464", empty disables metrics
 }
 
 type ProducerSignallerConfig struct {
-	URL string `mapstructure:"url"`
+	URL               string          `mapstructure:"url"`
+	Token             string          `mapstructure:"token"`              // consumer token for file lookups and downloads
+	RegistrationToken string          `mapstructure:"registration_token"` // token required to register producers
+	TLS               ClientTLSConfig `mapstructure:"tls"`
+}
+
+// ClientTLSConfig configures connections to an https:// signaller
+type ClientTLSConfig struct {
+	CAFile   string `mapstructure:"ca_file"`   // CA bundle for self-signed signallers, system roots when empty
+	CertFile string `mapstructure:"cert_file"` // client certificate for mutual TLS
+	KeyFile  string `mapstructure:"key_file"`
 }
 
 type STUNConfig struct {
@@ -24,11 +50,76 @@ type STUNConfig struct {
 	Timeout   int      `mapstructure:"timeout"` // seconds
 }
 
+type TransferConfig struct {
+	Compression []string `mapstructure:"compression"` // codecs in order of preference, empty disables compression
+}
+
+// LimitsConfig holds bandwidth limits in bytes per second, zero rate means unlimited
+type LimitsConfig struct {
+	Rate          uint64 `mapstructure:"rate"` // all transfers of the producer together
+	Burst         uint64 `mapstructure:"burst"`
+	TransferRate  uint64 `mapstructure:"transfer_rate"` // every single transfer
+	TransferBurst uint64 `mapstructure:"transfer_burst"`
+	DownloadRate  uint64 `mapstructure:"download_rate"` // limit a consumer asks producers to respect
+	MaxTransfers  int    `mapstructure:"max_transfers"` // concurrent outgoing transfers, 0 is unlimited
+	QueueSize     int    `mapstructure:"queue_size"`    // transfers waiting for a free slot, 0 rejects them as busy
+	QueueTimeout  int    `mapstructure:"queue_timeout"` // seconds a transfer may wait in the queue, 0 for no limit
+}
+
+// PolicyConfig decides which transfer requests a producer accepts.
+// Rules are checked in order, the first matching one decides.
+type PolicyConfig struct {
+	Default         string             `mapstructure:"default"`          // allow or deny when no rule matches
+	Interactive     bool               `mapstructure:"interactive"`      // ask the operator about every request not denied
+	ApprovalTimeout int                `mapstructure:"approval_timeout"` // seconds to wait for the operator
+	Rules           []PolicyRuleConfig `mapstructure:"rules"`
+}
+
+// PolicyRuleConfig matches requests by all of its non-empty conditions
+type PolicyRuleConfig struct {
+	Name         string   `mapstructure:"name"`
+	Action       string   `mapstructure:"action"`        // allow, deny or ask
+	Addresses    []string `mapstructure:"addresses"`     // consumer IPs or CIDRs
+	Identities   []string `mapstructure:"identities"`    // consumer names, authenticated by the signaller
+	Files        []string `mapstructure:"files"`         // file IDs, name or entry path patterns
+	MaxDownloads int      `mapstructure:"max_downloads"` // allowed downloads of each matched file, 0 is unlimited
+	Hours        string   `mapstructure:"hours"`         // local time window like "09:00-18:00"
+	Days         []string `mapstructure:"days"`          // mon, tue, wed, thu, fri, sat, sun
+}
+
+// DefaultApprovalTimeout is how long an interactive producer waits for the operator, seconds.
+// It has to stay below the 30 seconds the signaller waits for the producer.
+const DefaultApprovalTimeout = 20
+
+// DefaultControlSocket is where a listening producer accepts commands of the other producer commands
+const DefaultControlSocket = ".udpie-producer.sock"
+
+// Defaults for the number of transfers a producer serves at once and keeps waiting
+const (
+	DefaultMaxTransfers = 4
+	DefaultQueueSize    = 16
+	DefaultQueueTimeout = 1800 // seconds
+)
+
+// DefaultCompression lists codecs enabled when the config does not say otherwise
+var DefaultCompression = []string{"zstd", "flate"}
+
+// configFile is read instead of looking for the default config file when set
+var configFile string
+
+// UseConfigFile makes the config loaders read the given file instead of looking for the default one
+func UseConfigFile(path string) {
+	configFile = path
+}
+
 func LoadProducerConfig() (*ProducerConfig, error) {
 	viper.SetConfigType("toml")
 	viper.SetConfigName("config.producer")
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("./config")
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	}
 
 	// Set defaults
 	viper.SetDefault("signaller.url", "http://localhost:8080")
@@ -39,11 +130,25 @@ func LoadProducerConfig() (*ProducerConfig, error) {
 	})
 	viper.SetDefault("stun.local_port", defaultSTUNLocalPort)
 	viper.SetDefault("stun.timeout", defaultSTUNTimeout)
+	viper.SetDefault("transfer.compression", DefaultCompression)
+	viper.SetDefault("limits.max_transfers", DefaultMaxTransfers)
+	viper.SetDefault("limits.queue_size", DefaultQueueSize)
+	viper.SetDefault("limits.queue_timeout", DefaultQueueTimeout)
+	viper.SetDefault("policy.default", "allow")
+	viper.SetDefault("policy.approval_timeout", DefaultApprovalTimeout)
+	viper.SetDefault("control.socket", DefaultControlSocket)
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", "text")
+	viper.SetDefault("log.output_std", true)
+	viper.SetDefault("log.file", "udpie.log")
 
 	// Read environment variables
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
+		if configFile != "" {
+			return nil, err
+		}
 		// If config file not found, use defaults
 		// This is OK, we'll use default values
 		_ = err // explicitly ignore error
@@ -4,14 +4,94 @@ import (
 	"github.com/spf13/viper"
 )
 
+const defaultExpiryInterval = 60
+
+// DefaultTransferRetention is how long finished transfers are kept, seconds
+const DefaultTransferRetention = 7 * 24 * 60 * 60
+
 type SignallerConfig struct {
-	Server ServerConfig `mapstructure:"server"`
-	Log    LogConfig    `mapstructure:"log"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Log       LogConfig       `mapstructure:"log"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Storage   StorageConfig   `mapstructure:"storage"`
+	Files     FilesConfig     `mapstructure:"files"`
+	Transfers TransfersConfig `mapstructure:"transfers"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+}
+
+// MetricsConfig controls the Prometheus endpoint, it is not authenticated
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Path    string `mapstructure:"path"`
+	Listen  string `mapstructure:"listen"` // separate address like "127.0.0.1:9464", empty serves metrics on the API port
+}
+
+// FilesConfig limits how long registered files are kept, TTLs are in seconds
+type FilesConfig struct {
+	DefaultTTL     int `mapstructure:"default_ttl"`     // for files registered without a TTL, 0 keeps them
+	MaxTTL         int `mapstructure:"max_ttl"`         // longest TTL a producer may ask for, 0 for no limit
+	ExpiryInterval int `mapstructure:"expiry_interval"` // seconds between removals of expired files
+}
+
+// TransfersConfig limits how long the transfer history is kept, in seconds
+type TransfersConfig struct {
+	Retention      int `mapstructure:"retention"`       // finished transfers are removed this long after they ended, 0 keeps them
+	ExpiryInterval int `mapstructure:"expiry_interval"` // seconds between removals of old transfers
+}
+
+// StorageConfig selects where producers, files and transfer history are kept
+type StorageConfig struct {
+	Type string `mapstructure:"type"` // memory or bolt
+	Path string `mapstructure:"path"` // database file of the bolt storage
+}
+
+// AuthConfig holds static API tokens. Producers always authenticate with the secret issued at registration.
+type AuthConfig struct {
+	RegistrationTokens []string           `mapstructure:"registration_tokens"` // required to register producers, empty allows anyone
+	ConsumerTokens     []string           `mapstructure:"consumer_tokens"`     // required to look up and download files, empty allows anyone
+	Consumers          []ConsumerIdentity `mapstructure:"consumers"`           // named consumer tokens, accepted like consumer tokens
+}
+
+// ConsumerIdentity names the consumer authenticating with a token, producer policies match the name
+type ConsumerIdentity struct {
+	Name  string `mapstructure:"name"`
+	Token string `mapstructure:"token"`
+}
+
+// ConsumerIdentities maps the tokens of named consumers to their names
+func (c *AuthConfig) ConsumerIdentities() map[string]string {
+	identities := make(map[string]string, len(c.Consumers))
+	for _, consumer := range c.Consumers {
+		identities[consumer.Token] = consumer.Name
+	}
+	return identities
 }
 
 type ServerConfig struct {
-	Port string `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port string          `mapstructure:"port"`
+	Host string          `mapstructure:"host"`
+	TLS  ServerTLSConfig `mapstructure:"tls"`
+}
+
+// Client certificate modes of ServerTLSConfig.ClientAuth
+const (
+	ClientAuthNone    = "none"    // client certificates are not asked for
+	ClientAuthRequest = "request" // verified when presented, producers may authenticate with them
+	ClientAuthRequire = "require" // every client must present a verified certificate
+)
+
+// ServerTLSConfig enables HTTPS and WSS when cert and key files are set
+type ServerTLSConfig struct {
+	CertFile       string `mapstructure:"cert_file"`
+	KeyFile        string `mapstructure:"key_file"`
+	ReloadInterval int    `mapstructure:"reload_interval"` // seconds between certificate checks, 0 disables reloading
+	ClientCAFile   string `mapstructure:"client_ca_file"`  // CA bundle verifying client certificates
+	ClientAuth     string `mapstructure:"client_auth"`     // none, request or require
+}
+
+// Enabled reports whether the server terminates TLS
+func (c *ServerTLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
 }
 
 type LogConfig struct {
@@ -31,10 +111,21 @@ func LoadSignallerConfig() (*SignallerConfig, error) {
 
 	viper.SetConfigName("config")
 	viper.AddConfigPath(".")
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+	}
 
 	// Read environment variables
 	viper.AutomaticEnv()
 
+	viper.SetDefault("storage.type", "memory")
+	viper.SetDefault("storage.path", "signaller.db")
+	viper.SetDefault("files.expiry_interval", defaultExpiryInterval)
+	viper.SetDefault("transfers.retention", DefaultTransferRetention)
+	viper.SetDefault("transfers.expiry_interval", defaultExpiryInterval)
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.path", "/metrics")
+
 	if err := viper.ReadInConfig(); err != nil {
 		// If config file not found, use defaults
 		return nil, err
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	"udpie/internal/model/contract"
+)
+
+// Authenticator checks bearer credentials of API requests.
+// Producers use the secret issued at registration, consumers and registrations use static tokens.
+// Consumers authenticating with a named token are identified by its name, the only consumer
+// identity passed on to producer policies.
+// Over mutual TLS a verified client certificate replaces the registration token,
+// and producers registered with one may authenticate with it instead of the secret.
+type Authenticator struct {
+	producerService    contract.SignallerProducerService
+	registrationTokens []string
+	consumerTokens     []string
+	consumerIdentities map[string]string // token -> consumer name
+}
+
+// consumerNameKey is the user value holding the name of the authenticated consumer
+const consumerNameKey = "consumer_name"
+
+// NewAuthenticator creates an authenticator, consumerIdentities maps named consumer tokens to their names.
+// The named tokens are accepted as consumer tokens.
+func NewAuthenticator(producerService contract.SignallerProducerService,
+	registrationTokens, consumerTokens []string, consumerIdentities map[string]string,
+) *Authenticator {
+	tokens := slices.Clone(consumerTokens)
+	for token := range consumerIdentities {
+		tokens = append(tokens, token)
+	}
+	return &Authenticator{
+		producerService:    producerService,
+		registrationTokens: registrationTokens,
+		consumerTokens:     tokens,
+		consumerIdentities: consumerIdentities,
+	}
+}
+
+// RequireRegistrationToken protects producer registration
+func (a *Authenticator) RequireRegistrationToken(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if ClientCertFingerprint(ctx) == nil && !matchToken(a.registrationTokens, bearerToken(ctx)) {
+			unauthorized(ctx)
+			return
+		}
+		next(ctx)
+	}
+}
+
+// RequireConsumer protects consumer endpoints and records the name of a named consumer
+func (a *Authenticator) RequireConsumer(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		token := bearerToken(ctx)
+		if !matchToken(a.consumerTokens, token) {
+			unauthorized(ctx)
+			return
+		}
+		if name := a.consumerName(token); name != "" {
+			ctx.SetUserValue(consumerNameKey, name)
+		}
+		next(ctx)
+	}
+}
+
+// consumerName returns the name of the consumer a token belongs to, empty for unnamed tokens
+func (a *Authenticator) consumerName(token string) string {
+	if token == "" {
+		return ""
+	}
+	name := ""
+	for candidate, candidateName := range a.consumerIdentities {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			name = candidateName
+		}
+	}
+	return name
+}
+
+// ConsumerName returns the name of the consumer authenticated by RequireConsumer, empty when it is not named
+func ConsumerName(ctx *fasthttp.RequestCtx) string {
+	name, _ := ctx.UserValue(consumerNameKey).(string)
+	return name
+}
+
+// RequireProducer protects endpoints of the producer given by the "id" path parameter
+func (a *Authenticator) RequireProducer(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		id, err := uuid.Parse(ctx.UserValue("id").(string))
+		if err != nil {
+			ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "Invalid producer ID")
+			return
+		}
+		if !a.Producer(ctx, id) {
+			unauthorized(ctx)
+			return
+		}
+		next(ctx)
+	}
+}
+
+// Producer reports whether the request carries the secret or the client certificate of the producer
+func (a *Authenticator) Producer(ctx *fasthttp.RequestCtx, producerId uuid.UUID) bool {
+	if token := bearerToken(ctx); token != "" {
+		return a.producerService.AuthenticateProducer(producerId, token) == nil
+	}
+	if fingerprint := ClientCertFingerprint(ctx); fingerprint != nil {
+		return a.producerService.AuthenticateProducerCertificate(producerId, fingerprint) == nil
+	}
+	return false
+}
+
+// ClientCertFingerprint returns the sha256 of the verified client certificate, nil without one
+func ClientCertFingerprint(ctx *fasthttp.RequestCtx) []byte {
+	if !ctx.IsTLS() {
+		return nil
+	}
+	state := ctx.TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	fingerprint := sha256.Sum256(state.PeerCertificates[0].Raw)
+	return fingerprint[:]
+}
+
+func unauthorized(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set("WWW-Authenticate", "Bearer")
+	ErrorWithMessage(ctx, fasthttp.StatusUnauthorized, contract.ErrUnauthorized.Error())
+}
+
+func bearerToken(ctx *fasthttp.RequestCtx) string {
+	header := string(ctx.Request.Header.Peek(fasthttp.HeaderAuthorization))
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// matchToken checks the token against configured ones, no configured tokens means the endpoint is open
+func matchToken(tokens []string, token string) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	if token == "" {
+		return false
+	}
+
+	matched := 0
+	for _, candidate := range tokens {
+		matched |= subtle.ConstantTimeCompare([]byte(candidate), []byte(token))
+	}
+	return matched == 1
+}
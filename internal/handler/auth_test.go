@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMatchToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		token  string
+		want   bool
+	}{
+		{name: "no tokens configured", tokens: nil, token: "", want: true},
+		{name: "missing token", tokens: []string{"a"}, token: "", want: false},
+		{name: "matching token", tokens: []string{"a", "b"}, token: "b", want: true},
+		{name: "wrong token", tokens: []string{"a", "b"}, token: "c", want: false},
+		{name: "prefix of token", tokens: []string{"abc"}, token: "ab", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchToken(tt.tokens, tt.token); got != tt.want {
+				t.Errorf("matchToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_RequireConsumer(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     []string
+		identities map[string]string
+		token      string
+		wantStatus int
+		wantName   string
+	}{
+		{name: "open signaller", token: "", wantStatus: fasthttp.StatusOK},
+		{name: "unnamed token", tokens: []string{"a"}, token: "a", wantStatus: fasthttp.StatusOK},
+		{
+			name:       "named token",
+			tokens:     []string{"a"},
+			identities: map[string]string{"b": "alice"},
+			token:      "b",
+			wantStatus: fasthttp.StatusOK,
+			wantName:   "alice",
+		},
+		{
+			name:       "named tokens only",
+			identities: map[string]string{"b": "alice"},
+			token:      "",
+			wantStatus: fasthttp.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			tokens:     []string{"a"},
+			identities: map[string]string{"b": "alice"},
+			token:      "c",
+			wantStatus: fasthttp.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := NewAuthenticator(nil, nil, tt.tokens, tt.identities)
+			gotName := ""
+			handler := auth.RequireConsumer(func(ctx *fasthttp.RequestCtx) {
+				gotName = ConsumerName(ctx)
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			if tt.token != "" {
+				ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			handler(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if gotName != tt.wantName {
+				t.Errorf("ConsumerName() = %q, want %q", gotName, tt.wantName)
+			}
+		})
+	}
+}
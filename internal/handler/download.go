@@ -3,6 +3,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -13,8 +14,13 @@ import (
 )
 
 type InitDownloadRequest struct {
-	Id               uuid.UUID        `json:"id"`
-	ClientUdpOptions model.UdpOptions `json:"client_udp_options"`
+	Id               uuid.UUID         `json:"id"`
+	Path             string            `json:"path,omitempty"` // manifest entry path for directory items
+	ClientUdpOptions model.UdpOptions  `json:"client_udp_options"`
+	Compression      []string          `json:"compression,omitempty"` // accepted codecs in order of preference
+	Range            *model.BlockRange `json:"range,omitempty"`       // part of the file to download, nil for the whole file
+	MaxRate          uint64            `json:"max_rate,omitempty"`    // bytes per second the producer may send at most, 0 for unlimited
+	SessionId        string            `json:"session_id,omitempty"`  // consumer websocket session receiving the transfer events
 }
 
 type InitDownloadHandler struct {
@@ -42,6 +48,7 @@ func NewInitDownloadHandler(service contract.SignallerFileService,
 // @Param        request  body      InitDownloadRequest  true  "Init download request"
 // @Success      200      {object}  map[string]any  "Success response with transfer ID"
 // @Failure      400      {object}  map[string]any  "Invalid request body"
+// @Failure      503      {object}  map[string]any  "Producer is busy or offline, see the code"
 // @Failure      500      {object}  map[string]any  "Internal server error"
 // @Router       /initDownload [post]
 func (h *InitDownloadHandler) InitDownload(ctx *fasthttp.RequestCtx) {
@@ -53,8 +60,23 @@ func (h *InitDownloadHandler) InitDownload(ctx *fasthttp.RequestCtx) {
 
 	transfer, err := h.transferService.InitTransfer(contract.InitTransferOptions{
 		FileId:             request.Id,
+		Path:               request.Path,
 		ConsumerUdpOptions: request.ClientUdpOptions,
+		ConsumerName:       ConsumerName(ctx), // from the token, a name in the body could be anyone's
+		ConsumerIp:         ctx.RemoteIP().String(),
+		Compression:        request.Compression,
+		Range:              request.Range,
+		MaxRate:            request.MaxRate,
+		SessionId:          request.SessionId,
 	})
+	if errors.Is(err, contract.ErrProducerBusy) {
+		ErrorWithCode(ctx, fasthttp.StatusServiceUnavailable, ErrorCodeProducerBusy, err.Error())
+		return
+	}
+	if errors.Is(err, contract.ErrProducerOffline) {
+		ErrorWithCode(ctx, fasthttp.StatusServiceUnavailable, ErrorCodeProducerOffline, err.Error())
+		return
+	}
 	if err != nil {
 		ctx.Error(fmt.Sprintf("Failed to init download: %v", err), fasthttp.StatusInternalServerError)
 		return
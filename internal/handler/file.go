@@ -3,28 +3,79 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 
+	"udpie/internal/model"
 	"udpie/internal/model/contract"
 )
 
 type RegisterFileRequest struct {
+	Name       string          `json:"name"`
+	Size       uint64          `json:"size"`
+	Hash       []byte          `json:"hash,omitempty"` // sha256 of the content, files with equal hashes can be downloaded together
+	ProducerId uuid.UUID       `json:"producer_id"`
+	Manifest   *model.Manifest `json:"manifest,omitempty"` // set when registering a directory
+	TTL        uint64          `json:"ttl,omitempty"`      // seconds until the file expires, 0 for the signaller default
+}
+
+type FileSourceResponse struct {
+	FileId      uuid.UUID `json:"file_id"`
+	ProducerId  uuid.UUID `json:"producer_id"`
+	Name        string    `json:"name"`
+	Size        uint64    `json:"size"`
+	Hash        []byte    `json:"hash,omitempty"`
+	BlockSize   uint64    `json:"block_size"`
+	TotalBlocks uint64    `json:"total_blocks"`
+}
+
+// FileResponse describes a registered file or directory item
+type FileResponse struct {
+	Id         uuid.UUID `json:"id"`
 	Name       string    `json:"name"`
 	Size       uint64    `json:"size"`
+	Hash       []byte    `json:"hash,omitempty"`
 	ProducerId uuid.UUID `json:"producer_id"`
+	Directory  bool      `json:"directory"`
+	Entries    int       `json:"entries,omitempty"`  // files in a directory item
+	Online     bool      `json:"online"`             // whether the producer is connected
+	LastSeen   time.Time `json:"last_seen,omitzero"` // last time the producer was heard from
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"`
+}
+
+// maxTTLSeconds keeps requested TTLs from overflowing time.Duration
+const maxTTLSeconds = uint64(math.MaxInt64 / int64(time.Second))
+
+type FileListResponse struct {
+	Files  []FileResponse `json:"files"`
+	Total  int            `json:"total"` // files matching the filters
+	Offset int            `json:"offset"`
+}
+
+type FileManifestResponse struct {
+	Id       uuid.UUID       `json:"id"`
+	Name     string          `json:"name"`
+	Size     uint64          `json:"size"`
+	Manifest *model.Manifest `json:"manifest"` // null for single files
 }
 
 type FileHandler struct {
-	service         contract.SignallerFileService
-	producerService contract.SignallerProducerService
+	service  contract.SignallerFileService
+	presence contract.ProducerPresence
+	auth     *Authenticator
 }
 
-func NewFileHandler(service contract.SignallerFileService, producerService contract.SignallerProducerService) *FileHandler {
+func NewFileHandler(service contract.SignallerFileService, presence contract.ProducerPresence, auth *Authenticator,
+) *FileHandler {
 	return &FileHandler{
-		service:         service,
-		producerService: producerService,
+		service:  service,
+		presence: presence,
+		auth:     auth,
 	}
 }
 
@@ -35,8 +86,10 @@ func NewFileHandler(service contract.SignallerFileService, producerService contr
 // @Accept       json
 // @Produce      json
 // @Param        request  body      RegisterFileRequest  true  "File registration request"
+// @Security     BearerAuth
 // @Success      200      {object}  map[string]any  "Success response with file ID"
 // @Failure      400      {object}  map[string]any  "Invalid request body"
+// @Failure      401      {object}  map[string]any  "Missing or invalid producer secret"
 // @Failure      500      {object}  map[string]any  "Internal server error"
 // @Router       /files [post]
 func (h *FileHandler) RegisterFile(ctx *fasthttp.RequestCtx) {
@@ -46,16 +99,19 @@ func (h *FileHandler) RegisterFile(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	_, err := h.producerService.GetProducer(request.ProducerId)
-	if err != nil {
-		ctx.Error("Producer not found", fasthttp.StatusBadRequest)
+	// Unknown producers fail like wrong secrets, the response does not tell which producers exist
+	if !h.auth.Producer(ctx, request.ProducerId) {
+		unauthorized(ctx)
 		return
 	}
 
 	id, err := h.service.RegisterFile(contract.RegisterFileOptions{
 		Name:       request.Name,
 		Size:       request.Size,
+		Hash:       request.Hash,
 		ProducerId: request.ProducerId,
+		Manifest:   request.Manifest,
+		TTL:        time.Duration(min(request.TTL, maxTTLSeconds)) * time.Second,
 	})
 	if err != nil {
 		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
@@ -64,3 +120,222 @@ func (h *FileHandler) RegisterFile(ctx *fasthttp.RequestCtx) {
 
 	Success(ctx, map[string]string{"id": id.String()})
 }
+
+// GetManifest returns the manifest of a registered item
+// @Summary      Get file manifest
+// @Description  Get the manifest of a directory item. The manifest is null for single files
+// @Tags         files
+// @Produce      json
+// @Param        id   path      string  true  "File ID"
+// @Success      200  {object}  FileManifestResponse  "File manifest"
+// @Failure      400  {object}  map[string]any  "Invalid file ID"
+// @Failure      404  {object}  map[string]any  "File not found"
+// @Router       /files/{id}/manifest [get]
+func (h *FileHandler) GetManifest(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid file id format")
+		return
+	}
+
+	fileMeta, err := h.service.GetFileMeta(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, FileManifestResponse{
+		Id:       fileMeta.Id,
+		Name:     fileMeta.Name,
+		Size:     fileMeta.Size,
+		Manifest: fileMeta.Manifest,
+	})
+}
+
+// GetSources returns files with the same content as the given one
+// @Summary      Get file sources
+// @Description  Get all registered files with the same content hash, each served by its own producer
+// @Tags         files
+// @Produce      json
+// @Param        id   path      string  true  "File ID"
+// @Success      200  {array}   FileSourceResponse  "File sources"
+// @Failure      400  {object}  map[string]any  "Invalid file ID"
+// @Failure      404  {object}  map[string]any  "File not found"
+// @Router       /files/{id}/sources [get]
+func (h *FileHandler) GetSources(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid file id format")
+		return
+	}
+
+	sources, err := h.service.GetFileSources(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	response := make([]FileSourceResponse, 0, len(sources))
+	for _, source := range sources {
+		response = append(response, FileSourceResponse{
+			FileId:      source.Id,
+			ProducerId:  source.ProducerId,
+			Name:        source.Name,
+			Size:        source.Size,
+			Hash:        source.Hash,
+			BlockSize:   contract.DefaultBlockSize,
+			TotalBlocks: model.BlocksCount(source.Size, contract.DefaultBlockSize),
+		})
+	}
+
+	Success(ctx, response)
+}
+
+// ListFiles returns a page of registered files
+// @Summary      List files
+// @Description  List registered files ordered by registration time, optionally filtered
+// @Tags         files
+// @Produce      json
+// @Param        producer_id  query     string   false  "Only files of this producer"
+// @Param        name         query     string   false  "Case-insensitive substring of the name"
+// @Param        min_size     query     integer  false  "Minimum size in bytes"
+// @Param        max_size     query     integer  false  "Maximum size in bytes"
+// @Param        online       query     boolean  false  "Only files whose producer is (or is not) connected"
+// @Param        offset       query     integer  false  "Files to skip"
+// @Param        limit        query     integer  false  "Page size, 50 by default, at most 500"
+// @Security     BearerAuth
+// @Success      200          {object}  FileListResponse  "Page of files"
+// @Failure      400          {object}  map[string]any  "Invalid query"
+// @Failure      500          {object}  map[string]any  "Internal server error"
+// @Router       /files [get]
+func (h *FileHandler) ListFiles(ctx *fasthttp.RequestCtx) {
+	options, err := parseListFilesOptions(ctx)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.service.ListFiles(options)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := FileListResponse{
+		Files:  make([]FileResponse, 0, len(result.Files)),
+		Total:  result.Total,
+		Offset: options.Offset,
+	}
+	for _, fileMeta := range result.Files {
+		response.Files = append(response.Files, h.newFileResponse(fileMeta))
+	}
+
+	Success(ctx, response)
+}
+
+// GetFile returns metadata of a registered file
+// @Summary      Get file
+// @Description  Get metadata of a registered file or directory item
+// @Tags         files
+// @Produce      json
+// @Param        id   path      string  true  "File ID"
+// @Security     BearerAuth
+// @Success      200  {object}  FileResponse  "File metadata"
+// @Failure      400  {object}  map[string]any  "Invalid file ID"
+// @Failure      404  {object}  map[string]any  "File not found"
+// @Router       /files/{id} [get]
+func (h *FileHandler) GetFile(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid file id format")
+		return
+	}
+
+	fileMeta, err := h.service.GetFileMeta(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, h.newFileResponse(fileMeta))
+}
+
+// DeleteFile unregisters a file
+// @Summary      Unregister a file
+// @Description  Remove a file from the signaller, only its producer may do so
+// @Tags         files
+// @Produce      json
+// @Param        id   path      string  true  "File ID"
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]any  "Success response with file ID"
+// @Failure      400  {object}  map[string]any  "Invalid file ID"
+// @Failure      401  {object}  map[string]any  "Missing or invalid producer secret, or unknown file"
+// @Router       /files/{id} [delete]
+func (h *FileHandler) DeleteFile(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid file id format")
+		return
+	}
+
+	// Only the producer of a file is told it exists, unknown files fail like foreign ones
+	fileMeta, err := h.service.GetFileMeta(id)
+	if err != nil || !h.auth.Producer(ctx, fileMeta.ProducerId) {
+		unauthorized(ctx)
+		return
+	}
+
+	if err := h.service.DeleteFile(id); err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+
+	Success(ctx, map[string]string{"id": id.String()})
+}
+
+func (h *FileHandler) newFileResponse(fileMeta *model.FileMeta) FileResponse {
+	presence := h.presence.Presence(fileMeta.ProducerId)
+	response := FileResponse{
+		Id:         fileMeta.Id,
+		Name:       fileMeta.Name,
+		Size:       fileMeta.Size,
+		Hash:       fileMeta.Hash,
+		ProducerId: fileMeta.ProducerId,
+		Directory:  fileMeta.IsDirectory(),
+		Online:     presence.Online,
+		LastSeen:   presence.LastSeen,
+		CreatedAt:  fileMeta.CreatedAt,
+		ExpiresAt:  fileMeta.ExpiresAt,
+	}
+	if fileMeta.Manifest != nil {
+		response.Entries = len(fileMeta.Manifest.Entries)
+	}
+	return response
+}
+
+func parseListFilesOptions(ctx *fasthttp.RequestCtx) (contract.ListFilesOptions, error) {
+	var options contract.ListFilesOptions
+	var err error
+
+	if producerId := ctx.QueryArgs().Peek("producer_id"); len(producerId) > 0 {
+		if options.ProducerId, err = uuid.ParseBytes(producerId); err != nil {
+			return options, errors.New("invalid producer_id format")
+		}
+	}
+	options.Name = string(ctx.QueryArgs().Peek("name"))
+	if options.MinSize, err = queryUint(ctx, "min_size"); err != nil {
+		return options, err
+	}
+	if options.MaxSize, err = queryUint(ctx, "max_size"); err != nil {
+		return options, err
+	}
+	if options.Online, err = queryBool(ctx, "online"); err != nil {
+		return options, err
+	}
+	options.Offset, options.Limit, err = queryPage(ctx)
+	return options, err
+}
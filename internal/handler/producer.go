@@ -3,19 +3,44 @@ package handler
 
 import (
 	"encoding/json"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/valyala/fasthttp"
 
+	"udpie/internal/model"
 	"udpie/internal/model/contract"
 )
 
+// ProducerResponse describes a registered producer, its credentials and addresses are not exposed
+type ProducerResponse struct {
+	Id          uuid.UUID `json:"id"`
+	Online      bool      `json:"online"`
+	ConnectedAt time.Time `json:"connected_at,omitzero"` // start of the current connection
+	Uptime      uint64    `json:"uptime,omitempty"`      // seconds connected
+	LastSeen    time.Time `json:"last_seen,omitzero"`    // zero when not seen since the signaller started
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ProducerListResponse struct {
+	Producers []ProducerResponse `json:"producers"`
+	Total     int                `json:"total"`
+	Offset    int                `json:"offset"`
+}
+
 type ProducerHandler struct {
-	service contract.SignallerProducerService
+	service     contract.SignallerProducerService
+	fileService contract.SignallerFileService
+	wsService   contract.WebsocketProducerService
 }
 
-func NewProducerHandler(service contract.SignallerProducerService) *ProducerHandler {
+func NewProducerHandler(service contract.SignallerProducerService, fileService contract.SignallerFileService,
+	wsService contract.WebsocketProducerService,
+) *ProducerHandler {
 	return &ProducerHandler{
-		service: service,
+		service:     service,
+		fileService: fileService,
+		wsService:   wsService,
 	}
 }
 
@@ -26,8 +51,10 @@ func NewProducerHandler(service contract.SignallerProducerService) *ProducerHand
 // @Accept       json
 // @Produce      json
 // @Param        request  body      contract.RegisterProducerOptions  true  "Producer registration options"
-// @Success      200      {object}  map[string]any  "Success response with producer ID"
+// @Security     BearerAuth
+// @Success      200      {object}  contract.RegisterProducerResult  "Producer ID and the secret it authenticates with"
 // @Failure      400      {object}  map[string]any  "Invalid request body"
+// @Failure      401      {object}  map[string]any  "Missing or invalid registration token"
 // @Failure      500      {object}  map[string]any  "Internal server error"
 // @Router       /producers [post]
 func (h *ProducerHandler) RegisterProducer(ctx *fasthttp.RequestCtx) {
@@ -36,11 +63,132 @@ func (h *ProducerHandler) RegisterProducer(ctx *fasthttp.RequestCtx) {
 		ctx.Error("Invalid request body", fasthttp.StatusBadRequest)
 		return
 	}
+	options.CertFingerprint = ClientCertFingerprint(ctx)
 
-	id, err := h.service.RegisterProducer(options)
+	result, err := h.service.RegisterProducer(options)
 	if err != nil {
 		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
 		return
 	}
-	Success(ctx, map[string]string{"id": id.String()})
+	Success(ctx, result)
+}
+
+// ListProducers returns a page of registered producers
+// @Summary      List producers
+// @Description  List registered producers ordered by registration time
+// @Tags         producers
+// @Produce      json
+// @Param        online  query     boolean  false  "Only producers which are (or are not) connected"
+// @Param        offset  query     integer  false  "Producers to skip"
+// @Param        limit   query     integer  false  "Page size, 50 by default, at most 500"
+// @Security     BearerAuth
+// @Success      200     {object}  ProducerListResponse  "Page of producers"
+// @Failure      400     {object}  map[string]any  "Invalid query"
+// @Failure      500     {object}  map[string]any  "Internal server error"
+// @Router       /producers [get]
+func (h *ProducerHandler) ListProducers(ctx *fasthttp.RequestCtx) {
+	var options contract.ListProducersOptions
+	var err error
+	if options.Online, err = queryBool(ctx, "online"); err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+	if options.Offset, options.Limit, err = queryPage(ctx); err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.service.ListProducers(options)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := ProducerListResponse{
+		Producers: make([]ProducerResponse, 0, len(result.Producers)),
+		Total:     result.Total,
+		Offset:    options.Offset,
+	}
+	for _, producer := range result.Producers {
+		response.Producers = append(response.Producers, h.newProducerResponse(producer))
+	}
+
+	Success(ctx, response)
+}
+
+// GetProducer returns metadata of a registered producer
+// @Summary      Get producer
+// @Description  Get metadata of a registered producer
+// @Tags         producers
+// @Produce      json
+// @Param        id   path      string  true  "Producer ID"
+// @Security     BearerAuth
+// @Success      200  {object}  ProducerResponse  "Producer metadata"
+// @Failure      400  {object}  map[string]any  "Invalid producer ID"
+// @Failure      404  {object}  map[string]any  "Producer not found"
+// @Router       /producers/{id} [get]
+func (h *ProducerHandler) GetProducer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid producer id format")
+		return
+	}
+
+	producer, err := h.service.GetProducer(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, h.newProducerResponse(producer))
+}
+
+// DeleteProducer deregisters a producer
+// @Summary      Deregister a producer
+// @Description  Remove a producer and all of its files, the producer authenticates itself
+// @Tags         producers
+// @Produce      json
+// @Param        id   path      string  true  "Producer ID"
+// @Security     BearerAuth
+// @Success      200  {object}  map[string]any  "Producer ID and the number of files removed"
+// @Failure      400  {object}  map[string]any  "Invalid producer ID"
+// @Failure      401  {object}  map[string]any  "Missing or invalid producer secret"
+// @Failure      500  {object}  map[string]any  "Internal server error"
+// @Router       /producers/{id} [delete]
+func (h *ProducerHandler) DeleteProducer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid producer id format")
+		return
+	}
+
+	// Files go first, a failure leaves the producer able to retry
+	files, err := h.fileService.DeleteProducerFiles(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.service.DeleteProducer(id); err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusInternalServerError, err.Error())
+		return
+	}
+	h.wsService.Disconnect(id)
+
+	Success(ctx, map[string]any{"id": id.String(), "files": files})
+}
+
+func (h *ProducerHandler) newProducerResponse(producer *model.Producer) ProducerResponse {
+	presence := h.wsService.Presence(producer.Id)
+	// nolint:gosec // uptime of a connected producer is never negative
+	uptime := uint64(presence.Uptime(time.Now()) / time.Second)
+	return ProducerResponse{
+		Id:          producer.Id,
+		Online:      presence.Online,
+		ConnectedAt: presence.ConnectedAt,
+		Uptime:      uptime,
+		LastSeen:    presence.LastSeen,
+		CreatedAt:   producer.CreatedAt,
+	}
 }
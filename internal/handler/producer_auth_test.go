@@ -0,0 +1,203 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	"udpie/internal/handler"
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+	"udpie/internal/service/signaller"
+	"udpie/internal/storage"
+)
+
+// offlinePresence reports every producer offline
+type offlinePresence struct{}
+
+func (offlinePresence) IsOnline(uuid.UUID) bool { return false }
+
+func (offlinePresence) Presence(uuid.UUID) model.Presence { return model.Presence{} }
+
+// authTestSetup registers two producers, a file of the first one and the authenticator checking their secrets
+type authTestSetup struct {
+	auth         *handler.Authenticator
+	files        contract.SignallerFileService
+	producer     *contract.RegisterProducerResult
+	other        *contract.RegisterProducerResult
+	producerFile uuid.UUID
+}
+
+func newAuthTestSetup(t *testing.T) *authTestSetup {
+	store := storage.NewMemoryStorage()
+	producerService := signaller.NewProducerService(store)
+	fileService, err := signaller.NewFileService(store, producerService, offlinePresence{})
+	if err != nil {
+		t.Fatalf("NewFileService() error: %v", err)
+	}
+
+	setup := &authTestSetup{
+		auth:  handler.NewAuthenticator(producerService, nil, nil, nil),
+		files: fileService,
+	}
+	for _, result := range []**contract.RegisterProducerResult{&setup.producer, &setup.other} {
+		if *result, err = producerService.RegisterProducer(contract.RegisterProducerOptions{}); err != nil {
+			t.Fatalf("RegisterProducer() error: %v", err)
+		}
+	}
+	setup.producerFile, err = fileService.RegisterFile(contract.RegisterFileOptions{
+		Name: "file", Size: 1, ProducerId: setup.producer.Id,
+	})
+	if err != nil {
+		t.Fatalf("RegisterFile() error: %v", err)
+	}
+	return setup
+}
+
+// newAuthTestCtx returns a request carrying the secret as bearer token, none when it is empty
+func newAuthTestCtx(secret string) *fasthttp.RequestCtx {
+	ctx := &fasthttp.RequestCtx{}
+	if secret != "" {
+		ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+secret)
+	}
+	return ctx
+}
+
+func TestAuthenticator_RequireProducer(t *testing.T) {
+	setup := newAuthTestSetup(t)
+
+	tests := []struct {
+		name       string
+		id         string
+		secret     string
+		wantStatus int
+	}{
+		{name: "own secret", id: setup.producer.Id.String(), secret: setup.producer.Secret, wantStatus: fasthttp.StatusOK},
+		{name: "secret of another producer", id: setup.producer.Id.String(), secret: setup.other.Secret,
+			wantStatus: fasthttp.StatusUnauthorized},
+		{name: "no secret", id: setup.producer.Id.String(), wantStatus: fasthttp.StatusUnauthorized},
+		{name: "unknown producer", id: uuid.New().String(), secret: setup.producer.Secret,
+			wantStatus: fasthttp.StatusUnauthorized},
+		{name: "invalid producer ID", id: "producer", secret: setup.producer.Secret, wantStatus: fasthttp.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			next := setup.auth.RequireProducer(func(*fasthttp.RequestCtx) { called = true })
+
+			ctx := newAuthTestCtx(tt.secret)
+			ctx.SetUserValue("id", tt.id)
+			next(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			if want := tt.wantStatus == fasthttp.StatusOK; called != want {
+				t.Errorf("handler called = %v, want %v", called, want)
+			}
+		})
+	}
+}
+
+func TestWsHandler_HandleConnection_Unauthorized(t *testing.T) {
+	setup := newAuthTestSetup(t)
+	wsHandler := handler.NewWsHandler(nil, nil, setup.auth)
+
+	tests := []struct {
+		name       string
+		producerId string
+		secret     string
+		wantStatus int
+	}{
+		{name: "no secret", producerId: setup.producer.Id.String(), wantStatus: fasthttp.StatusUnauthorized},
+		{name: "secret of another producer", producerId: setup.producer.Id.String(), secret: setup.other.Secret,
+			wantStatus: fasthttp.StatusUnauthorized},
+		{name: "unknown producer", producerId: uuid.New().String(), secret: setup.producer.Secret,
+			wantStatus: fasthttp.StatusUnauthorized},
+		{name: "no producer ID", secret: setup.producer.Secret, wantStatus: fasthttp.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := newAuthTestCtx(tt.secret)
+			ctx.Request.SetRequestURI("/ws?producer_id=" + tt.producerId)
+			wsHandler.HandleConnection(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFileHandler_ProducerAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     func(setup *authTestSetup) string
+		wantStatus int
+	}{
+		{
+			name:       "own secret",
+			secret:     func(setup *authTestSetup) string { return setup.producer.Secret },
+			wantStatus: fasthttp.StatusOK,
+		},
+		{
+			name:       "secret of another producer",
+			secret:     func(setup *authTestSetup) string { return setup.other.Secret },
+			wantStatus: fasthttp.StatusUnauthorized,
+		},
+		{
+			name:       "no secret",
+			secret:     func(*authTestSetup) string { return "" },
+			wantStatus: fasthttp.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run("RegisterFile "+tt.name, func(t *testing.T) {
+			setup := newAuthTestSetup(t)
+			fileHandler := handler.NewFileHandler(setup.files, nil, setup.auth)
+
+			body, err := json.Marshal(handler.RegisterFileRequest{Name: "new", Size: 1, ProducerId: setup.producer.Id})
+			if err != nil {
+				t.Fatalf("Marshal() error: %v", err)
+			}
+			ctx := newAuthTestCtx(tt.secret(setup))
+			ctx.Request.SetBody(body)
+			fileHandler.RegisterFile(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			result, err := setup.files.ListFiles(contract.ListFilesOptions{ProducerId: setup.producer.Id})
+			if err != nil {
+				t.Fatalf("ListFiles() error: %v", err)
+			}
+			want := tt.wantStatus == fasthttp.StatusOK
+			if registered := result.Total == 2; registered != want {
+				t.Errorf("file registered = %v, want %v", registered, want)
+			}
+		})
+
+		t.Run("DeleteFile "+tt.name, func(t *testing.T) {
+			setup := newAuthTestSetup(t)
+			fileHandler := handler.NewFileHandler(setup.files, nil, setup.auth)
+
+			ctx := newAuthTestCtx(tt.secret(setup))
+			ctx.SetUserValue("id", setup.producerFile.String())
+			fileHandler.DeleteFile(ctx)
+
+			if got := ctx.Response.StatusCode(); got != tt.wantStatus {
+				t.Errorf("status = %d, want %d", got, tt.wantStatus)
+			}
+			_, err := setup.files.GetFileMeta(setup.producerFile)
+			want := tt.wantStatus == fasthttp.StatusOK
+			if deleted := err != nil; deleted != want {
+				t.Errorf("file deleted = %v, want %v", deleted, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// queryUint parses an optional unsigned query argument, zero when absent
+func queryUint(ctx *fasthttp.RequestCtx, name string) (uint64, error) {
+	value := ctx.QueryArgs().Peek(name)
+	if len(value) == 0 {
+		return 0, nil
+	}
+	number, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return number, nil
+}
+
+// queryBool parses an optional boolean query argument, nil when absent
+func queryBool(ctx *fasthttp.RequestCtx, name string) (*bool, error) {
+	value := ctx.QueryArgs().Peek(name)
+	if len(value) == 0 {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(string(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return &parsed, nil
+}
+
+// queryPage parses the offset and limit of list requests
+func queryPage(ctx *fasthttp.RequestCtx) (offset, limit int, err error) {
+	offsetValue, err := queryUint(ctx, "offset")
+	if err != nil {
+		return 0, 0, err
+	}
+	limitValue, err := queryUint(ctx, "limit")
+	if err != nil {
+		return 0, 0, err
+	}
+	const maxInt = int(^uint(0) >> 1)
+	return int(min(offsetValue, uint64(maxInt))), int(min(limitValue, uint64(maxInt))), nil
+}
@@ -26,3 +26,21 @@ func ErrorWithMessage(ctx *fasthttp.RequestCtx, status int, message string) {
 		ctx.Error("Failed to encode response", fasthttp.StatusInternalServerError)
 	}
 }
+
+// Error codes telling clients why a request failed when the status alone is ambiguous
+const (
+	ErrorCodeProducerBusy    = "producer_busy"
+	ErrorCodeProducerOffline = "producer_offline"
+)
+
+// ErrorWithCode responds with an error message and a machine readable code
+func ErrorWithCode(ctx *fasthttp.RequestCtx, status int, code, message string) {
+	ctx.SetContentType("application/json")
+	ctx.SetStatusCode(status)
+	response := map[string]any{"error": message, "code": code}
+	if body, err := json.Marshal(response); err == nil {
+		ctx.SetBody(body)
+	} else {
+		ctx.Error("Failed to encode response", fasthttp.StatusInternalServerError)
+	}
+}
@@ -11,7 +11,9 @@ type Router struct {
 	producerHandler *ProducerHandler
 	fileHandler     *FileHandler
 	downloadHandler *InitDownloadHandler
+	transferHandler *TransferHandler
 	wsHandler       *WsHandler
+	auth            *Authenticator
 }
 
 func NewRouter(
@@ -19,23 +21,50 @@ func NewRouter(
 	fileService contract.SignallerFileService,
 	transferService contract.SignallerTransferService,
 	wsService contract.WebsocketProducerService,
+	consumerWsService contract.WebsocketConsumerService,
+	auth *Authenticator,
 ) *Router {
 	return &Router{
-		producerHandler: NewProducerHandler(producerService),
-		fileHandler:     NewFileHandler(fileService, producerService),
+		producerHandler: NewProducerHandler(producerService, fileService, wsService),
+		fileHandler:     NewFileHandler(fileService, wsService, auth),
 		downloadHandler: NewInitDownloadHandler(fileService, producerService, transferService),
-		wsHandler:       NewWsHandler(wsService),
+		transferHandler: NewTransferHandler(transferService),
+		wsHandler:       NewWsHandler(wsService, consumerWsService, auth),
+		auth:            auth,
 	}
 }
 
 func (r *Router) SetupRoutes(router *router.Router) {
 	apiGroup := router.Group("/api")
-	apiGroup.POST("/producers", r.producerHandler.RegisterProducer)
+	apiGroup.POST("/producers", r.auth.RequireRegistrationToken(r.producerHandler.RegisterProducer))
+	apiGroup.GET("/producers", r.auth.RequireConsumer(r.producerHandler.ListProducers))
+	apiGroup.GET("/producers/{id}", r.auth.RequireConsumer(r.producerHandler.GetProducer))
+	apiGroup.DELETE("/producers/{id}", r.auth.RequireProducer(r.producerHandler.DeleteProducer))
+	apiGroup.GET("/producers/{id}/transfers", r.auth.RequireProducer(r.transferHandler.GetProducerTransfers))
+	apiGroup.POST("/producers/{id}/transfers/{transferId}/cancel",
+		r.auth.RequireProducer(r.transferHandler.CancelProducerTransfer))
+	apiGroup.POST("/producers/{id}/transfers/{transferId}/pause",
+		r.auth.RequireProducer(r.transferHandler.PauseProducerTransfer))
+	apiGroup.POST("/producers/{id}/transfers/{transferId}/resume",
+		r.auth.RequireProducer(r.transferHandler.ResumeProducerTransfer))
+	// The producer is authenticated by the handler, its ID is in the body
 	apiGroup.POST("/files", r.fileHandler.RegisterFile)
-	apiGroup.POST("/initDownload", r.downloadHandler.InitDownload)
+	apiGroup.GET("/files", r.auth.RequireConsumer(r.fileHandler.ListFiles))
+	apiGroup.GET("/files/{id}", r.auth.RequireConsumer(r.fileHandler.GetFile))
+	// The owning producer is authenticated by the handler
+	apiGroup.DELETE("/files/{id}", r.fileHandler.DeleteFile)
+	apiGroup.GET("/files/{id}/manifest", r.auth.RequireConsumer(r.fileHandler.GetManifest))
+	apiGroup.GET("/files/{id}/sources", r.auth.RequireConsumer(r.fileHandler.GetSources))
+	apiGroup.POST("/initDownload", r.auth.RequireConsumer(r.downloadHandler.InitDownload))
+	apiGroup.GET("/transfers/{id}", r.auth.RequireConsumer(r.transferHandler.GetTransfer))
+	apiGroup.POST("/transfers/{id}/cancel", r.auth.RequireConsumer(r.transferHandler.CancelTransfer))
+	apiGroup.POST("/transfers/{id}/pause", r.auth.RequireConsumer(r.transferHandler.PauseTransfer))
+	apiGroup.POST("/transfers/{id}/resume", r.auth.RequireConsumer(r.transferHandler.ResumeTransfer))
+	apiGroup.PUT("/transfers/{id}/received", r.auth.RequireConsumer(r.transferHandler.ReportReceived))
 
-	// WebSocket endpoint
+	// WebSocket endpoint, authenticated by the producer secret before the upgrade
 	router.GET("/ws", r.wsHandler.HandleConnection)
+	router.GET("/ws/consumer", r.auth.RequireConsumer(r.wsHandler.HandleConsumerConnection))
 
 	// Swagger UI
 	router.GET("/swagger/{filepath:*}", swagger.WrapHandler())
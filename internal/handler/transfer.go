@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/valyala/fasthttp"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+)
+
+type TransferStatusResponse struct {
+	Id            uuid.UUID            `json:"id"`
+	FileId        uuid.UUID            `json:"file_id"`
+	ProducerId    uuid.UUID            `json:"producer_id"`
+	Status        model.TransferStatus `json:"status"`
+	BlockSize     uint64               `json:"block_size"`
+	TotalBlocks   uint64               `json:"total_blocks"`
+	Compression   string               `json:"compression,omitempty"`
+	QueuePosition int                  `json:"queue_position,omitempty"` // position in the producer queue while queued
+}
+
+// CancelTransferRequest optionally tells the other side why the transfer was cancelled
+type CancelTransferRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReportReceivedRequest carries the bitmap of blocks the consumer has, base64 encoded in JSON
+type ReportReceivedRequest struct {
+	Received []byte `json:"received"`
+}
+
+type TransferHandler struct {
+	service contract.SignallerTransferService
+}
+
+func NewTransferHandler(service contract.SignallerTransferService) *TransferHandler {
+	return &TransferHandler{
+		service: service,
+	}
+}
+
+// GetTransfer returns the status of a transfer
+// @Summary      Get transfer status
+// @Description  Get the status of a transfer by the transfer ID shared by signaller, producer and consumer
+// @Tags         transfers
+// @Produce      json
+// @Param        id   path      string  true  "Transfer ID"
+// @Success      200  {object}  TransferStatusResponse  "Transfer status"
+// @Failure      400  {object}  map[string]any  "Invalid transfer ID"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Router       /transfers/{id} [get]
+func (h *TransferHandler) GetTransfer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return
+	}
+
+	transfer, err := h.service.GetTransfer(id)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, newTransferStatusResponse(transfer))
+}
+
+// GetProducerTransfers returns running and queued transfers of a producer
+// @Summary      Get producer transfers
+// @Description  Get unfinished transfers of a producer, queued ones ordered by queue position
+// @Tags         transfers
+// @Produce      json
+// @Param        id   path      string  true  "Producer ID"
+// @Success      200  {array}   TransferStatusResponse  "Transfers of the producer"
+// @Failure      400  {object}  map[string]any  "Invalid producer ID"
+// @Router       /producers/{id}/transfers [get]
+func (h *TransferHandler) GetProducerTransfers(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid producer id format")
+		return
+	}
+
+	transfers := h.service.GetProducerTransfers(id)
+	response := make([]TransferStatusResponse, 0, len(transfers))
+	for _, transfer := range transfers {
+		response = append(response, newTransferStatusResponse(transfer))
+	}
+
+	Success(ctx, response)
+}
+
+// CancelTransfer cancels a transfer on behalf of its consumer
+// @Summary      Cancel transfer
+// @Description  Record the transfer as cancelled and tell its producer to stop sending
+// @Tags         transfers
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                 true   "Transfer ID"
+// @Param        request  body      CancelTransferRequest  false  "Cancel reason"
+// @Success      200  {object}  TransferStatusResponse  "Cancelled transfer"
+// @Failure      400  {object}  map[string]any  "Invalid transfer ID or request"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer already finished"
+// @Router       /transfers/{id}/cancel [post]
+func (h *TransferHandler) CancelTransfer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return
+	}
+
+	h.cancel(ctx, id, "cancelled by the consumer")
+}
+
+// CancelProducerTransfer cancels a transfer on behalf of its producer
+// @Summary      Cancel producer transfer
+// @Description  Record a transfer of the producer as cancelled, its consumer is told to stop receiving
+// @Tags         transfers
+// @Accept       json
+// @Produce      json
+// @Param        id          path      string                 true   "Producer ID"
+// @Param        transferId  path      string                 true   "Transfer ID"
+// @Param        request     body      CancelTransferRequest  false  "Cancel reason"
+// @Success      200  {object}  TransferStatusResponse  "Cancelled transfer"
+// @Failure      400  {object}  map[string]any  "Invalid ID or request"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer already finished"
+// @Router       /producers/{id}/transfers/{transferId}/cancel [post]
+func (h *TransferHandler) CancelProducerTransfer(ctx *fasthttp.RequestCtx) {
+	id, ok := h.producerTransferId(ctx)
+	if !ok {
+		return
+	}
+
+	h.cancel(ctx, id, "cancelled by the producer")
+}
+
+// PauseTransfer pauses a running transfer on behalf of its consumer
+// @Summary      Pause transfer
+// @Description  Ask the producer to suspend sending, the transfer keeps its producer slot until resumed
+// @Tags         transfers
+// @Produce      json
+// @Param        id   path      string  true  "Transfer ID"
+// @Success      200  {object}  TransferStatusResponse  "Paused transfer"
+// @Failure      400  {object}  map[string]any  "Invalid transfer ID"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer is not sending, or its producer can not pause"
+// @Failure      503  {object}  map[string]any  "Producer is offline"
+// @Router       /transfers/{id}/pause [post]
+func (h *TransferHandler) PauseTransfer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return
+	}
+
+	h.control(ctx, h.service.PauseTransfer, id)
+}
+
+// ResumeTransfer resumes a paused transfer on behalf of its consumer
+// @Summary      Resume transfer
+// @Description  Continue a paused transfer, the producer skips blocks reported as received
+// @Tags         transfers
+// @Produce      json
+// @Param        id   path      string  true  "Transfer ID"
+// @Success      200  {object}  TransferStatusResponse  "Resumed transfer"
+// @Failure      400  {object}  map[string]any  "Invalid transfer ID"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer is not paused, or its producer can not resume"
+// @Failure      503  {object}  map[string]any  "Producer is offline"
+// @Router       /transfers/{id}/resume [post]
+func (h *TransferHandler) ResumeTransfer(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return
+	}
+
+	h.control(ctx, h.service.ResumeTransfer, id)
+}
+
+// ReportReceived saves the blocks the consumer has, they are skipped when the transfer is resumed
+// @Summary      Report received blocks
+// @Description  Merge a bitmap of received blocks into the transfer, bit i of byte i/8 marks block i
+// @Tags         transfers
+// @Accept       json
+// @Param        id       path  string                 true  "Transfer ID"
+// @Param        request  body  ReportReceivedRequest  true  "Received blocks"
+// @Success      204  "Blocks saved"
+// @Failure      400  {object}  map[string]any  "Invalid transfer ID or request"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer already finished"
+// @Router       /transfers/{id}/received [put]
+func (h *TransferHandler) ReportReceived(ctx *fasthttp.RequestCtx) {
+	idStr, _ := ctx.UserValue("id").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return
+	}
+
+	var request ReportReceivedRequest
+	if err := json.Unmarshal(ctx.PostBody(), &request); err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	err = h.service.ReportReceived(id, request.Received)
+	switch {
+	case errors.Is(err, contract.ErrTransferFinished):
+		ErrorWithMessage(ctx, fasthttp.StatusConflict, err.Error())
+		return
+	case err != nil:
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// PauseProducerTransfer pauses a running transfer on behalf of its producer
+// @Summary      Pause producer transfer
+// @Description  Suspend sending a transfer of the producer until it is resumed
+// @Tags         transfers
+// @Produce      json
+// @Param        id          path      string  true  "Producer ID"
+// @Param        transferId  path      string  true  "Transfer ID"
+// @Success      200  {object}  TransferStatusResponse  "Paused transfer"
+// @Failure      400  {object}  map[string]any  "Invalid ID"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer is not sending, or its producer can not pause"
+// @Failure      503  {object}  map[string]any  "Producer is offline"
+// @Router       /producers/{id}/transfers/{transferId}/pause [post]
+func (h *TransferHandler) PauseProducerTransfer(ctx *fasthttp.RequestCtx) {
+	id, ok := h.producerTransferId(ctx)
+	if !ok {
+		return
+	}
+
+	h.control(ctx, h.service.PauseTransfer, id)
+}
+
+// ResumeProducerTransfer resumes a paused transfer on behalf of its producer
+// @Summary      Resume producer transfer
+// @Description  Continue sending a paused transfer of the producer
+// @Tags         transfers
+// @Produce      json
+// @Param        id          path      string  true  "Producer ID"
+// @Param        transferId  path      string  true  "Transfer ID"
+// @Success      200  {object}  TransferStatusResponse  "Resumed transfer"
+// @Failure      400  {object}  map[string]any  "Invalid ID"
+// @Failure      404  {object}  map[string]any  "Transfer not found"
+// @Failure      409  {object}  map[string]any  "Transfer is not paused, or its producer can not resume"
+// @Failure      503  {object}  map[string]any  "Producer is offline"
+// @Router       /producers/{id}/transfers/{transferId}/resume [post]
+func (h *TransferHandler) ResumeProducerTransfer(ctx *fasthttp.RequestCtx) {
+	id, ok := h.producerTransferId(ctx)
+	if !ok {
+		return
+	}
+
+	h.control(ctx, h.service.ResumeTransfer, id)
+}
+
+// producerTransferId parses the transfer ID of a producer route and checks the transfer belongs to the producer,
+// an error response is written when it does not
+func (h *TransferHandler) producerTransferId(ctx *fasthttp.RequestCtx) (uuid.UUID, bool) {
+	producerIdStr, _ := ctx.UserValue("id").(string)
+	producerId, err := uuid.Parse(producerIdStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid producer id format")
+		return uuid.Nil, false
+	}
+	idStr, _ := ctx.UserValue("transferId").(string)
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid transfer id format")
+		return uuid.Nil, false
+	}
+
+	// Transfers of other producers are not revealed
+	transfer, err := h.service.GetTransfer(id)
+	if err != nil || transfer.FileMeta == nil || transfer.FileMeta.ProducerId != producerId {
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, "transfer not found")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// control pauses or resumes the transfer and responds with its new status
+func (h *TransferHandler) control(ctx *fasthttp.RequestCtx,
+	action func(uuid.UUID) (*model.Transfer, error), id uuid.UUID) {
+	transfer, err := action(id)
+	switch {
+	case errors.Is(err, contract.ErrProducerOffline):
+		ErrorWithCode(ctx, fasthttp.StatusServiceUnavailable, ErrorCodeProducerOffline, err.Error())
+		return
+	case errors.Is(err, contract.ErrTransferNotRunning), errors.Is(err, contract.ErrTransferFinished),
+		errors.Is(err, contract.ErrNotSupported):
+		ErrorWithMessage(ctx, fasthttp.StatusConflict, err.Error())
+		return
+	case err != nil:
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, newTransferStatusResponse(transfer))
+}
+
+// cancel cancels the transfer with the reason from the request body, defaultReason when none is given
+func (h *TransferHandler) cancel(ctx *fasthttp.RequestCtx, id uuid.UUID, defaultReason string) {
+	var request CancelTransferRequest
+	if body := ctx.PostBody(); len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if request.Reason == "" {
+		request.Reason = defaultReason
+	}
+
+	transfer, err := h.service.CancelTransfer(id, request.Reason)
+	switch {
+	case errors.Is(err, contract.ErrTransferFinished):
+		ErrorWithMessage(ctx, fasthttp.StatusConflict, err.Error())
+		return
+	case err != nil:
+		ErrorWithMessage(ctx, fasthttp.StatusNotFound, err.Error())
+		return
+	}
+
+	Success(ctx, newTransferStatusResponse(transfer))
+}
+
+func newTransferStatusResponse(transfer *model.Transfer) TransferStatusResponse {
+	response := TransferStatusResponse{
+		Id:            transfer.Id,
+		Status:        transfer.Status,
+		BlockSize:     transfer.BlockSize,
+		TotalBlocks:   transfer.TotalBlocks,
+		Compression:   transfer.Compression,
+		QueuePosition: transfer.QueuePosition,
+	}
+	if transfer.FileMeta != nil {
+		response.FileId = transfer.FileMeta.Id
+		response.ProducerId = transfer.FileMeta.ProducerId
+	}
+	return response
+}
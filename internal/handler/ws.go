@@ -15,12 +15,17 @@ var upgrader = websocket.FastHTTPUpgrader{
 }
 
 type WsHandler struct {
-	service contract.WebsocketProducerService
+	service         contract.WebsocketProducerService
+	consumerService contract.WebsocketConsumerService
+	auth            *Authenticator
 }
 
-func NewWsHandler(service contract.WebsocketProducerService) *WsHandler {
+func NewWsHandler(service contract.WebsocketProducerService, consumerService contract.WebsocketConsumerService,
+	auth *Authenticator) *WsHandler {
 	return &WsHandler{
-		service: service,
+		service:         service,
+		consumerService: consumerService,
+		auth:            auth,
 	}
 }
 
@@ -29,8 +34,10 @@ func NewWsHandler(service contract.WebsocketProducerService) *WsHandler {
 // @Description  Establishes a WebSocket connection for a producer to receive transfer notifications
 // @Tags         websocket
 // @Param        producer_id  query  string  true  "Producer ID"
+// @Security     BearerAuth
 // @Success      101          "Switching Protocols"
 // @Failure      400          {object}  map[string]any  "Invalid producer ID"
+// @Failure      401          {object}  map[string]any  "Missing or invalid producer secret"
 // @Failure      500          {object}  map[string]any  "Internal server error"
 // @Router       /ws [get]
 func (h *WsHandler) HandleConnection(ctx *fasthttp.RequestCtx) {
@@ -47,6 +54,12 @@ func (h *WsHandler) HandleConnection(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	// Authenticate before upgrading, the connection receives transfer requests of the producer
+	if !h.auth.Producer(ctx, producerId) {
+		unauthorized(ctx)
+		return
+	}
+
 	// Upgrade to websocket
 	err = upgrader.Upgrade(ctx, func(conn *websocket.Conn) {
 		defer func() {
@@ -72,3 +85,32 @@ func (h *WsHandler) HandleConnection(ctx *fasthttp.RequestCtx) {
 		return
 	}
 }
+
+// HandleConsumerConnection upgrades a consumer connection receiving transfer events
+// @Summary      WebSocket connection for consumers
+// @Description  Establishes a WebSocket connection for a consumer to follow transfers. The welcome message
+// @Description  carries a session ID, downloads initiated with it report their events on the connection.
+// @Tags         websocket
+// @Security     BearerAuth
+// @Success      101  "Switching Protocols"
+// @Failure      401  {object}  map[string]any  "Missing or invalid consumer token"
+// @Failure      400  {object}  map[string]any  "Failed to upgrade"
+// @Router       /ws/consumer [get]
+func (h *WsHandler) HandleConsumerConnection(ctx *fasthttp.RequestCtx) {
+	err := upgrader.Upgrade(ctx, func(conn *websocket.Conn) {
+		defer func() {
+			if r := recover(); r != nil {
+				logutils.WithField("error", r).Error("Panic in consumer websocket handler")
+			}
+		}()
+
+		if err := h.consumerService.HandleConnection(conn); err != nil {
+			logutils.WithField("error", err.Error()).Warn("Error handling consumer websocket connection")
+		}
+	})
+
+	if err != nil {
+		ErrorWithMessage(ctx, fasthttp.StatusBadRequest, "Failed to upgrade to websocket")
+		return
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const consumerSubsystem = "consumer"
+
+// Consumer metrics, updated by the receive loop
+var (
+	BytesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "bytes_received_total",
+		Help:      "UDP payload bytes of new blocks received from producers, before decompression.",
+	})
+	PacketsReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "packets_received_total",
+		Help:      "Data packets of new blocks received from producers.",
+	})
+	DuplicatePackets = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "duplicate_packets_total",
+		Help:      "Data packets of blocks the transfer had already received.",
+	})
+	ReceiveErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "receive_errors_total",
+		Help:      "Packets which could not be read, decoded or decompressed.",
+	})
+	PriorityRequests = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "priority_requests_total",
+		Help:      "Requests asking producers to send a missing block next.",
+	})
+	ActiveDownloads = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: consumerSubsystem,
+		Name:      "active_transfers",
+		Help:      "Transfers being received.",
+	})
+)
+
+// RegisterConsumer registers the consumer metrics with the registry
+func RegisterConsumer(registry prometheus.Registerer) {
+	registry.MustRegister(
+		BytesReceived,
+		PacketsReceived,
+		DuplicatePackets,
+		ReceiveErrors,
+		PriorityRequests,
+		ActiveDownloads,
+	)
+}
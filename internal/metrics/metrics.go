@@ -0,0 +1,48 @@
+// Package metrics exposes Prometheus metrics of the signaller, producers and consumers.
+//
+// Metric names are stable and prefixed with udpie_signaller_, udpie_producer_ or udpie_consumer_,
+// dashboards may rely on them.
+// Gauges describing state are read from the services on every scrape, counters are updated where
+// the events happen.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "udpie"
+
+// readHeaderTimeout bounds reading request headers of metrics scrapes
+const readHeaderTimeout = 5 * time.Second
+
+// NewRegistry returns a registry with the Go runtime and process collectors
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves the metrics of the registry on addr under /metrics until the process exits
+func ListenAndServe(addr string, registry *prometheus.Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(registry))
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	return server.ListenAndServe()
+}
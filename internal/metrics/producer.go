@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const producerSubsystem = "producer"
+
+// Producer counters, updated by the send loop
+var (
+	BytesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: producerSubsystem,
+		Name:      "bytes_sent_total",
+		Help:      "UDP payload bytes sent to consumers, after compression.",
+	})
+	PacketsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: producerSubsystem,
+		Name:      "packets_sent_total",
+		Help:      "Data packets sent to consumers.",
+	})
+	Retransmits = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: producerSubsystem,
+		Name:      "retransmits_total",
+		Help:      "Data packets of blocks the transfer had already sent.",
+	})
+	SendErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: producerSubsystem,
+		Name:      "send_errors_total",
+		Help:      "Blocks which could not be read, encoded or sent.",
+	})
+)
+
+// ProducerSources reads the producer state on every scrape
+type ProducerSources struct {
+	ActiveTransfers func() int // transfers sending right now
+	QueuedTransfers func() int // transfers waiting for a free slot
+}
+
+// RegisterProducer registers the producer metrics with the registry
+func RegisterProducer(registry prometheus.Registerer, sources ProducerSources) {
+	registry.MustRegister(
+		BytesSent,
+		PacketsSent,
+		Retransmits,
+		SendErrors,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: producerSubsystem,
+			Name:      "active_transfers",
+			Help:      "Transfers being sent.",
+		}, func() float64 {
+			return float64(sources.ActiveTransfers())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: producerSubsystem,
+			Name:      "queued_transfers",
+			Help:      "Transfers waiting for a free slot.",
+		}, func() float64 {
+			return float64(sources.QueuedTransfers())
+		}),
+	)
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+
+	"udpie/internal/model"
+	"udpie/pkg/logutils"
+)
+
+const signallerSubsystem = "signaller"
+
+// SignallerSources reads the signaller state on every scrape
+type SignallerSources struct {
+	Producers           func() (int, error)                 // registered producers
+	ProducerConnections func() int                          // connected producer websockets
+	ConsumerConnections func() int                          // connected consumer websockets
+	PendingRequests     func() int                          // requests to producers awaiting a response
+	Transfers           func() map[model.TransferStatus]int // stored transfers by status
+}
+
+var httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Subsystem: signallerSubsystem,
+	Name:      "http_request_duration_seconds",
+	Help:      "Latency of API requests by method, route and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "code"})
+
+// RegisterSignaller registers the signaller metrics with the registry
+func RegisterSignaller(registry prometheus.Registerer, sources SignallerSources) {
+	registry.MustRegister(
+		httpRequestDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: signallerSubsystem,
+			Name:      "producers_registered",
+			Help:      "Producers registered on the signaller.",
+		}, func() float64 {
+			count, err := sources.Producers()
+			if err != nil {
+				logutils.WithError(err).Warn("Failed to count producers for metrics")
+			}
+			return float64(count)
+		}),
+		newConnectionsCollector(sources),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: signallerSubsystem,
+			Name:      "websocket_pending_requests",
+			Help:      "Requests sent to producers over websocket which have not been answered yet.",
+		}, func() float64 {
+			return float64(sources.PendingRequests())
+		}),
+		newTransfersCollector(sources.Transfers),
+	)
+}
+
+// InstrumentHandler records the latency of every request routed by a router with SaveMatchedRoutePath set.
+// Requests matching no route are recorded with the "unmatched" route.
+func InstrumentHandler(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		start := time.Now()
+		next(ctx)
+
+		route, _ := ctx.UserValue(router.MatchedRoutePathParam).(string)
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestDuration.WithLabelValues(string(ctx.Method()), route, strconv.Itoa(ctx.Response.StatusCode())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// FastHTTPHandler serves the metrics of the registry on a fasthttp server
+func FastHTTPHandler(registry *prometheus.Registry) fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandler(Handler(registry))
+}
+
+// connectionsCollector reports connected websockets by role
+type connectionsCollector struct {
+	desc    *prometheus.Desc
+	sources SignallerSources
+}
+
+func newConnectionsCollector(sources SignallerSources) *connectionsCollector {
+	return &connectionsCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, signallerSubsystem, "websocket_connections"),
+			"Connected websockets by role, producer or consumer.", []string{"role"}, nil),
+		sources: sources,
+	}
+}
+
+func (c *connectionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *connectionsCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.sources.ProducerConnections()),
+		"producer")
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.sources.ConsumerConnections()),
+		"consumer")
+}
+
+// transfersCollector reports stored transfers by status
+type transfersCollector struct {
+	desc  *prometheus.Desc
+	count func() map[model.TransferStatus]int
+}
+
+func newTransfersCollector(count func() map[model.TransferStatus]int) *transfersCollector {
+	return &transfersCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, signallerSubsystem, "transfers"),
+			"Transfers known to the signaller by status.", []string{"status"}, nil),
+		count: count,
+	}
+}
+
+func (c *transfersCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *transfersCollector) Collect(ch chan<- prometheus.Metric) {
+	for status, count := range c.count() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), string(status))
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"udpie/internal/model"
+)
+
+func TestRegisterSignaller(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	RegisterSignaller(registry, SignallerSources{
+		Producers:           func() (int, error) { return 3, nil },
+		ProducerConnections: func() int { return 2 },
+		ConsumerConnections: func() int { return 5 },
+		PendingRequests:     func() int { return 1 },
+		Transfers: func() map[model.TransferStatus]int {
+			return map[model.TransferStatus]int{
+				model.TransferStatusDataSending: 4,
+				model.TransferStatusComplete:    7,
+			}
+		},
+	})
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	got := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += "/" + label.GetValue()
+			}
+			got[name] = metric.GetGauge().GetValue()
+		}
+	}
+
+	tests := []struct {
+		name string
+		want float64
+	}{
+		{name: "udpie_signaller_producers_registered", want: 3},
+		{name: "udpie_signaller_websocket_connections/producer", want: 2},
+		{name: "udpie_signaller_websocket_connections/consumer", want: 5},
+		{name: "udpie_signaller_websocket_pending_requests", want: 1},
+		{name: "udpie_signaller_transfers/data_sending", want: 4},
+		{name: "udpie_signaller_transfers/complete", want: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, exists := got[tt.name]
+			if !exists {
+				t.Fatalf("metric %s not gathered", tt.name)
+			}
+			if value != tt.want {
+				t.Errorf("metric %s = %v, want %v", tt.name, value, tt.want)
+			}
+		})
+	}
+}
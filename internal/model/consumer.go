@@ -4,5 +4,6 @@ import "github.com/google/uuid"
 
 type Consumer struct {
 	Id         uuid.UUID  `json:"id"`
+	Name       string     `json:"name,omitempty"` // name of the token the consumer authenticated with
 	UdpOptions UdpOptions `json:"udp_options"`
 }
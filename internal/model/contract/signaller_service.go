@@ -1,39 +1,117 @@
 package contract
 
 import (
+	"errors"
 	"time"
 
 	"github.com/fasthttp/websocket"
 	"github.com/google/uuid"
 
 	"udpie/internal/model"
+	"udpie/internal/protocol"
 )
 
 type RegisterFileOptions struct {
-	Name       string    `json:"name"`
-	Size       uint64    `json:"size"`
-	Hash       []byte    `json:"hash"`
-	ProducerId uuid.UUID `json:"producer_id"`
+	Name       string          `json:"name"`
+	Size       uint64          `json:"size"`
+	Hash       []byte          `json:"hash"`
+	ProducerId uuid.UUID       `json:"producer_id"`
+	Manifest   *model.Manifest `json:"manifest,omitempty"`
+	TTL        time.Duration   `json:"ttl,omitempty"` // zero uses the signaller default
 }
 
 type RegisterProducerOptions struct {
 	UdpOptions model.UdpOptions `json:"udp_options"`
+	// Set by the server from a verified client certificate, the producer may authenticate with it later
+	CertFingerprint []byte `json:"-"`
 }
 
+// RegisterProducerResult carries the secret the producer authenticates with.
+// It is only returned once, the signaller keeps its hash.
+type RegisterProducerResult struct {
+	Id     uuid.UUID `json:"id"`
+	Secret string    `json:"secret"`
+}
+
+// ErrUnauthorized is returned when credentials are missing or do not match
+var ErrUnauthorized = errors.New("unauthorized")
+
 type InitTransferOptions struct {
-	FileId             uuid.UUID        `json:"file_id"`
-	ConsumerUdpOptions model.UdpOptions `json:"consumer_udp_options"`
+	FileId             uuid.UUID         `json:"file_id"`
+	Path               string            `json:"path,omitempty"` // manifest entry path for directory items
+	ConsumerUdpOptions model.UdpOptions  `json:"consumer_udp_options"`
+	ConsumerName       string            `json:"consumer_name,omitempty"` // from the consumer token, not the request body
+	ConsumerIp         string            `json:"-"`                       // address the request came from, not what the consumer claims
+	Compression        []string          `json:"compression,omitempty"`   // accepted codecs in order of preference
+	Range              *model.BlockRange `json:"range,omitempty"`         // part of the file to send, nil for the whole file
+	MaxRate            uint64            `json:"max_rate,omitempty"`      // consumer bandwidth limit in bytes per second, 0 for unlimited
+	SessionId          string            `json:"session_id,omitempty"`    // consumer websocket session receiving the transfer events
+}
+
+// Page bounds of list requests
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// ListFilesOptions filters registered files, zero values do not filter
+type ListFilesOptions struct {
+	ProducerId uuid.UUID
+	Name       string // case-insensitive substring of the name
+	MinSize    uint64
+	MaxSize    uint64
+	Online     *bool // whether the producer of the file is connected
+	Offset     int
+	Limit      int // DefaultPageSize when zero, at most MaxPageSize
+}
+
+type ListFilesResult struct {
+	Files []*model.FileMeta
+	Total int // files matching the filters, not just this page
+}
+
+type ListProducersOptions struct {
+	Online *bool
+	Offset int
+	Limit  int
+}
+
+type ListProducersResult struct {
+	Producers []*model.Producer
+	Total     int
+}
+
+// ProducerPresence tells which producers are connected to the signaller
+type ProducerPresence interface {
+	IsOnline(producerId uuid.UUID) bool
+	// Presence returns the connection state of the producer, producers never seen since start are offline
+	Presence(producerId uuid.UUID) model.Presence
 }
 
 type SignallerProducerService interface {
-	RegisterProducer(options RegisterProducerOptions) (uuid.UUID, error)
+	RegisterProducer(options RegisterProducerOptions) (*RegisterProducerResult, error)
 	GetProducer(id uuid.UUID) (*model.Producer, error)
+	// AuthenticateProducer checks the secret issued to the producer at registration
+	AuthenticateProducer(id uuid.UUID, secret string) error
+	// AuthenticateProducerCertificate checks the client certificate the producer registered with
+	AuthenticateProducerCertificate(id uuid.UUID, fingerprint []byte) error
 	UpdateUdpOptions(id uuid.UUID, options model.UdpOptions) error
+	// ListProducers returns a page of producers ordered by registration time
+	ListProducers(options ListProducersOptions) (*ListProducersResult, error)
+	// DeleteProducer removes the producer, its files are removed by SignallerFileService.DeleteProducerFiles
+	DeleteProducer(id uuid.UUID) error
 }
 
 type SignallerFileService interface {
 	RegisterFile(options RegisterFileOptions) (uuid.UUID, error)
 	GetFileMeta(id uuid.UUID) (*model.FileMeta, error)
+	// GetFileSources returns all files with the same content hash, including the file itself
+	GetFileSources(id uuid.UUID) ([]*model.FileMeta, error)
+	// ListFiles returns a page of files ordered by registration time
+	ListFiles(options ListFilesOptions) (*ListFilesResult, error)
+	DeleteFile(id uuid.UUID) error
+	// DeleteProducerFiles removes all files of the producer and returns how many there were
+	DeleteProducerFiles(producerId uuid.UUID) (int, error)
 }
 
 type InitTransferResult struct {
@@ -41,33 +119,77 @@ type InitTransferResult struct {
 	ProducerUdpOptions model.UdpOptions `json:"producer_udp_options"`
 	BlockSize          uint64           `json:"block_size"`
 	TotalBlocks        uint64           `json:"total_blocks"`
+	Range              model.BlockRange `json:"range"`
+	Compression        string           `json:"compression,omitempty"`    // negotiated codec, empty for none
+	QueuePosition      int              `json:"queue_position,omitempty"` // set when the producer queued the transfer
 }
 
+// ErrProducerBusy is returned when the producer has no free transfer slot and no room in its queue
+var ErrProducerBusy = errors.New("producer is busy")
+
+// ErrProducerOffline is returned when the producer owning the file is not connected to the signaller
+var ErrProducerOffline = errors.New("producer is offline")
+
+// ErrRequestTimeout is returned when the producer does not answer a request in time
+var ErrRequestTimeout = errors.New("timeout waiting for response")
+
+// ErrTransferFinished is returned when a transfer can no longer be changed, e.g. cancelled
+var ErrTransferFinished = errors.New("transfer is already finished")
+
+// ErrNotSupported is returned when the producer did not announce support for a request
+var ErrNotSupported = errors.New("producer does not support this request")
+
+// ErrTransferNotRunning is returned when pausing a transfer which is not sending or resuming one which is not paused
+var ErrTransferNotRunning = errors.New("transfer is not running")
+
 type SignallerTransferService interface {
 	InitTransfer(options InitTransferOptions) (*InitTransferResult, error)
 	GetTransfer(id uuid.UUID) (*model.Transfer, error)
-}
-
-// WebsocketRequest represents a websocket request message
-type WebsocketRequest struct {
-	ProducerId uuid.UUID `json:"producer_id"`
-	RequestID  string    `json:"request_id,omitempty"` // Auto-generated if empty
-	Type       string    `json:"type"`
-	Data       any       `json:"data,omitempty"`
-}
-
-// WebsocketResponse represents a successful websocket response
-type WebsocketResponse struct {
-	ProducerId uuid.UUID `json:"producer_id"`
-	RequestID  string    `json:"request_id"`
-	Data       any       `json:"data,omitempty"`
+	// GetProducerTransfers returns unfinished transfers of the producer
+	GetProducerTransfers(producerId uuid.UUID) []*model.Transfer
+	// CancelTransfer records the transfer as cancelled and tells its producer to stop sending
+	CancelTransfer(id uuid.UUID, reason string) (*model.Transfer, error)
+	// PauseTransfer asks the producer to suspend sending a running transfer
+	PauseTransfer(id uuid.UUID) (*model.Transfer, error)
+	// ResumeTransfer continues a paused transfer from the blocks reported by ReportReceived
+	ResumeTransfer(id uuid.UUID) (*model.Transfer, error)
+	// ReportReceived saves the bitmap of blocks the consumer has, bit i of byte i/8 is block i
+	ReportReceived(id uuid.UUID, received []byte) error
 }
 
 const (
 	DefaultWebsocketRequestTimeout = 3 * time.Second
+	InitTransferTimeout            = 30 * time.Second // producers may ask their operator before accepting
+	TransferControlTimeout         = 5 * time.Second  // cancel, pause and resume requests
+	DefaultBlockSize               = 1024             // 1KB default block size
 )
 
+// WebsocketMessageHandler handles a message a producer sent on its own, not as a response
+type WebsocketMessageHandler func(producerId uuid.UUID, message protocol.Message) error
+
 type WebsocketProducerService interface {
+	// HandleConnection runs the protocol handshake and serves the connection until it is closed
 	HandleConnection(producerId uuid.UUID, conn *websocket.Conn) error
-	MakeClientRequestWithTimeout(request *WebsocketRequest, timeout time.Duration) (*WebsocketResponse, error)
+	// MakeClientRequestWithTimeout sends a request to the producer and waits for its response
+	MakeClientRequestWithTimeout(producerId uuid.UUID, request protocol.Message,
+		timeout time.Duration) (protocol.Message, error)
+	// OnMessage registers a handler for producer messages of the given kind
+	OnMessage(kind string, handler WebsocketMessageHandler)
+	// Capabilities returns the features agreed with a connected producer
+	Capabilities(producerId uuid.UUID) (protocol.Capabilities, bool)
+	// Disconnect closes the websocket connection of the producer, if any
+	Disconnect(producerId uuid.UUID)
+	ProducerPresence
+}
+
+// TransferEventSink delivers transfer events to the consumers following them
+type TransferEventSink interface {
+	// Follow subscribes a consumer session to a transfer, before the producer is asked about it
+	Follow(sessionId string, transferId uuid.UUID) error
+	Publish(event model.TransferEvent)
+}
+
+type WebsocketConsumerService interface {
+	// HandleConnection runs the protocol handshake and serves the consumer until the connection is closed
+	HandleConnection(conn *websocket.Conn) error
 }
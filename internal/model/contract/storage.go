@@ -0,0 +1,29 @@
+package contract
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+)
+
+// ErrNotFound is returned by storage collections for unknown IDs
+var ErrNotFound = errors.New("not found")
+
+// Storage keeps the signaller state: producers, files and transfer history
+type Storage interface {
+	Producers() Collection[model.Producer]
+	Files() Collection[model.FileMeta]
+	Transfers() Collection[model.Transfer]
+	Close() error
+}
+
+// Collection stores values by ID. Values are copied in and out,
+// changes to a value are only kept once it is put back.
+type Collection[T any] interface {
+	Get(id uuid.UUID) (*T, error)
+	Put(id uuid.UUID, value *T) error
+	Delete(id uuid.UUID) error
+	List() ([]*T, error)
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -10,6 +12,9 @@ type FileMeta struct {
 	Size       uint64    `json:"size"`
 	Hash       []byte    `json:"hash"`
 	ProducerId uuid.UUID `json:"producer_id"`
+	Manifest   *Manifest `json:"manifest,omitempty"` // set for directory items
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitzero"` // zero for files kept until unregistered
 }
 
 func NewFileMeta(name string, size uint64, hash []byte, producerId uuid.UUID) *FileMeta {
@@ -19,15 +24,32 @@ func NewFileMeta(name string, size uint64, hash []byte, producerId uuid.UUID) *F
 		Size:       size,
 		Hash:       hash,
 		ProducerId: producerId,
+		CreatedAt:  time.Now(),
 	}
 }
 
 func (f *FileMeta) Clone() *FileMeta {
-	return &FileMeta{
+	clone := &FileMeta{
 		Id:         f.Id,
 		Name:       f.Name,
 		Size:       f.Size,
 		Hash:       f.Hash,
 		ProducerId: f.ProducerId,
+		CreatedAt:  f.CreatedAt,
+		ExpiresAt:  f.ExpiresAt,
 	}
+	if f.Manifest != nil {
+		clone.Manifest = f.Manifest.Clone()
+	}
+	return clone
+}
+
+// IsDirectory reports whether the item is a directory described by a manifest
+func (f *FileMeta) IsDirectory() bool {
+	return f.Manifest != nil
+}
+
+// Expired reports whether the file TTL ran out
+func (f *FileMeta) Expired(now time.Time) bool {
+	return !f.ExpiresAt.IsZero() && !now.Before(f.ExpiresAt)
 }
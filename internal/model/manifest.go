@@ -0,0 +1,138 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ManifestEntry describes a single file of a directory item.
+// Path is slash-separated and relative to the shared directory root.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size uint64 `json:"size"`
+	Mode uint32 `json:"mode"`
+	Hash []byte `json:"hash"` // sha256 of the file content
+}
+
+// Manifest lists every file of a directory shared as a single item
+type Manifest struct {
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// TotalSize returns the summary size of all entries
+func (m *Manifest) TotalSize() uint64 {
+	var total uint64
+	for i := range m.Entries {
+		total += m.Entries[i].Size
+	}
+	return total
+}
+
+// Find returns the entry with the given relative path
+func (m *Manifest) Find(entryPath string) (ManifestEntry, bool) {
+	for i := range m.Entries {
+		if m.Entries[i].Path == entryPath {
+			return m.Entries[i], true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Validate checks that all paths are clean, relative, unique and stay inside the root
+func (m *Manifest) Validate() error {
+	if len(m.Entries) == 0 {
+		return errors.New("manifest has no entries")
+	}
+
+	seen := make(map[string]struct{}, len(m.Entries))
+	for i := range m.Entries {
+		entryPath := m.Entries[i].Path
+		if err := ValidateEntryPath(entryPath); err != nil {
+			return err
+		}
+		if _, exists := seen[entryPath]; exists {
+			return fmt.Errorf("duplicate manifest entry: %s", entryPath)
+		}
+		seen[entryPath] = struct{}{}
+	}
+
+	return nil
+}
+
+// Select returns entries matching any of the patterns. A pattern matches an entry
+// either as a path.Match glob or as a directory prefix. No patterns selects everything.
+func (m *Manifest) Select(patterns []string) ([]ManifestEntry, error) {
+	if len(patterns) == 0 {
+		return append([]ManifestEntry(nil), m.Entries...), nil
+	}
+
+	var selected []ManifestEntry
+	for i := range m.Entries {
+		matched, err := matchEntry(m.Entries[i].Path, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			selected = append(selected, m.Entries[i])
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, errors.New("no manifest entries match the selection")
+	}
+
+	return selected, nil
+}
+
+func (m *Manifest) Clone() *Manifest {
+	entries := make([]ManifestEntry, len(m.Entries))
+	copy(entries, m.Entries)
+	return &Manifest{Entries: entries}
+}
+
+// ValidateEntryPath checks that a manifest path is clean, relative and does not escape the root
+func ValidateEntryPath(entryPath string) error {
+	if entryPath == "" {
+		return errors.New("manifest entry path is empty")
+	}
+	if path.IsAbs(entryPath) || strings.Contains(entryPath, "\\") {
+		return fmt.Errorf("manifest entry path must be relative and slash-separated: %s", entryPath)
+	}
+	if path.Clean(entryPath) != entryPath || entryPath == ".." || strings.HasPrefix(entryPath, "../") {
+		return fmt.Errorf("manifest entry path is not clean: %s", entryPath)
+	}
+	return nil
+}
+
+// ValidateFileName checks that a name received from the network is usable as a single local file name
+func ValidateFileName(name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid file name: %q", name)
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("file name must not contain path separators: %q", name)
+	}
+	return nil
+}
+
+func matchEntry(entryPath string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		if strings.HasPrefix(entryPath, pattern+"/") || entryPath == pattern {
+			return true, nil
+		}
+		matched, err := path.Match(pattern, entryPath)
+		if err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testManifest() *Manifest {
+	return &Manifest{
+		Entries: []ManifestEntry{
+			{Path: "README.md", Size: 10},
+			{Path: "docs/guide.md", Size: 20},
+			{Path: "docs/api/index.html", Size: 30},
+			{Path: "src/main.go", Size: 40},
+		},
+	}
+}
+
+func TestManifest_TotalSize(t *testing.T) {
+	if got := testManifest().TotalSize(); got != 100 {
+		t.Errorf("TotalSize() = %d, want 100", got)
+	}
+}
+
+func TestManifest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{name: "valid paths", paths: []string{"a.txt", "dir/b.txt"}, wantErr: false},
+		{name: "no entries", paths: nil, wantErr: true},
+		{name: "empty path", paths: []string{""}, wantErr: true},
+		{name: "absolute path", paths: []string{"/etc/passwd"}, wantErr: true},
+		{name: "parent escape", paths: []string{"../secret"}, wantErr: true},
+		{name: "parent only", paths: []string{".."}, wantErr: true},
+		{name: "not clean", paths: []string{"dir/../b.txt"}, wantErr: true},
+		{name: "backslash", paths: []string{"dir\\b.txt"}, wantErr: true},
+		{name: "duplicate", paths: []string{"a.txt", "a.txt"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &Manifest{}
+			for _, p := range tt.paths {
+				manifest.Entries = append(manifest.Entries, ManifestEntry{Path: p})
+			}
+
+			err := manifest.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFileName(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		wantErr  bool
+	}{
+		{name: "plain name", fileName: "report.pdf", wantErr: false},
+		{name: "dots inside", fileName: "archive.tar.gz", wantErr: false},
+		{name: "empty", fileName: "", wantErr: true},
+		{name: "current directory", fileName: ".", wantErr: true},
+		{name: "parent directory", fileName: "..", wantErr: true},
+		{name: "slash", fileName: "../etc/passwd", wantErr: true},
+		{name: "absolute", fileName: "/etc/passwd", wantErr: true},
+		{name: "backslash", fileName: "..\\boot.ini", wantErr: true},
+		{name: "nul byte", fileName: "a\x00b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFileName(tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFileName(%q) error = %v, wantErr %v", tt.fileName, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManifest_Select(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "no patterns selects all",
+			patterns: nil,
+			want:     []string{"README.md", "docs/guide.md", "docs/api/index.html", "src/main.go"},
+		},
+		{
+			name:     "exact path",
+			patterns: []string{"src/main.go"},
+			want:     []string{"src/main.go"},
+		},
+		{
+			name:     "directory prefix",
+			patterns: []string{"docs/"},
+			want:     []string{"docs/guide.md", "docs/api/index.html"},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"docs/*.md"},
+			want:     []string{"docs/guide.md"},
+		},
+		{
+			name:     "several patterns",
+			patterns: []string{"*.md", "src"},
+			want:     []string{"README.md", "src/main.go"},
+		},
+		{
+			name:     "prefix does not match partial names",
+			patterns: []string{"doc"},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid glob",
+			patterns: []string{"["},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := testManifest().Select(tt.patterns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var got []string
+			for _, entry := range selected {
+				got = append(got, entry.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifest_Find(t *testing.T) {
+	manifest := testManifest()
+
+	entry, ok := manifest.Find("docs/guide.md")
+	if !ok || entry.Size != 20 {
+		t.Errorf("Find() = %v, %v, want entry with size 20", entry, ok)
+	}
+
+	if _, ok := manifest.Find("missing"); ok {
+		t.Error("Find() found a missing entry")
+	}
+}
@@ -1,22 +1,49 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Producer struct {
 	Id         uuid.UUID  `json:"id"`
 	UdpOptions UdpOptions `json:"udp_options"`
+	SecretHash []byte     `json:"secret_hash,omitempty"` // sha256 of the secret issued at registration
+	// sha256 of the client certificate the producer registered with over mutual TLS
+	CertFingerprint []byte    `json:"cert_fingerprint,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 func NewProducer(udpOptions UdpOptions) *Producer {
 	return &Producer{
 		Id:         uuid.New(),
 		UdpOptions: udpOptions,
+		CreatedAt:  time.Now(),
 	}
 }
 
 func (p *Producer) Clone() *Producer {
 	return &Producer{
-		Id:         p.Id,
-		UdpOptions: p.UdpOptions,
+		Id:              p.Id,
+		UdpOptions:      p.UdpOptions,
+		SecretHash:      append([]byte(nil), p.SecretHash...),
+		CertFingerprint: append([]byte(nil), p.CertFingerprint...),
+		CreatedAt:       p.CreatedAt,
+	}
+}
+
+// Presence describes the websocket connection of a producer to the signaller
+type Presence struct {
+	Online      bool      `json:"online"`
+	ConnectedAt time.Time `json:"connected_at,omitzero"` // start of the current connection
+	LastSeen    time.Time `json:"last_seen,omitzero"`    // last message, or the disconnect of an offline producer
+}
+
+// Uptime returns how long the producer has been connected, zero when offline
+func (p Presence) Uptime(now time.Time) time.Duration {
+	if !p.Online {
+		return 0
 	}
+	return now.Sub(p.ConnectedAt)
 }
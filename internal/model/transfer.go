@@ -2,6 +2,8 @@ package model
 
 import (
 	"math"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -15,55 +17,162 @@ const (
 	TransferStatusFailed           TransferStatus = "failed"
 	TransferStatusProducerAccepted TransferStatus = "producer_accepted"
 	TransferStatusProducerRejected TransferStatus = "producer_rejected"
+	TransferStatusQueued           TransferStatus = "queued"
 	TransferStatusDataSending      TransferStatus = "data_sending"
 	TransferStatusComplete         TransferStatus = "complete"
+	TransferStatusCancelled        TransferStatus = "cancelled"
+	TransferStatusPaused           TransferStatus = "paused"
 )
 
+// Finished reports whether the transfer reached a terminal state
+func (s TransferStatus) Finished() bool {
+	switch s {
+	case TransferStatusComplete, TransferStatusFailed, TransferStatusProducerRejected, TransferStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
 type RequestTransferStatus string
 
 const (
 	RequestTransferStatusAccepted RequestTransferStatus = "accepted"
 	RequestTransferStatusRejected RequestTransferStatus = "rejected"
+	RequestTransferStatusQueued   RequestTransferStatus = "queued"
 )
 
+// RejectReasonBusy is sent by a producer which has no free transfer slot and no room in its queue
+const RejectReasonBusy = "busy"
+
 type BlockStatus string
 
+// BlockRange is a half-open range [Start, End) of block numbers
+type BlockRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// Len returns the number of blocks in the range
+func (r BlockRange) Len() uint64 {
+	if r.End <= r.Start {
+		return 0
+	}
+	return r.End - r.Start
+}
+
+// Contains reports whether the block belongs to the range
+func (r BlockRange) Contains(block uint64) bool {
+	return block >= r.Start && block < r.End
+}
+
 type Transfer struct {
 	Id             uuid.UUID      `json:"id"`
 	FileMeta       *FileMeta      `json:"file_meta"`
+	Path           string         `json:"path,omitempty"` // manifest entry path for directory items
 	Consumer       *Consumer      `json:"consumer"`
 	Status         TransferStatus `json:"status"`
 	TotalBlocks    uint64         `json:"total_blocks"`
 	BlockSize      uint64         `json:"block_size"`
+	Range          BlockRange     `json:"range"` // blocks sent in this transfer
+	Compression    string         `json:"compression,omitempty"`
+	QueuePosition  int            `json:"queue_position,omitempty"` // position in the producer queue while queued
 	FailedBlocks   utils.BitArray `json:"failed_blocks"`
 	ReceivedBlocks utils.BitArray `json:"received_blocks"`
 	SentBlocks     utils.BitArray `json:"sent_blocks"`
+	// Received is the bitmap of blocks the consumer reported while the transfer was paused,
+	// bit i of byte i/8 is block i. Resumed transfers skip these blocks.
+	Received   []byte    `json:"received,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitzero"` // zero until the transfer reached a terminal state
 }
 
 type ProducerInitTransferRequestData struct {
+	TransferId         uuid.UUID  `json:"transfer_id"`
 	FileId             uuid.UUID  `json:"file_id"`
+	Path               string     `json:"path,omitempty"`
 	BlockSize          uint64     `json:"block_size"`
 	BlocksCount        uint64     `json:"blocks_count"`
+	Range              BlockRange `json:"range"` // blocks to send, the whole file unless a part was requested
 	ConsumerId         uuid.UUID  `json:"consumer_id"`
+	ConsumerName       string     `json:"consumer_name,omitempty"` // authenticated by the signaller, empty for unnamed consumers
 	ConsumerUdpOptions UdpOptions `json:"consumer_udp_options"`
+	ConsumerIp         string     `json:"consumer_ip,omitempty"` // address the signaller received the request from
+	Compression        []string   `json:"compression,omitempty"` // codecs accepted by consumer
+	MaxRate            uint64     `json:"max_rate,omitempty"`    // bytes per second the consumer wants to receive at most, 0 for unlimited
 }
 
 type ProducerInitTransferResponseData struct {
 	Status             RequestTransferStatus `json:"status"`
 	ProducerUdpOptions UdpOptions            `json:"producer_udp_options"`
+	Compression        string                `json:"compression,omitempty"`    // codec chosen by producer
+	QueuePosition      int                   `json:"queue_position,omitempty"` // set when the transfer is queued
+	Reason             string                `json:"reason,omitempty"`         // set when the transfer is rejected
+}
+
+// TransferStatusUpdate is sent by a producer when one of its transfers changes state
+type TransferStatusUpdate struct {
+	TransferId    uuid.UUID      `json:"transfer_id"`
+	Status        TransferStatus `json:"status"`
+	QueuePosition int            `json:"queue_position,omitempty"`
 }
 
-func NewTransfer(meta *FileMeta, consumer *Consumer, blockSize uint64) *Transfer {
-	blocks := uint64(math.Ceil(float64(meta.Size) / float64(blockSize)))
+// TransferEventType tells what happened to a transfer
+type TransferEventType string
+
+const (
+	TransferEventAccepted        TransferEventType = "accepted"         // the producer accepted the transfer
+	TransferEventRejected        TransferEventType = "rejected"         // the producer rejected the transfer
+	TransferEventQueued          TransferEventType = "queued"           // the transfer waits in the producer queue
+	TransferEventStatus          TransferEventType = "status"           // any other state change
+	TransferEventProducerAddress TransferEventType = "producer_address" // the producer is reachable on a new address
+	TransferEventCancelled       TransferEventType = "cancelled"        // the consumer or the producer cancelled the transfer
+	TransferEventPaused          TransferEventType = "paused"           // sending is suspended until the transfer is resumed
+	TransferEventResumed         TransferEventType = "resumed"          // sending continues after a pause
+)
+
+// TransferEvent is delivered to consumers following a transfer
+type TransferEvent struct {
+	TransferId         uuid.UUID         `json:"transfer_id"`
+	Type               TransferEventType `json:"type"`
+	Status             TransferStatus    `json:"status"`
+	QueuePosition      int               `json:"queue_position,omitempty"`
+	ProducerUdpOptions *UdpOptions       `json:"producer_udp_options,omitempty"` // set on accepted and producer_address
+	Reason             string            `json:"reason,omitempty"`               // set on rejected and cancelled
+}
+
+// BlocksCount returns the number of blocks needed to transfer size bytes
+func BlocksCount(size, blockSize uint64) uint64 {
+	return uint64(math.Ceil(float64(size) / float64(blockSize)))
+}
+
+// NewTransfer creates a transfer of size bytes. For directory items path
+// points to the manifest entry being transferred.
+func NewTransfer(meta *FileMeta, consumer *Consumer, path string, size, blockSize uint64) *Transfer {
+	blocks := BlocksCount(size, blockSize)
 	return &Transfer{
 		Id:          uuid.New(),
 		FileMeta:    meta,
+		Path:        path,
 		Consumer:    consumer,
 		Status:      TransferStatusCreated,
 		TotalBlocks: blocks,
 		BlockSize:   blockSize,
+		Range:       BlockRange{Start: 0, End: blocks},
 		// FailedBlocks:   utils.NewBitArray(blocks),
 		// ReceivedBlocks: utils.NewBitArray(blocks),
 		// SentBlocks:     utils.NewBitArray(blocks),
 	}
 }
+
+func (t *Transfer) Clone() *Transfer {
+	clone := *t
+	if t.FileMeta != nil {
+		clone.FileMeta = t.FileMeta.Clone()
+	}
+	if t.Consumer != nil {
+		consumer := *t.Consumer
+		clone.Consumer = &consumer
+	}
+	clone.Received = slices.Clone(t.Received)
+	return &clone
+}
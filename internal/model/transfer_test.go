@@ -0,0 +1,27 @@
+package model
+
+import "testing"
+
+func TestTransferStatus_Finished(t *testing.T) {
+	tests := []struct {
+		status TransferStatus
+		want   bool
+	}{
+		{status: TransferStatusCreated, want: false},
+		{status: TransferStatusProducerAccepted, want: false},
+		{status: TransferStatusQueued, want: false},
+		{status: TransferStatusDataSending, want: false},
+		{status: TransferStatusComplete, want: true},
+		{status: TransferStatusFailed, want: true},
+		{status: TransferStatusProducerRejected, want: true},
+		{status: TransferStatusCancelled, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			if got := tt.status.Finished(); got != tt.want {
+				t.Errorf("%s.Finished() = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Capabilities are the optional features a side of the connection supports
+type Capabilities struct {
+	Compression  []string `json:"compression,omitempty"`    // codecs in order of preference
+	Encryption   bool     `json:"encryption,omitempty"`     // encrypted UDP payloads
+	FEC          bool     `json:"fec,omitempty"`            // forward error correction of UDP blocks
+	MaxBlockSize uint64   `json:"max_block_size,omitempty"` // largest block in bytes, 0 for no limit
+	ConsumerIp   bool     `json:"consumer_ip,omitempty"`    // init_transfer carries the address the signaller saw the consumer at
+	Cancel       bool     `json:"cancel,omitempty"`         // cancel_transfer requests
+	Pause        bool     `json:"pause,omitempty"`          // pause_transfer and resume_transfer requests, the paused status
+}
+
+// UnmarshalJSON ignores capabilities it does not know. Newer peers announce features older ones
+// have never heard of, unlike other message fields this must not fail the handshake.
+func (c *Capabilities) UnmarshalJSON(data []byte) error {
+	type capabilities Capabilities // without the method, decoded by encoding/json allowing unknown fields
+	return json.Unmarshal(data, (*capabilities)(c))
+}
+
+// Intersect returns the capabilities supported by both sides, codecs keep the order of c
+func (c Capabilities) Intersect(other Capabilities) Capabilities {
+	result := Capabilities{
+		Encryption:   c.Encryption && other.Encryption,
+		FEC:          c.FEC && other.FEC,
+		MaxBlockSize: c.MaxBlockSize,
+		ConsumerIp:   c.ConsumerIp && other.ConsumerIp,
+		Cancel:       c.Cancel && other.Cancel,
+		Pause:        c.Pause && other.Pause,
+	}
+	if other.MaxBlockSize > 0 && (result.MaxBlockSize == 0 || other.MaxBlockSize < result.MaxBlockSize) {
+		result.MaxBlockSize = other.MaxBlockSize
+	}
+	for _, codec := range c.Compression {
+		if slices.Contains(other.Compression, codec) {
+			result.Compression = append(result.Compression, codec)
+		}
+	}
+	return result
+}
+
+// Supports reports whether a peer with these capabilities may be sent messages of the kind
+func (c Capabilities) Supports(kind string) bool {
+	switch kind {
+	case KindCancelTransfer:
+		return c.Cancel
+	case KindPauseTransfer, KindResumeTransfer:
+		return c.Pause
+	default:
+		return true
+	}
+}
+
+// Negotiate picks the highest version supported by both sides of the handshake
+func Negotiate(hello *Hello) (int, error) {
+	version := min(hello.MaxVersion, Version)
+	if version < max(hello.MinVersion, MinVersion) {
+		return 0, fmt.Errorf("%w: peer speaks %d-%d, supported %d-%d", ErrUnsupportedVersion,
+			hello.MinVersion, hello.MaxVersion, MinVersion, Version)
+	}
+	return version, nil
+}
+
+// NewHello returns the hello offering every version of this build
+func NewHello(capabilities Capabilities) *Hello {
+	return &Hello{
+		MinVersion:   MinVersion,
+		MaxVersion:   Version,
+		Capabilities: capabilities,
+	}
+}
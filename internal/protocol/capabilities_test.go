@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCapabilities_Intersect(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     Capabilities
+		other Capabilities
+		want  Capabilities
+	}{
+		{
+			name:  "nothing in common",
+			c:     Capabilities{Compression: []string{"zstd"}, Encryption: true, ConsumerIp: true},
+			other: Capabilities{Compression: []string{"flate"}, FEC: true},
+			want:  Capabilities{},
+		},
+		{
+			name:  "codecs keep own order",
+			c:     Capabilities{Compression: []string{"zstd", "flate"}},
+			other: Capabilities{Compression: []string{"flate", "zstd"}},
+			want:  Capabilities{Compression: []string{"zstd", "flate"}},
+		},
+		{
+			name:  "both features",
+			c:     Capabilities{Encryption: true, FEC: true, ConsumerIp: true},
+			other: Capabilities{Encryption: true, FEC: true, ConsumerIp: true},
+			want:  Capabilities{Encryption: true, FEC: true, ConsumerIp: true},
+		},
+		{
+			name:  "smaller block size",
+			c:     Capabilities{MaxBlockSize: 4096},
+			other: Capabilities{MaxBlockSize: 1024},
+			want:  Capabilities{MaxBlockSize: 1024},
+		},
+		{
+			name:  "unlimited block size",
+			c:     Capabilities{},
+			other: Capabilities{MaxBlockSize: 1024},
+			want:  Capabilities{MaxBlockSize: 1024},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Intersect(tt.other); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Intersect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapabilities_Supports(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities Capabilities
+		kind         string
+		want         bool
+	}{
+		{"cancel supported", Capabilities{Cancel: true}, KindCancelTransfer, true},
+		{"cancel of an older producer", Capabilities{}, KindCancelTransfer, false},
+		{"pause supported", Capabilities{Pause: true}, KindPauseTransfer, true},
+		{"resume of an older producer", Capabilities{Cancel: true}, KindResumeTransfer, false},
+		{"kinds every version knows", Capabilities{}, KindInitTransfer, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.capabilities.Supports(tt.kind); got != tt.want {
+				t.Errorf("Supports(%s) = %v, want %v", tt.kind, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hello   Hello
+		want    int
+		wantErr bool
+	}{
+		{"same version", Hello{MinVersion: 1, MaxVersion: 1}, 1, false},
+		{"newer peer", Hello{MinVersion: 1, MaxVersion: Version + 2}, Version, false},
+		{"peer too new", Hello{MinVersion: Version + 1, MaxVersion: Version + 2}, 0, true},
+		{"peer too old", Hello{MinVersion: 0, MaxVersion: MinVersion - 1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Negotiate(&tt.hello)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Negotiate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnsupportedVersion) {
+				t.Errorf("Negotiate() error = %v, want %v", err, ErrUnsupportedVersion)
+			}
+			if got != tt.want {
+				t.Errorf("Negotiate() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+)
+
+// Message kinds
+const (
+	KindHello              = "hello"                // producer -> signaller, first message of a connection
+	KindWelcome            = "welcome"              // signaller -> producer, accepts the hello
+	KindError              = "error"                // either way, a failed request or a refused handshake
+	KindInitTransfer       = "init_transfer"        // signaller -> producer request
+	KindInitTransferResult = "init_transfer_result" // producer -> signaller response
+	KindTransferStatus     = "transfer_status"      // producer -> signaller
+	KindSubscribe          = "subscribe"            // consumer -> signaller request, answered with a transfer_event
+	KindUnsubscribe        = "unsubscribe"          // consumer -> signaller
+	KindTransferEvent      = "transfer_event"       // signaller -> consumer
+	KindCancelTransfer     = "cancel_transfer"      // signaller -> producer request, answered with a transfer_status
+	KindPauseTransfer      = "pause_transfer"       // signaller -> producer request, answered with a transfer_status
+	KindResumeTransfer     = "resume_transfer"      // signaller -> producer request, answered with a transfer_status
+)
+
+// Error codes
+const (
+	CodeBadMessage         = "bad_message"
+	CodeUnknownKind        = "unknown_kind"
+	CodeUnsupportedVersion = "unsupported_version"
+	CodeHandshakeRequired  = "handshake_required"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict" // the request does not apply to the current state, e.g. pausing a queued transfer
+	CodeInternal           = "internal"
+)
+
+func init() {
+	Register(KindHello, func() Message { return &Hello{} })
+	Register(KindWelcome, func() Message { return &Welcome{} })
+	Register(KindError, func() Message { return &Error{} })
+	Register(KindInitTransfer, func() Message { return &InitTransfer{} })
+	Register(KindInitTransferResult, func() Message { return &InitTransferResult{} })
+	Register(KindTransferStatus, func() Message { return &TransferStatus{} })
+	Register(KindSubscribe, func() Message { return &Subscribe{} })
+	Register(KindUnsubscribe, func() Message { return &Unsubscribe{} })
+	Register(KindTransferEvent, func() Message { return &TransferEvent{} })
+	Register(KindCancelTransfer, func() Message { return &CancelTransfer{} })
+	Register(KindPauseTransfer, func() Message { return &PauseTransfer{} })
+	Register(KindResumeTransfer, func() Message { return &ResumeTransfer{} })
+}
+
+// Hello opens the handshake with the versions and capabilities of the producer
+type Hello struct {
+	MinVersion   int          `json:"min_version"`
+	MaxVersion   int          `json:"max_version"`
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+func (*Hello) Kind() string { return KindHello }
+
+// Welcome completes the handshake with the version used on the connection
+// and the capabilities both sides support
+type Welcome struct {
+	Version      int          `json:"version"`
+	Capabilities Capabilities `json:"capabilities"`
+	SessionId    string       `json:"session_id,omitempty"` // consumer connections, transfers started with it are followed
+}
+
+func (*Welcome) Kind() string { return KindWelcome }
+
+// Error answers a request which could not be handled
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (*Error) Kind() string { return KindError }
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// InitTransfer asks the producer to send a file to a consumer
+type InitTransfer model.ProducerInitTransferRequestData
+
+func (*InitTransfer) Kind() string { return KindInitTransfer }
+
+// InitTransferResult tells whether the producer accepted, queued or rejected a transfer
+type InitTransferResult model.ProducerInitTransferResponseData
+
+func (*InitTransferResult) Kind() string { return KindInitTransferResult }
+
+// TransferStatus reports a state change of a transfer
+type TransferStatus model.TransferStatusUpdate
+
+func (*TransferStatus) Kind() string { return KindTransferStatus }
+
+// Subscribe asks for the events of a transfer
+type Subscribe struct {
+	TransferId uuid.UUID `json:"transfer_id"`
+}
+
+func (*Subscribe) Kind() string { return KindSubscribe }
+
+// Unsubscribe stops the events of a transfer
+type Unsubscribe struct {
+	TransferId uuid.UUID `json:"transfer_id"`
+}
+
+func (*Unsubscribe) Kind() string { return KindUnsubscribe }
+
+// TransferEvent tells a consumer what happened to a transfer it follows
+type TransferEvent model.TransferEvent
+
+func (*TransferEvent) Kind() string { return KindTransferEvent }
+
+// CancelTransfer asks the producer to stop a running or queued transfer
+type CancelTransfer struct {
+	TransferId uuid.UUID `json:"transfer_id"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+func (*CancelTransfer) Kind() string { return KindCancelTransfer }
+
+// PauseTransfer asks the producer to suspend sending a running transfer
+type PauseTransfer struct {
+	TransferId uuid.UUID `json:"transfer_id"`
+}
+
+func (*PauseTransfer) Kind() string { return KindPauseTransfer }
+
+// ResumeTransfer continues a paused transfer. Received is the bitmap of blocks the consumer
+// already has, when set the producer sends the missing blocks of the range from its start.
+type ResumeTransfer struct {
+	TransferId uuid.UUID `json:"transfer_id"`
+	Received   []byte    `json:"received,omitempty"`
+}
+
+func (*ResumeTransfer) Kind() string { return KindResumeTransfer }
@@ -0,0 +1,112 @@
+// Package protocol defines the messages exchanged between the signaller and producers over websocket.
+//
+// Every message is an Envelope carrying the protocol version, the kind of the message and its data.
+// Kinds are registered with their data type, so both sides decode messages into typed values.
+// Decoding is strict: unknown kinds, unknown fields and unsupported versions are rejected,
+// except for unknown capabilities which are ignored so newer peers can still connect.
+// Features are rolled out behind capabilities exchanged in the hello handshake, a peer only
+// receives fields and kinds it announced support for.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Protocol versions spoken by this build
+const (
+	Version    = 1 // current version, offered in the handshake
+	MinVersion = 1 // oldest version still accepted
+)
+
+var (
+	// ErrUnknownKind is returned when decoding a message of a kind which is not registered
+	ErrUnknownKind = errors.New("unknown message kind")
+	// ErrUnsupportedVersion is returned for messages and handshakes of a version outside [MinVersion, Version]
+	ErrUnsupportedVersion = errors.New("unsupported protocol version")
+)
+
+// Message is the data of an envelope
+type Message interface {
+	Kind() string
+}
+
+// Envelope wraps every message sent over the websocket
+type Envelope struct {
+	Version   int             `json:"v"`
+	Kind      string          `json:"type"`
+	RequestId string          `json:"request_id,omitempty"` // set on requests expecting a response and on the response
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() Message)
+)
+
+// Register makes a kind decodable, newMessage returns a pointer to an empty message of the kind
+func Register(kind string, newMessage func() Message) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[kind]; exists {
+		panic(fmt.Sprintf("protocol: message kind %q registered twice", kind))
+	}
+	registry[kind] = newMessage
+}
+
+// Encode wraps a message into an envelope of the current version
+func Encode(requestId string, message Message) ([]byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", message.Kind(), err)
+	}
+	return json.Marshal(Envelope{
+		Version:   Version,
+		Kind:      message.Kind(),
+		RequestId: requestId,
+		Data:      data,
+	})
+}
+
+// Decode parses an envelope and its typed message. The envelope is returned
+// whenever it could be parsed, so the sender of a bad request can be answered.
+func Decode(data []byte) (*Envelope, Message, error) {
+	var envelope Envelope
+	if err := decodeStrict(data, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	if envelope.Version < MinVersion || envelope.Version > Version {
+		return &envelope, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, envelope.Version)
+	}
+
+	registryMu.RLock()
+	newMessage, exists := registry[envelope.Kind]
+	registryMu.RUnlock()
+	if !exists {
+		return &envelope, nil, fmt.Errorf("%w: %q", ErrUnknownKind, envelope.Kind)
+	}
+
+	message := newMessage()
+	if len(envelope.Data) > 0 {
+		if err := decodeStrict(envelope.Data, message); err != nil {
+			return &envelope, nil, fmt.Errorf("invalid %s data: %w", envelope.Kind, err)
+		}
+	}
+	return &envelope, message, nil
+}
+
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after message")
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	status := &TransferStatus{
+		TransferId:    uuid.New(),
+		Status:        model.TransferStatusQueued,
+		QueuePosition: 2,
+	}
+
+	data, err := Encode("request-1", status)
+	if err != nil {
+		t.Fatalf("Encode() error: %v", err)
+	}
+	envelope, message, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error: %v", err)
+	}
+	if envelope.Version != Version || envelope.Kind != KindTransferStatus || envelope.RequestId != "request-1" {
+		t.Errorf("Decode() envelope = %+v", envelope)
+	}
+	if !reflect.DeepEqual(message, status) {
+		t.Errorf("Decode() message = %+v, want %+v", message, status)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         string
+		valid        bool
+		wantErr      error
+		wantEnvelope bool
+	}{
+		{
+			name:  "hello",
+			data:  `{"v":1,"type":"hello","data":{"min_version":1,"max_version":1,"capabilities":{}}}`,
+			valid: true,
+		},
+		{
+			name: "hello with an unknown capability",
+			data: `{"v":1,"type":"hello","data":{"min_version":1,"max_version":1,` +
+				`"capabilities":{"cancel":true,"new_feature":true}}}`,
+			valid: true,
+		},
+		{
+			name:  "welcome with an unknown capability",
+			data:  `{"v":1,"type":"welcome","data":{"version":1,"capabilities":{"pause":true,"new_feature":{"x":1}}}}`,
+			valid: true,
+		},
+		{
+			name:         "unknown field next to capabilities",
+			data:         `{"v":1,"type":"hello","data":{"min_version":1,"max_version":1,"capabilities":{},"extra":1}}`,
+			wantEnvelope: true,
+		},
+		{
+			name:         "unknown kind",
+			data:         `{"v":1,"type":"teleport","request_id":"r"}`,
+			wantErr:      ErrUnknownKind,
+			wantEnvelope: true,
+		},
+		{
+			name:         "future version",
+			data:         `{"v":99,"type":"hello"}`,
+			wantErr:      ErrUnsupportedVersion,
+			wantEnvelope: true,
+		},
+		{
+			name:         "missing version",
+			data:         `{"type":"hello"}`,
+			wantErr:      ErrUnsupportedVersion,
+			wantEnvelope: true,
+		},
+		{
+			name: "unknown envelope field",
+			data: `{"v":1,"type":"hello","extra":true}`,
+		},
+		{
+			name:         "unknown data field",
+			data:         `{"v":1,"type":"error","data":{"code":"x","message":"y","details":1}}`,
+			wantEnvelope: true,
+		},
+		{
+			name: "trailing data",
+			data: `{"v":1,"type":"hello"}{}`,
+		},
+		{
+			name: "not json",
+			data: `init_transfer`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope, message, err := Decode([]byte(tt.data))
+			if tt.valid {
+				if err != nil || message == nil {
+					t.Fatalf("Decode() = %v, %v", message, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Decode() error = nil, message %+v", message)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode() error = %v, want %v", err, tt.wantErr)
+			}
+			if (envelope != nil) != tt.wantEnvelope {
+				t.Errorf("Decode() envelope = %+v, want envelope %v", envelope, tt.wantEnvelope)
+			}
+		})
+	}
+}
+
+func TestDecode_UnknownCapability(t *testing.T) {
+	data := `{"v":1,"type":"hello","data":{"min_version":1,"max_version":1,` +
+		`"capabilities":{"cancel":true,"new_feature":true}}}`
+	_, message, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	hello, ok := message.(*Hello)
+	if !ok {
+		t.Fatalf("Decode() message = %T, want *Hello", message)
+	}
+	if want := (Capabilities{Cancel: true}); !reflect.DeepEqual(hello.Capabilities, want) {
+		t.Errorf("capabilities = %+v, want %+v", hello.Capabilities, want)
+	}
+}
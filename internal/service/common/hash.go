@@ -0,0 +1,39 @@
+package common
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// HashFile returns the sha256 of the file content
+func HashFile(filePath string) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", filePath, err)
+	}
+
+	return hasher.Sum(nil), nil
+}
+
+// VerifyFile checks that the file content matches the expected sha256
+func VerifyFile(filePath string, expected []byte) error {
+	actual, err := HashFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(actual, expected) {
+		return fmt.Errorf("hash mismatch for %s", filePath)
+	}
+
+	return nil
+}
@@ -3,38 +3,42 @@ package consumer
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 
+	"udpie/internal/client"
 	"udpie/internal/handler"
-	"udpie/internal/model"
 	"udpie/internal/model/contract"
 )
 
 type ConsumerService struct {
 	signallerURL string
+	token        string // consumer token configured on the signaller
 	client       *http.Client
+	tlsConfig    *tls.Config // nil uses system roots for wss://
 }
 
-func NewConsumerService(signallerURL string) *ConsumerService {
+func NewConsumerService(signallerURL, token string, tlsConfig *tls.Config) *ConsumerService {
 	return &ConsumerService{
 		signallerURL: signallerURL,
-		client:       &http.Client{},
+		token:        token,
+		client:       client.NewHTTPClient(tlsConfig),
+		tlsConfig:    tlsConfig,
 	}
 }
 
-// InitDownload initiates a file download and returns transfer info
-func (s *ConsumerService) InitDownload(fileId uuid.UUID, udpOptions model.UdpOptions) (*contract.InitTransferResult, error) {
-	reqBody := &handler.InitDownloadRequest{
-		Id:               fileId,
-		ClientUdpOptions: udpOptions,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
+// InitDownload initiates a file download and returns transfer info.
+// For directory items request.Path selects the manifest entry to download,
+// request.Range selects a part of the file.
+func (s *ConsumerService) InitDownload(request *handler.InitDownloadRequest) (*contract.InitTransferResult, error) {
+	jsonData, err := json.Marshal(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -44,6 +48,7 @@ func (s *ConsumerService) InitDownload(fileId uuid.UUID, udpOptions model.UdpOpt
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	s.authorize(req)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -53,7 +58,7 @@ func (s *ConsumerService) InitDownload(fileId uuid.UUID, udpOptions model.UdpOpt
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		return nil, initDownloadError(resp.StatusCode, body)
 	}
 
 	var result contract.InitTransferResult
@@ -63,3 +68,302 @@ func (s *ConsumerService) InitDownload(fileId uuid.UUID, udpOptions model.UdpOpt
 
 	return &result, nil
 }
+
+// initDownloadError wraps the contract errors the signaller reports with an error code
+func initDownloadError(status int, body []byte) error {
+	var response struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	if json.Unmarshal(body, &response) == nil {
+		switch response.Code {
+		case handler.ErrorCodeProducerBusy:
+			return fmt.Errorf("server returned status %d: %w", status, contract.ErrProducerBusy)
+		case handler.ErrorCodeProducerOffline:
+			return fmt.Errorf("server returned status %d: %w", status, contract.ErrProducerOffline)
+		}
+	}
+	return fmt.Errorf("server returned status %d: %s", status, string(body))
+}
+
+// GetManifest returns the name, size and manifest of a registered item.
+// The manifest is nil for single files.
+func (s *ConsumerService) GetManifest(fileId uuid.UUID) (*handler.FileManifestResponse, error) {
+	url := fmt.Sprintf("%s/api/files/%s/manifest", s.signallerURL, fileId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result handler.FileManifestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// GetSources returns files with the same content as the given one, each served by its own producer
+func (s *ConsumerService) GetSources(fileId uuid.UUID) ([]handler.FileSourceResponse, error) {
+	url := fmt.Sprintf("%s/api/files/%s/sources", s.signallerURL, fileId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result []handler.FileSourceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetTransfer returns the transfer status known to the signaller, including the queue position
+func (s *ConsumerService) GetTransfer(transferId uuid.UUID) (*handler.TransferStatusResponse, error) {
+	url := fmt.Sprintf("%s/api/transfers/%s", s.signallerURL, transferId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result handler.TransferStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// WatchTransfer polls the signaller every interval while the transfer is received and stops
+// receiving once the signaller reports it ended, e.g. cancelled by the producer
+func (s *ConsumerService) WatchTransfer(ctx context.Context, transfer *ActiveTransfer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-transfer.DoneChan:
+			return
+		case <-ticker.C:
+		}
+
+		status, err := s.GetTransfer(transfer.TransferId)
+		if err != nil {
+			transfer.logger().WithError(err).Debug("Failed to get transfer status")
+			continue
+		}
+		if transfer.Finish(status.Status) {
+			return
+		}
+	}
+}
+
+// CancelTransfer asks the signaller to record the transfer as cancelled and stop its producer
+func (s *ConsumerService) CancelTransfer(transferId uuid.UUID, reason string) error {
+	jsonData, err := json.Marshal(handler.CancelTransferRequest{Reason: reason})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/transfers/%s/cancel", s.signallerURL, transferId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// PauseTransfer asks the signaller to suspend the producer sending the transfer
+func (s *ConsumerService) PauseTransfer(transferId uuid.UUID) error {
+	return s.controlTransfer(transferId, "pause")
+}
+
+// ResumeTransfer asks the signaller to continue a paused transfer
+func (s *ConsumerService) ResumeTransfer(transferId uuid.UUID) error {
+	return s.controlTransfer(transferId, "resume")
+}
+
+func (s *ConsumerService) controlTransfer(transferId uuid.UUID, action string) error {
+	url := fmt.Sprintf("%s/api/transfers/%s/%s", s.signallerURL, transferId.String(), action)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// ReportReceived uploads the bitmap of received blocks, the producer skips them when the transfer resumes
+func (s *ConsumerService) ReportReceived(transferId uuid.UUID, received []byte) error {
+	jsonData, err := json.Marshal(handler.ReportReceivedRequest{Received: received})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/transfers/%s/received", s.signallerURL, transferId.String())
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	s.authorize(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (s *ConsumerService) authorize(req *http.Request) {
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+}
+
+// ListFiles returns a page of registered files matching the options
+func (s *ConsumerService) ListFiles(options contract.ListFilesOptions) (*handler.FileListResponse, error) {
+	url := fmt.Sprintf("%s/api/files", s.signallerURL)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	query := req.URL.Query()
+	if options.ProducerId != uuid.Nil {
+		query.Set("producer_id", options.ProducerId.String())
+	}
+	if options.Name != "" {
+		query.Set("name", options.Name)
+	}
+	if options.MinSize > 0 {
+		query.Set("min_size", strconv.FormatUint(options.MinSize, 10))
+	}
+	if options.MaxSize > 0 {
+		query.Set("max_size", strconv.FormatUint(options.MaxSize, 10))
+	}
+	if options.Online != nil {
+		query.Set("online", strconv.FormatBool(*options.Online))
+	}
+	setPage(query, options.Offset, options.Limit)
+	req.URL.RawQuery = query.Encode()
+
+	var result handler.FileListResponse
+	if err := s.getJSON(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListProducers returns a page of registered producers
+func (s *ConsumerService) ListProducers(options contract.ListProducersOptions) (*handler.ProducerListResponse, error) {
+	url := fmt.Sprintf("%s/api/producers", s.signallerURL)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	query := req.URL.Query()
+	if options.Online != nil {
+		query.Set("online", strconv.FormatBool(*options.Online))
+	}
+	setPage(query, options.Offset, options.Limit)
+	req.URL.RawQuery = query.Encode()
+
+	var result handler.ProducerListResponse
+	if err := s.getJSON(req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func setPage(query map[string][]string, offset, limit int) {
+	if offset > 0 {
+		query["offset"] = []string{strconv.Itoa(offset)}
+	}
+	if limit > 0 {
+		query["limit"] = []string{strconv.Itoa(limit)}
+	}
+}
+
+func (s *ConsumerService) getJSON(req *http.Request, result any) error {
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/handler"
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+)
+
+func TestInitDownloadError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want error
+	}{
+		{
+			name: "offline",
+			body: `{"error":"producer is offline","code":"producer_offline"}`,
+			want: contract.ErrProducerOffline,
+		},
+		{
+			name: "busy",
+			body: `{"error":"producer is busy","code":"producer_busy"}`,
+			want: contract.ErrProducerBusy,
+		},
+		{
+			name: "no code",
+			body: `{"error":"file not found"}`,
+		},
+		{
+			name: "plain text",
+			body: "Failed to init download",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := initDownloadError(503, []byte(tt.body))
+			if err == nil {
+				t.Fatal("initDownloadError() = nil")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("initDownloadError() = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && (errors.Is(err, contract.ErrProducerOffline) || errors.Is(err, contract.ErrProducerBusy)) {
+				t.Errorf("initDownloadError() = %v, want no contract error", err)
+			}
+		})
+	}
+}
+
+func TestConsumerService_WatchTransfer(t *testing.T) {
+	tests := []struct {
+		name   string
+		status model.TransferStatus
+		want   string
+	}{
+		{name: "cancelled by the producer", status: model.TransferStatusCancelled, want: "cancelled"},
+		{name: "failed", status: model.TransferStatusFailed, want: "failed"},
+		{name: "complete with blocks lost", status: model.TransferStatusComplete, want: "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The producer never sends anything, its cancel packet got lost
+			producerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatalf("ListenUDP() unexpected error: %v", err)
+			}
+			defer producerConn.Close()
+
+			signaller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(handler.TransferStatusResponse{Status: tt.status})
+			}))
+			defer signaller.Close()
+
+			transferId := uuid.New()
+			transferService := NewTransferService()
+			doneChan, err := transferService.StartRangeTransfer(context.Background(), transferId, 1024, 4,
+				model.BlockRange{Start: 0, End: 4}, producerConn.LocalAddr().(*net.UDPAddr), "",
+				func(uint64, []byte) {})
+			if err != nil {
+				t.Fatalf("StartRangeTransfer() unexpected error: %v", err)
+			}
+			transfer, _ := transferService.GetTransferStatus(transferId)
+
+			consumerService := NewConsumerService(signaller.URL, "", nil)
+			go consumerService.WatchTransfer(context.Background(), transfer, 10*time.Millisecond)
+
+			select {
+			case <-doneChan:
+			case <-time.After(5 * time.Second):
+				t.Fatal("receiving did not stop")
+			}
+			if status := transfer.GetStatus(); status != tt.want {
+				t.Errorf("status = %q, want %q", status, tt.want)
+			}
+		})
+	}
+}
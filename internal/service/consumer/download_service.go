@@ -2,31 +2,57 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 
 	"udpie/internal/client"
+	"udpie/internal/metrics"
+	"udpie/internal/model"
+	"udpie/pkg/logutils"
+	"udpie/utils"
 )
 
+// completeDrainDelay is how long blocks sent last may take to arrive after the producer reported
+// the transfer complete
+const completeDrainDelay = time.Second
+
+// ErrNotReceiving is returned when asking for blocks of a transfer which is not receiving
+var ErrNotReceiving = errors.New("transfer is not receiving")
+
 type TransferService struct {
 	mu        sync.RWMutex
 	transfers map[uuid.UUID]*ActiveTransfer
 }
 
+// BlockHandler receives blocks of range transfers instead of storing them in memory
+type BlockHandler func(blockNum uint64, data []byte)
+
 type ActiveTransfer struct {
 	TransferId        uuid.UUID
-	FilePath          string
+	FilePath          string // empty for range transfers delivering blocks to a handler
 	BlockSize         uint64
 	TotalBlocks       uint64
+	Range             model.BlockRange
 	ProducerAddr      *net.UDPAddr
 	TransferStartTime time.Time
+	Compression       string
 	Status            string
 	ReceivedBlocks    map[uint64][]byte
+	ReceivedCount     uint64
+	DataBytes         uint64 // block bytes after decompression
+	WireBytes         uint64 // payload bytes as received
+	received          utils.BitArray
+	blockHandler      BlockHandler
+	conn              *net.UDPConn // receiving socket, nil until receiving starts and after it ends
+	stop              context.CancelFunc
+	finished          string // status the signaller reported the transfer ended with, empty while it runs
 	mu                sync.Mutex
 	DoneChan          chan struct{}
 }
@@ -45,22 +71,57 @@ func (s *TransferService) StartTransfer(
 	blockSize uint64,
 	totalBlocks uint64,
 	producerAddr *net.UDPAddr,
+	compression string,
+) (chan struct{}, error) {
+	return s.start(ctx, &ActiveTransfer{
+		TransferId:   transferId,
+		FilePath:     filePath,
+		BlockSize:    blockSize,
+		TotalBlocks:  totalBlocks,
+		Range:        model.BlockRange{Start: 0, End: totalBlocks},
+		ProducerAddr: producerAddr,
+		Compression:  compression,
+	})
+}
+
+// StartRangeTransfer starts receiving a block range of a file. Blocks are passed to
+// the handler as they arrive, nothing is written to disk by the transfer itself.
+func (s *TransferService) StartRangeTransfer(
+	ctx context.Context,
+	transferId uuid.UUID,
+	blockSize uint64,
+	totalBlocks uint64,
+	blockRange model.BlockRange,
+	producerAddr *net.UDPAddr,
+	compression string,
+	handler BlockHandler,
 ) (chan struct{}, error) {
-	// Create active transfer
-	transfer := &ActiveTransfer{
-		TransferId:        transferId,
-		FilePath:          filePath,
-		BlockSize:         blockSize,
-		TotalBlocks:       totalBlocks,
-		ProducerAddr:      producerAddr,
-		TransferStartTime: time.Now(),
-		Status:            "receiving",
-		ReceivedBlocks:    make(map[uint64][]byte),
-		DoneChan:          make(chan struct{}),
+	return s.start(ctx, &ActiveTransfer{
+		TransferId:   transferId,
+		BlockSize:    blockSize,
+		TotalBlocks:  totalBlocks,
+		Range:        blockRange,
+		ProducerAddr: producerAddr,
+		Compression:  compression,
+		blockHandler: handler,
+	})
+}
+
+func (s *TransferService) start(ctx context.Context, transfer *ActiveTransfer) (chan struct{}, error) {
+	codec, err := client.NewCodec(transfer.Compression)
+	if err != nil {
+		return nil, err
 	}
 
+	transfer.TransferStartTime = time.Now()
+	transfer.Status = "receiving"
+	transfer.ReceivedBlocks = make(map[uint64][]byte)
+	transfer.received = utils.NewBitArray(transfer.TotalBlocks)
+	transfer.DoneChan = make(chan struct{})
+	ctx, transfer.stop = context.WithCancel(ctx)
+
 	s.mu.Lock()
-	s.transfers[transferId] = transfer
+	s.transfers[transfer.TransferId] = transfer
 	s.mu.Unlock()
 
 	// pinger
@@ -69,6 +130,8 @@ func (s *TransferService) StartTransfer(
 			select {
 			case <-ctx.Done():
 				return
+			case <-transfer.DoneChan:
+				return
 			default:
 			}
 			time.Sleep(1 * time.Second)
@@ -76,7 +139,7 @@ func (s *TransferService) StartTransfer(
 		}
 	}()
 	// Start receiving in goroutine
-	go s.receiveFile(ctx, transfer)
+	go s.receiveFile(ctx, transfer, codec)
 
 	return transfer.DoneChan, nil
 }
@@ -84,14 +147,14 @@ func (s *TransferService) StartTransfer(
 func ping(transfer *ActiveTransfer) {
 	conn, err := net.DialUDP("udp", nil, transfer.ProducerAddr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error pinging producer: %v\n", err)
+		transfer.logger().WithError(err).Warn("Failed to ping producer")
 		return
 	}
 
 	defer conn.Close()
 
 	pack := client.UdpPacket{
-		ContentType:  0x02, // Ping packet
+		ContentType:  client.ContentTypePing,
 		SerialNumber: 0,
 		TransferId:   transfer.TransferId,
 		Timestamp:    time.Now(),
@@ -99,48 +162,66 @@ func ping(transfer *ActiveTransfer) {
 	}
 	packData, err := pack.Marshal(transfer.TransferStartTime)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error marshaling ping packet: %v\n", err)
+		transfer.logger().WithError(err).Warn("Failed to marshal ping packet")
 		return
 	}
 	if _, err := conn.Write(packData); err != nil {
-		fmt.Fprintf(os.Stderr, "Error sending ping packet: %v\n", err)
+		transfer.logger().WithError(err).Warn("Failed to send ping packet")
 		return
 	}
 
 }
 
 // nolint:gocyclo,funlen // complex transfer logic with multiple error handling paths
-func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTransfer) {
+func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTransfer, codec client.Codec) {
 	defer close(transfer.DoneChan)
+	defer transfer.stop()
+	metrics.ActiveDownloads.Inc()
+	defer metrics.ActiveDownloads.Dec()
 	// Create UDP connection to listen for packets
 	localAddr := &net.UDPAddr{IP: net.IPv4zero, Port: 0}
 	conn, err := net.ListenUDP("udp", localAddr)
 	if err != nil {
-		fmt.Printf("Error creating UDP listener: %v\n", err)
+		transfer.logger().WithError(err).Error("Failed to create UDP listener")
 		transfer.mu.Lock()
 		transfer.Status = "failed"
 		transfer.mu.Unlock()
 		return
 	}
 	defer conn.Close()
+	transfer.mu.Lock()
+	transfer.conn = conn
+	transfer.mu.Unlock()
+	defer func() {
+		transfer.mu.Lock()
+		transfer.conn = nil
+		transfer.mu.Unlock()
+	}()
+
+	// Cancelling interrupts the read waiting for the next packet
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetReadDeadline(time.Now()) })
+	defer stop()
 
 	transferStartTime := time.Now()
 	const maxUDPPacketSize = 65507 // Max UDP packet size
 	buffer := make([]byte, maxUDPPacketSize)
 
-	fmt.Printf("Starting file download: %s\n", transfer.FilePath)
-	fmt.Printf("Transfer ID: %s\n", transfer.TransferId.String())
-	fmt.Printf("Total blocks: %d\n", transfer.TotalBlocks)
-	fmt.Printf("Block size: %d bytes\n", transfer.BlockSize)
-	fmt.Printf("Producer: %s\n", transfer.ProducerAddr.String())
-	fmt.Printf("Listening on: %s\n", conn.LocalAddr().String())
+	transfer.logger().WithFields(logutils.Fields{
+		"path":         transfer.FilePath,
+		"total_blocks": transfer.TotalBlocks,
+		"range_start":  transfer.Range.Start,
+		"range_end":    transfer.Range.End,
+		"block_size":   transfer.BlockSize,
+		"producer":     transfer.ProducerAddr.String(),
+		"local":        conn.LocalAddr().String(),
+	}).Info("Starting file download")
 
 	// Receive packets
-	receivedCount := 0
-	for {
+	expected := transfer.Range.Len()
+	for transfer.GetReceivedCount() < expected {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("Transfer canceled: %s\n", transfer.TransferId.String())
+			cancelTransfer(conn, transfer)
 			return
 		default:
 		}
@@ -148,38 +229,19 @@ func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTrans
 		// Set read deadline
 		const readTimeout = 5 * time.Second
 		if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
-			fmt.Printf("Error setting read deadline: %v\n", err)
+			transfer.logger().WithError(err).Warn("Failed to set read deadline")
 			continue
 		}
 
 		n, addr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
-			// Check if we've received all blocks
-			transfer.mu.Lock()
-			currentReceivedCount := len(transfer.ReceivedBlocks)
-			transfer.mu.Unlock()
-
-			// nolint:gosec // TotalBlocks is controlled by the protocol and safe to convert
-			if currentReceivedCount >= int(transfer.TotalBlocks) {
-				break
-			}
-
-			// Check if timeout (expected when no more packets)
+			// Check if timeout (expected when no more packets), continue waiting for more packets
 			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				// Check if we should continue waiting
-				transfer.mu.Lock()
-				received := len(transfer.ReceivedBlocks)
-				transfer.mu.Unlock()
-
-				// nolint:gosec // TotalBlocks is controlled by the protocol and safe to convert
-				if received >= int(transfer.TotalBlocks) {
-					break
-				}
-				// Continue waiting for more packets
 				continue
 			}
 
-			fmt.Printf("Error reading UDP packet: %v\n", err)
+			transfer.logger().WithError(err).Warn("Failed to read UDP packet")
+			metrics.ReceiveErrors.Inc()
 			continue
 		}
 
@@ -192,7 +254,8 @@ func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTrans
 		// Parse UDP packet
 		packet := &client.UdpPacket{}
 		if err := packet.Unmarshal(buffer[:n], transferStartTime); err != nil {
-			fmt.Printf("Error unmarshaling packet: %v\n", err)
+			transfer.logger().WithError(err).Warn("Failed to unmarshal packet")
+			metrics.ReceiveErrors.Inc()
 			continue
 		}
 
@@ -201,27 +264,75 @@ func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTrans
 			continue
 		}
 
+		if packet.Kind() == client.ContentTypeCancel {
+			transfer.logger().Info("Producer cancelled transfer")
+			transfer.mu.Lock()
+			transfer.Status = "cancelled"
+			transfer.mu.Unlock()
+			return
+		}
+
+		if packet.Kind() != client.ContentTypeData || !transfer.Range.Contains(packet.SerialNumber) {
+			continue
+		}
+
+		wireSize := len(packet.Data)
+		if packet.Compressed() {
+			if codec == nil {
+				transfer.logger().WithField("block", packet.SerialNumber).
+					Warn("Dropping compressed block, compression was not negotiated")
+				metrics.ReceiveErrors.Inc()
+				continue
+			}
+			data, err := codec.Decompress(packet.Data, transfer.BlockSize)
+			if err != nil {
+				transfer.logger().WithField("block", packet.SerialNumber).WithError(err).Warn("Failed to decompress block")
+				metrics.ReceiveErrors.Inc()
+				continue
+			}
+			packet.Data = data
+		}
+
 		// Store received block
 		transfer.mu.Lock()
-		transfer.ReceivedBlocks[packet.SerialNumber] = packet.Data
-		receivedCount = len(transfer.ReceivedBlocks)
+		if transfer.received.Get(packet.SerialNumber) {
+			transfer.mu.Unlock()
+			metrics.DuplicatePackets.Inc()
+			continue
+		}
+		transfer.received.Set(packet.SerialNumber)
+		transfer.ReceivedCount++
+		// nolint:gosec // lengths are non-negative
+		transfer.WireBytes += uint64(wireSize)
+		transfer.DataBytes += uint64(len(packet.Data))
+		if transfer.blockHandler == nil {
+			transfer.ReceivedBlocks[packet.SerialNumber] = packet.Data
+		}
+		receivedCount := transfer.ReceivedCount
 		transfer.mu.Unlock()
+		metrics.PacketsReceived.Inc()
+		metrics.BytesReceived.Add(float64(wireSize))
 
-		// nolint:gosec // TotalBlocks is controlled by the protocol and safe to convert
-		if receivedCount%100 == 0 || receivedCount >= int(transfer.TotalBlocks) {
-			fmt.Printf("Received block %d/%d\n", receivedCount, transfer.TotalBlocks)
+		if transfer.blockHandler != nil {
+			transfer.blockHandler(packet.SerialNumber, packet.Data)
 		}
 
-		// Check if we've received all blocks
-		// nolint:gosec // TotalBlocks is controlled by the protocol and safe to convert
-		if receivedCount >= int(transfer.TotalBlocks) {
-			break
+		if receivedCount%100 == 0 || receivedCount >= expected {
+			transfer.logger().WithField("received", receivedCount).Debugf("Received block %d/%d", receivedCount, expected)
 		}
 	}
 
+	// Range transfers hand blocks over as they arrive
+	if transfer.FilePath == "" {
+		transfer.mu.Lock()
+		transfer.Status = "complete"
+		transfer.mu.Unlock()
+		return
+	}
+
 	// Write file
 	if err := s.writeFile(transfer); err != nil {
-		fmt.Printf("Error writing file: %v\n", err)
+		transfer.logger().WithError(err).Error("Failed to write file")
 		transfer.mu.Lock()
 		transfer.Status = "failed"
 		transfer.mu.Unlock()
@@ -232,8 +343,48 @@ func (s *TransferService) receiveFile(ctx context.Context, transfer *ActiveTrans
 	transfer.Status = "complete"
 	transfer.mu.Unlock()
 
-	fmt.Printf("File download completed: %s\n", transfer.TransferId.String())
-	fmt.Printf("File saved to: %s\n", transfer.FilePath)
+	entry := transfer.logger().WithField("path", transfer.FilePath)
+	if codec != nil {
+		dataBytes, wireBytes, ratio := transfer.CompressionStats()
+		entry = entry.WithFields(logutils.Fields{
+			"compression":       codec.Name(),
+			"data_bytes":        dataBytes,
+			"wire_bytes":        wireBytes,
+			"compression_ratio": ratio,
+		})
+	}
+	entry.Info("File download completed")
+}
+
+// cancelTransfer marks the transfer cancelled and tells the producer to stop sending.
+// The packet is sent from the receiving socket, the address the producer sends to.
+func cancelTransfer(conn *net.UDPConn, transfer *ActiveTransfer) {
+	transfer.mu.Lock()
+	finished := transfer.finished
+	transfer.Status = "cancelled"
+	if finished != "" {
+		transfer.Status = finished
+	}
+	transfer.mu.Unlock()
+	if finished != "" {
+		// The producer stopped already
+		transfer.logger().WithField("status", finished).Info("Transfer ended by the producer")
+		return
+	}
+	transfer.logger().Info("Transfer cancelled")
+
+	packet := client.UdpPacket{
+		ContentType: client.ContentTypeCancel,
+		TransferId:  transfer.TransferId,
+		Timestamp:   time.Now(),
+	}
+	packetData, err := packet.Marshal(transfer.TransferStartTime)
+	if err != nil {
+		return
+	}
+	if _, err := conn.WriteToUDP(packetData, transfer.ProducerAddr); err != nil {
+		transfer.logger().WithError(err).Warn("Failed to send cancel packet")
+	}
 }
 
 func (*TransferService) writeFile(transfer *ActiveTransfer) error {
@@ -249,7 +400,7 @@ func (*TransferService) writeFile(transfer *ActiveTransfer) error {
 		blockData, exists := transfer.ReceivedBlocks[blockNum]
 		if !exists {
 			// Missing block, fill with zeros
-			fmt.Printf("Warning: Missing block %d, filling with zeros\n", blockNum)
+			transfer.logger().WithField("block", blockNum).Warn("Missing block, filling with zeros")
 			blockData = make([]byte, transfer.BlockSize)
 		}
 
@@ -261,6 +412,88 @@ func (*TransferService) writeFile(transfer *ActiveTransfer) error {
 	return nil
 }
 
+// Prioritize asks the producer to send the block next, e.g. because a reader waits for it.
+// The request may get lost like any packet.
+func (t *ActiveTransfer) Prioritize(blockNum uint64) error {
+	t.mu.Lock()
+	has := t.received.Get(blockNum)
+	t.mu.Unlock()
+	if has || !t.Range.Contains(blockNum) {
+		return nil
+	}
+	metrics.PriorityRequests.Inc()
+	return t.sendControl(client.ContentTypePriority, blockNum)
+}
+
+// EndRangeAt asks the producer to stop sending at the block, another source took over the rest of the range.
+// The request may get lost like any packet, it is safe to repeat.
+func (t *ActiveTransfer) EndRangeAt(end uint64) error {
+	return t.sendControl(client.ContentTypeRangeEnd, end)
+}
+
+// sendControl sends a control packet from the receiving socket, the address the producer sends to
+func (t *ActiveTransfer) sendControl(contentType byte, serialNumber uint64) error {
+	t.mu.Lock()
+	conn := t.conn
+	t.mu.Unlock()
+	if conn == nil {
+		return ErrNotReceiving
+	}
+
+	packet := client.UdpPacket{
+		ContentType:  contentType,
+		SerialNumber: serialNumber,
+		TransferId:   t.TransferId,
+		Timestamp:    time.Now(),
+	}
+	packetData, err := packet.Marshal(t.TransferStartTime)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteToUDP(packetData, t.ProducerAddr); err != nil {
+		return fmt.Errorf("failed to send control packet: %w", err)
+	}
+	return nil
+}
+
+// Finish stops receiving when the signaller reports the transfer ended without the consumer noticing,
+// e.g. the producer cancelled it while queued or its cancel packet got lost. It reports whether the
+// status ends the transfer. A producer completes once it stopped resending lost blocks, the transfer
+// fails when blocks are still missing after the last ones had time to arrive.
+func (t *ActiveTransfer) Finish(status model.TransferStatus) bool {
+	switch status {
+	case model.TransferStatusCancelled:
+		t.end("cancelled")
+	case model.TransferStatusFailed, model.TransferStatusProducerRejected:
+		t.end("failed")
+	case model.TransferStatusComplete:
+		time.AfterFunc(completeDrainDelay, func() { t.end("failed") })
+	default:
+		return false
+	}
+	return true
+}
+
+// end stops receiving with the status unless every block of the range arrived
+func (t *ActiveTransfer) end(status string) {
+	t.mu.Lock()
+	if t.ReceivedCount >= t.Range.Len() {
+		t.mu.Unlock()
+		return
+	}
+	t.finished = status
+	stop := t.stop
+	t.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// logger returns a log entry with the ID of the transfer
+func (t *ActiveTransfer) logger() *logutils.Entry {
+	return logutils.WithField("transfer_id", t.TransferId.String())
+}
+
 // GetTransferStatus returns the status of a transfer
 func (s *TransferService) GetTransferStatus(transferId uuid.UUID) (*ActiveTransfer, bool) {
 	s.mu.RLock()
@@ -270,6 +503,39 @@ func (s *TransferService) GetTransferStatus(transferId uuid.UUID) (*ActiveTransf
 	return transfer, exists
 }
 
+// CompressionStats returns data and wire byte counts and the effective compression ratio
+func (t *ActiveTransfer) CompressionStats() (dataBytes, wireBytes uint64, ratio float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ratio = 1
+	if t.WireBytes > 0 {
+		ratio = float64(t.DataBytes) / float64(t.WireBytes)
+	}
+	return t.DataBytes, t.WireBytes, ratio
+}
+
+// GetReceivedCount returns the number of distinct blocks received
+func (t *ActiveTransfer) GetReceivedCount() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.ReceivedCount
+}
+
+// HasBlock reports whether the block has been received by this transfer
+func (t *ActiveTransfer) HasBlock(blockNum uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.received.Get(blockNum)
+}
+
+// ReceivedBitmap returns a copy of the received blocks bitmap, bit i of byte i/8 is block i
+func (t *ActiveTransfer) ReceivedBitmap() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.received.Array())
+}
+
 // GetStatus returns the status string of a transfer
 func (t *ActiveTransfer) GetStatus() string {
 	t.mu.Lock()
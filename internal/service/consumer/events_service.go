@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"udpie/internal/client"
+	"udpie/internal/model"
+	"udpie/internal/protocol"
+)
+
+const (
+	eventsWriteWait     = 10 * time.Second
+	eventsHandshakeWait = 10 * time.Second
+	eventsBuffer        = 64
+)
+
+// TransferEvents is a websocket connection delivering the events of transfers the consumer follows
+type TransferEvents struct {
+	SessionId string // passed with download requests so their transfers are followed from the start
+
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	events  chan model.TransferEvent
+	err     error // why the connection was lost, set before events is closed
+}
+
+// OpenEvents connects to the consumer websocket of the signaller
+func (s *ConsumerService) OpenEvents() (*TransferEvents, error) {
+	header := http.Header{}
+	if s.token != "" {
+		header.Set("Authorization", "Bearer "+s.token)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = s.tlsConfig
+	conn, resp, err := dialer.Dial(websocketURL(s.signallerURL)+"/ws/consumer", header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("error connecting to websocket (status %d): %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("error connecting to websocket: %w", err)
+	}
+
+	welcome, err := eventsHandshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+
+	events := &TransferEvents{
+		SessionId: welcome.SessionId,
+		conn:      conn,
+		events:    make(chan model.TransferEvent, eventsBuffer),
+	}
+	go events.read()
+	return events, nil
+}
+
+// websocketURL converts the http(s) URL of the signaller to ws(s)
+func websocketURL(signallerURL string) string {
+	if rest, found := strings.CutPrefix(signallerURL, "http://"); found {
+		return "ws://" + rest
+	}
+	if rest, found := strings.CutPrefix(signallerURL, "https://"); found {
+		return "wss://" + rest
+	}
+	return signallerURL
+}
+
+func eventsHandshake(conn *websocket.Conn) (*protocol.Welcome, error) {
+	hello := protocol.NewHello(protocol.Capabilities{
+		Compression:  client.SupportedCompressions,
+		MaxBlockSize: client.MaxBlockSize,
+	})
+	data, err := protocol.Encode("", hello)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(eventsHandshakeWait))
+	_, data, err = conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+
+	_, message, err := protocol.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	switch message := message.(type) {
+	case *protocol.Welcome:
+		return message, nil
+	case *protocol.Error:
+		return nil, message
+	default:
+		return nil, fmt.Errorf("expected %s, got %s", protocol.KindWelcome, message.Kind())
+	}
+}
+
+// read delivers events until the connection is lost, errors of subscriptions are dropped
+func (e *TransferEvents) read() {
+	defer close(e.events)
+
+	for {
+		_, data, err := e.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) && !errors.Is(err, net.ErrClosed) {
+				e.err = err
+			}
+			return
+		}
+		_, message, err := protocol.Decode(data)
+		if err != nil {
+			continue
+		}
+		if event, ok := message.(*protocol.TransferEvent); ok {
+			e.events <- model.TransferEvent(*event)
+		}
+	}
+}
+
+// Events returns the channel of transfer events, it is closed when the connection is lost
+func (e *TransferEvents) Events() <-chan model.TransferEvent {
+	return e.events
+}
+
+// Err returns why the connection was lost once Events is closed, nil after Close
+func (e *TransferEvents) Err() error {
+	return e.err
+}
+
+// Subscribe follows a transfer, its current state is delivered as the first event
+func (e *TransferEvents) Subscribe(transferId uuid.UUID) error {
+	return e.send(&protocol.Subscribe{TransferId: transferId})
+}
+
+// Unsubscribe stops following a transfer
+func (e *TransferEvents) Unsubscribe(transferId uuid.UUID) error {
+	return e.send(&protocol.Unsubscribe{TransferId: transferId})
+}
+
+func (e *TransferEvents) send(message protocol.Message) error {
+	data, err := protocol.Encode(uuid.New().String(), message)
+	if err != nil {
+		return err
+	}
+
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	_ = e.conn.SetWriteDeadline(time.Now().Add(eventsWriteWait))
+	return e.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Close closes the connection
+func (e *TransferEvents) Close() error {
+	e.writeMu.Lock()
+	_ = e.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(eventsWriteWait))
+	e.writeMu.Unlock()
+	return e.conn.Close()
+}
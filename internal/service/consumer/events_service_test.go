@@ -0,0 +1,22 @@
+package consumer
+
+import "testing"
+
+func TestWebsocketURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://localhost:8080", want: "ws://localhost:8080"},
+		{url: "https://signaller.example.com", want: "wss://signaller.example.com"},
+		{url: "ws://localhost:8080", want: "ws://localhost:8080"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := websocketURL(tt.url); got != tt.want {
+				t.Errorf("websocketURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
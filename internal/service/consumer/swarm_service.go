@@ -0,0 +1,514 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/handler"
+	"udpie/internal/model"
+	"udpie/internal/service/common"
+	"udpie/pkg/logutils"
+	"udpie/utils"
+)
+
+const (
+	swarmTickInterval    = 1 * time.Second
+	swarmStallTimeout    = 10 * time.Second // no new blocks for this long means the source slowed down or disappeared
+	maxSourceFailures    = 3                // consecutive transfers without a single block before a source is dropped
+	minStealBlocks       = 64               // smaller remainders are not worth splitting
+	swarmFilePermissions = 0644
+)
+
+type swarmSource struct {
+	fileId     uuid.UUID
+	producerId uuid.UUID
+	failures   int
+	retryAt    time.Time // failed sources rest until then
+	busy       bool
+	disabled   bool
+}
+
+type swarmTransfer struct {
+	source       *swarmSource
+	transfer     *ActiveTransfer
+	blockRange   model.BlockRange // may shrink when another source takes over the tail
+	cancel       context.CancelFunc
+	lastCount    uint64
+	lastProgress time.Time
+	waiting      bool // the producer queued or paused the transfer, waiting is not a stall
+	shrunk       bool // the producer has to be told the end of blockRange until the transfer ends
+}
+
+// SwarmDownload downloads a file from several producers holding the same content.
+// Every source gets a disjoint block range, ranges of slow or vanished sources
+// are handed over to the others.
+type SwarmDownload struct {
+	consumerService *ConsumerService
+	transferService *TransferService
+	request         handler.InitDownloadRequest // options shared by requests to all sources
+	filePath        string
+	size            uint64
+	hash            []byte
+	blockSize       uint64
+	totalBlocks     uint64
+	sources         []*swarmSource
+	active          []*swarmTransfer
+	pending         []model.BlockRange // ranges waiting for a free source
+
+	mu        sync.Mutex
+	file      *os.File
+	have      utils.BitArray
+	haveCount uint64
+	writeErr  error
+}
+
+// NewSwarmDownload creates a download of sources into filePath. The request carries
+// UDP options, compression, rate limit and identity used for all sources.
+func NewSwarmDownload(
+	consumerService *ConsumerService,
+	sources []handler.FileSourceResponse,
+	filePath string,
+	request handler.InitDownloadRequest,
+) (*SwarmDownload, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no sources to download from")
+	}
+
+	first := sources[0]
+	d := &SwarmDownload{
+		consumerService: consumerService,
+		transferService: NewTransferService(),
+		request:         request,
+		filePath:        filePath,
+		size:            first.Size,
+		hash:            first.Hash,
+		blockSize:       first.BlockSize,
+		totalBlocks:     first.TotalBlocks,
+		have:            utils.NewBitArray(first.TotalBlocks),
+	}
+
+	for i := range sources {
+		if sources[i].Size != d.size || sources[i].TotalBlocks != d.totalBlocks {
+			continue
+		}
+		d.sources = append(d.sources, &swarmSource{
+			fileId:     sources[i].FileId,
+			producerId: sources[i].ProducerId,
+		})
+	}
+
+	// Sources run in parallel, split the limit between them
+	if request.MaxRate > 0 && len(d.sources) > 0 {
+		// nolint:gosec // number of sources is small and positive
+		d.request.MaxRate = max(request.MaxRate/uint64(len(d.sources)), 1)
+	}
+
+	return d, nil
+}
+
+// Run downloads the file and verifies its hash
+func (d *SwarmDownload) Run(ctx context.Context) error {
+	file, err := os.OpenFile(d.filePath, os.O_CREATE|os.O_RDWR|os.O_TRUNC, swarmFilePermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	d.file = file
+	defer d.stopAll()
+
+	// nolint:gosec // size is a file size
+	if err := file.Truncate(int64(d.size)); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to allocate file: %w", err)
+	}
+
+	d.logger().WithFields(logutils.Fields{
+		"total_blocks": d.totalBlocks,
+		"sources":      len(d.sources),
+	}).Info("Starting swarm download")
+	d.pending = splitRange(model.BlockRange{Start: 0, End: d.totalBlocks}, len(d.sources))
+
+	err = d.loop(ctx)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(d.hash) > 0 {
+		if err := common.VerifyFile(d.filePath, d.hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *SwarmDownload) loop(ctx context.Context) error {
+	ticker := time.NewTicker(swarmTickInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.getWriteErr(); err != nil {
+			return err
+		}
+
+		d.checkActive()
+		d.assign(ctx)
+
+		received := d.receivedCount()
+		if received >= d.totalBlocks {
+			return nil
+		}
+
+		if len(d.active) == 0 && len(d.pending) == 0 {
+			// Nothing is running but blocks are still missing, schedule them again
+			if span, missing := d.missingSpan(model.BlockRange{Start: 0, End: d.totalBlocks}); missing {
+				d.pending = append(d.pending, span)
+			}
+		}
+
+		if len(d.active) == 0 && d.healthySources() == 0 {
+			return errors.New("all sources failed")
+		}
+
+		d.logger().WithFields(logutils.Fields{
+			"received": received,
+			"active":   len(d.active),
+		}).Debugf("Swarm received %d/%d blocks", received, d.totalBlocks)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkActive retires finished and stalled transfers
+func (d *SwarmDownload) checkActive() {
+	now := time.Now()
+	active := d.active[:0]
+
+	for _, st := range d.active {
+		count := st.transfer.GetReceivedCount()
+		if count > st.lastCount {
+			st.lastCount = count
+			st.lastProgress = now
+			st.waiting = false
+		}
+		if st.waiting {
+			// Waiting in the queue or paused is not a stall, the stall timeout starts once the producer sends again
+			d.stillWaiting(st)
+			st.lastProgress = now
+		}
+
+		span, missing := d.missingSpan(st.blockRange)
+		switch {
+		case !missing:
+			d.retire(st)
+		case now.Sub(st.lastProgress) > swarmStallTimeout && d.paused(st):
+			// Paused while sending, e.g. by the user, the producer keeps the slot until it is resumed
+			st.waiting = true
+			st.lastProgress = now
+			active = append(active, st)
+		case now.Sub(st.lastProgress) > swarmStallTimeout:
+			if st.lastCount == 0 {
+				st.source.failures++
+			}
+			d.logger().WithFields(logutils.Fields{
+				"producer_id": st.source.producerId.String(),
+				"range_start": span.Start,
+				"range_end":   span.End,
+			}).Warn("Source stalled, rescheduling blocks")
+			d.retire(st)
+			d.pending = append(d.pending, span)
+		default:
+			// The range end packet may have been lost, repeating it is harmless
+			if st.shrunk {
+				d.endRange(st)
+			}
+			active = append(active, st)
+		}
+	}
+
+	d.active = active
+}
+
+// assign starts pending ranges on free sources and splits the largest remaining range for idle ones
+func (d *SwarmDownload) assign(ctx context.Context) {
+	for {
+		source := d.idleSource()
+		if source == nil {
+			return
+		}
+
+		if len(d.pending) > 0 {
+			blockRange := d.pending[0]
+			d.pending = d.pending[1:]
+			d.start(ctx, source, blockRange)
+			continue
+		}
+
+		stolen, ok := d.steal()
+		if !ok {
+			return
+		}
+		d.start(ctx, source, stolen)
+	}
+}
+
+// steal takes over the upper half of the blocks the slowest transfer has left.
+// Its producer is told to stop before them, so they are not sent twice.
+func (d *SwarmDownload) steal() (model.BlockRange, bool) {
+	victim, span := d.slowest()
+	if victim == nil || span.Len() < 2*minStealBlocks {
+		return model.BlockRange{}, false
+	}
+
+	mid := span.Start + span.Len()/2
+	victim.blockRange.End = mid
+	victim.shrunk = true
+	d.endRange(victim)
+	return model.BlockRange{Start: mid, End: span.End}, true
+}
+
+// endRange tells the producer of a shrunk transfer where its range ends now
+func (d *SwarmDownload) endRange(st *swarmTransfer) {
+	if err := st.transfer.EndRangeAt(st.blockRange.End); err != nil {
+		d.logger().WithField("transfer_id", st.transfer.TransferId.String()).WithError(err).
+			Debug("Failed to shrink the range of a source")
+	}
+}
+
+func (d *SwarmDownload) start(ctx context.Context, source *swarmSource, blockRange model.BlockRange) {
+	if err := d.startTransfer(ctx, source, blockRange); err != nil {
+		d.logger().WithField("producer_id", source.producerId.String()).WithError(err).Warn("Source failed")
+		source.failures++
+		source.retryAt = time.Now().Add(swarmStallTimeout)
+		if source.failures >= maxSourceFailures {
+			source.disabled = true
+		}
+		d.pending = append(d.pending, blockRange)
+	}
+}
+
+func (d *SwarmDownload) startTransfer(ctx context.Context, source *swarmSource, blockRange model.BlockRange) error {
+	request := d.request
+	request.Id = source.fileId
+	request.Range = &blockRange
+	result, err := d.consumerService.InitDownload(&request)
+	if err != nil {
+		return err
+	}
+
+	if result.TotalBlocks != d.totalBlocks || result.BlockSize != d.blockSize {
+		return fmt.Errorf("source layout mismatch: %d blocks of %d bytes", result.TotalBlocks, result.BlockSize)
+	}
+
+	producerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
+		result.ProducerUdpOptions.ExternalIp,
+		result.ProducerUdpOptions.ExternalPort))
+	if err != nil {
+		return fmt.Errorf("error resolving producer address: %w", err)
+	}
+
+	transferCtx, cancel := context.WithCancel(ctx)
+	_, err = d.transferService.StartRangeTransfer(
+		transferCtx,
+		result.TransferId,
+		result.BlockSize,
+		result.TotalBlocks,
+		result.Range,
+		producerAddr,
+		result.Compression,
+		d.storeBlock,
+	)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	transfer, _ := d.transferService.GetTransferStatus(result.TransferId)
+	source.busy = true
+	d.active = append(d.active, &swarmTransfer{
+		source:       source,
+		transfer:     transfer,
+		blockRange:   result.Range,
+		cancel:       cancel,
+		lastProgress: time.Now(),
+		waiting:      result.QueuePosition > 0,
+	})
+
+	d.logger().WithFields(logutils.Fields{
+		"producer_id":    source.producerId.String(),
+		"transfer_id":    result.TransferId.String(),
+		"range_start":    result.Range.Start,
+		"range_end":      result.Range.End,
+		"queue_position": result.QueuePosition,
+	}).Info("Source started a transfer")
+	return nil
+}
+
+// logger returns a log entry with the ID of the downloaded file
+func (d *SwarmDownload) logger() *logutils.Entry {
+	return logutils.WithField("file_id", d.request.Id.String())
+}
+
+// stillWaiting asks the signaller whether the producer still holds the transfer in its queue or paused
+func (d *SwarmDownload) stillWaiting(st *swarmTransfer) {
+	status, err := d.consumerService.GetTransfer(st.transfer.TransferId)
+	if err != nil || (status.Status != model.TransferStatusQueued && status.Status != model.TransferStatusPaused) {
+		st.waiting = false
+	}
+}
+
+// paused asks the signaller whether the transfer was paused
+func (d *SwarmDownload) paused(st *swarmTransfer) bool {
+	status, err := d.consumerService.GetTransfer(st.transfer.TransferId)
+	return err == nil && status.Status == model.TransferStatusPaused
+}
+
+// Transfer returns a transfer started by the download, e.g. to report its received blocks when it is paused
+func (d *SwarmDownload) Transfer(transferId uuid.UUID) (*ActiveTransfer, bool) {
+	return d.transferService.GetTransferStatus(transferId)
+}
+
+// retire gives up a stalled transfer, its producer is told to free the slot
+func (d *SwarmDownload) retire(st *swarmTransfer) {
+	st.cancel()
+	go func(transferId uuid.UUID) {
+		_ = d.consumerService.CancelTransfer(transferId, "stalled, retried on another source")
+	}(st.transfer.TransferId)
+	st.source.busy = false
+	if st.source.failures >= maxSourceFailures {
+		st.source.disabled = true
+	}
+	if st.lastCount > 0 {
+		st.source.failures = 0
+	}
+}
+
+func (d *SwarmDownload) stopAll() {
+	for _, st := range d.active {
+		st.cancel()
+	}
+	d.active = nil
+}
+
+// storeBlock writes a block received from any source
+func (d *SwarmDownload) storeBlock(blockNum uint64, data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.writeErr != nil || d.have.Get(blockNum) {
+		return
+	}
+
+	// nolint:gosec // offset is bounded by the file size
+	if _, err := d.file.WriteAt(data, int64(blockNum*d.blockSize)); err != nil {
+		d.writeErr = fmt.Errorf("failed to write block %d: %w", blockNum, err)
+		return
+	}
+
+	d.have.Set(blockNum)
+	d.haveCount++
+}
+
+// missingSpan returns the smallest range covering all missing blocks of blockRange
+func (d *SwarmDownload) missingSpan(blockRange model.BlockRange) (model.BlockRange, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	span := model.BlockRange{}
+	found := false
+	for block := blockRange.Start; block < blockRange.End; block++ {
+		if d.have.Get(block) {
+			continue
+		}
+		if !found {
+			span.Start = block
+			found = true
+		}
+		span.End = block + 1
+	}
+
+	return span, found
+}
+
+// slowest returns the active transfer with the most blocks left
+func (d *SwarmDownload) slowest() (*swarmTransfer, model.BlockRange) {
+	var victim *swarmTransfer
+	var victimSpan model.BlockRange
+
+	for _, st := range d.active {
+		span, missing := d.missingSpan(st.blockRange)
+		if missing && span.Len() > victimSpan.Len() {
+			victim, victimSpan = st, span
+		}
+	}
+
+	return victim, victimSpan
+}
+
+func (d *SwarmDownload) idleSource() *swarmSource {
+	now := time.Now()
+	for _, source := range d.sources {
+		if !source.busy && !source.disabled && now.After(source.retryAt) {
+			return source
+		}
+	}
+	return nil
+}
+
+func (d *SwarmDownload) healthySources() int {
+	count := 0
+	for _, source := range d.sources {
+		if !source.disabled {
+			count++
+		}
+	}
+	return count
+}
+
+func (d *SwarmDownload) receivedCount() uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.haveCount
+}
+
+func (d *SwarmDownload) getWriteErr() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.writeErr
+}
+
+// splitRange splits blockRange into at most parts contiguous ranges of similar size
+func splitRange(blockRange model.BlockRange, parts int) []model.BlockRange {
+	total := blockRange.Len()
+	if parts < 1 || total == 0 {
+		return nil
+	}
+	// nolint:gosec // parts is a small positive number
+	if uint64(parts) > total {
+		parts = int(total)
+	}
+
+	ranges := make([]model.BlockRange, 0, parts)
+	start := blockRange.Start
+	for i := range parts {
+		// nolint:gosec // i and parts are small positive numbers
+		end := blockRange.Start + total*uint64(i+1)/uint64(parts)
+		ranges = append(ranges, model.BlockRange{Start: start, End: end})
+		start = end
+	}
+
+	return ranges
+}
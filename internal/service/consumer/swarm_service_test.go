@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/client"
+	"udpie/internal/handler"
+	"udpie/internal/model"
+	"udpie/utils"
+)
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		blockRange model.BlockRange
+		parts      int
+		want       []model.BlockRange
+	}{
+		{
+			name:       "even split",
+			blockRange: model.BlockRange{Start: 0, End: 100},
+			parts:      4,
+			want:       []model.BlockRange{{Start: 0, End: 25}, {Start: 25, End: 50}, {Start: 50, End: 75}, {Start: 75, End: 100}},
+		},
+		{
+			name:       "uneven split covers every block",
+			blockRange: model.BlockRange{Start: 10, End: 20},
+			parts:      3,
+			want:       []model.BlockRange{{Start: 10, End: 13}, {Start: 13, End: 16}, {Start: 16, End: 20}},
+		},
+		{
+			name:       "more parts than blocks",
+			blockRange: model.BlockRange{Start: 0, End: 2},
+			parts:      5,
+			want:       []model.BlockRange{{Start: 0, End: 1}, {Start: 1, End: 2}},
+		},
+		{
+			name:       "single part",
+			blockRange: model.BlockRange{Start: 0, End: 7},
+			parts:      1,
+			want:       []model.BlockRange{{Start: 0, End: 7}},
+		},
+		{
+			name:       "empty range",
+			blockRange: model.BlockRange{Start: 5, End: 5},
+			parts:      2,
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitRange(tt.blockRange, tt.parts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSwarmDownload_Steal(t *testing.T) {
+	// The producer of the slow transfer listens for control packets
+	producerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() unexpected error: %v", err)
+	}
+	defer producerConn.Close()
+	consumerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() unexpected error: %v", err)
+	}
+	defer consumerConn.Close()
+
+	const totalBlocks = 1000
+	slow := &swarmTransfer{
+		blockRange: model.BlockRange{Start: 0, End: 500},
+		transfer: &ActiveTransfer{
+			TransferId:        uuid.New(),
+			TransferStartTime: time.Now(),
+			ProducerAddr:      producerConn.LocalAddr().(*net.UDPAddr),
+			conn:              consumerConn,
+		},
+	}
+	fast := &swarmTransfer{blockRange: model.BlockRange{Start: 500, End: 1000}, transfer: &ActiveTransfer{}}
+	d := &SwarmDownload{
+		totalBlocks: totalBlocks,
+		have:        utils.NewBitArray(totalBlocks),
+		active:      []*swarmTransfer{slow, fast},
+	}
+	// The fast source is done, the slow one has blocks 100..499 left
+	for block := uint64(0); block < 100; block++ {
+		d.have.Set(block)
+	}
+	for block := uint64(500); block < totalBlocks; block++ {
+		d.have.Set(block)
+	}
+
+	stolen, ok := d.steal()
+	if !ok {
+		t.Fatal("steal() found nothing to take over")
+	}
+	if want := (model.BlockRange{Start: 300, End: 500}); stolen != want {
+		t.Errorf("steal() = %v, want %v", stolen, want)
+	}
+	if want := (model.BlockRange{Start: 0, End: 300}); slow.blockRange != want {
+		t.Errorf("slow range = %v, want %v", slow.blockRange, want)
+	}
+
+	// The producer of the slow transfer is told to stop at the stolen half
+	_ = producerConn.SetReadDeadline(time.Now().Add(time.Second))
+	buffer := make([]byte, client.MaxBlockSize)
+	n, err := producerConn.Read(buffer)
+	if err != nil {
+		t.Fatalf("producer received no range end: %v", err)
+	}
+	var packet client.UdpPacket
+	if err := packet.Unmarshal(buffer[:n], slow.transfer.TransferStartTime); err != nil {
+		t.Fatalf("Unmarshal() unexpected error: %v", err)
+	}
+	if packet.Kind() != client.ContentTypeRangeEnd || packet.SerialNumber != 300 ||
+		packet.TransferId != slow.transfer.TransferId {
+		t.Errorf("packet = kind %#x block %d, want range end at 300", packet.Kind(), packet.SerialNumber)
+	}
+
+	// Remainders too small to split are left alone
+	for block := uint64(100); block < 250; block++ {
+		d.have.Set(block)
+	}
+	if _, ok := d.steal(); ok {
+		t.Error("steal() split a remainder below the minimum")
+	}
+}
+
+func TestSwarmDownload_CheckActivePaused(t *testing.T) {
+	tests := []struct {
+		name   string
+		status model.TransferStatus
+		kept   bool
+	}{
+		{name: "paused is kept", status: model.TransferStatusPaused, kept: true},
+		{name: "sending without progress is retired", status: model.TransferStatusDataSending, kept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signaller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(handler.TransferStatusResponse{Status: tt.status})
+			}))
+			defer signaller.Close()
+
+			const totalBlocks = 100
+			st := &swarmTransfer{
+				source:       &swarmSource{busy: true},
+				transfer:     &ActiveTransfer{TransferId: uuid.New()},
+				blockRange:   model.BlockRange{Start: 0, End: totalBlocks},
+				cancel:       func() {},
+				lastCount:    10,
+				lastProgress: time.Now().Add(-2 * swarmStallTimeout),
+			}
+			d := &SwarmDownload{
+				consumerService: NewConsumerService(signaller.URL, "", nil),
+				totalBlocks:     totalBlocks,
+				have:            utils.NewBitArray(totalBlocks),
+				active:          []*swarmTransfer{st},
+			}
+
+			d.checkActive()
+
+			if kept := len(d.active) == 1; kept != tt.kept {
+				t.Fatalf("transfer kept = %v, want %v", kept, tt.kept)
+			}
+			if tt.kept && !st.waiting {
+				t.Error("paused transfer is not waiting")
+			}
+			if !tt.kept && len(d.pending) != 1 {
+				t.Errorf("pending ranges = %v, want the stalled range rescheduled", d.pending)
+			}
+		})
+	}
+}
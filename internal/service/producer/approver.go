@@ -0,0 +1,100 @@
+package producer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsoleApprover asks the operator on the terminal to approve transfer requests.
+// Requests are asked one at a time, unanswered ones are declined after the timeout.
+// The timeout counts from the arrival of the request, time spent waiting for an earlier
+// prompt included, so the signaller is answered before it stops waiting.
+type ConsoleApprover struct {
+	mu      sync.Mutex
+	lines   chan string
+	out     io.Writer
+	timeout time.Duration
+}
+
+func NewConsoleApprover(in io.Reader, out io.Writer, timeout time.Duration) *ConsoleApprover {
+	a := &ConsoleApprover{
+		lines:   make(chan string),
+		out:     out,
+		timeout: timeout,
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			a.lines <- scanner.Text()
+		}
+		close(a.lines)
+	}()
+
+	return a
+}
+
+// SetTimeout changes how long the operator has to answer
+func (a *ConsoleApprover) SetTimeout(timeout time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.timeout = timeout
+}
+
+// Approve prompts the operator and waits for the answer
+func (a *ConsoleApprover) Approve(request PolicyRequest) (bool, string) {
+	arrived := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	remaining := a.timeout - time.Since(arrived)
+	if remaining <= 0 {
+		return false, "approval timed out"
+	}
+
+	// Drop answers typed while no request was pending
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-a.lines:
+			if !ok {
+				return false, "operator is not available"
+			}
+		default:
+			drained = true
+		}
+	}
+
+	consumer := request.ConsumerIP.String()
+	if request.ConsumerName != "" {
+		consumer = fmt.Sprintf("%s (%s)", request.ConsumerName, consumer)
+	}
+	item := request.FileName
+	if request.Path != "" {
+		item = fmt.Sprintf("%s/%s", request.FileName, request.Path)
+	}
+
+	_, _ = fmt.Fprintf(a.out, "\nTransfer request: %s to %s\n", item, consumer)
+	_, _ = fmt.Fprintf(a.out, "Approve? [y/N] (declined in %s): ", remaining.Round(time.Second))
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case line, ok := <-a.lines:
+		if !ok {
+			return false, "operator is not available"
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "y" || answer == "yes" {
+			return true, ""
+		}
+		return false, "declined by operator"
+	case <-timer.C:
+		_, _ = fmt.Fprintln(a.out)
+		return false, "approval timed out"
+	}
+}
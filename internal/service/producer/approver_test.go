@@ -0,0 +1,34 @@
+package producer
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConsoleApprover_QueuedRequestsKeepTheirDeadline(t *testing.T) {
+	in, _ := io.Pipe() // the operator never answers
+	timeout := 200 * time.Millisecond
+	approver := NewConsoleApprover(in, io.Discard, timeout)
+
+	request := PolicyRequest{FileName: "file", ConsumerIP: net.IPv4(127, 0, 0, 1)}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if approved, reason := approver.Approve(request); approved || reason != "approval timed out" {
+				t.Errorf("Approve() = %v, %q, want false, %q", approved, reason, "approval timed out")
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Prompts waiting for an earlier one are not given a timeout of their own
+	if elapsed := time.Since(start); elapsed > 2*timeout {
+		t.Errorf("queued requests answered after %s, want within %s", elapsed, 2*timeout)
+	}
+}
@@ -0,0 +1,41 @@
+package producer
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between reconnection attempts.
+// Every delay is randomized within its upper half so producers disconnected
+// together don't reconnect in lockstep.
+type Backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func NewBackoff(minDelay, maxDelay time.Duration) *Backoff {
+	return &Backoff{min: minDelay, max: maxDelay}
+}
+
+// Next returns the delay before the next attempt
+func (b *Backoff) Next() time.Duration {
+	delay := b.max
+	// Past the shift delay reaches max anyway, the check keeps it from overflowing
+	const maxShift = 30
+	if b.attempt < maxShift {
+		if d := b.min << b.attempt; d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	b.attempt++
+
+	half := delay / 2
+	// nolint:gosec // jitter needs no cryptographic randomness
+	return half + rand.N(delay-half+1)
+}
+
+// Reset starts over from the minimum delay
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
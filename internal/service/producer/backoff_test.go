@@ -0,0 +1,45 @@
+package producer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff_Next(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		wantMax  time.Duration
+	}{
+		{"first", 1, time.Second},
+		{"second", 2, 2 * time.Second},
+		{"fourth", 4, 8 * time.Second},
+		{"capped", 10, time.Minute},
+		{"far past cap", 100, time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBackoff(time.Second, time.Minute)
+			var delay time.Duration
+			for range tt.attempts {
+				delay = b.Next()
+			}
+			if delay < tt.wantMax/2 || delay > tt.wantMax {
+				t.Errorf("Next() after %d attempts = %v, want within [%v, %v]",
+					tt.attempts, delay, tt.wantMax/2, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestBackoff_Reset(t *testing.T) {
+	b := NewBackoff(time.Second, time.Minute)
+	for range 5 {
+		b.Next()
+	}
+	b.Reset()
+	if delay := b.Next(); delay > time.Second {
+		t.Errorf("Next() after Reset() = %v, want at most %v", delay, time.Second)
+	}
+}
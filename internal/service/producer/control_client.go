@@ -0,0 +1,176 @@
+package producer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// controlDialTimeout bounds connecting to the control socket, a listening producer accepts right away
+const controlDialTimeout = time.Second
+
+// controlURL is the base of control API requests, the host is ignored when dialing the socket
+const controlURL = "http://producer"
+
+// ErrNoControl is returned when no producer is listening on the control socket
+var ErrNoControl = errors.New("no listening producer")
+
+// ControlClient calls the control API of a listening producer
+type ControlClient struct {
+	client *http.Client
+}
+
+// DialControl connects to the producer listening on the socket path.
+// ErrNoControl is returned when the socket is missing or nobody accepts on it.
+func DialControl(socketPath string) (*ControlClient, error) {
+	if socketPath == "" {
+		return nil, ErrNoControl
+	}
+	conn, err := net.DialTimeout("unix", socketPath, controlDialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w on %s: %w", ErrNoControl, socketPath, err)
+	}
+	_ = conn.Close()
+
+	dialer := &net.Dialer{Timeout: controlDialTimeout}
+	return &ControlClient{
+		// No overall timeout, registering a large file takes as long as hashing it
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}, nil
+}
+
+// Files returns the files shared by the producer
+func (c *ControlClient) Files() ([]ControlFile, error) {
+	var files []ControlFile
+	if err := c.do(http.MethodGet, "/files", nil, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// RegisterFile shares a file or directory, zero ttl uses the signaller default
+func (c *ControlClient) RegisterFile(filePath string, ttl time.Duration) (*ControlFile, error) {
+	// The producer may run in another directory
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	var file ControlFile
+	request := ControlRegisterFileRequest{Path: absPath, TTL: uint64(ttl.Seconds())}
+	if err := c.do(http.MethodPost, "/files", request, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// UnregisterFile stops sharing a file
+func (c *ControlClient) UnregisterFile(fileId uuid.UUID) error {
+	return c.do(http.MethodDelete, "/files/"+fileId.String(), nil, nil)
+}
+
+// Transfers returns the transfers of the producer since it started
+func (c *ControlClient) Transfers() ([]TransferInfo, error) {
+	var transfers []TransferInfo
+	if err := c.do(http.MethodGet, "/transfers", nil, &transfers); err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+// PauseTransfer suspends sending a transfer
+func (c *ControlClient) PauseTransfer(transferId uuid.UUID) error {
+	return c.do(http.MethodPost, "/transfers/"+transferId.String()+"/pause", nil, nil)
+}
+
+// ResumeTransfer continues sending a paused transfer
+func (c *ControlClient) ResumeTransfer(transferId uuid.UUID) error {
+	return c.do(http.MethodPost, "/transfers/"+transferId.String()+"/resume", nil, nil)
+}
+
+// CancelTransfer cancels a running or queued transfer
+func (c *ControlClient) CancelTransfer(transferId uuid.UUID, reason string) error {
+	return c.do(http.MethodPost, "/transfers/"+transferId.String()+"/cancel", ControlCancelRequest{Reason: reason}, nil)
+}
+
+// Limits returns the limits the producer applies
+func (c *ControlClient) Limits() (*ControlLimits, error) {
+	var limits ControlLimits
+	if err := c.do(http.MethodGet, "/limits", nil, &limits); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// SetLimits replaces the limits of the producer and returns the applied ones
+func (c *ControlClient) SetLimits(limits ControlLimits) (*ControlLimits, error) {
+	var applied ControlLimits
+	if err := c.do(http.MethodPut, "/limits", limits, &applied); err != nil {
+		return nil, err
+	}
+	return &applied, nil
+}
+
+// Stats summarizes the producer
+func (c *ControlClient) Stats() (*ControlStats, error) {
+	var stats ControlStats
+	if err := c.do(http.MethodGet, "/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func (c *ControlClient) do(method, path string, body, result any) error {
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, controlURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr controlError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return fmt.Errorf("producer returned status %d", resp.StatusCode)
+		}
+		return errors.New(apiErr.Error)
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
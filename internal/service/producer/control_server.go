@@ -0,0 +1,382 @@
+package producer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/pkg/logutils"
+)
+
+// controlReadTimeout bounds reading request headers from the control socket
+const controlReadTimeout = 5 * time.Second
+
+// ControlFile describes a file shared by the producer
+type ControlFile struct {
+	Id      uuid.UUID `json:"id"`
+	Name    string    `json:"name"`
+	Size    uint64    `json:"size"`
+	Path    string    `json:"path"`              // file path or directory root
+	Entries int       `json:"entries,omitempty"` // files in a directory
+}
+
+// ControlRegisterFileRequest shares a file or directory, the path has to be absolute
+type ControlRegisterFileRequest struct {
+	Path string `json:"path"`
+	TTL  uint64 `json:"ttl,omitempty"` // seconds, 0 uses the signaller default
+}
+
+// ControlCancelRequest optionally tells the consumer why the transfer was cancelled
+type ControlCancelRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ControlLimits are the bandwidth and queue limits of a running producer
+type ControlLimits struct {
+	Rate          uint64 `json:"rate"` // bytes per second, 0 for unlimited
+	Burst         uint64 `json:"burst"`
+	TransferRate  uint64 `json:"transfer_rate"`
+	TransferBurst uint64 `json:"transfer_burst"`
+	MaxTransfers  int    `json:"max_transfers"` // 0 for unlimited
+	QueueSize     int    `json:"queue_size"`
+}
+
+// ControlStats summarizes a running producer
+type ControlStats struct {
+	ProducerId uuid.UUID `json:"producer_id"`
+	Uptime     uint64    `json:"uptime"` // seconds since the producer started listening
+	Files      int       `json:"files"`
+	Running    int       `json:"running"`
+	Paused     int       `json:"paused"`
+	Queued     int       `json:"queued"`
+	Finished   int       `json:"finished"`   // completed or cancelled since start
+	DataBytes  uint64    `json:"data_bytes"` // file bytes sent since start
+	WireBytes  uint64    `json:"wire_bytes"`
+}
+
+type controlError struct {
+	Error string `json:"error"`
+}
+
+// ControlServer serves the local control API of a listening producer over a Unix socket.
+// Files are registered with the state of the running producer, so it serves them right away.
+type ControlServer struct {
+	producerId      uuid.UUID
+	producerService *ProducerService
+	stateService    *StateService
+	transferService *TransferService
+	startedAt       time.Time
+	server          *http.Server
+	socketPath      string // removed on close
+}
+
+func NewControlServer(producerId uuid.UUID, producerService *ProducerService, stateService *StateService,
+	transferService *TransferService) *ControlServer {
+	c := &ControlServer{
+		producerId:      producerId,
+		producerService: producerService,
+		stateService:    stateService,
+		transferService: transferService,
+		startedAt:       time.Now(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /files", c.listFiles)
+	mux.HandleFunc("POST /files", c.registerFile)
+	mux.HandleFunc("DELETE /files/{id}", c.unregisterFile)
+	mux.HandleFunc("GET /transfers", c.listTransfers)
+	mux.HandleFunc("POST /transfers/{id}/pause", c.pauseTransfer)
+	mux.HandleFunc("POST /transfers/{id}/resume", c.resumeTransfer)
+	mux.HandleFunc("POST /transfers/{id}/cancel", c.cancelTransfer)
+	mux.HandleFunc("GET /limits", c.getLimits)
+	mux.HandleFunc("PUT /limits", c.setLimits)
+	mux.HandleFunc("GET /stats", c.stats)
+	c.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: controlReadTimeout,
+	}
+	return c
+}
+
+// Listen starts serving the control API on the socket path until Close is called.
+// A socket left behind by a producer which did not shut down is replaced, the one of a running producer is not.
+func (c *ControlServer) Listen(socketPath string) error {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", socketPath)
+		}
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			_ = conn.Close()
+			return fmt.Errorf("another producer is listening on %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := listenPrivate(socketPath)
+	if err != nil {
+		return err
+	}
+	c.socketPath = socketPath
+
+	go func() {
+		if err := c.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logutils.WithError(err).Error("Control API stopped")
+		}
+	}()
+	logutils.WithField("socket", socketPath).Info("Serving control API")
+	return nil
+}
+
+// listenPrivate listens on a Unix socket only the user running the producer may connect to.
+// The socket is created in a private directory and moved into place once its permissions are
+// restricted, nobody can connect in between.
+func listenPrivate(socketPath string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socketPath), ".udpie-control-") // readable by the owner only
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	privatePath := filepath.Join(dir, "control.sock")
+	ln, err := net.Listen("unix", privatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// The socket is moved, Close removes it by its final path
+	if unixListener, ok := ln.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+
+	const socketPerm = 0600
+	if err := os.Chmod(privatePath, socketPerm); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to restrict access to %s: %w", socketPath, err)
+	}
+	if err := os.Rename(privatePath, socketPath); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to move socket to %s: %w", socketPath, err)
+	}
+	return ln, nil
+}
+
+// Close stops serving and removes the socket
+func (c *ControlServer) Close() error {
+	err := c.server.Close()
+	if c.socketPath != "" {
+		if removeErr := os.Remove(c.socketPath); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			err = errors.Join(err, removeErr)
+		}
+	}
+	return err
+}
+
+func (c *ControlServer) listFiles(w http.ResponseWriter, _ *http.Request) {
+	files := c.stateService.GetAllFiles()
+	result := make([]ControlFile, 0, len(files))
+	for _, info := range files {
+		result = append(result, controlFile(&info))
+	}
+	writeControlJSON(w, http.StatusOK, result)
+}
+
+func (c *ControlServer) registerFile(w http.ResponseWriter, r *http.Request) {
+	var request ControlRegisterFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if request.Path == "" {
+		writeControlError(w, http.StatusBadRequest, errors.New("path is required"))
+		return
+	}
+
+	absPath, name, size, manifest, err := DescribeFile(request.Path)
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// nolint:gosec // the TTL in seconds is far below the int64 range
+	ttl := time.Duration(request.TTL) * time.Second
+	fileId, err := c.producerService.RegisterFile(name, size, c.producerId, absPath, manifest, ttl)
+	if err != nil {
+		writeControlError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	info, _ := c.stateService.GetFile(fileId)
+	logutils.WithFields(logutils.Fields{
+		"file_id": fileId.String(),
+		"path":    absPath,
+	}).Info("File registered")
+	writeControlJSON(w, http.StatusCreated, controlFile(&info))
+}
+
+func (c *ControlServer) unregisterFile(w http.ResponseWriter, r *http.Request) {
+	fileId, ok := controlId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := c.producerService.UnregisterFile(fileId); err != nil {
+		writeControlError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	logutils.WithField("file_id", fileId.String()).Info("File unregistered")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *ControlServer) listTransfers(w http.ResponseWriter, _ *http.Request) {
+	writeControlJSON(w, http.StatusOK, c.transferService.Transfers())
+}
+
+func (c *ControlServer) pauseTransfer(w http.ResponseWriter, r *http.Request) {
+	c.controlTransfer(w, r, c.producerService.PauseTransfer)
+}
+
+func (c *ControlServer) resumeTransfer(w http.ResponseWriter, r *http.Request) {
+	c.controlTransfer(w, r, c.producerService.ResumeTransfer)
+}
+
+func (c *ControlServer) cancelTransfer(w http.ResponseWriter, r *http.Request) {
+	var request ControlCancelRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+	}
+
+	c.controlTransfer(w, r, func(producerId, transferId uuid.UUID) error {
+		return c.producerService.CancelTransfer(producerId, transferId, request.Reason)
+	})
+}
+
+// controlTransfer changes a transfer through the signaller, so the consumer and the signaller learn about it
+func (c *ControlServer) controlTransfer(w http.ResponseWriter, r *http.Request,
+	action func(producerId, transferId uuid.UUID) error) {
+	transferId, ok := controlId(w, r)
+	if !ok {
+		return
+	}
+
+	if err := action(c.producerId, transferId); err != nil {
+		writeControlError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *ControlServer) getLimits(w http.ResponseWriter, _ *http.Request) {
+	limits := c.transferService.GetLimits()
+	queue := c.transferService.GetQueueState()
+	writeControlJSON(w, http.StatusOK, ControlLimits{
+		Rate:          limits.Rate,
+		Burst:         limits.Burst,
+		TransferRate:  limits.TransferRate,
+		TransferBurst: limits.TransferBurst,
+		MaxTransfers:  queue.MaxActive,
+		QueueSize:     queue.QueueSize,
+	})
+}
+
+// setLimits applies new limits until the producer stops or reloads its config
+func (c *ControlServer) setLimits(w http.ResponseWriter, r *http.Request) {
+	var limits ControlLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if limits.MaxTransfers < 0 || limits.QueueSize < 0 {
+		writeControlError(w, http.StatusBadRequest, errors.New("max_transfers and queue_size can not be negative"))
+		return
+	}
+
+	c.transferService.SetLimits(RateLimits{
+		Rate:          limits.Rate,
+		Burst:         limits.Burst,
+		TransferRate:  limits.TransferRate,
+		TransferBurst: limits.TransferBurst,
+	})
+	c.transferService.SetQueueLimits(limits.MaxTransfers, limits.QueueSize)
+	logutils.WithFields(logutils.Fields{
+		"rate":          limits.Rate,
+		"transfer_rate": limits.TransferRate,
+		"max_transfers": limits.MaxTransfers,
+		"queue_size":    limits.QueueSize,
+	}).Info("Limits updated")
+	c.getLimits(w, r)
+}
+
+func (c *ControlServer) stats(w http.ResponseWriter, _ *http.Request) {
+	stats := ControlStats{
+		ProducerId: c.producerId,
+		Uptime:     uint64(time.Since(c.startedAt).Seconds()),
+		Files:      len(c.stateService.GetAllFiles()),
+	}
+	for _, transfer := range c.transferService.Transfers() {
+		switch transfer.Status {
+		case "sending":
+			stats.Running++
+		case "paused":
+			stats.Paused++
+		case "queued":
+			stats.Queued++
+		default:
+			// Counted by the totals, only the latest finished transfers are listed
+			continue
+		}
+		stats.DataBytes += transfer.DataBytes
+		stats.WireBytes += transfer.WireBytes
+	}
+	totals := c.transferService.FinishedTotals()
+	stats.Finished = totals.Count
+	stats.DataBytes += totals.DataBytes
+	stats.WireBytes += totals.WireBytes
+	writeControlJSON(w, http.StatusOK, stats)
+}
+
+func controlFile(info *FileInfo) ControlFile {
+	file := ControlFile{
+		Id:   info.FileId,
+		Name: info.Name,
+		Size: info.Size,
+		Path: info.FilePath,
+	}
+	if info.Manifest != nil {
+		file.Entries = len(info.Manifest.Entries)
+	}
+	return file
+}
+
+// controlId parses the ID in the request path, it responds with an error when it is invalid
+func controlId(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid ID: %w", err))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func writeControlJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		logutils.WithError(err).Warn("Failed to write control API response")
+	}
+}
+
+func writeControlError(w http.ResponseWriter, status int, err error) {
+	writeControlJSON(w, status, controlError{Error: err.Error()})
+}
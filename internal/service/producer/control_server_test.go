@@ -0,0 +1,113 @@
+package producer
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func newControlTestServer() *ControlServer {
+	stateService := NewStateService("")
+	transferService := NewTransferService(stateService, nil, RateLimits{})
+	return NewControlServer(uuid.New(), nil, stateService, transferService)
+}
+
+func TestControlServer_Requests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "limits", method: http.MethodGet, path: "/limits", status: http.StatusOK},
+		{name: "set limits", method: http.MethodPut, path: "/limits", body: `{"rate":1000,"max_transfers":2}`,
+			status: http.StatusOK},
+		{name: "negative limits", method: http.MethodPut, path: "/limits", body: `{"queue_size":-1}`,
+			status: http.StatusBadRequest},
+		{name: "files", method: http.MethodGet, path: "/files", status: http.StatusOK},
+		{name: "register without path", method: http.MethodPost, path: "/files", body: `{}`,
+			status: http.StatusBadRequest},
+		{name: "register missing file", method: http.MethodPost, path: "/files", body: `{"path":"/nonexistent/udpie"}`,
+			status: http.StatusBadRequest},
+		{name: "invalid transfer ID", method: http.MethodPost, path: "/transfers/x/pause",
+			status: http.StatusBadRequest},
+		{name: "transfers", method: http.MethodGet, path: "/transfers", status: http.StatusOK},
+		{name: "stats", method: http.MethodGet, path: "/stats", status: http.StatusOK},
+		{name: "unknown route", method: http.MethodGet, path: "/unknown", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newControlTestServer()
+			recorder := httptest.NewRecorder()
+			c.server.Handler.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestControlServer_SetLimits(t *testing.T) {
+	c := newControlTestServer()
+	body := `{"rate":1000,"burst":2000,"transfer_rate":500,"transfer_burst":600,"max_transfers":2,"queue_size":3}`
+	recorder := httptest.NewRecorder()
+	c.server.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPut, "/limits", strings.NewReader(body)))
+
+	var applied ControlLimits
+	if err := json.NewDecoder(recorder.Body).Decode(&applied); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := ControlLimits{Rate: 1000, Burst: 2000, TransferRate: 500, TransferBurst: 600, MaxTransfers: 2, QueueSize: 3}
+	if applied != want {
+		t.Errorf("applied limits = %+v, want %+v", applied, want)
+	}
+	if limits := c.transferService.GetLimits(); limits.Rate != want.Rate || limits.TransferRate != want.TransferRate {
+		t.Errorf("transfer service limits = %+v", limits)
+	}
+	if queue := c.transferService.GetQueueState(); queue.MaxActive != 2 || queue.QueueSize != 3 {
+		t.Errorf("queue limits = %d, %d, want 2, 3", queue.MaxActive, queue.QueueSize)
+	}
+}
+
+func TestControlServer_Listen(t *testing.T) {
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "control.sock")
+	c := newControlTestServer()
+	if err := c.Listen(socketPath); err != nil {
+		t.Fatalf("Listen() unexpected error: %v", err)
+	}
+
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("socket not created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Dial() unexpected error: %v", err)
+	}
+	_ = conn.Close()
+
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() unexpected error: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("files left after close: %v", entries)
+	}
+}
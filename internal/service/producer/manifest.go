@@ -0,0 +1,99 @@
+package producer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"udpie/internal/model"
+	"udpie/internal/service/common"
+)
+
+// DescribeFile resolves the absolute path of a file or directory to share and describes it,
+// directories get a manifest of the files in them
+func DescribeFile(filePath string) (absPath, fileName string, fileSize uint64, manifest *model.Manifest, err error) {
+	// Get absolute path
+	absPath, err = filepath.Abs(filePath)
+	if err != nil {
+		return "", "", 0, nil, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	// Check if file exists
+	fileInfo, err := os.Stat(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", 0, nil, fmt.Errorf("file does not exist: %s", absPath)
+		}
+		return "", "", 0, nil, fmt.Errorf("failed to access file: %w", err)
+	}
+
+	fileName = fileInfo.Name()
+
+	if fileInfo.IsDir() {
+		// Directories are shared as a single item described by a manifest
+		manifest, err = BuildManifest(absPath)
+		if err != nil {
+			return "", "", 0, nil, err
+		}
+		return absPath, fileName, manifest.TotalSize(), manifest, nil
+	}
+
+	// nolint:gosec // fileInfo.Size() returns int64, safe to convert to uint64 for file sizes
+	fileSize = uint64(fileInfo.Size())
+
+	return absPath, fileName, fileSize, nil, nil
+}
+
+// BuildManifest walks the directory tree and describes every regular file in it.
+// Symlinks and other special files are skipped.
+func BuildManifest(root string) (*model.Manifest, error) {
+	manifest := &model.Manifest{}
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", filePath, err)
+		}
+
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path of %s: %w", filePath, err)
+		}
+
+		hash, err := common.HashFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		manifest.Entries = append(manifest.Entries, model.ManifestEntry{
+			Path: filepath.ToSlash(relPath),
+			// nolint:gosec // info.Size() returns int64, safe to convert to uint64 for file sizes
+			Size: uint64(info.Size()),
+			Mode: uint32(info.Mode().Perm()),
+			Hash: hash,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build manifest: %w", err)
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path < manifest.Entries[j].Path
+	})
+
+	if err := manifest.Validate(); err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
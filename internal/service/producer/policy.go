@@ -0,0 +1,404 @@
+package producer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/config"
+	"udpie/internal/model/contract"
+	"udpie/pkg/logutils"
+)
+
+// PolicyAction is what a policy does with a transfer request
+type PolicyAction string
+
+const (
+	PolicyAllow PolicyAction = "allow"
+	PolicyDeny  PolicyAction = "deny"
+	PolicyAsk   PolicyAction = "ask"
+)
+
+// PolicyRequest describes a transfer request checked by the policy
+type PolicyRequest struct {
+	FileId       uuid.UUID
+	FileName     string
+	Path         string  // manifest entry path for directory items
+	Share        float64 // part of the file requested, 1 for the whole file
+	ConsumerIP   net.IP
+	ConsumerName string // name of the consumer token, set by the signaller
+	Time         time.Time
+}
+
+// DownloadCounter counts accepted downloads of files. Range downloads count proportionally.
+type DownloadCounter interface {
+	GetDownloads(fileId uuid.UUID, entryPath string) float64
+	AddDownload(fileId uuid.UUID, entryPath string, share float64) error
+}
+
+// Approver asks the operator whether a request should be accepted.
+// It returns the reason when the request is declined.
+type Approver interface {
+	Approve(request PolicyRequest) (bool, string)
+}
+
+// Policy decides which transfer requests a producer accepts
+type Policy struct {
+	mu            sync.Mutex // makes limit checks and counting atomic
+	defaultAction PolicyAction
+	interactive   bool
+	rules         []policyRule
+	counter       DownloadCounter
+	approver      Approver
+}
+
+type policyRule struct {
+	name         string
+	action       PolicyAction
+	networks     []*net.IPNet
+	identities   []string
+	files        []string
+	maxDownloads int
+	window       *timeWindow
+	days         []time.Weekday
+}
+
+// timeWindow is a daily window in minutes since midnight, it wraps around midnight when from > to
+type timeWindow struct {
+	from int
+	to   int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// NewPolicy builds a policy from config. The approver is asked about requests
+// matched by "ask" rules, and about every request not denied in interactive mode.
+func NewPolicy(cfg config.PolicyConfig, counter DownloadCounter, approver Approver) (*Policy, error) {
+	policy := &Policy{
+		defaultAction: PolicyAllow,
+		interactive:   cfg.Interactive,
+		counter:       counter,
+		approver:      approver,
+	}
+
+	if cfg.Default != "" {
+		action, err := parseAction(cfg.Default)
+		if err != nil || action == PolicyAsk {
+			return nil, fmt.Errorf("invalid default policy action: %s", cfg.Default)
+		}
+		policy.defaultAction = action
+	}
+
+	for i := range cfg.Rules {
+		rule, err := newPolicyRule(&cfg.Rules[i], i)
+		if err != nil {
+			return nil, err
+		}
+		if rule.action == PolicyAsk && approver == nil {
+			return nil, fmt.Errorf("policy rule %s asks the operator but no approver is available", rule.name)
+		}
+		policy.rules = append(policy.rules, rule)
+	}
+
+	if policy.interactive && approver == nil {
+		return nil, fmt.Errorf("interactive policy requires an approver")
+	}
+
+	return policy, nil
+}
+
+func newPolicyRule(cfg *config.PolicyRuleConfig, index int) (policyRule, error) {
+	rule := policyRule{
+		name:         cfg.Name,
+		identities:   cfg.Identities,
+		files:        cfg.Files,
+		maxDownloads: cfg.MaxDownloads,
+	}
+	if rule.name == "" {
+		rule.name = fmt.Sprintf("#%d", index+1)
+	}
+
+	action, err := parseAction(cfg.Action)
+	if err != nil {
+		return rule, fmt.Errorf("policy rule %s: %w", rule.name, err)
+	}
+	rule.action = action
+
+	for _, address := range cfg.Addresses {
+		network, err := parseNetwork(address)
+		if err != nil {
+			return rule, fmt.Errorf("policy rule %s: %w", rule.name, err)
+		}
+		rule.networks = append(rule.networks, network)
+	}
+
+	for _, pattern := range cfg.Files {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return rule, fmt.Errorf("policy rule %s: invalid file pattern %q: %w", rule.name, pattern, err)
+		}
+	}
+
+	if cfg.Hours != "" {
+		window, err := parseTimeWindow(cfg.Hours)
+		if err != nil {
+			return rule, fmt.Errorf("policy rule %s: %w", rule.name, err)
+		}
+		rule.window = window
+	}
+
+	for _, day := range cfg.Days {
+		weekday, exists := weekdays[strings.ToLower(day)]
+		if !exists {
+			return rule, fmt.Errorf("policy rule %s: invalid day %q", rule.name, day)
+		}
+		rule.days = append(rule.days, weekday)
+	}
+
+	return rule, nil
+}
+
+// Check decides whether the request is accepted and returns the rejection reason otherwise.
+// Accepted requests are counted as downloads, Release takes them back if the transfer does not start.
+func (p *Policy) Check(request PolicyRequest) (bool, string) {
+	p.mu.Lock()
+	action, reason := p.evaluate(request)
+	if action == PolicyAllow && p.interactive {
+		action = PolicyAsk
+	}
+	if action == PolicyAllow {
+		p.count(request, request.Share)
+	}
+	p.mu.Unlock()
+
+	switch action {
+	case PolicyAllow:
+		return true, ""
+	case PolicyDeny:
+		return false, reason
+	default:
+	}
+
+	if approved, reason := p.approver.Approve(request); !approved {
+		return false, reason
+	}
+
+	// Limits may have been reached while the operator was deciding
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if action, reason := p.evaluate(request); action == PolicyDeny {
+		return false, reason
+	}
+	p.count(request, request.Share)
+	return true, ""
+}
+
+// Release takes back the download counted for an accepted request
+func (p *Policy) Release(request PolicyRequest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.count(request, -request.Share)
+}
+
+func (p *Policy) count(request PolicyRequest, share float64) {
+	if p.counter == nil {
+		return
+	}
+	if err := p.counter.AddDownload(request.FileId, request.Path, share); err != nil {
+		logutils.WithField("file_id", request.FileId.String()).WithError(err).Error("Failed to count download")
+	}
+}
+
+// evaluate returns the action of the first matching rule, or the default one
+func (p *Policy) evaluate(request PolicyRequest) (PolicyAction, string) {
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.matches(request) {
+			continue
+		}
+
+		if rule.action != PolicyDeny && rule.maxDownloads > 0 && p.counter != nil {
+			downloads := p.counter.GetDownloads(request.FileId, request.Path)
+			// A tiny epsilon keeps rounding of proportional range downloads from blocking the last one
+			const epsilon = 1e-9
+			if downloads+request.Share > float64(rule.maxDownloads)+epsilon {
+				return PolicyDeny, fmt.Sprintf("download limit of %d reached", rule.maxDownloads)
+			}
+		}
+
+		return rule.action, fmt.Sprintf("denied by policy rule %s", rule.name)
+	}
+
+	return p.defaultAction, "denied by default policy"
+}
+
+func (r *policyRule) matches(request PolicyRequest) bool {
+	if len(r.networks) > 0 && !slices.ContainsFunc(r.networks, func(network *net.IPNet) bool {
+		return request.ConsumerIP != nil && network.Contains(request.ConsumerIP)
+	}) {
+		return false
+	}
+
+	if len(r.identities) > 0 && !slices.Contains(r.identities, request.ConsumerName) {
+		return false
+	}
+
+	if len(r.files) > 0 && !slices.ContainsFunc(r.files, func(pattern string) bool {
+		return matchFile(pattern, request)
+	}) {
+		return false
+	}
+
+	if len(r.days) > 0 && !slices.Contains(r.days, request.Time.Weekday()) {
+		return false
+	}
+
+	if r.window != nil && !r.window.contains(request.Time) {
+		return false
+	}
+
+	return true
+}
+
+// matchFile matches a file ID, the registered name or the entry path of a directory item
+func matchFile(pattern string, request PolicyRequest) bool {
+	if pattern == request.FileId.String() {
+		return true
+	}
+
+	for _, name := range []string{request.FileName, request.Path} {
+		if name == "" {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *timeWindow) contains(t time.Time) bool {
+	const minutesPerHour = 60
+	minute := t.Hour()*minutesPerHour + t.Minute()
+	if w.from <= w.to {
+		return minute >= w.from && minute < w.to
+	}
+	return minute >= w.from || minute < w.to
+}
+
+func parseAction(action string) (PolicyAction, error) {
+	switch PolicyAction(strings.ToLower(action)) {
+	case PolicyAllow:
+		return PolicyAllow, nil
+	case PolicyDeny:
+		return PolicyDeny, nil
+	case PolicyAsk:
+		return PolicyAsk, nil
+	default:
+		return "", fmt.Errorf("invalid action %q", action)
+	}
+}
+
+// parseNetwork accepts a CIDR or a single IP address
+func parseNetwork(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", address, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", address)
+	}
+
+	const ipv4Bits, ipv6Bits = 32, 128
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ipv4Bits, ipv4Bits)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ipv6Bits, ipv6Bits)}, nil
+}
+
+// parseTimeWindow parses "HH:MM-HH:MM"
+func parseTimeWindow(hours string) (*timeWindow, error) {
+	from, to, found := strings.Cut(hours, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid hours %q, expected HH:MM-HH:MM", hours)
+	}
+
+	fromTime, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hours %q: %w", hours, err)
+	}
+	toTime, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hours %q: %w", hours, err)
+	}
+
+	const minutesPerHour = 60
+	return &timeWindow{
+		from: fromTime.Hour()*minutesPerHour + fromTime.Minute(),
+		to:   toTime.Hour()*minutesPerHour + toTime.Minute(),
+	}, nil
+}
+
+// PolicyLoader builds policies from config. Policies share a single console approver,
+// there is only one terminal to ask.
+type PolicyLoader struct {
+	counter  DownloadCounter
+	approver *ConsoleApprover
+}
+
+func NewPolicyLoader(counter DownloadCounter) *PolicyLoader {
+	return &PolicyLoader{counter: counter}
+}
+
+// Load builds a policy, the console approver is started when the config asks the operator
+func (l *PolicyLoader) Load(cfg config.PolicyConfig) (*Policy, error) {
+	var approver Approver
+	if requiresApprover(cfg) {
+		timeout := time.Duration(cfg.ApprovalTimeout) * time.Second
+		if timeout <= 0 {
+			timeout = config.DefaultApprovalTimeout * time.Second
+		}
+		if timeout >= contract.InitTransferTimeout {
+			return nil, fmt.Errorf("approval timeout must be below %s", contract.InitTransferTimeout)
+		}
+
+		if l.approver == nil {
+			l.approver = NewConsoleApprover(os.Stdin, os.Stdout, timeout)
+		} else {
+			l.approver.SetTimeout(timeout)
+		}
+		approver = l.approver
+	}
+
+	return NewPolicy(cfg, l.counter, approver)
+}
+
+// requiresApprover reports whether the config asks the operator about some requests
+func requiresApprover(cfg config.PolicyConfig) bool {
+	if cfg.Interactive {
+		return true
+	}
+	return slices.ContainsFunc(cfg.Rules, func(rule config.PolicyRuleConfig) bool {
+		return strings.EqualFold(rule.Action, string(PolicyAsk))
+	})
+}
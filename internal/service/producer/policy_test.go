@@ -0,0 +1,272 @@
+package producer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/config"
+	"udpie/internal/model"
+)
+
+type fakeCounter struct {
+	downloads map[string]float64
+}
+
+func (c *fakeCounter) GetDownloads(fileId uuid.UUID, entryPath string) float64 {
+	return c.downloads[downloadKey(fileId, entryPath)]
+}
+
+func (c *fakeCounter) AddDownload(fileId uuid.UUID, entryPath string, share float64) error {
+	c.downloads[downloadKey(fileId, entryPath)] += share
+	return nil
+}
+
+type fakeApprover struct {
+	approve bool
+	asked   int
+}
+
+func (a *fakeApprover) Approve(PolicyRequest) (bool, string) {
+	a.asked++
+	if a.approve {
+		return true, ""
+	}
+	return false, "declined by operator"
+}
+
+func TestPolicy_Check(t *testing.T) {
+	fileId := uuid.New()
+	// Wednesday
+	noon := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.Local)
+	night := time.Date(2024, time.May, 15, 23, 30, 0, 0, time.Local)
+
+	request := func(ip, name string, at time.Time) PolicyRequest {
+		return PolicyRequest{
+			FileId:       fileId,
+			FileName:     "disk.iso",
+			Share:        1,
+			ConsumerIP:   net.ParseIP(ip),
+			ConsumerName: name,
+			Time:         at,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.PolicyConfig
+		request PolicyRequest
+		allowed bool
+		reason  string
+	}{
+		{
+			name:    "default allow",
+			cfg:     config.PolicyConfig{},
+			request: request("1.2.3.4", "", noon),
+			allowed: true,
+		},
+		{
+			name:    "default deny",
+			cfg:     config.PolicyConfig{Default: "deny"},
+			request: request("1.2.3.4", "", noon),
+			reason:  "denied by default policy",
+		},
+		{
+			name: "cidr allow",
+			cfg: config.PolicyConfig{Default: "deny", Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Addresses: []string{"10.0.0.0/8"}},
+			}},
+			request: request("10.1.2.3", "", noon),
+			allowed: true,
+		},
+		{
+			name: "single ip deny",
+			cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+				{Name: "blocked", Action: "deny", Addresses: []string{"1.2.3.4"}},
+			}},
+			request: request("1.2.3.4", "", noon),
+			reason:  "denied by policy rule blocked",
+		},
+		{
+			name: "identity",
+			cfg: config.PolicyConfig{Default: "deny", Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Identities: []string{"alice"}},
+			}},
+			request: request("1.2.3.4", "bob", noon),
+			reason:  "denied by default policy",
+		},
+		{
+			name: "file pattern",
+			cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+				{Action: "deny", Files: []string{"*.iso"}},
+			}},
+			request: request("1.2.3.4", "", noon),
+			reason:  "denied by policy rule #1",
+		},
+		{
+			name: "outside hours",
+			cfg: config.PolicyConfig{Default: "deny", Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Hours: "09:00-18:00"},
+			}},
+			request: request("1.2.3.4", "", night),
+			reason:  "denied by default policy",
+		},
+		{
+			name: "hours wrapping midnight",
+			cfg: config.PolicyConfig{Default: "deny", Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Hours: "22:00-06:00"},
+			}},
+			request: request("1.2.3.4", "", night),
+			allowed: true,
+		},
+		{
+			name: "days",
+			cfg: config.PolicyConfig{Default: "deny", Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Days: []string{"sat", "sun"}},
+			}},
+			request: request("1.2.3.4", "", noon),
+			reason:  "denied by default policy",
+		},
+		{
+			name: "first matching rule wins",
+			cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+				{Action: "allow", Identities: []string{"alice"}},
+				{Action: "deny"},
+			}},
+			request: request("1.2.3.4", "alice", noon),
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.cfg, nil, nil)
+			if err != nil {
+				t.Fatalf("NewPolicy() unexpected error: %v", err)
+			}
+
+			allowed, reason := policy.Check(tt.request)
+			if allowed != tt.allowed {
+				t.Errorf("Check() allowed = %v, want %v", allowed, tt.allowed)
+			}
+			if reason != tt.reason {
+				t.Errorf("Check() reason = %q, want %q", reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestPolicy_MaxDownloads(t *testing.T) {
+	fileId := uuid.New()
+	counter := &fakeCounter{downloads: make(map[string]float64)}
+	policy, err := NewPolicy(config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+		{Action: "allow", MaxDownloads: 1},
+	}}, counter, nil)
+	if err != nil {
+		t.Fatalf("NewPolicy() unexpected error: %v", err)
+	}
+
+	half := PolicyRequest{FileId: fileId, Share: 0.5, Time: time.Now()}
+	for i := range 2 {
+		if allowed, reason := policy.Check(half); !allowed {
+			t.Fatalf("Check() half %d rejected: %s", i, reason)
+		}
+	}
+
+	if allowed, _ := policy.Check(half); allowed {
+		t.Fatal("Check() allowed a download over the limit")
+	}
+
+	// A transfer which did not start gives its share back
+	policy.Release(half)
+	if allowed, reason := policy.Check(half); !allowed {
+		t.Errorf("Check() after release rejected: %s", reason)
+	}
+}
+
+func TestPolicy_Ask(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.PolicyConfig
+		approve bool
+		allowed bool
+		asked   int
+	}{
+		{name: "ask rule approved", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{{Action: "ask"}}},
+			approve: true, allowed: true, asked: 1},
+		{name: "ask rule declined", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{{Action: "ask"}}},
+			asked: 1},
+		{name: "interactive", cfg: config.PolicyConfig{Interactive: true}, approve: true, allowed: true, asked: 1},
+		{name: "interactive does not ask about denied", cfg: config.PolicyConfig{Interactive: true, Default: "deny"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approver := &fakeApprover{approve: tt.approve}
+			policy, err := NewPolicy(tt.cfg, nil, approver)
+			if err != nil {
+				t.Fatalf("NewPolicy() unexpected error: %v", err)
+			}
+
+			allowed, _ := policy.Check(PolicyRequest{FileId: uuid.New(), Share: 1, Time: time.Now()})
+			if allowed != tt.allowed {
+				t.Errorf("Check() allowed = %v, want %v", allowed, tt.allowed)
+			}
+			if approver.asked != tt.asked {
+				t.Errorf("approver asked %d times, want %d", approver.asked, tt.asked)
+			}
+		})
+	}
+}
+
+func TestNewPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PolicyConfig
+	}{
+		{name: "default ask", cfg: config.PolicyConfig{Default: "ask"}},
+		{name: "unknown action", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{{Action: "maybe"}}}},
+		{name: "bad cidr", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+			{Action: "allow", Addresses: []string{"10.0.0.0/33"}}}}},
+		{name: "bad hours", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+			{Action: "allow", Hours: "9-18"}}}},
+		{name: "bad day", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{
+			{Action: "allow", Days: []string{"someday"}}}}},
+		{name: "ask without approver", cfg: config.PolicyConfig{Rules: []config.PolicyRuleConfig{{Action: "ask"}}}},
+		{name: "interactive without approver", cfg: config.PolicyConfig{Interactive: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicy(tt.cfg, nil, nil); err == nil {
+				t.Error("NewPolicy() expected error")
+			}
+		})
+	}
+}
+
+func TestConsumerIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		observed   string
+		advertised string
+		want       string
+	}{
+		{name: "observed by the signaller", observed: "198.51.100.7", advertised: "10.0.0.1", want: "198.51.100.7"},
+		{name: "signaller without it", advertised: "10.0.0.1", want: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := consumerIP(&model.ProducerInitTransferRequestData{
+				ConsumerIp:         tt.observed,
+				ConsumerUdpOptions: model.UdpOptions{ExternalIp: tt.advertised},
+			})
+			if !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("consumerIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,52 +1,149 @@
 package producer
 
 import (
+	"crypto/tls"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 
 	"udpie/internal/client"
+	"udpie/internal/handler"
 	"udpie/internal/model"
+	"udpie/internal/service/common"
 )
 
 type ProducerService struct {
-	signallerClient *client.SignallerClient
-	stateService    *StateService
+	signallerURL      string
+	registrationToken string
+	tlsConfig         *tls.Config
+	stateService      *StateService
 }
 
-func NewProducerService(signallerURL string, stateService *StateService) *ProducerService {
+func NewProducerService(signallerURL, registrationToken string, tlsConfig *tls.Config,
+	stateService *StateService) *ProducerService {
 	return &ProducerService{
-		signallerClient: client.NewSignallerClient(signallerURL),
-		stateService:    stateService,
+		signallerURL:      signallerURL,
+		registrationToken: registrationToken,
+		tlsConfig:         tlsConfig,
+		stateService:      stateService,
 	}
 }
 
-// Register registers a producer with the given UDP options and saves the ID
+// Register registers a producer with the given UDP options and saves the ID with the issued secret
 func (s *ProducerService) Register(udpOptions model.UdpOptions) (uuid.UUID, error) {
-	producerId, err := s.signallerClient.RegisterProducer(udpOptions)
+	result, err := client.NewSignallerClient(s.signallerURL, s.registrationToken, s.tlsConfig).RegisterProducer(udpOptions)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to register producer: %w", err)
 	}
 
-	// Save producer ID to state
-	if err := s.stateService.SetProducerId(producerId); err != nil {
+	// Save producer ID and secret to state
+	if err := s.stateService.SetProducer(result.Id, result.Secret); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to save producer ID: %w", err)
 	}
 
-	return producerId, nil
+	return result.Id, nil
 }
 
-// RegisterFile registers a file for a producer and saves the file path
-func (s *ProducerService) RegisterFile(name string, size uint64, producerId uuid.UUID, filePath string) (uuid.UUID, error) {
-	fileId, err := s.signallerClient.RegisterFile(name, size, producerId)
+// signallerClient authenticates with the secret saved at registration
+func (s *ProducerService) signallerClient() *client.SignallerClient {
+	return client.NewSignallerClient(s.signallerURL, s.stateService.GetSecret(), s.tlsConfig)
+}
+
+// RegisterFile registers a file for a producer and saves the file path.
+// Directories are registered with their manifest. Zero ttl uses the signaller default.
+func (s *ProducerService) RegisterFile(name string, size uint64, producerId uuid.UUID, filePath string,
+	manifest *model.Manifest, ttl time.Duration) (uuid.UUID, error) {
+	// Content hash lets consumers download the same file from several producers
+	var hash []byte
+	if manifest == nil {
+		var err error
+		if hash, err = common.HashFile(filePath); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	fileId, err := s.signallerClient().RegisterFile(name, size, hash, producerId, manifest, ttl)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to register file: %w", err)
 	}
 
 	// Save file info to state
-	if err := s.stateService.AddFile(fileId, name, size, filePath); err != nil {
+	if err := s.stateService.AddFile(FileInfo{
+		FileId:   fileId,
+		Name:     name,
+		Size:     size,
+		Hash:     hash,
+		FilePath: filePath,
+		Manifest: manifest,
+	}); err != nil {
 		return uuid.Nil, fmt.Errorf("failed to save file info: %w", err)
 	}
 
 	return fileId, nil
 }
+
+// UnregisterFile removes a file from the signaller and the state. A file the signaller
+// does not know any more, e.g. because it expired, is still removed from the state.
+func (s *ProducerService) UnregisterFile(fileId uuid.UUID) error {
+	signallerErr := s.signallerClient().DeleteFile(fileId)
+
+	if _, exists := s.stateService.GetFile(fileId); !exists && signallerErr != nil {
+		return fmt.Errorf("failed to unregister file: %w", signallerErr)
+	}
+	if err := s.stateService.RemoveFile(fileId); err != nil {
+		return fmt.Errorf("failed to update state: %w", err)
+	}
+
+	if signallerErr != nil {
+		return fmt.Errorf("removed from state, but the signaller failed: %w", signallerErr)
+	}
+	return nil
+}
+
+// Deregister removes the producer with its files from the signaller and clears the state.
+// It returns how many files the signaller removed.
+func (s *ProducerService) Deregister(producerId uuid.UUID) (int, error) {
+	files, err := s.signallerClient().DeleteProducer(producerId)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deregister producer: %w", err)
+	}
+
+	if err := s.stateService.ClearProducer(); err != nil {
+		return files, fmt.Errorf("failed to update state: %w", err)
+	}
+	return files, nil
+}
+
+// GetTransfers returns running and queued transfers of the producer known to the signaller
+func (s *ProducerService) GetTransfers(producerId uuid.UUID) ([]handler.TransferStatusResponse, error) {
+	transfers, err := s.signallerClient().GetProducerTransfers(producerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// CancelTransfer cancels a running or queued transfer of the producer through the signaller
+func (s *ProducerService) CancelTransfer(producerId, transferId uuid.UUID, reason string) error {
+	if err := s.signallerClient().CancelTransfer(producerId, transferId, reason); err != nil {
+		return fmt.Errorf("failed to cancel transfer: %w", err)
+	}
+	return nil
+}
+
+// PauseTransfer suspends sending a transfer of the producer through the signaller
+func (s *ProducerService) PauseTransfer(producerId, transferId uuid.UUID) error {
+	if err := s.signallerClient().PauseTransfer(producerId, transferId); err != nil {
+		return fmt.Errorf("failed to pause transfer: %w", err)
+	}
+	return nil
+}
+
+// ResumeTransfer continues sending a paused transfer of the producer through the signaller
+func (s *ProducerService) ResumeTransfer(producerId, transferId uuid.UUID) error {
+	if err := s.signallerClient().ResumeTransfer(producerId, transferId); err != nil {
+		return fmt.Errorf("failed to resume transfer: %w", err)
+	}
+	return nil
+}
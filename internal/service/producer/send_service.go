@@ -2,7 +2,9 @@ package producer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"sync"
@@ -11,12 +13,48 @@ import (
 	"github.com/google/uuid"
 
 	"udpie/internal/client"
+	"udpie/internal/config"
+	"udpie/internal/metrics"
+	"udpie/internal/model"
+	"udpie/pkg/logutils"
+	"udpie/utils"
 )
 
+// RateLimits configures producer bandwidth in bytes per second, zero rate means unlimited.
+// Zero burst defaults to one second worth of traffic.
+type RateLimits struct {
+	Rate          uint64 // all transfers together
+	Burst         uint64
+	TransferRate  uint64 // every single transfer
+	TransferBurst uint64
+}
+
+// NewRateLimits takes producer bandwidth limits from config
+func NewRateLimits(cfg config.LimitsConfig) RateLimits {
+	return RateLimits{
+		Rate:          cfg.Rate,
+		Burst:         cfg.Burst,
+		TransferRate:  cfg.TransferRate,
+		TransferBurst: cfg.TransferBurst,
+	}
+}
+
 type TransferService struct {
 	mu           sync.RWMutex
 	transfers    map[uuid.UUID]*ActiveTransfer
 	stateService *StateService
+	compressions []string // codecs enabled on this producer in order of preference
+	limits       RateLimits
+	limiter      *utils.TokenBucket // shared by all transfers
+	maxActive    int                // concurrent outgoing transfers, 0 for unlimited
+	queueSize    int                // transfers waiting for a free slot, 0 rejects them right away
+	running      int
+	queue        []*ActiveTransfer
+	queueTimeout time.Duration  // queued transfers fail after waiting this long, 0 for never
+	tailGrace    time.Duration  // lost blocks are resent this long after the range was sent
+	finished     []TransferInfo // summaries of the latest finished transfers, oldest first
+	totals       FinishedTotals // all transfers finished since start
+	onStatus     func(update model.TransferStatusUpdate)
 }
 
 type ActiveTransfer struct {
@@ -26,63 +64,156 @@ type ActiveTransfer struct {
 	BlockSize    uint64
 	TotalBlocks  uint64
 	ConsumerAddr *net.UDPAddr
+	Range        model.BlockRange
+	Compression  string
 	Status       string
 	SentBlocks   map[uint64]bool
+	DataBytes    uint64 // file bytes sent
+	WireBytes    uint64 // payload bytes sent after compression
+	MaxRate      uint64 // limit requested by the consumer, 0 for none
+	limiter      *utils.TokenBucket
+	ctx          context.Context // done once the transfer is cancelled
+	cancel       context.CancelFunc
+	resumed      chan struct{}  // closed on resume, nil while sending
+	restart      bool           // the next block is the range start again
+	received     utils.BitArray // blocks the consumer reported on resume, nil when unknown
+	pass         utils.BitArray // blocks taken for sending since the start or the last restart
+	priority     *uint64        // block the consumer asked for, sent next
+	prioritized  chan struct{}  // signalled when the consumer asks for a block, nil until the range was sent
+	expiry       *time.Timer    // fails the transfer while it waits in the queue, guarded by the service lock
+	held         bool           // not run before the consumer was answered, guarded by the service lock
+	started      bool           // sendFile was run, guarded by the service lock
 	mu           sync.Mutex
 }
 
-func NewTransferService(stateService *StateService) *TransferService {
+func NewTransferService(stateService *StateService, compressions []string, limits RateLimits) *TransferService {
 	return &TransferService{
 		transfers:    make(map[uuid.UUID]*ActiveTransfer),
 		stateService: stateService,
+		compressions: compressions,
+		limits:       limits,
+		limiter:      utils.NewTokenBucket(limits.Rate, limits.Burst),
+		queueTimeout: DefaultQueueTimeout,
+		tailGrace:    tailGracePeriod,
+	}
+}
+
+// SetLimits changes bandwidth limits, running transfers pick them up immediately
+func (s *TransferService) SetLimits(limits RateLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limits = limits
+	s.limiter.SetLimit(limits.Rate, limits.Burst)
+	for _, transfer := range s.transfers {
+		transfer.limiter.SetLimit(transferRate(limits.TransferRate, transfer.MaxRate), limits.TransferBurst)
 	}
 }
 
-// StartTransfer starts sending a file to consumer
+// GetLimits returns current bandwidth limits
+func (s *TransferService) GetLimits() RateLimits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits
+}
+
+// transferRate returns the stricter of the producer and consumer limits
+func transferRate(producerRate, consumerRate uint64) uint64 {
+	if producerRate == 0 || (consumerRate != 0 && consumerRate < producerRate) {
+		return consumerRate
+	}
+	return producerRate
+}
+
+// Compressions returns the codecs enabled on this producer in order of preference
+func (s *TransferService) Compressions() []string {
+	return s.compressions
+}
+
+// NegotiateCompression picks a codec offered by the consumer which is enabled on the producer
+func (s *TransferService) NegotiateCompression(offered []string) string {
+	return client.NegotiateCompression(offered, s.compressions)
+}
+
+// StartTransfer takes a transfer slot for sending a file to the consumer. When all transfer slots
+// are taken the transfer is queued and its 1-based queue position is returned, 0 means it has a slot.
+// ErrQueueFull is returned when the queue has no room either.
+// Nothing is sent before ReleaseTransfer, the consumer has to be told about the transfer first.
 func (s *TransferService) StartTransfer(
 	transferId uuid.UUID,
 	fileId uuid.UUID,
+	entryPath string,
 	blockSize uint64,
 	totalBlocks uint64,
+	blockRange model.BlockRange,
 	consumerAddr *net.UDPAddr,
-) error {
+	compression string,
+	maxRate uint64,
+) (int, error) {
+	if blockRange.Start > blockRange.End || blockRange.End > totalBlocks {
+		return 0, fmt.Errorf("invalid block range [%d, %d) for %d blocks", blockRange.Start, blockRange.End, totalBlocks)
+	}
+
 	// Get file info from state
 	fileInfo, exists := s.stateService.GetFile(fileId)
 	if !exists {
-		return fmt.Errorf("file not found in state: %s", fileId.String())
+		return 0, fmt.Errorf("file not found in state: %s", fileId.String())
+	}
+
+	filePath, err := fileInfo.ResolvePath(entryPath)
+	if err != nil {
+		return 0, err
 	}
 
 	// Check if file exists
-	if _, err := os.Stat(fileInfo.FilePath); err != nil {
-		return fmt.Errorf("file does not exist: %w", err)
+	if _, err := os.Stat(filePath); err != nil {
+		return 0, fmt.Errorf("file does not exist: %w", err)
+	}
+
+	s.mu.RLock()
+	_, duplicate := s.transfers[transferId]
+	s.mu.RUnlock()
+	if duplicate {
+		return 0, fmt.Errorf("transfer already exists: %s", transferId.String())
 	}
 
 	// Create active transfer
 	transfer := &ActiveTransfer{
 		TransferId:   transferId,
 		FileId:       fileId,
-		FilePath:     fileInfo.FilePath,
+		FilePath:     filePath,
 		BlockSize:    blockSize,
 		TotalBlocks:  totalBlocks,
 		ConsumerAddr: consumerAddr,
-		Status:       "sending",
+		Range:        blockRange,
+		Compression:  compression,
 		SentBlocks:   make(map[uint64]bool),
+		MaxRate:      maxRate,
+		held:         true,
 	}
+	transfer.ctx, transfer.cancel = context.WithCancel(context.Background())
 
 	s.mu.Lock()
+	if _, duplicate := s.transfers[transferId]; duplicate {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("transfer already exists: %s", transferId.String())
+	}
+	position, err := s.admit(transfer)
+	if err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	transfer.limiter = utils.NewTokenBucket(transferRate(s.limits.TransferRate, maxRate), s.limits.TransferBurst)
 	s.transfers[transferId] = transfer
 	s.mu.Unlock()
 
-	// Start sending in goroutine
-	go s.sendFile(context.Background(), transfer)
-
-	return nil
+	return position, nil
 }
 
-func (*TransferService) sendFile(ctx context.Context, transfer *ActiveTransfer) {
+func (s *TransferService) sendFile(ctx context.Context, transfer *ActiveTransfer) {
 	file, err := os.Open(transfer.FilePath)
 	if err != nil {
-		fmt.Printf("Error opening file %s: %v\n", transfer.FilePath, err)
+		transfer.logger().WithError(err).WithField("path", transfer.FilePath).Error("Failed to open file")
 		transfer.mu.Lock()
 		transfer.Status = "failed"
 		transfer.mu.Unlock()
@@ -93,7 +224,7 @@ func (*TransferService) sendFile(ctx context.Context, transfer *ActiveTransfer)
 	// Create UDP connection
 	conn, err := net.DialUDP("udp", nil, transfer.ConsumerAddr)
 	if err != nil {
-		fmt.Printf("Error creating UDP connection: %v\n", err)
+		transfer.logger().WithError(err).Error("Failed to create UDP connection")
 		transfer.mu.Lock()
 		transfer.Status = "failed"
 		transfer.mu.Unlock()
@@ -101,70 +232,225 @@ func (*TransferService) sendFile(ctx context.Context, transfer *ActiveTransfer)
 	}
 	defer conn.Close()
 
+	codec, err := client.NewCodec(transfer.Compression)
+	if err != nil {
+		transfer.logger().WithError(err).Error("Failed to create codec")
+		transfer.mu.Lock()
+		transfer.Status = "failed"
+		transfer.mu.Unlock()
+		return
+	}
+
 	transferStartTime := time.Now()
 	buffer := make([]byte, transfer.BlockSize)
 
-	fmt.Printf("Starting file transfer: %s\n", transfer.FilePath)
-	fmt.Printf("Transfer ID: %s\n", transfer.TransferId.String())
-	fmt.Printf("Total blocks: %d\n", transfer.TotalBlocks)
-	fmt.Printf("Block size: %d bytes\n", transfer.BlockSize)
-	fmt.Printf("Consumer: %s\n", transfer.ConsumerAddr.String())
-
-	// Send all blocks
-	for blockNum := range transfer.TotalBlocks {
-		select {
-		case <-ctx.Done():
-			fmt.Printf("Transfer canceled: %s\n", transfer.TransferId.String())
+	rate, _ := transfer.limiter.Limit()
+	transfer.logger().WithFields(logutils.Fields{
+		"path":         transfer.FilePath,
+		"total_blocks": transfer.TotalBlocks,
+		"range_start":  transfer.Range.Start,
+		"range_end":    transfer.Range.End,
+		"block_size":   transfer.BlockSize,
+		"consumer":     transfer.ConsumerAddr.String(),
+		"compression":  transfer.Compression,
+		"rate_limit":   rate,
+	}).Info("Starting file transfer")
+
+	// The consumer may cancel the transfer or ask for blocks first with control packets
+	go watchConsumer(conn, transfer)
+
+	// Send all blocks of the range, in order unless the consumer asks for a block
+	for blockNum := transfer.Range.Start; ; blockNum++ {
+		// A resumed transfer goes over the range again for the blocks the consumer is missing
+		restart, err := waitResumed(ctx, conn, transfer, transferStartTime)
+		if err != nil {
+			stopTransfer(conn, transfer, transferStartTime)
 			return
-		default:
+		}
+		if restart {
+			transfer.newPass()
+			blockNum = transfer.Range.Start
+		}
+		next, ok := transfer.nextBlock(blockNum)
+		if !ok {
+			// Blocks lost at the end of the range are only sent again when the consumer asks for them
+			if transfer.awaitPriority(ctx, s.tailGrace) {
+				continue
+			}
+			break
+		}
+		blockNum = next
+		if transfer.consumerHas(blockNum) {
+			continue
 		}
 
 		// Read block from file
-		n, err := file.Read(buffer)
+		// nolint:gosec // offset is bounded by the file size
+		n, err := file.ReadAt(buffer, int64(blockNum*transfer.BlockSize))
 		if err != nil && n == 0 {
-			if err.Error() == "EOF" {
+			if errors.Is(err, io.EOF) {
 				break
 			}
-			fmt.Printf("Error reading file at block %d: %v\n", blockNum, err)
+			transfer.logger().WithError(err).WithField("block", blockNum).Error("Failed to read block")
+			metrics.SendErrors.Inc()
 			continue
 		}
 
 		// Create UDP packet
 		packet := &client.UdpPacket{
-			ContentType:  0x01, // Data packet
+			ContentType:  client.ContentTypeData,
 			SerialNumber: blockNum,
 			TransferId:   transfer.TransferId,
 			Timestamp:    time.Now(),
 			Data:         buffer[:n],
 		}
+		compressBlock(codec, packet)
 
 		// Marshal packet
 		packetData, err := packet.Marshal(transferStartTime)
 		if err != nil {
-			fmt.Printf("Error marshaling packet %d: %v\n", blockNum, err)
+			transfer.logger().WithError(err).WithField("block", blockNum).Error("Failed to marshal packet")
+			metrics.SendErrors.Inc()
 			continue
 		}
 
+		// Wait for bandwidth of the transfer and of the producer as a whole
+		if err := s.waitBandwidth(ctx, transfer, len(packetData)); err != nil {
+			stopTransfer(conn, transfer, transferStartTime)
+			return
+		}
+
 		// Send packet
 		if _, err := conn.Write(packetData); err != nil {
-			fmt.Printf("Error sending packet %d: %v\n", blockNum, err)
+			transfer.logger().WithError(err).WithField("block", blockNum).Warn("Failed to send packet")
+			metrics.SendErrors.Inc()
 			continue
 		}
+		metrics.PacketsSent.Inc()
+		metrics.BytesSent.Add(float64(len(packetData)))
 
 		transfer.mu.Lock()
+		if transfer.SentBlocks[blockNum] {
+			metrics.Retransmits.Inc()
+		}
 		transfer.SentBlocks[blockNum] = true
+		// nolint:gosec // n is a non-negative read count
+		transfer.DataBytes += uint64(n)
+		transfer.WireBytes += uint64(len(packet.Data))
 		transfer.mu.Unlock()
 
-		if blockNum%100 == 0 || blockNum == transfer.TotalBlocks-1 {
-			fmt.Printf("Sent block %d/%d\n", blockNum+1, transfer.TotalBlocks)
+		if blockNum%100 == 0 || blockNum == transfer.rangeEnd()-1 {
+			transfer.logger().WithField("block", blockNum+1).Debugf("Sent block %d/%d", blockNum+1, transfer.TotalBlocks)
 		}
 	}
 
 	transfer.mu.Lock()
 	transfer.Status = "complete"
+	dataBytes, wireBytes := transfer.DataBytes, transfer.WireBytes
 	transfer.mu.Unlock()
 
-	fmt.Printf("File transfer completed: %s\n", transfer.TransferId.String())
+	entry := transfer.logger().WithField("data_bytes", dataBytes)
+	if codec != nil {
+		entry = entry.WithFields(logutils.Fields{
+			"wire_bytes":        wireBytes,
+			"compression_ratio": compressionRatio(dataBytes, wireBytes),
+		})
+	}
+	entry.Info("File transfer completed")
+}
+
+// watchConsumer cancels the transfer when the consumer sends a cancel packet, prioritizes
+// the blocks it asks for and shrinks the range when another source took over its tail.
+// It returns once the connection is closed by the finished transfer.
+func watchConsumer(conn *net.UDPConn, transfer *ActiveTransfer) {
+	buffer := make([]byte, client.MaxBlockSize)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// The consumer port may be unreachable for a while, e.g. ICMP errors before its NAT opens
+			continue
+		}
+
+		var packet client.UdpPacket
+		if packet.Unmarshal(buffer[:n], time.Now()) != nil {
+			continue
+		}
+		if packet.TransferId != transfer.TransferId {
+			continue
+		}
+		switch packet.Kind() {
+		case client.ContentTypeCancel:
+			transfer.logger().Info("Consumer cancelled transfer")
+			transfer.cancel()
+			return
+		case client.ContentTypePriority:
+			transfer.Prioritize(packet.SerialNumber)
+		case client.ContentTypeRangeEnd:
+			transfer.ShrinkRange(packet.SerialNumber)
+		}
+	}
+}
+
+// stopTransfer marks a cancelled transfer and tells the consumer to stop waiting for blocks
+func stopTransfer(conn *net.UDPConn, transfer *ActiveTransfer, transferStartTime time.Time) {
+	transfer.setStatus("cancelled")
+	transfer.logger().Info("Transfer cancelled")
+
+	packet := &client.UdpPacket{
+		ContentType: client.ContentTypeCancel,
+		TransferId:  transfer.TransferId,
+		Timestamp:   time.Now(),
+	}
+	packetData, err := packet.Marshal(transferStartTime)
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write(packetData); err != nil {
+		transfer.logger().WithError(err).Warn("Failed to send cancel packet")
+	}
+}
+
+// logger returns a log entry with the IDs of the transfer
+func (t *ActiveTransfer) logger() *logutils.Entry {
+	return logutils.WithFields(logutils.Fields{
+		"transfer_id": t.TransferId.String(),
+		"file_id":     t.FileId.String(),
+	})
+}
+
+func (s *TransferService) waitBandwidth(ctx context.Context, transfer *ActiveTransfer, size int) error {
+	// nolint:gosec // size is a non-negative packet length
+	n := uint64(size)
+	if err := transfer.limiter.Wait(ctx, n); err != nil {
+		return err
+	}
+	return s.limiter.Wait(ctx, n)
+}
+
+// compressBlock replaces the packet payload with its compressed form.
+// Incompressible blocks are left raw.
+func compressBlock(codec client.Codec, packet *client.UdpPacket) {
+	if codec == nil || len(packet.Data) == 0 {
+		return
+	}
+
+	compressed, err := codec.Compress(packet.Data)
+	if err != nil || len(compressed) >= len(packet.Data) {
+		return
+	}
+
+	packet.Data = compressed
+	packet.ContentType |= client.FlagCompressed
+}
+
+func compressionRatio(dataBytes, wireBytes uint64) float64 {
+	if wireBytes == 0 {
+		return 1
+	}
+	return float64(dataBytes) / float64(wireBytes)
 }
 
 // GetTransferStatus returns the status of a transfer
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
+
+	"udpie/internal/model"
 )
 
 const (
@@ -15,17 +19,43 @@ const (
 
 type ProducerState struct {
 	ProducerId uuid.UUID           `json:"producer_id"`
-	Files      map[string]FileInfo `json:"files"` // fileId -> FileInfo
+	Secret     string              `json:"secret,omitempty"`    // issued by the signaller at registration
+	Files      map[string]FileInfo `json:"files"`               // fileId -> FileInfo
+	Downloads  map[string]float64  `json:"downloads,omitempty"` // fileId or fileId/entry path -> accepted downloads
 }
 
 type FileInfo struct {
-	FileId   uuid.UUID `json:"file_id"`
-	Name     string    `json:"name"`
-	Size     uint64    `json:"size"`
-	FilePath string    `json:"file_path"`
+	FileId   uuid.UUID       `json:"file_id"`
+	Name     string          `json:"name"`
+	Size     uint64          `json:"size"`
+	Hash     []byte          `json:"hash,omitempty"`     // sha256 of a single file content
+	FilePath string          `json:"file_path"`          // file path or directory root
+	Manifest *model.Manifest `json:"manifest,omitempty"` // set for directory items
+}
+
+// ResolvePath returns the path on disk of the transferred content.
+// For directory items entryPath must be listed in the manifest.
+func (f *FileInfo) ResolvePath(entryPath string) (string, error) {
+	if f.Manifest == nil {
+		if entryPath != "" {
+			return "", fmt.Errorf("file %s is not a directory", f.FileId.String())
+		}
+		return f.FilePath, nil
+	}
+
+	if _, exists := f.Manifest.Find(entryPath); !exists {
+		return "", fmt.Errorf("manifest entry not found: %s", entryPath)
+	}
+
+	if err := model.ValidateEntryPath(entryPath); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(f.FilePath, filepath.FromSlash(entryPath)), nil
 }
 
 type StateService struct {
+	mu        sync.RWMutex
 	stateFile string
 	state     *ProducerState
 }
@@ -38,13 +68,17 @@ func NewStateService(stateFile string) *StateService {
 	return &StateService{
 		stateFile: stateFile,
 		state: &ProducerState{
-			Files: make(map[string]FileInfo),
+			Files:     make(map[string]FileInfo),
+			Downloads: make(map[string]float64),
 		},
 	}
 }
 
 // Load loads state from file
 func (s *StateService) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	data, err := os.ReadFile(s.stateFile)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -61,12 +95,21 @@ func (s *StateService) Load() error {
 	if s.state.Files == nil {
 		s.state.Files = make(map[string]FileInfo)
 	}
+	if s.state.Downloads == nil {
+		s.state.Downloads = make(map[string]float64)
+	}
 
 	return nil
 }
 
 // Save saves state to file
 func (s *StateService) Save() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.save()
+}
+
+func (s *StateService) save() error {
 	data, err := json.MarshalIndent(s.state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
@@ -91,36 +134,107 @@ func (s *StateService) Save() error {
 
 // GetProducerId returns the saved producer ID
 func (s *StateService) GetProducerId() (uuid.UUID, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if s.state.ProducerId == uuid.Nil {
 		return uuid.Nil, false
 	}
 	return s.state.ProducerId, true
 }
 
-// SetProducerId sets and saves the producer ID
-func (s *StateService) SetProducerId(producerId uuid.UUID) error {
+// SetProducer sets and saves the producer ID with the secret it authenticates with
+func (s *StateService) SetProducer(producerId uuid.UUID, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.state.ProducerId = producerId
-	return s.Save()
+	s.state.Secret = secret
+	return s.save()
+}
+
+// GetSecret returns the saved producer secret
+func (s *StateService) GetSecret() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Secret
 }
 
-// AddFile adds a file to the state
-func (s *StateService) AddFile(fileId uuid.UUID, name string, size uint64, filePath string) error {
-	s.state.Files[fileId.String()] = FileInfo{
-		FileId:   fileId,
-		Name:     name,
-		Size:     size,
-		FilePath: filePath,
+// AddFile adds a file or a directory (with its manifest) to the state
+func (s *StateService) AddFile(info FileInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Files[info.FileId.String()] = info
+	return s.save()
+}
+
+// RemoveFile removes a file and its download counts from the state
+func (s *StateService) RemoveFile(fileId uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.state.Files, fileId.String())
+	for key := range s.state.Downloads {
+		if key == fileId.String() || strings.HasPrefix(key, fileId.String()+"/") {
+			delete(s.state.Downloads, key)
+		}
 	}
-	return s.Save()
+	return s.save()
+}
+
+// ClearProducer forgets the producer identity and its files
+func (s *StateService) ClearProducer() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.ProducerId = uuid.Nil
+	s.state.Secret = ""
+	s.state.Files = make(map[string]FileInfo)
+	s.state.Downloads = make(map[string]float64)
+	return s.save()
 }
 
 // GetFile returns file info by file ID
 func (s *StateService) GetFile(fileId uuid.UUID) (FileInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	info, exists := s.state.Files[fileId.String()]
 	return info, exists
 }
 
 // GetAllFiles returns all registered files
 func (s *StateService) GetAllFiles() map[string]FileInfo {
-	return s.state.Files
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := make(map[string]FileInfo, len(s.state.Files))
+	for id, info := range s.state.Files {
+		files[id] = info
+	}
+	return files
+}
+
+// GetDownloads returns how many times a file or a directory entry was downloaded
+func (s *StateService) GetDownloads(fileId uuid.UUID, entryPath string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Downloads[downloadKey(fileId, entryPath)]
+}
+
+// AddDownload counts an accepted download, share is the requested part of the file
+func (s *StateService) AddDownload(fileId uuid.UUID, entryPath string, share float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Downloads[downloadKey(fileId, entryPath)] += share
+	return s.save()
+}
+
+func downloadKey(fileId uuid.UUID, entryPath string) string {
+	if entryPath == "" {
+		return fileId.String()
+	}
+	return fileId.String() + "/" + entryPath
 }
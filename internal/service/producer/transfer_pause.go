@@ -0,0 +1,137 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/client"
+	"udpie/utils"
+)
+
+// keepaliveInterval is how often a paused transfer pings the consumer to keep its NAT mapping open
+const keepaliveInterval = 15 * time.Second
+
+// ErrTransferNotRunning is returned when pausing or resuming a transfer which is not sending
+var ErrTransferNotRunning = errors.New("transfer is not running")
+
+// PauseTransfer suspends sending a running transfer, it keeps its slot until it is resumed or cancelled
+func (s *TransferService) PauseTransfer(transferId uuid.UUID) error {
+	transfer, err := s.runningTransfer(transferId)
+	if err != nil {
+		return err
+	}
+
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+	if transfer.resumed == nil {
+		transfer.resumed = make(chan struct{})
+	}
+	return nil
+}
+
+// ResumeTransfer continues a paused transfer. When received is set it is the bitmap of blocks
+// the consumer already has, the missing blocks of the range are sent again from its start.
+func (s *TransferService) ResumeTransfer(transferId uuid.UUID, received []byte) error {
+	transfer, err := s.runningTransfer(transferId)
+	if err != nil {
+		return err
+	}
+
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+	if transfer.resumed == nil {
+		return nil
+	}
+	if len(received) > 0 {
+		transfer.received = utils.NewBitArrayFromBytes(received, transfer.TotalBlocks)
+		transfer.restart = true
+	}
+	close(transfer.resumed)
+	transfer.resumed = nil
+	return nil
+}
+
+func (s *TransferService) runningTransfer(transferId uuid.UUID) (*ActiveTransfer, error) {
+	transfer, exists := s.GetTransferStatus(transferId)
+	if !exists {
+		if _, finished := s.finishedTransfer(transferId); finished {
+			return nil, ErrTransferNotRunning
+		}
+		return nil, ErrTransferNotFound
+	}
+	if transfer.GetStatus() != "sending" {
+		return nil, ErrTransferNotRunning
+	}
+	return transfer, nil
+}
+
+// IsPaused reports whether sending is suspended
+func (t *ActiveTransfer) IsPaused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resumed != nil
+}
+
+// consumerHas reports whether the consumer reported the block received when the transfer was resumed
+func (t *ActiveTransfer) consumerHas(blockNum uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.received != nil && t.received.Get(blockNum)
+}
+
+// waitResumed blocks while the transfer is paused, pinging the consumer meanwhile.
+// It reports whether sending has to start over the range after a resume with the consumer bitmap.
+func waitResumed(ctx context.Context, conn *net.UDPConn, transfer *ActiveTransfer,
+	transferStartTime time.Time) (bool, error) {
+	var ticker *time.Ticker
+	for {
+		transfer.mu.Lock()
+		resumed := transfer.resumed
+		restart := transfer.restart
+		if resumed == nil {
+			transfer.restart = false
+		}
+		transfer.mu.Unlock()
+
+		if resumed == nil {
+			if ticker != nil {
+				ticker.Stop()
+				transfer.logger().Info("Transfer resumed")
+			}
+			return restart, ctx.Err()
+		}
+
+		if ticker == nil {
+			transfer.logger().Info("Transfer paused")
+			ticker = time.NewTicker(keepaliveInterval)
+		}
+		select {
+		case <-ctx.Done():
+			ticker.Stop()
+			return false, ctx.Err()
+		case <-resumed:
+		case <-ticker.C:
+			keepalive(conn, transfer, transferStartTime)
+		}
+	}
+}
+
+// keepalive sends a ping the consumer ignores, it only keeps the path through NATs open
+func keepalive(conn *net.UDPConn, transfer *ActiveTransfer, transferStartTime time.Time) {
+	packet := &client.UdpPacket{
+		ContentType: client.ContentTypePing,
+		TransferId:  transfer.TransferId,
+		Timestamp:   time.Now(),
+	}
+	packetData, err := packet.Marshal(transferStartTime)
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write(packetData); err != nil {
+		transfer.logger().WithError(err).Warn("Failed to send keepalive")
+	}
+}
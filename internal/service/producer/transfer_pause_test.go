@@ -0,0 +1,77 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTransferService_PauseResume(t *testing.T) {
+	s := newQueueTestService(1, 1)
+
+	running := &ActiveTransfer{TransferId: uuid.New(), TotalBlocks: 16}
+	queued := &ActiveTransfer{TransferId: uuid.New(), TotalBlocks: 16}
+	for _, transfer := range []*ActiveTransfer{running, queued} {
+		if _, err := s.admit(transfer); err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+		s.transfers[transfer.TransferId] = transfer
+	}
+
+	if err := s.PauseTransfer(queued.TransferId); !errors.Is(err, ErrTransferNotRunning) {
+		t.Errorf("PauseTransfer() queued = %v, want %v", err, ErrTransferNotRunning)
+	}
+	if err := s.PauseTransfer(uuid.New()); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("PauseTransfer() unknown = %v, want %v", err, ErrTransferNotFound)
+	}
+
+	if err := s.PauseTransfer(running.TransferId); err != nil {
+		t.Fatalf("PauseTransfer() unexpected error: %v", err)
+	}
+	if !running.IsPaused() {
+		t.Fatal("transfer is not paused")
+	}
+
+	type result struct {
+		restart bool
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		restart, err := waitResumed(context.Background(), nil, running, time.Now())
+		done <- result{restart, err}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("waitResumed() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := s.ResumeTransfer(running.TransferId, []byte{0b00000110}); err != nil {
+		t.Fatalf("ResumeTransfer() unexpected error: %v", err)
+	}
+
+	select {
+	case got := <-done:
+		if got.err != nil || !got.restart {
+			t.Errorf("waitResumed() = %v, %v, want restart", got.restart, got.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitResumed() did not return after resume")
+	}
+
+	for block, want := range map[uint64]bool{0: false, 1: true, 2: true, 3: false} {
+		if got := running.consumerHas(block); got != want {
+			t.Errorf("consumerHas(%d) = %v, want %v", block, got, want)
+		}
+	}
+
+	// The restart is taken once
+	if restart, err := waitResumed(context.Background(), nil, running, time.Now()); restart || err != nil {
+		t.Errorf("waitResumed() again = %v, %v, want no restart", restart, err)
+	}
+}
@@ -0,0 +1,115 @@
+package producer
+
+import (
+	"context"
+	"time"
+
+	"udpie/utils"
+)
+
+// tailGracePeriod is how long a transfer which sent its whole range keeps serving requests for blocks,
+// the consumer asks again for the ones lost on the way. Every request starts the period over.
+const tailGracePeriod = 5 * time.Second
+
+// Prioritize moves sending to the block, the blocks it skips are sent once the end of the range is reached.
+// A block already sent is sent again, the consumer asking for it lost it.
+func (t *ActiveTransfer) Prioritize(blockNum uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.Range.Contains(blockNum) {
+		return
+	}
+	t.priority = &blockNum
+	if t.prioritized != nil {
+		select {
+		case t.prioritized <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// awaitPriority waits for the consumer to ask for a block once the range was sent. It returns false
+// when nothing was asked for within the grace period and true when a block was or ctx is done.
+func (t *ActiveTransfer) awaitPriority(ctx context.Context, grace time.Duration) bool {
+	t.mu.Lock()
+	if t.priority != nil {
+		t.mu.Unlock()
+		return true
+	}
+	if t.prioritized == nil {
+		t.prioritized = make(chan struct{}, 1)
+	}
+	prioritized := t.prioritized
+	t.mu.Unlock()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-prioritized:
+		return true
+	case <-ctx.Done():
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// ShrinkRange ends the range of the transfer before the block, the consumer gets the blocks from there on
+// from another source. Ranges only shrink and never become empty.
+func (t *ActiveTransfer) ShrinkRange(end uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if end <= t.Range.Start || end >= t.Range.End {
+		return
+	}
+	t.Range.End = end
+	if t.priority != nil && *t.priority >= end {
+		t.priority = nil
+	}
+}
+
+// rangeEnd returns the end of the range, it may shrink while sending
+func (t *ActiveTransfer) rangeEnd() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Range.End
+}
+
+// nextBlock takes the block to send at or after blockNum, false once every block of the range was taken
+// in this pass. A prioritized block comes first, the search wraps around at the end of the range
+// for the blocks skipped by a priority jump.
+func (t *ActiveTransfer) nextBlock(blockNum uint64) (uint64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pass == nil {
+		t.pass = utils.NewBitArray(t.TotalBlocks)
+	}
+	if t.priority != nil {
+		blockNum = *t.priority
+		t.priority = nil
+		t.pass.Clear(blockNum)
+	}
+	if !t.Range.Contains(blockNum) {
+		blockNum = t.Range.Start
+	}
+
+	n := t.Range.Len()
+	for i := range n {
+		block := t.Range.Start + (blockNum-t.Range.Start+i)%n
+		if t.pass.Get(block) {
+			continue
+		}
+		t.pass.Set(block)
+		return block, true
+	}
+	return 0, false
+}
+
+// newPass forgets the blocks taken so far, a resumed transfer goes over the range again
+func (t *ActiveTransfer) newPass() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pass = nil
+	t.priority = nil
+}
@@ -0,0 +1,187 @@
+package producer
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/client"
+	"udpie/internal/model"
+	"udpie/utils"
+)
+
+func TestActiveTransfer_NextBlock(t *testing.T) {
+	tests := []struct {
+		name       string
+		blockRange model.BlockRange
+		priorities map[int]uint64 // blocks prioritized after the given number of blocks was taken
+		want       []uint64
+	}{
+		{
+			name:       "in order",
+			blockRange: model.BlockRange{Start: 0, End: 5},
+			want:       []uint64{0, 1, 2, 3, 4},
+		},
+		{
+			name:       "jump ahead sends skipped blocks at the end",
+			blockRange: model.BlockRange{Start: 0, End: 6},
+			priorities: map[int]uint64{1: 4},
+			want:       []uint64{0, 4, 5, 1, 2, 3},
+		},
+		{
+			name:       "jump back sends a lost block again",
+			blockRange: model.BlockRange{Start: 0, End: 5},
+			priorities: map[int]uint64{3: 1},
+			want:       []uint64{0, 1, 2, 1, 3, 4},
+		},
+		{
+			name:       "blocks outside the range are ignored",
+			blockRange: model.BlockRange{Start: 2, End: 5},
+			priorities: map[int]uint64{1: 7},
+			want:       []uint64{2, 3, 4},
+		},
+		{
+			name:       "empty range",
+			blockRange: model.BlockRange{Start: 3, End: 3},
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer := &ActiveTransfer{TotalBlocks: 8, Range: tt.blockRange}
+
+			var got []uint64
+			for blockNum := tt.blockRange.Start; ; blockNum++ {
+				if priority, ok := tt.priorities[len(got)]; ok {
+					transfer.Prioritize(priority)
+				}
+				next, ok := transfer.nextBlock(blockNum)
+				if !ok {
+					break
+				}
+				blockNum = next
+				got = append(got, blockNum)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blocks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveTransfer_ShrinkRange(t *testing.T) {
+	transfer := &ActiveTransfer{TotalBlocks: 8, Range: model.BlockRange{Start: 0, End: 8}}
+
+	var got []uint64
+	for blockNum := uint64(0); ; blockNum++ {
+		if len(got) == 2 {
+			// Another source took over blocks 5..7, growing or emptying the range is ignored
+			transfer.ShrinkRange(5)
+			transfer.ShrinkRange(7)
+			transfer.ShrinkRange(0)
+		}
+		next, ok := transfer.nextBlock(blockNum)
+		if !ok {
+			break
+		}
+		blockNum = next
+		got = append(got, blockNum)
+	}
+
+	if want := []uint64{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %v, want %v", got, want)
+	}
+}
+
+func TestTransferService_ResendsLostTail(t *testing.T) {
+	const blockSize, totalBlocks = 4, 4
+	filePath := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filePath, []byte("aaaabbbbccccdddd"), 0600); err != nil {
+		t.Fatalf("WriteFile() unexpected error: %v", err)
+	}
+	consumerConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() unexpected error: %v", err)
+	}
+	defer consumerConn.Close()
+
+	s := newQueueTestService(0, 0)
+	s.tailGrace = 200 * time.Millisecond
+	transfer := &ActiveTransfer{
+		TransferId:   uuid.New(),
+		FilePath:     filePath,
+		BlockSize:    blockSize,
+		TotalBlocks:  totalBlocks,
+		ConsumerAddr: consumerConn.LocalAddr().(*net.UDPAddr),
+		Range:        model.BlockRange{Start: 0, End: totalBlocks},
+		SentBlocks:   make(map[uint64]bool),
+		limiter:      utils.NewTokenBucket(0, 0),
+	}
+	transfer.ctx, transfer.cancel = context.WithCancel(context.Background())
+	defer transfer.cancel()
+
+	startTime := time.Now()
+	done := make(chan struct{})
+	go func() {
+		s.sendFile(transfer.ctx, transfer)
+		close(done)
+	}()
+
+	// The last block is lost on the way, the consumer asks for it once the others arrived
+	receive := func() (uint64, *net.UDPAddr) {
+		_ = consumerConn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, client.MaxBlockSize)
+		n, addr, err := consumerConn.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("block not received: %v", err)
+		}
+		var packet client.UdpPacket
+		if err := packet.Unmarshal(buffer[:n], startTime); err != nil {
+			t.Fatalf("Unmarshal() unexpected error: %v", err)
+		}
+		return packet.SerialNumber, addr
+	}
+	var producerAddr *net.UDPAddr
+	for want := range uint64(totalBlocks) {
+		var block uint64
+		block, producerAddr = receive()
+		if block != want {
+			t.Fatalf("received block %d, want %d", block, want)
+		}
+	}
+
+	request := &client.UdpPacket{
+		ContentType:  client.ContentTypePriority,
+		SerialNumber: totalBlocks - 1,
+		TransferId:   transfer.TransferId,
+		Timestamp:    time.Now(),
+	}
+	data, err := request.Marshal(time.Now())
+	if err != nil {
+		t.Fatalf("Marshal() unexpected error: %v", err)
+	}
+	if _, err := consumerConn.WriteToUDP(data, producerAddr); err != nil {
+		t.Fatalf("WriteToUDP() unexpected error: %v", err)
+	}
+	if block, _ := receive(); block != totalBlocks-1 {
+		t.Errorf("resent block %d, want %d", block, totalBlocks-1)
+	}
+
+	// Nothing else is asked for, the transfer completes after the grace period
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer did not end after the grace period")
+	}
+	if status := transfer.GetStatus(); status != "complete" {
+		t.Errorf("status = %q, want complete", status)
+	}
+}
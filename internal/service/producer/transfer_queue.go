@@ -0,0 +1,427 @@
+package producer
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/pkg/logutils"
+)
+
+// ErrQueueFull is returned when no transfer slot is free and the queue has no room
+var ErrQueueFull = errors.New("all transfer slots are busy and the queue is full")
+
+// ErrTransferNotFound is returned for transfers this producer does not know about
+var ErrTransferNotFound = errors.New("transfer not found")
+
+// ErrTransferFinished is returned when cancelling a transfer which is no longer running or queued
+var ErrTransferFinished = errors.New("transfer is already finished")
+
+// DefaultQueueTimeout is how long a transfer waits in the queue before it is dropped,
+// the consumer most likely gave up on it by then
+const DefaultQueueTimeout = 30 * time.Minute
+
+// maxFinishedTransfers bounds the summaries of finished transfers kept for the control API
+const maxFinishedTransfers = 100
+
+// FinishedTotals sums up the transfers finished since the producer started
+type FinishedTotals struct {
+	Count     int
+	DataBytes uint64
+	WireBytes uint64
+}
+
+// QueueState describes running and waiting transfers
+type QueueState struct {
+	MaxActive int
+	QueueSize int
+	Running   []uuid.UUID
+	Queued    []uuid.UUID // in queue order
+}
+
+// SetQueueLimits changes the number of concurrent transfers and the queue size.
+// Zero maxActive means unlimited, zero queueSize rejects transfers when all slots are busy.
+// Transfers already queued are kept even if the queue shrinks.
+func (s *TransferService) SetQueueLimits(maxActive, queueSize int) {
+	s.mu.Lock()
+	s.maxActive = maxActive
+	s.queueSize = queueSize
+	started, queued := s.dequeue()
+	s.mu.Unlock()
+
+	s.startQueued(started, queued)
+}
+
+// SetQueueTimeout changes how long transfers wait in the queue before they fail, zero keeps them until they start.
+// Transfers already queued keep their timeout.
+func (s *TransferService) SetQueueTimeout(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queueTimeout = timeout
+}
+
+// OnStatusChange sets a callback receiving transfer state changes, e.g. to report them to the signaller
+func (s *TransferService) OnStatusChange(handler func(update model.TransferStatusUpdate)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onStatus = handler
+}
+
+// GetQueueState returns running and queued transfers
+func (s *TransferService) GetQueueState() QueueState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	state := QueueState{
+		MaxActive: s.maxActive,
+		QueueSize: s.queueSize,
+		Queued:    make([]uuid.UUID, 0, len(s.queue)),
+	}
+	for _, transfer := range s.queue {
+		state.Queued = append(state.Queued, transfer.TransferId)
+	}
+	for id, transfer := range s.transfers {
+		if transfer.GetStatus() == "sending" {
+			state.Running = append(state.Running, id)
+		}
+	}
+	return state
+}
+
+// admit takes a transfer slot or a queue place for the transfer. Must be called with s.mu held.
+func (s *TransferService) admit(transfer *ActiveTransfer) (int, error) {
+	if s.maxActive == 0 || s.running < s.maxActive {
+		s.running++
+		transfer.setStatus("sending")
+		return 0, nil
+	}
+
+	if len(s.queue) >= s.queueSize {
+		return 0, ErrQueueFull
+	}
+
+	transfer.setStatus("queued")
+	s.queue = append(s.queue, transfer)
+	if s.queueTimeout > 0 {
+		transfer.expiry = time.AfterFunc(s.queueTimeout, func() { s.expire(transfer) })
+	}
+	return len(s.queue), nil
+}
+
+// dequeue moves queued transfers into free slots and returns the started ones
+// and the ones still waiting. Must be called with s.mu held.
+func (s *TransferService) dequeue() (started, queued []*ActiveTransfer) {
+	for len(s.queue) > 0 && (s.maxActive == 0 || s.running < s.maxActive) {
+		transfer := s.queue[0]
+		s.queue = s.queue[1:]
+		transfer.stopExpiry()
+		s.running++
+		transfer.setStatus("sending")
+		started = append(started, transfer)
+	}
+
+	if len(started) > 0 {
+		queued = append(queued, s.queue...)
+	}
+	return started, queued
+}
+
+// CancelTransfer stops a running transfer or removes a queued one. Running transfers
+// report the cancellation once their sender stopped, queued ones right away.
+func (s *TransferService) CancelTransfer(transferId uuid.UUID) error {
+	s.mu.Lock()
+	transfer, exists := s.transfers[transferId]
+	if !exists {
+		s.mu.Unlock()
+		if _, finished := s.finishedTransfer(transferId); finished {
+			return ErrTransferFinished
+		}
+		return ErrTransferNotFound
+	}
+
+	switch transfer.GetStatus() {
+	case "sending":
+		if !transfer.started {
+			// Held in its slot, no sender reports the cancellation or frees the slot
+			s.running--
+			started, _ := s.dequeue()
+			s.drop(transfer, "cancelled")
+			s.startQueued(started, nil)
+			return nil
+		}
+		s.mu.Unlock()
+		transfer.cancel()
+		return nil
+	case "queued":
+	default:
+		s.mu.Unlock()
+		return ErrTransferFinished
+	}
+
+	s.drop(transfer, "cancelled")
+	return nil
+}
+
+// expire fails a transfer which waited too long in the queue
+func (s *TransferService) expire(transfer *ActiveTransfer) {
+	s.mu.Lock()
+	if transfer.GetStatus() != "queued" {
+		s.mu.Unlock()
+		return
+	}
+
+	logutils.WithField("transfer_id", transfer.TransferId.String()).Warn("Queued transfer expired")
+	s.drop(transfer, "failed")
+}
+
+// drop removes a queued transfer, reports its new status and the new positions of the others.
+// Must be called with s.mu held, it is released.
+func (s *TransferService) drop(transfer *ActiveTransfer, status string) {
+	s.queue = slices.DeleteFunc(s.queue, func(queued *ActiveTransfer) bool { return queued == transfer })
+	transfer.stopExpiry()
+	transfer.setStatus(status)
+	transfer.cancel()
+	s.retire(transfer)
+	queued := slices.Clone(s.queue)
+	s.mu.Unlock()
+
+	s.notify(model.TransferStatusUpdate{
+		TransferId: transfer.TransferId,
+		Status:     transferStatus(status),
+	})
+	s.startQueued(nil, queued)
+}
+
+// retire replaces a finished transfer with its summary, the sent blocks are not kept.
+// Must be called with s.mu held.
+func (s *TransferService) retire(transfer *ActiveTransfer) {
+	delete(s.transfers, transfer.TransferId)
+
+	info := transfer.info(0)
+	s.totals.Count++
+	s.totals.DataBytes += info.DataBytes
+	s.totals.WireBytes += info.WireBytes
+	s.finished = append(s.finished, info)
+	if len(s.finished) > maxFinishedTransfers {
+		s.finished = slices.Delete(s.finished, 0, len(s.finished)-maxFinishedTransfers)
+	}
+}
+
+// finishedTransfer returns the summary of a recently finished transfer
+func (s *TransferService) finishedTransfer(transferId uuid.UUID) (TransferInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, info := range s.finished {
+		if info.Id == transferId {
+			return info, true
+		}
+	}
+	return TransferInfo{}, false
+}
+
+// FinishedTotals returns the number and the sent bytes of all transfers finished since start
+func (s *TransferService) FinishedTotals() FinishedTotals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.totals
+}
+
+// stopExpiry stops the queue timeout of a transfer leaving the queue. Must be called with s.mu held.
+func (t *ActiveTransfer) stopExpiry() {
+	if t.expiry != nil {
+		t.expiry.Stop()
+		t.expiry = nil
+	}
+}
+
+// ReleaseTransfer lets a transfer taken by StartTransfer send once it has a slot,
+// it is called after the consumer was told about the transfer
+func (s *TransferService) ReleaseTransfer(transferId uuid.UUID) {
+	s.mu.Lock()
+	transfer, exists := s.transfers[transferId]
+	if exists {
+		transfer.held = false
+	}
+	s.mu.Unlock()
+
+	if exists {
+		s.launch(transfer)
+	}
+}
+
+// launch runs a transfer which has a slot unless it is held or already running
+func (s *TransferService) launch(transfer *ActiveTransfer) {
+	s.mu.Lock()
+	ready := !transfer.held && !transfer.started && transfer.GetStatus() == "sending"
+	if ready {
+		transfer.started = true
+	}
+	s.mu.Unlock()
+
+	if ready {
+		s.run(transfer)
+	}
+}
+
+// startQueued runs transfers which got a slot and reports new positions of the waiting ones
+func (s *TransferService) startQueued(started, queued []*ActiveTransfer) {
+	for _, transfer := range started {
+		s.launch(transfer)
+	}
+	for i, transfer := range queued {
+		s.notify(model.TransferStatusUpdate{
+			TransferId:    transfer.TransferId,
+			Status:        model.TransferStatusQueued,
+			QueuePosition: i + 1,
+		})
+	}
+}
+
+// run sends the file in a goroutine and hands the slot over to the next queued transfer when done
+func (s *TransferService) run(transfer *ActiveTransfer) {
+	s.notify(model.TransferStatusUpdate{
+		TransferId: transfer.TransferId,
+		Status:     model.TransferStatusDataSending,
+	})
+
+	go func() {
+		s.sendFile(transfer.ctx, transfer)
+		transfer.cancel()
+
+		s.notify(model.TransferStatusUpdate{
+			TransferId: transfer.TransferId,
+			Status:     transferStatus(transfer.GetStatus()),
+		})
+
+		s.mu.Lock()
+		s.running--
+		s.retire(transfer)
+		started, queued := s.dequeue()
+		s.mu.Unlock()
+
+		s.startQueued(started, queued)
+	}()
+}
+
+// transferStatus maps the local status of a transfer to the one reported to the signaller
+func transferStatus(status string) model.TransferStatus {
+	switch status {
+	case "queued":
+		return model.TransferStatusQueued
+	case "sending":
+		return model.TransferStatusDataSending
+	case "complete":
+		return model.TransferStatusComplete
+	case "cancelled":
+		return model.TransferStatusCancelled
+	default:
+		return model.TransferStatusFailed
+	}
+}
+
+func (s *TransferService) notify(update model.TransferStatusUpdate) {
+	s.mu.RLock()
+	handler := s.onStatus
+	s.mu.RUnlock()
+
+	if handler != nil {
+		handler(update)
+	}
+}
+
+func (t *ActiveTransfer) setStatus(status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Status = status
+}
+
+// GetStatus returns the status string of a transfer
+func (t *ActiveTransfer) GetStatus() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Status
+}
+
+// StatusUpdates returns the current state of running and queued transfers,
+// e.g. to announce them to the signaller after reconnecting
+func (s *TransferService) StatusUpdates() []model.TransferStatusUpdate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	updates := make([]model.TransferStatusUpdate, 0, len(s.transfers))
+	for id, transfer := range s.transfers {
+		if transfer.GetStatus() == "sending" {
+			status := model.TransferStatusDataSending
+			if transfer.IsPaused() {
+				status = model.TransferStatusPaused
+			}
+			updates = append(updates, model.TransferStatusUpdate{
+				TransferId: id,
+				Status:     status,
+			})
+		}
+	}
+	for i, transfer := range s.queue {
+		updates = append(updates, model.TransferStatusUpdate{
+			TransferId:    transfer.TransferId,
+			Status:        model.TransferStatusQueued,
+			QueuePosition: i + 1,
+		})
+	}
+	return updates
+}
+
+// TransferInfo describes a transfer of this producer, e.g. for the control API
+type TransferInfo struct {
+	Id            uuid.UUID `json:"id"`
+	FileId        uuid.UUID `json:"file_id"`
+	Status        string    `json:"status"`                   // queued, sending, paused, complete or cancelled
+	QueuePosition int       `json:"queue_position,omitempty"` // 1-based while queued
+	SentBlocks    int       `json:"sent_blocks"`
+	TotalBlocks   uint64    `json:"total_blocks"`
+	DataBytes     uint64    `json:"data_bytes"` // file bytes sent
+	WireBytes     uint64    `json:"wire_bytes"` // payload bytes sent after compression
+}
+
+// Transfers describes unfinished transfers, queued ones in queue order first, and the latest finished ones
+func (s *TransferService) Transfers() []TransferInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := make([]TransferInfo, 0, len(s.transfers)+len(s.finished))
+	positions := make(map[uuid.UUID]int, len(s.queue))
+	for i, transfer := range s.queue {
+		positions[transfer.TransferId] = i + 1
+		infos = append(infos, transfer.info(i+1))
+	}
+	for id, transfer := range s.transfers {
+		if _, queued := positions[id]; !queued {
+			infos = append(infos, transfer.info(0))
+		}
+	}
+	return append(infos, s.finished...)
+}
+
+func (t *ActiveTransfer) info(queuePosition int) TransferInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := t.Status
+	if status == "sending" && t.resumed != nil {
+		status = "paused"
+	}
+	return TransferInfo{
+		Id:            t.TransferId,
+		FileId:        t.FileId,
+		Status:        status,
+		QueuePosition: queuePosition,
+		SentBlocks:    len(t.SentBlocks),
+		TotalBlocks:   t.TotalBlocks,
+		DataBytes:     t.DataBytes,
+		WireBytes:     t.WireBytes,
+	}
+}
@@ -0,0 +1,340 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+)
+
+func newQueueTestService(maxActive, queueSize int) *TransferService {
+	s := NewTransferService(nil, nil, RateLimits{})
+	s.maxActive = maxActive
+	s.queueSize = queueSize
+	return s
+}
+
+func TestTransferService_Admit(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxActive int
+		queueSize int
+		admitted  int
+		positions []int
+		rejected  int
+	}{
+		{name: "unlimited", maxActive: 0, queueSize: 0, admitted: 5, positions: []int{0, 0, 0, 0, 0}},
+		{name: "no queue", maxActive: 2, queueSize: 0, admitted: 4, positions: []int{0, 0}, rejected: 2},
+		{name: "queue", maxActive: 1, queueSize: 2, admitted: 4, positions: []int{0, 1, 2}, rejected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newQueueTestService(tt.maxActive, tt.queueSize)
+
+			var positions []int
+			rejected := 0
+			for range tt.admitted {
+				position, err := s.admit(&ActiveTransfer{TransferId: uuid.New()})
+				if errors.Is(err, ErrQueueFull) {
+					rejected++
+					continue
+				}
+				if err != nil {
+					t.Fatalf("admit() unexpected error: %v", err)
+				}
+				positions = append(positions, position)
+			}
+
+			if len(positions) != len(tt.positions) {
+				t.Fatalf("admitted %d transfers, want %d", len(positions), len(tt.positions))
+			}
+			for i := range positions {
+				if positions[i] != tt.positions[i] {
+					t.Errorf("position[%d] = %d, want %d", i, positions[i], tt.positions[i])
+				}
+			}
+			if rejected != tt.rejected {
+				t.Errorf("rejected %d transfers, want %d", rejected, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestTransferService_Dequeue(t *testing.T) {
+	s := newQueueTestService(1, 3)
+
+	transfers := make([]*ActiveTransfer, 4)
+	for i := range transfers {
+		transfers[i] = &ActiveTransfer{TransferId: uuid.New()}
+		if _, err := s.admit(transfers[i]); err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+	}
+
+	// Nothing moves while the slot is taken
+	if started, queued := s.dequeue(); len(started) != 0 || len(queued) != 0 {
+		t.Fatalf("dequeue() = %d started, %d queued, want nothing", len(started), len(queued))
+	}
+
+	// The running transfer finishes
+	s.running--
+	started, queued := s.dequeue()
+	if len(started) != 1 || started[0] != transfers[1] {
+		t.Fatalf("dequeue() started %v, want the first queued transfer", started)
+	}
+	if len(queued) != 2 || queued[0] != transfers[2] || queued[1] != transfers[3] {
+		t.Errorf("dequeue() queued %v, want the remaining transfers in order", queued)
+	}
+	if status := transfers[1].GetStatus(); status != "sending" {
+		t.Errorf("started transfer status = %q, want sending", status)
+	}
+
+	// Raising the limit starts the rest
+	s.maxActive = 0
+	started, queued = s.dequeue()
+	if len(started) != 2 || len(queued) != 0 {
+		t.Errorf("dequeue() = %d started, %d queued, want 2 started", len(started), len(queued))
+	}
+}
+
+func TestTransferService_CancelQueued(t *testing.T) {
+	s := newQueueTestService(1, 3)
+
+	var updates []model.TransferStatusUpdate
+	s.OnStatusChange(func(update model.TransferStatusUpdate) {
+		updates = append(updates, update)
+	})
+
+	transfers := make([]*ActiveTransfer, 3)
+	for i := range transfers {
+		transfers[i] = &ActiveTransfer{TransferId: uuid.New()}
+		transfers[i].ctx, transfers[i].cancel = context.WithCancel(context.Background())
+		if _, err := s.admit(transfers[i]); err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+		s.transfers[transfers[i].TransferId] = transfers[i]
+	}
+
+	if err := s.CancelTransfer(transfers[1].TransferId); err != nil {
+		t.Fatalf("CancelTransfer() unexpected error: %v", err)
+	}
+	if status := transfers[1].GetStatus(); status != "cancelled" {
+		t.Errorf("cancelled transfer status = %q, want cancelled", status)
+	}
+	if transfers[1].ctx.Err() == nil {
+		t.Error("cancelled transfer context is not done")
+	}
+	if len(s.queue) != 1 || s.queue[0] != transfers[2] {
+		t.Fatalf("queue = %v, want only the last transfer", s.queue)
+	}
+
+	want := []model.TransferStatusUpdate{
+		{TransferId: transfers[1].TransferId, Status: model.TransferStatusCancelled},
+		{TransferId: transfers[2].TransferId, Status: model.TransferStatusQueued, QueuePosition: 1},
+	}
+	if len(updates) != len(want) {
+		t.Fatalf("got %d status updates, want %d", len(updates), len(want))
+	}
+	for i := range want {
+		if updates[i] != want[i] {
+			t.Errorf("update[%d] = %+v, want %+v", i, updates[i], want[i])
+		}
+	}
+
+	if err := s.CancelTransfer(transfers[1].TransferId); !errors.Is(err, ErrTransferFinished) {
+		t.Errorf("CancelTransfer() twice = %v, want %v", err, ErrTransferFinished)
+	}
+	if err := s.CancelTransfer(uuid.New()); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("CancelTransfer() unknown = %v, want %v", err, ErrTransferNotFound)
+	}
+}
+
+func TestTransferService_QueueTimeout(t *testing.T) {
+	s := newQueueTestService(1, 2)
+	s.SetQueueTimeout(10 * time.Millisecond)
+
+	updates := make(chan model.TransferStatusUpdate, 4)
+	s.OnStatusChange(func(update model.TransferStatusUpdate) { updates <- update })
+
+	transfers := make([]*ActiveTransfer, 2)
+	for i := range transfers {
+		transfers[i] = &ActiveTransfer{TransferId: uuid.New()}
+		transfers[i].ctx, transfers[i].cancel = context.WithCancel(context.Background())
+		s.mu.Lock()
+		_, err := s.admit(transfers[i])
+		s.transfers[transfers[i].TransferId] = transfers[i]
+		s.mu.Unlock()
+		if err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+	}
+
+	// The consumer of the queued transfer never shows up again
+	select {
+	case update := <-updates:
+		want := model.TransferStatusUpdate{TransferId: transfers[1].TransferId, Status: model.TransferStatusFailed}
+		if update != want {
+			t.Errorf("update = %+v, want %+v", update, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued transfer did not expire")
+	}
+
+	if status := transfers[1].GetStatus(); status != "failed" {
+		t.Errorf("expired transfer status = %q, want failed", status)
+	}
+	if transfers[1].ctx.Err() == nil {
+		t.Error("expired transfer context is not done")
+	}
+	s.mu.RLock()
+	queued := len(s.queue)
+	s.mu.RUnlock()
+	if queued != 0 {
+		t.Errorf("queue has %d transfers, want none", queued)
+	}
+	if status := transfers[0].GetStatus(); status != "sending" {
+		t.Errorf("running transfer status = %q, want sending", status)
+	}
+}
+
+func TestTransferService_Transfers(t *testing.T) {
+	s := newQueueTestService(1, 2)
+	var ids []uuid.UUID
+	for range 3 {
+		transfer := &ActiveTransfer{TransferId: uuid.New(), SentBlocks: map[uint64]bool{}}
+		if _, err := s.admit(transfer); err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+		s.transfers[transfer.TransferId] = transfer
+		ids = append(ids, transfer.TransferId)
+	}
+	s.transfers[ids[0]].resumed = make(chan struct{})
+
+	infos := s.Transfers()
+	if len(infos) != len(ids) {
+		t.Fatalf("got %d transfers, want %d", len(infos), len(ids))
+	}
+	want := []struct {
+		id       uuid.UUID
+		status   string
+		position int
+	}{
+		{id: ids[1], status: "queued", position: 1},
+		{id: ids[2], status: "queued", position: 2},
+		{id: ids[0], status: "paused"},
+	}
+	for i, w := range want {
+		if infos[i].Id != w.id || infos[i].Status != w.status || infos[i].QueuePosition != w.position {
+			t.Errorf("transfer[%d] = %s %s #%d, want %s %s #%d", i, infos[i].Id, infos[i].Status,
+				infos[i].QueuePosition, w.id, w.status, w.position)
+		}
+	}
+}
+
+func TestTransferService_Retire(t *testing.T) {
+	s := newQueueTestService(0, 0)
+	var ids []uuid.UUID
+	for range maxFinishedTransfers + 1 {
+		transfer := &ActiveTransfer{
+			TransferId: uuid.New(),
+			Status:     "complete",
+			SentBlocks: map[uint64]bool{0: true},
+			DataBytes:  10,
+			WireBytes:  5,
+		}
+		s.transfers[transfer.TransferId] = transfer
+		ids = append(ids, transfer.TransferId)
+
+		s.mu.Lock()
+		s.retire(transfer)
+		s.mu.Unlock()
+	}
+
+	if len(s.transfers) != 0 {
+		t.Errorf("%d finished transfers are still active", len(s.transfers))
+	}
+	if infos := s.Transfers(); len(infos) != maxFinishedTransfers || infos[0].Id != ids[1] {
+		t.Errorf("got %d finished transfers, want the latest %d", len(infos), maxFinishedTransfers)
+	}
+	want := FinishedTotals{Count: maxFinishedTransfers + 1, DataBytes: 10 * (maxFinishedTransfers + 1),
+		WireBytes: 5 * (maxFinishedTransfers + 1)}
+	if totals := s.FinishedTotals(); totals != want {
+		t.Errorf("FinishedTotals() = %+v, want %+v", totals, want)
+	}
+
+	tests := []struct {
+		name string
+		id   uuid.UUID
+		want error
+	}{
+		{name: "recently finished", id: ids[len(ids)-1], want: ErrTransferFinished},
+		{name: "summary dropped", id: ids[0], want: ErrTransferNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.CancelTransfer(tt.id); !errors.Is(err, tt.want) {
+				t.Errorf("CancelTransfer() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferService_HeldUntilReleased(t *testing.T) {
+	s := newQueueTestService(1, 2)
+
+	updates := make(chan model.TransferStatusUpdate, 10)
+	s.OnStatusChange(func(update model.TransferStatusUpdate) {
+		updates <- update
+	})
+	next := func() model.TransferStatusUpdate {
+		select {
+		case update := <-updates:
+			return update
+		case <-time.After(time.Second):
+			t.Fatal("no status update")
+			return model.TransferStatusUpdate{}
+		}
+	}
+
+	// Both wait for the consumer to be answered, the second also for the slot
+	transfers := make([]*ActiveTransfer, 2)
+	for i := range transfers {
+		transfers[i] = &ActiveTransfer{TransferId: uuid.New(), held: true}
+		transfers[i].ctx, transfers[i].cancel = context.WithCancel(context.Background())
+		if _, err := s.admit(transfers[i]); err != nil {
+			t.Fatalf("admit() unexpected error: %v", err)
+		}
+		s.transfers[transfers[i].TransferId] = transfers[i]
+	}
+
+	// The consumer was never answered, the slot goes to the queued transfer which stays held
+	if err := s.CancelTransfer(transfers[0].TransferId); err != nil {
+		t.Fatalf("CancelTransfer() unexpected error: %v", err)
+	}
+	want := model.TransferStatusUpdate{TransferId: transfers[0].TransferId, Status: model.TransferStatusCancelled}
+	if update := next(); update != want {
+		t.Errorf("update after cancel = %+v, want %+v", update, want)
+	}
+	if status := transfers[1].GetStatus(); status != "sending" {
+		t.Errorf("queued transfer status = %q, want sending", status)
+	}
+	select {
+	case update := <-updates:
+		t.Errorf("held transfer reported %+v before it was released", update)
+	default:
+	}
+
+	// Without a file the sender fails right away and frees the slot
+	s.ReleaseTransfer(transfers[1].TransferId)
+	for _, status := range []model.TransferStatus{model.TransferStatusDataSending, model.TransferStatusFailed} {
+		want := model.TransferStatusUpdate{TransferId: transfers[1].TransferId, Status: status}
+		if update := next(); update != want {
+			t.Errorf("update after release = %+v, want %+v", update, want)
+		}
+	}
+}
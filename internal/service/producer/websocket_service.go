@@ -1,32 +1,44 @@
 package producer
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"udpie/internal/client"
 	"udpie/internal/model"
-	"udpie/internal/model/contract"
+	"udpie/internal/protocol"
 	"udpie/internal/service/common"
+	"udpie/pkg/logutils"
 )
 
 type WebsocketListener struct {
 	producerId      uuid.UUID
 	wsURL           string
 	conn            *websocket.Conn
+	writeMu         sync.Mutex // gorilla connections support one concurrent writer
 	stateService    *StateService
 	transferService *TransferService
 	stunService     *common.STUNService
+	tlsConfig       *tls.Config // nil uses system roots for wss://
+	policyMu        sync.RWMutex
+	policy          *Policy // nil accepts every request
+	unsentMu        sync.Mutex
+	unsent          map[uuid.UUID]model.TransferStatusUpdate // latest updates not delivered to the signaller
 }
 
-func NewWebsocketListener(producerId uuid.UUID, signallerURL string,
+func NewWebsocketListener(producerId uuid.UUID, signallerURL string, tlsConfig *tls.Config,
 	stateService *StateService,
 	transferService *TransferService,
 	stunService *common.STUNService) *WebsocketListener {
@@ -43,33 +55,174 @@ func NewWebsocketListener(producerId uuid.UUID, signallerURL string,
 	return &WebsocketListener{
 		producerId:      producerId,
 		wsURL:           wsURL,
+		tlsConfig:       tlsConfig,
 		stateService:    stateService,
 		transferService: transferService,
 		stunService:     stunService,
+		unsent:          make(map[uuid.UUID]model.TransferStatusUpdate),
 	}
 }
 
-// Listen starts listening for websocket messages
+// SetPolicy sets the policy deciding which transfer requests are accepted, it may be replaced at runtime
+func (w *WebsocketListener) SetPolicy(policy *Policy) {
+	w.policyMu.Lock()
+	defer w.policyMu.Unlock()
+	w.policy = policy
+}
+
+// ErrProducerRejected is returned when the signaller refuses the connection of the producer,
+// e.g. after it forgot the producer. Reconnecting can not help, the producer has to register again.
+var ErrProducerRejected = errors.New("signaller does not know the producer or rejected its secret, register the producer again")
+
+// Reconnection and keepalive timing of the signaller connection
+const (
+	reconnectMinDelay = time.Second
+	reconnectMaxDelay = time.Minute
+	pingInterval      = 30 * time.Second
+	pongWait          = 2 * pingInterval // the connection is considered lost without any message for this long
+	writeWait         = 10 * time.Second
+	handshakeWait     = 10 * time.Second
+)
+
+// Listen keeps a websocket connection to the signaller and handles its messages.
+// Lost connections are reestablished with exponential backoff, transfers keep running meanwhile.
+// It returns on SIGINT or SIGTERM.
 func (w *WebsocketListener) Listen() error {
-	fmt.Printf("Connecting to websocket: %s\n", w.wsURL)
+	// Handle graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Connect to websocket
-	conn, resp, err := websocket.DefaultDialer.Dial(w.wsURL, nil)
+	return w.ListenContext(ctx)
+}
+
+// ListenContext is Listen returning once ctx is done instead of on signals.
+// It returns ErrProducerRejected when the signaller refuses the producer.
+func (w *WebsocketListener) ListenContext(ctx context.Context) error {
+	w.transferService.OnStatusChange(w.sendStatusUpdate)
+
+	backoff := NewBackoff(reconnectMinDelay, reconnectMaxDelay)
+	for {
+		conn, err := w.connect()
+		if errors.Is(err, ErrProducerRejected) {
+			return err
+		}
+		if err != nil {
+			logutils.WithError(err).Error("Failed to connect to the signaller")
+		} else {
+			connectedAt := time.Now()
+			if w.serve(conn, ctx.Done()) {
+				return nil
+			}
+			// Only a connection which stayed up for a while resets the backoff,
+			// a signaller dropping producers right away must not be hammered
+			if time.Since(connectedAt) >= reconnectMaxDelay {
+				backoff.Reset()
+			}
+		}
+
+		delay := backoff.Next()
+		logutils.WithField("delay", delay.Round(time.Millisecond).String()).Info("Reconnecting")
+		select {
+		case <-ctx.Done():
+			logutils.Info("Shutting down")
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// connect dials the signaller authenticating with the producer secret
+func (w *WebsocketListener) connect() (*websocket.Conn, error) {
+	logutils.WithField("url", w.wsURL).Info("Connecting to websocket")
+
+	header := http.Header{}
+	if secret := w.stateService.GetSecret(); secret != "" {
+		header.Set("Authorization", "Bearer "+secret)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = w.tlsConfig
+	conn, resp, err := dialer.Dial(w.wsURL, header)
 	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound) {
+			return nil, fmt.Errorf("%w (status %d)", ErrProducerRejected, resp.StatusCode)
+		}
 		if resp != nil {
-			return fmt.Errorf("error connecting to websocket (status %d): %w", resp.StatusCode, err)
+			return nil, fmt.Errorf("error connecting to websocket (status %d): %w", resp.StatusCode, err)
 		}
-		return fmt.Errorf("error connecting to websocket: %w", err)
+		return nil, fmt.Errorf("error connecting to websocket: %w", err)
+	}
+
+	welcome, err := w.handshake(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+	logutils.WithFields(logutils.Fields{
+		"version":     welcome.Version,
+		"compression": welcome.Capabilities.Compression,
+	}).Info("Connected to websocket")
+	return conn, nil
+}
+
+// handshake announces the protocol versions and capabilities of the producer and waits for the signaller to agree
+func (w *WebsocketListener) handshake(conn *websocket.Conn) (*protocol.Welcome, error) {
+	hello := protocol.NewHello(protocol.Capabilities{
+		Compression:  w.transferService.Compressions(),
+		MaxBlockSize: client.MaxBlockSize,
+		ConsumerIp:   true,
+		Cancel:       true,
+		Pause:        true,
+	})
+	data, err := protocol.Encode("", hello)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+
+	_ = conn.SetReadDeadline(time.Now().Add(handshakeWait))
+	_, data, err = conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	_, message, err := protocol.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	switch message := message.(type) {
+	case *protocol.Welcome:
+		return message, nil
+	case *protocol.Error:
+		return nil, message
+	default:
+		return nil, fmt.Errorf("expected %s, got %s", protocol.KindWelcome, message.Kind())
 	}
+}
+
+// serve handles messages of a connection until it is lost or shutdown is closed.
+// It reports whether the listener has to shut down.
+func (w *WebsocketListener) serve(conn *websocket.Conn, shutdown <-chan struct{}) bool {
+	w.writeMu.Lock()
 	w.conn = conn
-	defer conn.Close()
+	w.writeMu.Unlock()
+	defer func() {
+		w.writeMu.Lock()
+		w.conn = nil
+		w.writeMu.Unlock()
+		_ = conn.Close()
+	}()
 
-	fmt.Printf("Connected to websocket successfully\n")
-	fmt.Printf("Listening for messages...\n\n")
+	w.announce()
+	logutils.Info("Listening for messages")
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	// Pings are answered by the signaller, a silent connection is dead
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 
 	// Message handling goroutine
 	done := make(chan struct{})
@@ -78,65 +231,157 @@ func (w *WebsocketListener) Listen() error {
 		for {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					fmt.Fprintf(os.Stderr, "Websocket error: %v\n", err)
+				if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway,
+					websocket.CloseAbnormalClosure) {
+					logutils.WithError(err).Error("Websocket error")
 				}
 				return
 			}
+			_ = conn.SetReadDeadline(time.Now().Add(pongWait))
 
 			w.handleMessage(message)
 		}
 	}()
 
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
 	// Wait for interrupt or connection close
-	select {
-	case <-sigChan:
-		fmt.Println("\nShutting down...")
-		// Close connection gracefully
-		closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
-		if err := conn.WriteMessage(websocket.CloseMessage, closeMsg); err != nil {
-			fmt.Printf("Error sending close message: %v\n", err)
+	for {
+		select {
+		case <-shutdown:
+			logutils.Info("Shutting down")
+			// Close connection gracefully
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			w.writeMu.Lock()
+			err := conn.WriteMessage(websocket.CloseMessage, closeMsg)
+			w.writeMu.Unlock()
+			if err != nil {
+				logutils.WithError(err).Warn("Failed to send close message")
+			}
+			const closeDelay = 100 * time.Millisecond
+			time.Sleep(closeDelay)
+			return true
+		case <-done:
+			logutils.Warn("Connection closed")
+			return false
+		case <-ticker.C:
+			w.writeMu.Lock()
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			w.writeMu.Unlock()
+			if err != nil {
+				// Unblocks the reader, which ends the connection
+				_ = conn.Close()
+			}
 		}
-		const closeDelay = 100 * time.Millisecond
-		time.Sleep(closeDelay)
-	case <-done:
-		fmt.Println("Connection closed")
 	}
+}
 
-	return nil
+// announce reports the state of transfers to the signaller after (re)connecting,
+// including the changes which could not be sent while disconnected
+func (w *WebsocketListener) announce() {
+	w.unsentMu.Lock()
+	updates := w.unsent
+	w.unsent = make(map[uuid.UUID]model.TransferStatusUpdate)
+	w.unsentMu.Unlock()
+
+	for _, update := range w.transferService.StatusUpdates() {
+		updates[update.TransferId] = update
+	}
+	for _, update := range updates {
+		w.sendStatusUpdate(update)
+	}
 }
 
-func (w *WebsocketListener) handleMessage(message []byte) {
-	// Try to parse as JSON
-	var msgReq contract.WebsocketRequest
-	if err := json.Unmarshal(message, &msgReq); err != nil {
-		fmt.Printf("Received non-JSON message: %s\n", string(message))
+func (w *WebsocketListener) handleMessage(data []byte) {
+	envelope, message, err := protocol.Decode(data)
+	if err != nil {
+		logutils.WithError(err).Warn("Received invalid message")
+		if envelope != nil && envelope.RequestId != "" {
+			code := protocol.CodeBadMessage
+			if errors.Is(err, protocol.ErrUnknownKind) {
+				code = protocol.CodeUnknownKind
+			}
+			w.sendErrorResponse(envelope.RequestId, code, err.Error())
+		}
 		return
 	}
 
-	switch msgReq.Type {
-	case "init_transfer":
-		j, err := json.Marshal(msgReq.Data)
-		if err != nil {
-			w.sendErrorResponse(msgReq.RequestID, "failed to parse request data")
-			return
-		}
-		var d model.ProducerInitTransferRequestData
-		if err := json.Unmarshal(j, &d); err != nil {
-			w.sendErrorResponse(msgReq.RequestID, "failed to parse request data")
-			return
-		}
-		w.handleInitTransferRequest(msgReq.RequestID, &d)
+	switch message := message.(type) {
+	case *protocol.InitTransfer:
+		requestData := model.ProducerInitTransferRequestData(*message)
+		// Requests may wait for the operator, they must not block reading
+		go w.handleInitTransferRequest(envelope.RequestId, &requestData)
+	case *protocol.CancelTransfer:
+		w.handleCancelTransfer(envelope.RequestId, message)
+	case *protocol.PauseTransfer:
+		logutils.WithField("transfer_id", message.TransferId.String()).Info("Pausing transfer")
+		w.respondTransferControl(envelope.RequestId, message.TransferId,
+			w.transferService.PauseTransfer(message.TransferId), model.TransferStatusPaused)
+	case *protocol.ResumeTransfer:
+		logutils.WithField("transfer_id", message.TransferId.String()).Info("Resuming transfer")
+		w.respondTransferControl(envelope.RequestId, message.TransferId,
+			w.transferService.ResumeTransfer(message.TransferId, message.Received), model.TransferStatusDataSending)
+	case *protocol.Error:
+		logutils.WithError(message).Warn("Signaller reported an error")
 	default:
-		fmt.Printf("Unknown request type: %s\n", msgReq.Type)
-		// Send error response
-		w.sendErrorResponse(msgReq.RequestID, fmt.Sprintf("unknown request type: %s", msgReq.Type))
+		logutils.WithField("type", message.Kind()).Warn("Unexpected message")
+		if envelope.RequestId != "" {
+			w.sendErrorResponse(envelope.RequestId, protocol.CodeUnknownKind,
+				fmt.Sprintf("unexpected request: %s", message.Kind()))
+		}
 	}
+}
+
+// handleCancelTransfer stops a transfer the consumer or the producer operator cancelled through the signaller
+func (w *WebsocketListener) handleCancelTransfer(requestId string, request *protocol.CancelTransfer) {
+	logutils.WithFields(logutils.Fields{
+		"transfer_id": request.TransferId.String(),
+		"reason":      request.Reason,
+	}).Info("Transfer cancelled through the signaller")
 
-	fmt.Printf("Received message: %s\n", string(message))
+	err := w.transferService.CancelTransfer(request.TransferId)
+	if errors.Is(err, ErrTransferNotFound) {
+		w.sendErrorResponse(requestId, protocol.CodeNotFound, err.Error())
+		return
+	}
+	// Finished transfers are reported as they ended, the signaller keeps its own terminal state
+	status := model.TransferStatusCancelled
+	if finished, exists := w.transferService.finishedTransfer(request.TransferId); exists && err != nil {
+		status = transferStatus(finished.Status)
+	}
+	if err := w.send(requestId, &protocol.TransferStatus{TransferId: request.TransferId, Status: status}); err != nil {
+		logutils.WithError(err).Warn("Failed to send cancel response")
+	}
+}
+
+// respondTransferControl answers a pause or resume request with the new status of the transfer
+func (w *WebsocketListener) respondTransferControl(requestId string, transferId uuid.UUID, err error,
+	status model.TransferStatus) {
+	switch {
+	case errors.Is(err, ErrTransferNotFound):
+		w.sendErrorResponse(requestId, protocol.CodeNotFound, err.Error())
+	case err != nil:
+		w.sendErrorResponse(requestId, protocol.CodeConflict, err.Error())
+	default:
+		if err := w.send(requestId, &protocol.TransferStatus{TransferId: transferId, Status: status}); err != nil {
+			logutils.WithError(err).Warn("Failed to send transfer status response")
+		}
+	}
 }
 
 func (w *WebsocketListener) handleInitTransferRequest(requestId string, requestData *model.ProducerInitTransferRequestData) {
+	// The signaller owns the transfer ID, it is shared with the consumer
+	if requestData.TransferId == uuid.Nil {
+		w.sendRejectResponse(requestId, "transfer ID is missing")
+		return
+	}
+
+	if _, exists := w.transferService.GetTransferStatus(requestData.TransferId); exists {
+		w.sendRejectResponse(requestId, fmt.Sprintf("transfer already exists: %s", requestData.TransferId.String()))
+		return
+	}
+
 	// Check if file exists in state
 	fileInfo, exists := w.stateService.GetFile(requestData.FileId)
 	if !exists {
@@ -144,16 +389,38 @@ func (w *WebsocketListener) handleInitTransferRequest(requestId string, requestD
 		return
 	}
 
+	filePath, err := fileInfo.ResolvePath(requestData.Path)
+	if err != nil {
+		w.sendRejectResponse(requestId, err.Error())
+		return
+	}
+
 	// Check if file exists on disk
-	if _, err := os.Stat(fileInfo.FilePath); err != nil {
+	if _, err := os.Stat(filePath); err != nil {
 		w.sendRejectResponse(requestId, fmt.Sprintf("file does not exist: %v", err))
 		return
 	}
 
+	policy, policyRequest := w.policyRequest(&fileInfo, requestData)
+	if policy != nil {
+		if allowed, reason := policy.Check(policyRequest); !allowed {
+			w.sendRejectResponse(requestId, reason)
+			return
+		}
+	}
+
+	// The transfer did not start, the download does not count
+	rejected := func(reason string) {
+		if policy != nil {
+			policy.Release(policyRequest)
+		}
+		w.sendRejectResponse(requestId, reason)
+	}
+
 	// Reevaluate udp options
 	extAddr, err := w.stunService.Query()
 	if err != nil {
-		w.sendRejectResponse(requestId, fmt.Sprintf("failed to reevaluate udp options: %v", err))
+		rejected(fmt.Sprintf("failed to reevaluate udp options: %v", err))
 		return
 	}
 
@@ -163,94 +430,172 @@ func (w *WebsocketListener) handleInitTransferRequest(requestId string, requestD
 	udpOptions.ExternalIp = udpAddr.IP.String()
 	udpOptions.ExternalPort = udpAddr.Port
 
-	// Accept transfer and send response
-	responseData := model.ProducerInitTransferResponseData{
-		Status:             model.RequestTransferStatusAccepted,
-		ProducerUdpOptions: udpOptions,
-	}
-
-	response := contract.WebsocketResponse{
-		ProducerId: w.producerId,
-		RequestID:  requestId,
-		Data:       responseData,
-	}
-
-	if writeErr := w.conn.WriteJSON(response); writeErr != nil {
-		fmt.Printf("Error sending response: %v\n", writeErr)
-		return
-	}
+	compression := w.transferService.NegotiateCompression(requestData.Compression)
 
-	fmt.Printf("Accepted transfer request\n")
-	fmt.Printf("  File ID: %s\n", requestData.FileId.String())
-	fmt.Printf("  File: %s\n", fileInfo.FilePath)
-	fmt.Printf("  Block Size: %d\n", requestData.BlockSize)
-	fmt.Printf("  Total Blocks: %d\n", requestData.BlocksCount)
-	fmt.Printf("  Consumer: %s:%d\n", requestData.ConsumerUdpOptions.ExternalIp, requestData.ConsumerUdpOptions.ExternalPort)
-
-	// Start file transfer
 	consumerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
 		requestData.ConsumerUdpOptions.ExternalIp,
 		requestData.ConsumerUdpOptions.ExternalPort))
 	if err != nil {
-		fmt.Printf("Error resolving consumer address: %v\n", err)
+		rejected(fmt.Sprintf("invalid consumer address: %v", err))
 		return
 	}
 
-	// Generate transfer ID (or use one from request if provided)
-	transferId := uuid.New()
+	transferId := requestData.TransferId
 
-	if err := w.transferService.StartTransfer(
+	// Take a transfer slot or a place in the queue before answering, sending starts once the answer is out
+	position, err := w.transferService.StartTransfer(
 		transferId,
 		requestData.FileId,
+		requestData.Path,
 		requestData.BlockSize,
 		requestData.BlocksCount,
+		requestData.Range,
 		consumerAddr,
-	); err != nil {
-		fmt.Printf("Error starting transfer: %v\n", err)
+		compression,
+		requestData.MaxRate,
+	)
+	if errors.Is(err, ErrQueueFull) {
+		rejected(model.RejectReasonBusy)
+		return
+	}
+	if err != nil {
+		rejected(err.Error())
 		return
 	}
 
-	fmt.Printf("Transfer started: %s\n", transferId.String())
+	responseData := model.ProducerInitTransferResponseData{
+		Status:             model.RequestTransferStatusAccepted,
+		ProducerUdpOptions: udpOptions,
+		Compression:        compression,
+	}
+	if position > 0 {
+		responseData.Status = model.RequestTransferStatusQueued
+		responseData.QueuePosition = position
+	}
+
+	if writeErr := w.send(requestId, (*protocol.InitTransferResult)(&responseData)); writeErr != nil {
+		// The consumer never learns about the transfer, free its slot or queue place
+		logutils.WithField("transfer_id", transferId.String()).WithError(writeErr).Warn("Failed to send response")
+		if err := w.transferService.CancelTransfer(transferId); err != nil {
+			logutils.WithField("transfer_id", transferId.String()).WithError(err).Warn("Failed to cancel unanswered transfer")
+		}
+		if policy != nil {
+			policy.Release(policyRequest)
+		}
+		return
+	}
+	w.transferService.ReleaseTransfer(transferId)
+
+	entry := logutils.WithFields(logutils.Fields{
+		"transfer_id":  transferId.String(),
+		"file_id":      requestData.FileId.String(),
+		"path":         filePath,
+		"block_size":   requestData.BlockSize,
+		"total_blocks": requestData.BlocksCount,
+		"range_start":  requestData.Range.Start,
+		"range_end":    requestData.Range.End,
+		"max_rate":     requestData.MaxRate,
+		"consumer":     consumerAddr.String(),
+	})
+	if position > 0 {
+		entry.WithField("queue_position", position).Info("Transfer queued")
+		return
+	}
+	entry.Info("Transfer started")
 }
 
-func (w *WebsocketListener) sendErrorResponse(requestId, errorMsg string) {
-	response := map[string]any{
-		"request_id":  requestId,
-		"producer_id": w.producerId.String(),
-		"error":       errorMsg,
+// policyRequest returns the current policy and the request it has to check
+func (w *WebsocketListener) policyRequest(fileInfo *FileInfo,
+	requestData *model.ProducerInitTransferRequestData) (*Policy, PolicyRequest) {
+	w.policyMu.RLock()
+	policy := w.policy
+	w.policyMu.RUnlock()
+
+	return policy, PolicyRequest{
+		FileId:       requestData.FileId,
+		FileName:     fileInfo.Name,
+		Path:         requestData.Path,
+		Share:        requestShare(requestData),
+		ConsumerIP:   consumerIP(requestData),
+		ConsumerName: requestData.ConsumerName,
+		Time:         time.Now(),
 	}
+}
 
-	responseBytes, err := json.Marshal(response)
-	if err != nil {
-		fmt.Printf("Error marshaling error response: %v\n", err)
-		return
+// consumerIP returns the address the signaller saw the consumer at. Signallers which do not
+// report it only pass on the address the consumer announced itself.
+func consumerIP(requestData *model.ProducerInitTransferRequestData) net.IP {
+	if requestData.ConsumerIp != "" {
+		return net.ParseIP(requestData.ConsumerIp)
 	}
+	return net.ParseIP(requestData.ConsumerUdpOptions.ExternalIp)
+}
 
-	if err := w.conn.WriteMessage(websocket.TextMessage, responseBytes); err != nil {
-		fmt.Printf("Error sending error response: %v\n", err)
+// requestShare returns the part of the file requested, range downloads count proportionally
+func requestShare(requestData *model.ProducerInitTransferRequestData) float64 {
+	if requestData.BlocksCount == 0 {
+		return 1
 	}
+	return float64(requestData.Range.Len()) / float64(requestData.BlocksCount)
 }
 
-func (w *WebsocketListener) sendRejectResponse(requestId, reason string) {
-	responseData := model.ProducerInitTransferResponseData{
-		Status: model.RequestTransferStatusRejected,
+// sendStatusUpdate reports a transfer state change to the signaller
+func (w *WebsocketListener) sendStatusUpdate(update model.TransferStatusUpdate) {
+	switch update.Status {
+	case model.TransferStatusQueued:
+		logutils.WithFields(logutils.Fields{
+			"transfer_id":    update.TransferId.String(),
+			"queue_position": update.QueuePosition,
+		}).Info("Transfer moved in the queue")
+	case model.TransferStatusDataSending:
+		state := w.transferService.GetQueueState()
+		logutils.WithFields(logutils.Fields{
+			"transfer_id": update.TransferId.String(),
+			"running":     len(state.Running),
+			"queued":      len(state.Queued),
+		}).Info("Transfer is sending")
+	default:
 	}
 
-	response := map[string]any{
-		"request_id":  requestId,
-		"producer_id": w.producerId.String(),
-		"data":        responseData,
+	if err := w.send("", (*protocol.TransferStatus)(&update)); err != nil {
+		logutils.WithField("transfer_id", update.TransferId.String()).WithError(err).
+			Warn("Failed to send transfer status, it is sent after reconnecting")
+		w.unsentMu.Lock()
+		w.unsent[update.TransferId] = update
+		w.unsentMu.Unlock()
 	}
+}
 
-	responseBytes, err := json.Marshal(response)
+// send writes a message, transfers report their state from their own goroutines
+func (w *WebsocketListener) send(requestId string, message protocol.Message) error {
+	data, err := protocol.Encode(requestId, message)
 	if err != nil {
-		fmt.Printf("Error marshaling reject response: %v\n", err)
-		return
+		return err
+	}
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	if w.conn == nil {
+		return errors.New("not connected")
+	}
+	return w.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (w *WebsocketListener) sendErrorResponse(requestId, code, errorMsg string) {
+	if err := w.send(requestId, &protocol.Error{Code: code, Message: errorMsg}); err != nil {
+		logutils.WithError(err).Warn("Failed to send error response")
 	}
+}
 
-	if err := w.conn.WriteMessage(websocket.TextMessage, responseBytes); err != nil {
-		fmt.Printf("Error sending reject response: %v\n", err)
+func (w *WebsocketListener) sendRejectResponse(requestId, reason string) {
+	response := &protocol.InitTransferResult{
+		Status: model.RequestTransferStatusRejected,
+		Reason: reason,
+	}
+	if err := w.send(requestId, response); err != nil {
+		logutils.WithError(err).Warn("Failed to send reject response")
 	}
 
-	fmt.Printf("Rejected transfer request: %s\n", reason)
+	logutils.WithField("reason", reason).Info("Rejected transfer request")
 }
@@ -0,0 +1,42 @@
+package producer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestWebsocketListener_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+	}{
+		{name: "unknown producer", status: http.StatusUnauthorized},
+		{name: "no websocket endpoint", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			stateService := NewStateService(filepath.Join(t.TempDir(), "state.json"))
+			listener := NewWebsocketListener(uuid.New(), server.URL, nil, stateService,
+				NewTransferService(stateService, nil, RateLimits{}), nil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := listener.ListenContext(ctx); !errors.Is(err, ErrProducerRejected) {
+				t.Errorf("ListenContext() = %v, want %v", err, ErrProducerRejected)
+			}
+		})
+	}
+}
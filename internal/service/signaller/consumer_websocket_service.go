@@ -0,0 +1,262 @@
+package signaller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+	"udpie/internal/protocol"
+	"udpie/pkg/logutils"
+)
+
+// Writing to consumers, events are published from producer connections which must not wait for them
+const (
+	consumerQueueSize = 64               // messages waiting to be written, a session falling further behind is dropped
+	consumerWriteWait = 10 * time.Second // a write taking longer drops the session
+)
+
+// errSessionDropped is returned when sending to a session which was dropped
+var errSessionDropped = errors.New("consumer session dropped")
+
+// consumerSession is a websocket connection of a consumer following transfers
+type consumerSession struct {
+	id        string
+	conn      *websocket.Conn
+	outgoing  chan []byte   // written by writeLoop
+	dropped   chan struct{} // closed once the connection is closed
+	dropOnce  sync.Once
+	transfers map[uuid.UUID]struct{} // guarded by ConsumerWebsocketService.mu
+}
+
+func newConsumerSession(conn *websocket.Conn) *consumerSession {
+	return &consumerSession{
+		id:        uuid.New().String(),
+		conn:      conn,
+		outgoing:  make(chan []byte, consumerQueueSize),
+		dropped:   make(chan struct{}),
+		transfers: make(map[uuid.UUID]struct{}),
+	}
+}
+
+// send queues a message without waiting for the consumer, a session with a full queue is dropped
+func (c *consumerSession) send(requestId string, message protocol.Message) error {
+	data, err := protocol.Encode(requestId, message)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.dropped:
+		return errSessionDropped
+	default:
+	}
+	select {
+	case c.outgoing <- data:
+		return nil
+	default:
+		c.drop()
+		return fmt.Errorf("%w: consumer is not reading", errSessionDropped)
+	}
+}
+
+// writeLoop writes queued messages until the session is dropped
+func (c *consumerSession) writeLoop() {
+	for {
+		select {
+		case <-c.dropped:
+			return
+		case data := <-c.outgoing:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(consumerWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				logutils.WithField("session_id", c.id).WithError(err).Info("Dropping consumer which is not reading")
+				c.drop()
+				return
+			}
+		}
+	}
+}
+
+// drop closes the connection, the read loop of HandleConnection ends and removes the session
+func (c *consumerSession) drop() {
+	c.dropOnce.Do(func() {
+		close(c.dropped)
+		_ = c.conn.Close()
+	})
+}
+
+// ConsumerWebsocketService delivers transfer events to consumers over their own websocket connections
+type ConsumerWebsocketService struct {
+	mu              sync.RWMutex
+	sessions        map[string]*consumerSession
+	followers       map[uuid.UUID]map[string]*consumerSession // transfer -> sessions following it
+	transferService contract.SignallerTransferService
+}
+
+func NewConsumerWebsocketService(transferService contract.SignallerTransferService) *ConsumerWebsocketService {
+	return &ConsumerWebsocketService{
+		sessions:        make(map[string]*consumerSession),
+		followers:       make(map[uuid.UUID]map[string]*consumerSession),
+		transferService: transferService,
+	}
+}
+
+// SessionCount returns the number of connected consumers
+func (s *ConsumerWebsocketService) SessionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.sessions)
+}
+
+// Follow subscribes a session to the events of a transfer
+func (s *ConsumerWebsocketService) Follow(sessionId string, transferId uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionId]
+	if !exists {
+		return errors.New("consumer session not found")
+	}
+	s.follow(session, transferId)
+	return nil
+}
+
+// follow must be called with s.mu held
+func (s *ConsumerWebsocketService) follow(session *consumerSession, transferId uuid.UUID) {
+	if s.followers[transferId] == nil {
+		s.followers[transferId] = make(map[string]*consumerSession)
+	}
+	s.followers[transferId][session.id] = session
+	session.transfers[transferId] = struct{}{}
+}
+
+// unfollow must be called with s.mu held
+func (s *ConsumerWebsocketService) unfollow(session *consumerSession, transferId uuid.UUID) {
+	delete(session.transfers, transferId)
+	delete(s.followers[transferId], session.id)
+	if len(s.followers[transferId]) == 0 {
+		delete(s.followers, transferId)
+	}
+}
+
+// Publish sends an event to the sessions following its transfer.
+// Sessions stop following transfers which are finished.
+func (s *ConsumerWebsocketService) Publish(event model.TransferEvent) {
+	finished := event.Status.Finished()
+
+	s.mu.Lock()
+	sessions := make([]*consumerSession, 0, len(s.followers[event.TransferId]))
+	for _, session := range s.followers[event.TransferId] {
+		sessions = append(sessions, session)
+		if finished {
+			s.unfollow(session, event.TransferId)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, session := range sessions {
+		if err := session.send("", (*protocol.TransferEvent)(&event)); err != nil {
+			logutils.WithFields(logutils.Fields{
+				"session_id":  session.id,
+				"transfer_id": event.TransferId.String(),
+			}).WithError(err).Debug("Failed to send transfer event")
+		}
+	}
+}
+
+// HandleConnection runs the handshake, handing out a session ID, and serves the consumer
+func (s *ConsumerWebsocketService) HandleConnection(conn *websocket.Conn) error {
+	session := newConsumerSession(conn)
+	if _, err := handshake(conn, session.id); err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	go session.writeLoop()
+	defer session.drop()
+
+	s.mu.Lock()
+	s.sessions[session.id] = session
+	s.mu.Unlock()
+
+	logutils.WithField("session_id", session.id).Info("Consumer websocket connection registered")
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			logutils.WithFields(logutils.Fields{
+				"session_id": session.id,
+				"error":      err.Error(),
+			}).Info("Consumer websocket connection closed")
+			break
+		}
+		s.handleMessage(session, data)
+	}
+
+	s.mu.Lock()
+	for transferId := range session.transfers {
+		s.unfollow(session, transferId)
+	}
+	delete(s.sessions, session.id)
+	s.mu.Unlock()
+	return nil
+}
+
+// handleMessage serves a control message of the consumer
+func (s *ConsumerWebsocketService) handleMessage(session *consumerSession, data []byte) {
+	envelope, message, err := protocol.Decode(data)
+	if err != nil {
+		if envelope != nil {
+			code := protocol.CodeBadMessage
+			if errors.Is(err, protocol.ErrUnknownKind) {
+				code = protocol.CodeUnknownKind
+			}
+			s.reply(session, envelope.RequestId, &protocol.Error{Code: code, Message: err.Error()})
+		}
+		return
+	}
+
+	switch message := message.(type) {
+	case *protocol.Subscribe:
+		transfer, err := s.transferService.GetTransfer(message.TransferId)
+		if err != nil {
+			s.reply(session, envelope.RequestId, &protocol.Error{Code: protocol.CodeNotFound, Message: err.Error()})
+			return
+		}
+		s.mu.Lock()
+		s.follow(session, transfer.Id)
+		s.mu.Unlock()
+
+		// The current state answers the subscription
+		event := protocol.TransferEvent(statusEvent(transfer))
+		s.reply(session, envelope.RequestId, &event)
+	case *protocol.Unsubscribe:
+		s.mu.Lock()
+		s.unfollow(session, message.TransferId)
+		s.mu.Unlock()
+	default:
+		s.reply(session, envelope.RequestId, &protocol.Error{
+			Code:    protocol.CodeUnknownKind,
+			Message: fmt.Sprintf("unexpected message: %s", message.Kind()),
+		})
+	}
+}
+
+func (*ConsumerWebsocketService) reply(session *consumerSession, requestId string, message protocol.Message) {
+	if err := session.send(requestId, message); err != nil {
+		logutils.WithField("session_id", session.id).WithError(err).Debug("Failed to reply to consumer")
+	}
+}
+
+// statusEvent describes the current state of a transfer
+func statusEvent(transfer *model.Transfer) model.TransferEvent {
+	return model.TransferEvent{
+		TransferId:    transfer.Id,
+		Type:          model.TransferEventStatus,
+		Status:        transfer.Status,
+		QueuePosition: transfer.QueuePosition,
+	}
+}
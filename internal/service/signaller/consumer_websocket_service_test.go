@@ -0,0 +1,181 @@
+package signaller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/protocol"
+)
+
+// newConsumerTestServer serves consumer websockets of the service over HTTP
+func newConsumerTestServer(t *testing.T, s *ConsumerWebsocketService) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = s.HandleConnection(conn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// connectConsumer opens a consumer websocket and returns it with its session ID
+func connectConsumer(t *testing.T, server *httptest.Server) (*websocket.Conn, string) {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial() unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	data, err := protocol.Encode("", &protocol.Hello{MinVersion: protocol.MinVersion, MaxVersion: protocol.Version})
+	if err != nil {
+		t.Fatalf("Encode() unexpected error: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("WriteMessage() unexpected error: %v", err)
+	}
+	message := readConsumerMessage(t, conn, time.Second)
+	welcome, ok := message.(*protocol.Welcome)
+	if !ok {
+		t.Fatalf("handshake answered with %s, want %s", message.Kind(), protocol.KindWelcome)
+	}
+	return conn, welcome.SessionId
+}
+
+// readConsumerMessage reads the next message, nil when none arrives within the timeout
+func readConsumerMessage(t *testing.T, conn *websocket.Conn, timeout time.Duration) protocol.Message {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil
+	}
+	_, message, err := protocol.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() unexpected error: %v", err)
+	}
+	return message
+}
+
+// waitFor polls the condition until it holds or a second passed
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConsumerWebsocketService_Publish(t *testing.T) {
+	s := NewConsumerWebsocketService(nil)
+	server := newConsumerTestServer(t, s)
+
+	transferId, otherId := uuid.New(), uuid.New()
+	type consumer struct {
+		conn      *websocket.Conn
+		following uuid.UUID
+	}
+	consumers := make([]consumer, 3)
+	for i, following := range []uuid.UUID{transferId, transferId, otherId} {
+		conn, sessionId := connectConsumer(t, server)
+		if err := s.Follow(sessionId, following); err != nil {
+			t.Fatalf("Follow() unexpected error: %v", err)
+		}
+		consumers[i] = consumer{conn: conn, following: following}
+	}
+	if err := s.Follow(uuid.New().String(), transferId); err == nil {
+		t.Error("Follow() of an unknown session succeeded")
+	}
+
+	steps := []struct {
+		name     string
+		status   model.TransferStatus
+		followed bool // whether the transfer is still followed afterwards
+	}{
+		{name: "running", status: model.TransferStatusDataSending, followed: true},
+		{name: "finished", status: model.TransferStatusComplete, followed: false},
+	}
+	for _, step := range steps {
+		s.Publish(model.TransferEvent{TransferId: transferId, Type: model.TransferEventStatus, Status: step.status})
+
+		for i, c := range consumers {
+			message := readConsumerMessage(t, c.conn, 100*time.Millisecond)
+			if c.following != transferId {
+				if message != nil {
+					t.Errorf("%s: consumer %d following another transfer got %s", step.name, i, message.Kind())
+				}
+				continue
+			}
+			event, ok := message.(*protocol.TransferEvent)
+			if !ok || event.TransferId != transferId || event.Status != step.status {
+				t.Errorf("%s: consumer %d got %#v, want %s event", step.name, i, message, step.status)
+			}
+		}
+
+		s.mu.RLock()
+		followers := len(s.followers[transferId])
+		s.mu.RUnlock()
+		if followed := followers > 0; followed != step.followed {
+			t.Errorf("%s: transfer followed = %v, want %v", step.name, followed, step.followed)
+		}
+	}
+
+	// Events of finished transfers are not sent anymore
+	s.Publish(model.TransferEvent{TransferId: transferId, Type: model.TransferEventStatus,
+		Status: model.TransferStatusComplete})
+	if message := readConsumerMessage(t, consumers[0].conn, 100*time.Millisecond); message != nil {
+		t.Errorf("unfollowed consumer got %s", message.Kind())
+	}
+}
+
+func TestConsumerWebsocketService_Disconnect(t *testing.T) {
+	s := NewConsumerWebsocketService(nil)
+	server := newConsumerTestServer(t, s)
+
+	conn, sessionId := connectConsumer(t, server)
+	if err := s.Follow(sessionId, uuid.New()); err != nil {
+		t.Fatalf("Follow() unexpected error: %v", err)
+	}
+	_ = conn.Close()
+
+	waitFor(t, "the session to be removed", func() bool {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return len(s.sessions) == 0 && len(s.followers) == 0
+	})
+}
+
+func TestConsumerSession_DropsSlowConsumer(t *testing.T) {
+	server := newConsumerTestServer(t, NewConsumerWebsocketService(nil))
+	conn, _ := connectConsumer(t, server)
+	// Nothing is written, the queue fills up as with a consumer which stopped reading
+	session := newConsumerSession(conn)
+
+	event := &protocol.TransferEvent{TransferId: uuid.New(), Type: model.TransferEventStatus}
+	for i := range consumerQueueSize {
+		if err := session.send("", event); err != nil {
+			t.Fatalf("send() %d unexpected error: %v", i, err)
+		}
+	}
+	if err := session.send("", event); !errors.Is(err, errSessionDropped) {
+		t.Fatalf("send() to a full queue error = %v, want %v", err, errSessionDropped)
+	}
+	if err := session.send("", event); !errors.Is(err, errSessionDropped) {
+		t.Errorf("send() to a dropped session error = %v, want %v", err, errSessionDropped)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{}")); err == nil {
+		t.Error("connection of the dropped session is still open")
+	}
+}
@@ -1,26 +1,59 @@
 package signaller
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
 	"udpie/internal/model"
 	"udpie/internal/model/contract"
+	"udpie/pkg/logutils"
 )
 
 type FileService struct {
 	mu              sync.RWMutex
-	files           map[uuid.UUID]*model.FileMeta
+	files           contract.Collection[model.FileMeta]
+	byHash          map[string][]uuid.UUID // hex content hash -> files with that content
 	ProducerService contract.SignallerProducerService
+	presence        contract.ProducerPresence
+	defaultTTL      time.Duration
+	maxTTL          time.Duration
 }
 
-func NewFileService(producerService contract.SignallerProducerService) *FileService {
-	return &FileService{
-		files:           make(map[uuid.UUID]*model.FileMeta),
+// NewFileService builds the content hash index from the stored files
+func NewFileService(storage contract.Storage, producerService contract.SignallerProducerService,
+	presence contract.ProducerPresence) (*FileService, error) {
+	s := &FileService{
+		files:           storage.Files(),
+		byHash:          make(map[string][]uuid.UUID),
 		ProducerService: producerService,
+		presence:        presence,
 	}
+
+	files, err := s.files.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load files: %w", err)
+	}
+	for _, fileMeta := range files {
+		s.index(fileMeta)
+	}
+
+	return s, nil
+}
+
+// SetTTL sets the TTL of files registered without one and the longest TTL allowed, zero means no limit
+func (s *FileService) SetTTL(defaultTTL, maxTTL time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultTTL = defaultTTL
+	s.maxTTL = maxTTL
 }
 
 func (s *FileService) RegisterFile(options contract.RegisterFileOptions) (uuid.UUID, error) {
@@ -32,19 +65,207 @@ func (s *FileService) RegisterFile(options contract.RegisterFileOptions) (uuid.U
 		return uuid.UUID{}, err
 	}
 
-	fileMeta := model.NewFileMeta(options.Name, options.Size, options.Hash, options.ProducerId)
-	s.files[fileMeta.Id] = fileMeta
+	size := options.Size
+	if options.Manifest != nil {
+		if err := options.Manifest.Validate(); err != nil {
+			return uuid.UUID{}, err
+		}
+		size = options.Manifest.TotalSize()
+	}
+
+	fileMeta := model.NewFileMeta(options.Name, size, options.Hash, options.ProducerId)
+	if options.Manifest != nil {
+		fileMeta.Manifest = options.Manifest.Clone()
+	}
+	if ttl := s.fileTTL(options.TTL); ttl > 0 {
+		fileMeta.ExpiresAt = fileMeta.CreatedAt.Add(ttl)
+	}
+	if err := s.files.Put(fileMeta.Id, fileMeta); err != nil {
+		return uuid.UUID{}, fmt.Errorf("failed to save file: %w", err)
+	}
+	s.index(fileMeta)
 	return fileMeta.Id, nil
 }
 
+// fileTTL applies the default and the maximum to a requested TTL, zero keeps the file forever
+func (s *FileService) fileTTL(requested time.Duration) time.Duration {
+	ttl := requested
+	if ttl <= 0 {
+		ttl = s.defaultTTL
+	}
+	if s.maxTTL > 0 && (ttl <= 0 || ttl > s.maxTTL) {
+		ttl = s.maxTTL
+	}
+	return ttl
+}
+
+func (s *FileService) index(fileMeta *model.FileMeta) {
+	if len(fileMeta.Hash) > 0 {
+		key := hex.EncodeToString(fileMeta.Hash)
+		s.byHash[key] = append(s.byHash[key], fileMeta.Id)
+	}
+}
+
+func (s *FileService) unindex(fileMeta *model.FileMeta) {
+	if len(fileMeta.Hash) == 0 {
+		return
+	}
+	key := hex.EncodeToString(fileMeta.Hash)
+	s.byHash[key] = slices.DeleteFunc(s.byHash[key], func(id uuid.UUID) bool {
+		return id == fileMeta.Id
+	})
+	if len(s.byHash[key]) == 0 {
+		delete(s.byHash, key)
+	}
+}
+
+// GetFileMeta returns the file, expired files are not found even before they are removed
 func (s *FileService) GetFileMeta(id uuid.UUID) (*model.FileMeta, error) {
+	fileMeta, err := s.files.Get(id)
+	if errors.Is(err, contract.ErrNotFound) || (err == nil && fileMeta.Expired(time.Now())) {
+		return nil, errors.New("file not found")
+	}
+	return fileMeta, err
+}
+
+func (s *FileService) DeleteFile(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.deleteFile(id)
+}
+
+func (s *FileService) deleteFile(id uuid.UUID) error {
+	fileMeta, err := s.files.Get(id)
+	if errors.Is(err, contract.ErrNotFound) {
+		return errors.New("file not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.files.Delete(id); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	s.unindex(fileMeta)
+	return nil
+}
+
+func (s *FileService) DeleteProducerFiles(producerId uuid.UUID) (int, error) {
+	return s.deleteWhere(func(fileMeta *model.FileMeta) bool {
+		return fileMeta.ProducerId == producerId
+	})
+}
+
+// ExpireFiles removes files whose TTL ran out and returns how many there were
+func (s *FileService) ExpireFiles(now time.Time) (int, error) {
+	return s.deleteWhere(func(fileMeta *model.FileMeta) bool {
+		return fileMeta.Expired(now)
+	})
+}
+
+// StartExpiry removes expired files every interval until the context is done
+func (s *FileService) StartExpiry(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				expired, err := s.ExpireFiles(now)
+				if err != nil {
+					logutils.WithError(err).Error("Failed to remove expired files")
+				}
+				if expired > 0 {
+					logutils.WithField("count", expired).Info("Expired files removed")
+				}
+			}
+		}
+	}()
+}
+
+func (s *FileService) deleteWhere(match func(fileMeta *model.FileMeta) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	deleted := 0
+	for _, fileMeta := range files {
+		if !match(fileMeta) {
+			continue
+		}
+		if err := s.deleteFile(fileMeta.Id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (s *FileService) GetFileSources(id uuid.UUID) ([]*model.FileMeta, error) {
+	fileMeta, err := s.GetFileMeta(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories and files registered without a hash can only be served by their owner
+	if len(fileMeta.Hash) == 0 || fileMeta.IsDirectory() {
+		return []*model.FileMeta{fileMeta}, nil
+	}
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	ids := slices.Clone(s.byHash[hex.EncodeToString(fileMeta.Hash)])
+	s.mu.RUnlock()
 
-	fileMeta, exists := s.files[id]
-	if !exists {
-		return nil, errors.New("file not found")
+	sources := make([]*model.FileMeta, 0, len(ids))
+	for _, sourceId := range ids {
+		source, err := s.GetFileMeta(sourceId)
+		if err != nil || source.Size != fileMeta.Size || source.IsDirectory() {
+			continue
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+func (s *FileService) ListFiles(options contract.ListFilesOptions) (*contract.ListFilesResult, error) {
+	stored, err := s.files.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	now := time.Now()
+	name := strings.ToLower(options.Name)
+	files := make([]*model.FileMeta, 0, len(stored))
+	for _, fileMeta := range stored {
+		switch {
+		case fileMeta.Expired(now),
+			options.ProducerId != uuid.Nil && fileMeta.ProducerId != options.ProducerId,
+			name != "" && !strings.Contains(strings.ToLower(fileMeta.Name), name),
+			fileMeta.Size < options.MinSize,
+			options.MaxSize > 0 && fileMeta.Size > options.MaxSize,
+			!matchesOnline(options.Online, s.presence.IsOnline(fileMeta.ProducerId)):
+			continue
+		default:
+			files = append(files, fileMeta)
+		}
 	}
+	slices.SortFunc(files, func(a, b *model.FileMeta) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
 
-	return fileMeta.Clone(), nil
+	return &contract.ListFilesResult{
+		Files: page(files, options.Offset, options.Limit),
+		Total: len(files),
+	}, nil
 }
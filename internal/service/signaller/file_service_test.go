@@ -0,0 +1,166 @@
+package signaller
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+	"udpie/internal/storage"
+)
+
+type fakePresence map[uuid.UUID]bool
+
+func (p fakePresence) IsOnline(producerId uuid.UUID) bool {
+	return p[producerId]
+}
+
+func (p fakePresence) Presence(producerId uuid.UUID) model.Presence {
+	return model.Presence{Online: p[producerId]}
+}
+
+func TestFileService_ListFiles(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	producerService := NewProducerService(store)
+	online, err := producerService.RegisterProducer(contract.RegisterProducerOptions{})
+	if err != nil {
+		t.Fatalf("RegisterProducer() error: %v", err)
+	}
+	offline, err := producerService.RegisterProducer(contract.RegisterProducerOptions{})
+	if err != nil {
+		t.Fatalf("RegisterProducer() error: %v", err)
+	}
+
+	fileService, err := NewFileService(store, producerService, fakePresence{online.Id: true})
+	if err != nil {
+		t.Fatalf("NewFileService() error: %v", err)
+	}
+	files := []struct {
+		name     string
+		size     uint64
+		producer uuid.UUID
+	}{
+		{"Ubuntu.iso", 4000, online.Id},
+		{"debian.iso", 3000, offline.Id},
+		{"notes.txt", 10, online.Id},
+	}
+	for _, file := range files {
+		_, err := fileService.RegisterFile(contract.RegisterFileOptions{
+			Name: file.name, Size: file.size, ProducerId: file.producer,
+		})
+		if err != nil {
+			t.Fatalf("RegisterFile() error: %v", err)
+		}
+	}
+
+	yes := true
+	tests := []struct {
+		name    string
+		options contract.ListFilesOptions
+		want    []string
+		total   int
+	}{
+		{name: "all", options: contract.ListFilesOptions{}, want: []string{"Ubuntu.iso", "debian.iso", "notes.txt"}, total: 3},
+		{name: "name ignores case", options: contract.ListFilesOptions{Name: "UBUNTU"}, want: []string{"Ubuntu.iso"}, total: 1},
+		{name: "producer", options: contract.ListFilesOptions{ProducerId: offline.Id}, want: []string{"debian.iso"}, total: 1},
+		{name: "size range", options: contract.ListFilesOptions{MinSize: 100, MaxSize: 3500},
+			want: []string{"debian.iso"}, total: 1},
+		{name: "online", options: contract.ListFilesOptions{Online: &yes}, want: []string{"Ubuntu.iso", "notes.txt"}, total: 2},
+		{name: "page", options: contract.ListFilesOptions{Offset: 1, Limit: 1}, want: []string{"debian.iso"}, total: 3},
+		{name: "past the end", options: contract.ListFilesOptions{Offset: 5}, want: []string{}, total: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := fileService.ListFiles(tt.options)
+			if err != nil {
+				t.Fatalf("ListFiles() error: %v", err)
+			}
+			if result.Total != tt.total {
+				t.Errorf("ListFiles() total = %d, want %d", result.Total, tt.total)
+			}
+			if names := fileNames(result.Files); !slices.Equal(names, tt.want) {
+				t.Errorf("ListFiles() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func fileNames(files []*model.FileMeta) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func TestFileService_fileTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultTTL time.Duration
+		maxTTL     time.Duration
+		requested  time.Duration
+		want       time.Duration
+	}{
+		{"no limits", 0, 0, 0, 0},
+		{"requested", 0, 0, time.Hour, time.Hour},
+		{"default", time.Hour, 0, 0, time.Hour},
+		{"requested over default", time.Hour, 0, 2 * time.Hour, 2 * time.Hour},
+		{"capped", 0, time.Hour, 2 * time.Hour, time.Hour},
+		{"forever capped", 0, time.Hour, 0, time.Hour},
+		{"under max", time.Hour, 3 * time.Hour, 2 * time.Hour, 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &FileService{}
+			s.SetTTL(tt.defaultTTL, tt.maxTTL)
+			if got := s.fileTTL(tt.requested); got != tt.want {
+				t.Errorf("fileTTL(%v) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileService_ExpireFiles(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	producerService := NewProducerService(store)
+	registered, err := producerService.RegisterProducer(contract.RegisterProducerOptions{})
+	if err != nil {
+		t.Fatalf("RegisterProducer() error: %v", err)
+	}
+	fileService, err := NewFileService(store, producerService, fakePresence{})
+	if err != nil {
+		t.Fatalf("NewFileService() error: %v", err)
+	}
+
+	expiring, err := fileService.RegisterFile(contract.RegisterFileOptions{
+		Name: "old.iso", Size: 1, ProducerId: registered.Id, TTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("RegisterFile() error: %v", err)
+	}
+	kept, err := fileService.RegisterFile(contract.RegisterFileOptions{
+		Name: "new.iso", Size: 1, ProducerId: registered.Id,
+	})
+	if err != nil {
+		t.Fatalf("RegisterFile() error: %v", err)
+	}
+
+	removed, err := fileService.ExpireFiles(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ExpireFiles() error: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("ExpireFiles() removed %d files, want 1", removed)
+	}
+	if _, err := fileService.GetFileMeta(expiring); err == nil {
+		t.Errorf("GetFileMeta() found expired file")
+	}
+	if _, err := fileService.GetFileMeta(kept); err != nil {
+		t.Errorf("GetFileMeta() error: %v", err)
+	}
+}
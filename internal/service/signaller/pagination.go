@@ -0,0 +1,22 @@
+package signaller
+
+import "udpie/internal/model/contract"
+
+// page returns the items of the requested page and the limit applied
+func page[T any](items []T, offset, limit int) []T {
+	if limit <= 0 {
+		limit = contract.DefaultPageSize
+	}
+	limit = min(limit, contract.MaxPageSize)
+	offset = max(offset, 0)
+
+	if offset >= len(items) {
+		return items[:0]
+	}
+	return items[offset:min(offset+limit, len(items))]
+}
+
+// matchesOnline reports whether the online state passes the optional filter
+func matchesOnline(filter *bool, online bool) bool {
+	return filter == nil || *filter == online
+}
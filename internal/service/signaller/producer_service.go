@@ -1,7 +1,14 @@
 package signaller
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/google/uuid"
@@ -11,61 +18,145 @@ import (
 )
 
 type ProducerService struct {
-	mu        sync.RWMutex
-	producers map[uuid.UUID]*model.Producer
+	mu        sync.Mutex // serializes updates of stored producers
+	producers contract.Collection[model.Producer]
+	presence  contract.ProducerPresence
 }
 
-func NewProducerService() *ProducerService {
+func NewProducerService(storage contract.Storage) *ProducerService {
 	return &ProducerService{
-		producers: make(map[uuid.UUID]*model.Producer),
+		producers: storage.Producers(),
 	}
 }
 
-func (s *ProducerService) RegisterProducer(options contract.RegisterProducerOptions) (uuid.UUID, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// SetPresence sets where online producers are looked up. The websocket service
+// tracking connections depends on this service, so it is set after construction.
+func (s *ProducerService) SetPresence(presence contract.ProducerPresence) {
+	s.presence = presence
+}
+
+// IsOnline reports whether the producer is connected, false until presence is set
+func (s *ProducerService) IsOnline(producerId uuid.UUID) bool {
+	return s.presence != nil && s.presence.IsOnline(producerId)
+}
+
+const producerSecretSize = 32
+
+func (s *ProducerService) RegisterProducer(options contract.RegisterProducerOptions) (*contract.RegisterProducerResult, error) {
+	secret := make([]byte, producerSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate producer secret: %w", err)
+	}
+	encoded := hex.EncodeToString(secret)
+	hash := sha256.Sum256([]byte(encoded))
 
 	producer := model.NewProducer(options.UdpOptions)
-	id := producer.Id
+	producer.SecretHash = hash[:]
+	producer.CertFingerprint = options.CertFingerprint
 
-	s.producers[id] = producer
-	return id, nil
+	if err := s.producers.Put(producer.Id, producer); err != nil {
+		return nil, fmt.Errorf("failed to save producer: %w", err)
+	}
+	return &contract.RegisterProducerResult{
+		Id:     producer.Id,
+		Secret: encoded,
+	}, nil
 }
 
-func (s *ProducerService) GetProducer(id uuid.UUID) (*model.Producer, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *ProducerService) AuthenticateProducer(id uuid.UUID, secret string) error {
+	producer, err := s.producers.Get(id)
 
-	producer, exists := s.producers[id]
-	if !exists {
-		return nil, errors.New("producer not found")
+	// Unknown producers and wrong secrets are not told apart
+	if err != nil || secret == "" || len(producer.SecretHash) == 0 {
+		return contract.ErrUnauthorized
 	}
 
-	return producer.Clone(), nil
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], producer.SecretHash) != 1 {
+		return contract.ErrUnauthorized
+	}
+
+	return nil
 }
 
-func (s *ProducerService) UpdateProducer(id uuid.UUID, options contract.RegisterProducerOptions) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *ProducerService) AuthenticateProducerCertificate(id uuid.UUID, fingerprint []byte) error {
+	producer, err := s.producers.Get(id)
+	if err != nil || len(fingerprint) == 0 || len(producer.CertFingerprint) == 0 {
+		return contract.ErrUnauthorized
+	}
 
-	producer, exists := s.producers[id]
-	if !exists {
-		return errors.New("producer not found")
+	if subtle.ConstantTimeCompare(fingerprint, producer.CertFingerprint) != 1 {
+		return contract.ErrUnauthorized
 	}
 
-	producer.UdpOptions = options.UdpOptions
 	return nil
 }
 
+func (s *ProducerService) GetProducer(id uuid.UUID) (*model.Producer, error) {
+	producer, err := s.producers.Get(id)
+	if errors.Is(err, contract.ErrNotFound) {
+		return nil, errors.New("producer not found")
+	}
+	return producer, err
+}
+
+func (s *ProducerService) UpdateProducer(id uuid.UUID, options contract.RegisterProducerOptions) error {
+	return s.UpdateUdpOptions(id, options.UdpOptions)
+}
+
 func (s *ProducerService) UpdateUdpOptions(id uuid.UUID, options model.UdpOptions) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	producer, exists := s.producers[id]
-	if !exists {
-		return errors.New("producer not found")
+	producer, err := s.GetProducer(id)
+	if err != nil {
+		return err
 	}
 
 	producer.UdpOptions = options
-	return nil
+	return s.producers.Put(id, producer)
+}
+
+func (s *ProducerService) DeleteProducer(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetProducer(id); err != nil {
+		return err
+	}
+	return s.producers.Delete(id)
+}
+
+// CountProducers returns the number of registered producers
+func (s *ProducerService) CountProducers() (int, error) {
+	stored, err := s.producers.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list producers: %w", err)
+	}
+	return len(stored), nil
+}
+
+func (s *ProducerService) ListProducers(options contract.ListProducersOptions) (*contract.ListProducersResult, error) {
+	stored, err := s.producers.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list producers: %w", err)
+	}
+
+	producers := make([]*model.Producer, 0, len(stored))
+	for _, producer := range stored {
+		if matchesOnline(options.Online, s.IsOnline(producer.Id)) {
+			producers = append(producers, producer)
+		}
+	}
+	slices.SortFunc(producers, func(a, b *model.Producer) int {
+		if order := a.CreatedAt.Compare(b.CreatedAt); order != 0 {
+			return order
+		}
+		return strings.Compare(a.Id.String(), b.Id.String())
+	})
+
+	return &contract.ListProducersResult{
+		Producers: page(producers, options.Offset, options.Limit),
+		Total:     len(producers),
+	}, nil
 }
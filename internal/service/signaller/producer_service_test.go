@@ -0,0 +1,44 @@
+package signaller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model/contract"
+	"udpie/internal/storage"
+)
+
+func TestProducerService_AuthenticateProducer(t *testing.T) {
+	s := NewProducerService(storage.NewMemoryStorage())
+	producer, err := s.RegisterProducer(contract.RegisterProducerOptions{})
+	if err != nil {
+		t.Fatalf("RegisterProducer() error: %v", err)
+	}
+	other, err := s.RegisterProducer(contract.RegisterProducerOptions{})
+	if err != nil {
+		t.Fatalf("RegisterProducer() error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		secret  string
+		wantErr error
+	}{
+		{name: "own secret", id: producer.Id, secret: producer.Secret},
+		{name: "wrong secret", id: producer.Id, secret: "wrong", wantErr: contract.ErrUnauthorized},
+		{name: "empty secret", id: producer.Id, secret: "", wantErr: contract.ErrUnauthorized},
+		{name: "secret of another producer", id: producer.Id, secret: other.Secret, wantErr: contract.ErrUnauthorized},
+		{name: "unknown producer", id: uuid.New(), secret: producer.Secret, wantErr: contract.ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.AuthenticateProducer(tt.id, tt.secret); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthenticateProducer() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,136 +1,704 @@
 package signaller
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 
 	"udpie/internal/model"
 	"udpie/internal/model/contract"
+	"udpie/internal/protocol"
+	"udpie/pkg/logutils"
 	"udpie/utils"
 )
 
-const defaultBlockSize = 1024 // 1KB default block size
-
 type TransferService struct {
-	mu               sync.RWMutex
-	transfers        map[uuid.UUID]*model.Transfer
+	mu               sync.Mutex // serializes updates of stored transfers
+	transfers        contract.Collection[model.Transfer]
 	fileService      contract.SignallerFileService
 	producerService  contract.SignallerProducerService
 	websocketService contract.WebsocketProducerService
+	events           contract.TransferEventSink   // nil until consumers can follow transfers
+	counts           map[model.TransferStatus]int // stored transfers by status, changed with the store under mu
 }
 
-func NewTransferService(fileService contract.SignallerFileService,
+// NewTransferService loads the stored transfers. Transfers which were running when the signaller
+// stopped are marked failed, nobody is waiting for them anymore.
+func NewTransferService(storage contract.Storage,
+	fileService contract.SignallerFileService,
 	producerService contract.SignallerProducerService,
-	websocketService contract.WebsocketProducerService) *TransferService {
-	return &TransferService{
-		transfers:        make(map[uuid.UUID]*model.Transfer),
+	websocketService contract.WebsocketProducerService) (*TransferService, error) {
+	s := &TransferService{
+		transfers:        storage.Transfers(),
 		fileService:      fileService,
 		producerService:  producerService,
 		websocketService: websocketService,
+		counts:           make(map[model.TransferStatus]int),
+	}
+	if err := s.failInterrupted(time.Now()); err != nil {
+		return nil, err
 	}
+	websocketService.OnMessage(protocol.KindTransferStatus, s.handleStatusMessage)
+	return s, nil
 }
 
-func (s *TransferService) InitTransfer(options contract.InitTransferOptions) (*contract.InitTransferResult, error) {
+// failInterrupted fails transfers left unfinished by the previous run. Finished transfers stored
+// before they had an end time get one, so the retention applies to them as well.
+func (s *TransferService) failInterrupted(now time.Time) error {
+	stored, err := s.transfers.List()
+	if err != nil {
+		return fmt.Errorf("failed to load transfers: %w", err)
+	}
+
+	failed := 0
+	for _, transfer := range stored {
+		if transfer.Status.Finished() && !transfer.FinishedAt.IsZero() {
+			s.counts[transfer.Status]++
+			continue
+		}
+		if !transfer.Status.Finished() {
+			transfer.Status = model.TransferStatusFailed
+			transfer.QueuePosition = 0
+			failed++
+		}
+		transfer.FinishedAt = now
+		if err := s.transfers.Put(transfer.Id, transfer); err != nil {
+			return fmt.Errorf("failed to save transfer: %w", err)
+		}
+		s.counts[transfer.Status]++
+	}
+
+	if failed > 0 {
+		logutils.WithField("count", failed).Warn("Transfers interrupted by the restart marked failed")
+	}
+	return nil
+}
+
+// ExpireTransfers removes transfers which finished at least retention ago and returns how many there were
+func (s *TransferService) ExpireTransfers(now time.Time, retention time.Duration) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	stored, err := s.transfers.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list transfers: %w", err)
+	}
+
+	expired := 0
+	for _, transfer := range stored {
+		if !transfer.Status.Finished() || transfer.FinishedAt.IsZero() || now.Sub(transfer.FinishedAt) < retention {
+			continue
+		}
+		if err := s.transfers.Delete(transfer.Id); err != nil {
+			return expired, fmt.Errorf("failed to delete transfer: %w", err)
+		}
+		s.counts[transfer.Status]--
+		expired++
+	}
+	return expired, nil
+}
+
+// StartExpiry removes old finished transfers every interval until the context is done
+func (s *TransferService) StartExpiry(ctx context.Context, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				expired, err := s.ExpireTransfers(now, retention)
+				if err != nil {
+					logutils.WithError(err).Error("Failed to remove old transfers")
+				}
+				if expired > 0 {
+					logutils.WithField("count", expired).Info("Old transfers removed")
+				}
+			}
+		}
+	}()
+}
+
+// SetEvents sets where transfer events for consumers are published
+func (s *TransferService) SetEvents(events contract.TransferEventSink) {
+	s.events = events
+}
+
+func (s *TransferService) publish(event model.TransferEvent) {
+	if s.events != nil {
+		s.events.Publish(event)
+	}
+}
+
+func (s *TransferService) handleStatusMessage(producerId uuid.UUID, message protocol.Message) error {
+	update, ok := message.(*protocol.TransferStatus)
+	if !ok {
+		return fmt.Errorf("unexpected %s message", message.Kind())
+	}
+	return s.UpdateTransferStatus(producerId, model.TransferStatusUpdate(*update))
+}
+
+func (s *TransferService) InitTransfer(options contract.InitTransferOptions) (*contract.InitTransferResult, error) {
 	fileMeta, err := s.fileService.GetFileMeta(options.FileId)
 	if err != nil {
 		return nil, err
 	}
 
+	// Fail before a transfer is stored for a producer which can't be asked
+	capabilities, online := s.websocketService.Capabilities(fileMeta.ProducerId)
+	if !online {
+		return nil, contract.ErrProducerOffline
+	}
+	if capabilities.MaxBlockSize > 0 && contract.DefaultBlockSize > capabilities.MaxBlockSize {
+		return nil, fmt.Errorf("producer supports blocks of at most %d bytes", capabilities.MaxBlockSize)
+	}
+	// Only codecs the producer announced are offered to it
+	compression := make([]string, 0, len(options.Compression))
+	for _, codec := range options.Compression {
+		if slices.Contains(capabilities.Compression, codec) {
+			compression = append(compression, codec)
+		}
+	}
+
 	consumer := &model.Consumer{
 		Id:         uuid.New(),
+		Name:       options.ConsumerName,
 		UdpOptions: options.ConsumerUdpOptions,
 	}
 
-	transfer := model.NewTransfer(fileMeta, consumer, defaultBlockSize)
-	s.transfers[transfer.Id] = transfer
-	transfer.Status = model.TransferStatusCreated
-
-	resp, err := s.websocketService.MakeClientRequestWithTimeout(&contract.WebsocketRequest{
-		ProducerId: fileMeta.ProducerId,
-		Type:       "init_transfer",
-		Data: model.ProducerInitTransferRequestData{
-			FileId:             fileMeta.Id,
-			BlockSize:          transfer.BlockSize,
-			BlocksCount:        transfer.TotalBlocks,
-			ConsumerId:         consumer.Id,
-			ConsumerUdpOptions: consumer.UdpOptions,
-		},
-	}, contract.DefaultWebsocketRequestTimeout)
+	size, err := transferSize(fileMeta, options.Path)
 	if err != nil {
-		transfer.Status = model.TransferStatusFailed
 		return nil, err
 	}
 
-	rd, err := json.Marshal(resp.Data)
+	transfer := model.NewTransfer(fileMeta, consumer, options.Path, size, contract.DefaultBlockSize)
+	if options.Range != nil {
+		if options.Range.Len() == 0 || options.Range.End > transfer.TotalBlocks {
+			return nil, fmt.Errorf("invalid block range [%d, %d) for %d blocks",
+				options.Range.Start, options.Range.End, transfer.TotalBlocks)
+		}
+		transfer.Range = *options.Range
+	}
+
+	if options.SessionId != "" {
+		if s.events == nil {
+			return nil, errors.New("transfer events are not available")
+		}
+		if err := s.events.Follow(options.SessionId, transfer.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	// The lock is not held while waiting for the producer, its status updates
+	// are read by the same websocket connection
+	transfer.Status = model.TransferStatusCreated
+	s.mu.Lock()
+	err = s.transfers.Put(transfer.Id, transfer)
+	if err == nil {
+		s.counts[transfer.Status]++
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save transfer: %w", err)
+	}
+
+	logFields := logutils.Fields{
+		"transfer_id": transfer.Id.String(),
+		"file_id":     fileMeta.Id.String(),
+		"producer_id": fileMeta.ProducerId.String(),
+		"path":        transfer.Path,
+	}
+	logutils.WithFields(logFields).Info("Transfer created")
+
+	request := &protocol.InitTransfer{
+		TransferId:         transfer.Id,
+		FileId:             fileMeta.Id,
+		Path:               transfer.Path,
+		BlockSize:          transfer.BlockSize,
+		BlocksCount:        transfer.TotalBlocks,
+		Range:              transfer.Range,
+		ConsumerId:         consumer.Id,
+		ConsumerName:       consumer.Name,
+		ConsumerUdpOptions: consumer.UdpOptions,
+		Compression:        compression,
+		MaxRate:            options.MaxRate,
+	}
+	// Older producers reject fields they do not know
+	if capabilities.ConsumerIp {
+		request.ConsumerIp = options.ConsumerIp
+	}
+	response, err := s.websocketService.MakeClientRequestWithTimeout(fileMeta.ProducerId, request,
+		contract.InitTransferTimeout)
 	if err != nil {
-		transfer.Status = model.TransferStatusFailed
+		s.fail(transfer.Id, err.Error())
+		logutils.WithFields(logFields).WithError(err).Warn("Init transfer request to producer failed")
+		if errors.Is(err, contract.ErrRequestTimeout) {
+			// The producer may still accept it and start sending to a consumer which gave up
+			go s.cancelAtProducer(transfer, "init transfer request timed out")
+		}
 		return nil, err
 	}
 
-	var respData model.ProducerInitTransferResponseData
-	if err := json.Unmarshal(rd, &respData); err != nil {
-		transfer.Status = model.TransferStatusFailed
+	respData, ok := response.(*protocol.InitTransferResult)
+	if !ok {
+		err := fmt.Errorf("unexpected %s response to %s", response.Kind(), protocol.KindInitTransfer)
+		s.fail(transfer.Id, err.Error())
 		return nil, err
 	}
 
 	if respData.Status == model.RequestTransferStatusRejected {
-		transfer.Status = model.TransferStatusProducerRejected
-		return nil, errors.New("producer rejected transfer")
+		s.setStatus(transfer.Id, model.TransferStatusProducerRejected)
+		s.publish(model.TransferEvent{
+			TransferId: transfer.Id,
+			Type:       model.TransferEventRejected,
+			Status:     model.TransferStatusProducerRejected,
+			Reason:     respData.Reason,
+		})
+		logutils.WithFields(logFields).WithField("reason", respData.Reason).Info("Producer rejected transfer")
+		if respData.Reason == model.RejectReasonBusy {
+			return nil, contract.ErrProducerBusy
+		}
+		return nil, fmt.Errorf("producer rejected transfer: %s", respData.Reason)
+	}
+
+	if respData.Compression != "" && !slices.Contains(compression, respData.Compression) {
+		err := fmt.Errorf("producer chose unsupported compression: %s", respData.Compression)
+		s.fail(transfer.Id, err.Error())
+		return nil, err
 	}
 
-	transfer.Status = model.TransferStatusProducerAccepted
-	if err := s.producerService.UpdateUdpOptions(fileMeta.ProducerId, respData.ProducerUdpOptions); err != nil {
+	transfer, err = s.update(transfer.Id, func(transfer *model.Transfer) error {
+		transfer.Compression = respData.Compression
+		// The producer may have reported progress already
+		if transfer.Status == model.TransferStatusCreated {
+			transfer.Status = model.TransferStatusProducerAccepted
+			if respData.Status == model.RequestTransferStatusQueued {
+				transfer.Status = model.TransferStatusQueued
+				transfer.QueuePosition = respData.QueuePosition
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
+	queuePosition := transfer.QueuePosition
+
+	logutils.WithFields(logFields).WithField("queue_position", queuePosition).Info("Producer accepted transfer")
+	if err := s.updateProducerAddress(fileMeta.ProducerId, transfer.Id, respData.ProducerUdpOptions); err != nil {
+		return nil, err
+	}
+
+	accepted := model.TransferEvent{
+		TransferId:         transfer.Id,
+		Type:               model.TransferEventAccepted,
+		Status:             transfer.Status,
+		QueuePosition:      queuePosition,
+		ProducerUdpOptions: &respData.ProducerUdpOptions,
+	}
+	if transfer.Status == model.TransferStatusQueued {
+		accepted.Type = model.TransferEventQueued
+	}
+	s.publish(accepted)
 
 	return &contract.InitTransferResult{
 		TransferId:         transfer.Id,
 		ProducerUdpOptions: respData.ProducerUdpOptions,
 		BlockSize:          transfer.BlockSize,
 		TotalBlocks:        transfer.TotalBlocks,
+		Range:              transfer.Range,
+		Compression:        transfer.Compression,
+		QueuePosition:      queuePosition,
 	}, nil
 }
 
-func (s *TransferService) GetTransfer(id uuid.UUID) (*model.Transfer, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// updateProducerAddress saves the address the producer reported for a new transfer.
+// Consumers of its other transfers are told when the address changed.
+func (s *TransferService) updateProducerAddress(producerId, transferId uuid.UUID, udpOptions model.UdpOptions) error {
+	producer, err := s.producerService.GetProducer(producerId)
+	if err != nil {
+		return err
+	}
+	if err := s.producerService.UpdateUdpOptions(producerId, udpOptions); err != nil {
+		return err
+	}
+	if producer.UdpOptions == udpOptions {
+		return nil
+	}
 
-	transfer, exists := s.transfers[id]
-	if !exists {
-		return nil, errors.New("transfer not found")
+	for _, transfer := range s.GetProducerTransfers(producerId) {
+		if transfer.Id == transferId {
+			continue
+		}
+		s.publish(model.TransferEvent{
+			TransferId:         transfer.Id,
+			Type:               model.TransferEventProducerAddress,
+			Status:             transfer.Status,
+			QueuePosition:      transfer.QueuePosition,
+			ProducerUdpOptions: &udpOptions,
+		})
 	}
+	return nil
+}
 
-	return transfer, nil
+// fail marks a transfer failed before the producer accepted it
+func (s *TransferService) fail(id uuid.UUID, reason string) {
+	s.setStatus(id, model.TransferStatusFailed)
+	s.publish(model.TransferEvent{
+		TransferId: id,
+		Type:       model.TransferEventStatus,
+		Status:     model.TransferStatusFailed,
+		Reason:     reason,
+	})
 }
 
-func (s *TransferService) AcknowledgeBlocksProducer(transferId uuid.UUID, offset uint64, packets utils.BitArray) error {
+func (s *TransferService) setStatus(id uuid.UUID, status model.TransferStatus) {
+	_, err := s.update(id, func(transfer *model.Transfer) error {
+		transfer.Status = status
+		return nil
+	})
+	if err != nil {
+		logutils.WithField("transfer_id", id.String()).WithError(err).Error("Failed to update transfer status")
+	}
+}
+
+// update applies a change to a stored transfer and saves it
+func (s *TransferService) update(id uuid.UUID, change func(transfer *model.Transfer) error) (*model.Transfer, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	transfer, exists := s.transfers[transferId]
-	if !exists {
-		return errors.New("transfer not found")
+	transfer, err := s.GetTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	previous := transfer.Status
+	if err := change(transfer); err != nil {
+		return nil, err
+	}
+	if transfer.Status.Finished() && transfer.FinishedAt.IsZero() {
+		transfer.FinishedAt = time.Now()
+	}
+	if err := s.transfers.Put(id, transfer); err != nil {
+		return nil, fmt.Errorf("failed to save transfer: %w", err)
+	}
+	s.counts[previous]--
+	s.counts[transfer.Status]++
+	return transfer, nil
+}
+
+// CancelTransfer records the transfer as cancelled, consumers following it are told right away.
+// The producer is asked to stop sending when it is connected, a lost request only leaves
+// the producer sending to a consumer which stopped listening.
+func (s *TransferService) CancelTransfer(id uuid.UUID, reason string) (*model.Transfer, error) {
+	previous := model.TransferStatusCreated
+	transfer, err := s.update(id, func(transfer *model.Transfer) error {
+		if transfer.Status.Finished() {
+			return contract.ErrTransferFinished
+		}
+		previous = transfer.Status
+		transfer.Status = model.TransferStatusCancelled
+		transfer.QueuePosition = 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	transfer.ReceivedBlocks.Or(offset, packets)
+	s.publish(model.TransferEvent{
+		TransferId: transfer.Id,
+		Type:       model.TransferEventCancelled,
+		Status:     model.TransferStatusCancelled,
+		Reason:     reason,
+	})
+
+	logFields := logutils.Fields{
+		"transfer_id": transfer.Id.String(),
+		"status":      previous,
+		"reason":      reason,
+	}
+	logutils.WithFields(logFields).Info("Transfer cancelled")
+
+	err = s.controlProducer(transfer, &protocol.CancelTransfer{TransferId: transfer.Id, Reason: reason})
+	if err != nil && !errors.Is(err, contract.ErrProducerOffline) && !errors.Is(err, contract.ErrNotSupported) {
+		logutils.WithFields(logFields).WithError(err).Warn("Cancel transfer request to producer failed")
+	}
+	return transfer, nil
+}
+
+// cancelAtProducer asks the producer to stop a transfer the signaller already gave up on
+func (s *TransferService) cancelAtProducer(transfer *model.Transfer, reason string) {
+	err := s.controlProducer(transfer, &protocol.CancelTransfer{TransferId: transfer.Id, Reason: reason})
+	if err != nil && !errors.Is(err, contract.ErrProducerOffline) && !errors.Is(err, contract.ErrNotSupported) {
+		logutils.WithField("transfer_id", transfer.Id.String()).WithError(err).
+			Debug("Cancel transfer request to producer failed")
+	}
+}
+
+// PauseTransfer asks the producer to suspend sending, the transfer keeps its producer slot
+func (s *TransferService) PauseTransfer(id uuid.UUID) (*model.Transfer, error) {
+	transfer, err := s.GetTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != model.TransferStatusDataSending {
+		return nil, contract.ErrTransferNotRunning
+	}
+	if err := s.controlProducer(transfer, &protocol.PauseTransfer{TransferId: id}); err != nil {
+		return nil, err
+	}
+
+	transfer, err = s.update(id, func(transfer *model.Transfer) error {
+		if transfer.Status.Finished() {
+			return contract.ErrTransferFinished
+		}
+		transfer.Status = model.TransferStatusPaused
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.TransferEvent{
+		TransferId: id,
+		Type:       model.TransferEventPaused,
+		Status:     model.TransferStatusPaused,
+	})
+	logutils.WithField("transfer_id", id.String()).Info("Transfer paused")
+	return transfer, nil
+}
+
+// ResumeTransfer continues a paused transfer. The producer gets the blocks the consumer
+// reported received while paused and sends the rest.
+func (s *TransferService) ResumeTransfer(id uuid.UUID) (*model.Transfer, error) {
+	transfer, err := s.GetTransfer(id)
+	if err != nil {
+		return nil, err
+	}
+	if transfer.Status != model.TransferStatusPaused {
+		return nil, contract.ErrTransferNotRunning
+	}
+	err = s.controlProducer(transfer, &protocol.ResumeTransfer{TransferId: id, Received: transfer.Received})
+	if err != nil {
+		return nil, err
+	}
+
+	transfer, err = s.update(id, func(transfer *model.Transfer) error {
+		if transfer.Status.Finished() {
+			return contract.ErrTransferFinished
+		}
+		transfer.Status = model.TransferStatusDataSending
+		transfer.Received = nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.TransferEvent{
+		TransferId: id,
+		Type:       model.TransferEventResumed,
+		Status:     model.TransferStatusDataSending,
+	})
+	logutils.WithField("transfer_id", id.String()).Info("Transfer resumed")
+	return transfer, nil
+}
+
+// ReportReceived merges the bitmap of blocks the consumer has into the one sent on resume
+func (s *TransferService) ReportReceived(id uuid.UUID, received []byte) error {
+	_, err := s.update(id, func(transfer *model.Transfer) error {
+		if transfer.Status.Finished() {
+			return contract.ErrTransferFinished
+		}
+		transfer.Received = mergeBitmaps(transfer.Received, received)
+		return nil
+	})
+	return err
+}
+
+// mergeBitmaps returns the union of two block bitmaps
+func mergeBitmaps(a, b []byte) []byte {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	merged := slices.Clone(a)
+	for i := range b {
+		merged[i] |= b[i]
+	}
+	return merged
+}
+
+// controlProducer sends a cancel, pause or resume request to the producer of the transfer,
+// it answers with the new status of the transfer. Producers which did not announce support
+// for the request are not sent it, ErrNotSupported is returned instead.
+func (s *TransferService) controlProducer(transfer *model.Transfer, request protocol.Message) error {
+	if transfer.FileMeta == nil {
+		return contract.ErrProducerOffline
+	}
+	capabilities, online := s.websocketService.Capabilities(transfer.FileMeta.ProducerId)
+	if !online {
+		return contract.ErrProducerOffline
+	}
+	if !capabilities.Supports(request.Kind()) {
+		return fmt.Errorf("%w: %s", contract.ErrNotSupported, request.Kind())
+	}
+
+	response, err := s.websocketService.MakeClientRequestWithTimeout(transfer.FileMeta.ProducerId, request,
+		contract.TransferControlTimeout)
+	var producerErr *protocol.Error
+	if errors.As(err, &producerErr) && producerErr.Code == protocol.CodeConflict {
+		return fmt.Errorf("%w: %s", contract.ErrTransferNotRunning, producerErr.Message)
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := response.(*protocol.TransferStatus); !ok {
+		return fmt.Errorf("unexpected %s response to %s", response.Kind(), request.Kind())
+	}
 	return nil
 }
 
-func (s *TransferService) AcknowledgeBlocksConsumer(transferId uuid.UUID, offset uint64, packets utils.BitArray) error {
+// UpdateTransferStatus applies a status update reported by the producer of the transfer.
+// Updates of finished transfers are ignored, e.g. the producer reporting a transfer cancelled by the consumer.
+func (s *TransferService) UpdateTransferStatus(producerId uuid.UUID, update model.TransferStatusUpdate) error {
+	switch update.Status {
+	case model.TransferStatusQueued, model.TransferStatusDataSending, model.TransferStatusPaused,
+		model.TransferStatusComplete, model.TransferStatusFailed, model.TransferStatusCancelled:
+	default:
+		return fmt.Errorf("unexpected transfer status: %s", update.Status)
+	}
+
+	transfer, err := s.update(update.TransferId, func(transfer *model.Transfer) error {
+		if transfer.FileMeta == nil || transfer.FileMeta.ProducerId != producerId {
+			return errors.New("transfer belongs to another producer")
+		}
+		if transfer.Status.Finished() {
+			return contract.ErrTransferFinished
+		}
+
+		transfer.Status = update.Status
+		transfer.QueuePosition = 0
+		if update.Status == model.TransferStatusQueued {
+			transfer.QueuePosition = update.QueuePosition
+		}
+		return nil
+	})
+	if errors.Is(err, contract.ErrTransferFinished) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	event := statusEvent(transfer)
+	switch transfer.Status {
+	case model.TransferStatusQueued:
+		event.Type = model.TransferEventQueued
+	case model.TransferStatusCancelled:
+		event.Type = model.TransferEventCancelled
+		event.Reason = "cancelled by the producer"
+	default:
+	}
+	s.publish(event)
+
+	logutils.WithFields(logutils.Fields{
+		"transfer_id":    transfer.Id.String(),
+		"producer_id":    producerId.String(),
+		"status":         update.Status,
+		"queue_position": transfer.QueuePosition,
+	}).Debug("Transfer status updated by producer")
+	return nil
+}
+
+// GetProducerTransfers returns transfers of the producer which are not finished yet,
+// queued ones ordered by their queue position
+func (s *TransferService) GetProducerTransfers(producerId uuid.UUID) []*model.Transfer {
+	stored, err := s.transfers.List()
+	if err != nil {
+		logutils.WithField("producer_id", producerId.String()).WithError(err).Error("Failed to list transfers")
+	}
+
+	transfers := make([]*model.Transfer, 0)
+	for _, transfer := range stored {
+		if transfer.FileMeta == nil || transfer.FileMeta.ProducerId != producerId {
+			continue
+		}
+		switch transfer.Status {
+		case model.TransferStatusProducerAccepted, model.TransferStatusQueued, model.TransferStatusDataSending,
+			model.TransferStatusPaused:
+			transfers = append(transfers, transfer)
+		default:
+		}
+	}
+
+	slices.SortFunc(transfers, func(a, b *model.Transfer) int {
+		return a.QueuePosition - b.QueuePosition
+	})
+	return transfers
+}
+
+// CountByStatus returns the number of stored transfers of every status without reading the store
+func (s *TransferService) CountByStatus() map[model.TransferStatus]int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	transfer, exists := s.transfers[transferId]
+	counts := make(map[model.TransferStatus]int, len(s.counts))
+	for status, count := range s.counts {
+		if count > 0 {
+			counts[status] = count
+		}
+	}
+	return counts
+}
+
+// transferSize returns the size of the transferred content: the whole file
+// or a single manifest entry of a directory item
+func transferSize(fileMeta *model.FileMeta, entryPath string) (uint64, error) {
+	if !fileMeta.IsDirectory() {
+		if entryPath != "" {
+			return 0, errors.New("path is only supported for directory items")
+		}
+		return fileMeta.Size, nil
+	}
+
+	if entryPath == "" {
+		return 0, errors.New("path is required for directory items")
+	}
+
+	entry, exists := fileMeta.Manifest.Find(entryPath)
 	if !exists {
-		return errors.New("transfer not found")
+		return 0, fmt.Errorf("manifest entry not found: %s", entryPath)
 	}
 
-	transfer.ReceivedBlocks.Or(offset, packets)
-	return nil
+	return entry.Size, nil
+}
+
+func (s *TransferService) GetTransfer(id uuid.UUID) (*model.Transfer, error) {
+	transfer, err := s.transfers.Get(id)
+	if errors.Is(err, contract.ErrNotFound) {
+		return nil, errors.New("transfer not found")
+	}
+	return transfer, err
+}
+
+func (s *TransferService) AcknowledgeBlocksProducer(transferId uuid.UUID, offset uint64, packets utils.BitArray) error {
+	_, err := s.update(transferId, func(transfer *model.Transfer) error {
+		transfer.ReceivedBlocks.Or(offset, packets)
+		return nil
+	})
+	return err
+}
+
+func (s *TransferService) AcknowledgeBlocksConsumer(transferId uuid.UUID, offset uint64, packets utils.BitArray) error {
+	_, err := s.update(transferId, func(transfer *model.Transfer) error {
+		transfer.ReceivedBlocks.Or(offset, packets)
+		return nil
+	})
+	return err
 }
@@ -0,0 +1,166 @@
+package signaller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/storage"
+)
+
+func TestNewTransferService_FailsInterrupted(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	finishedAt := time.Now().Add(-time.Hour)
+	stored := map[model.TransferStatus]*model.Transfer{
+		model.TransferStatusCreated:          {Status: model.TransferStatusCreated},
+		model.TransferStatusProducerAccepted: {Status: model.TransferStatusProducerAccepted},
+		model.TransferStatusQueued:           {Status: model.TransferStatusQueued, QueuePosition: 2},
+		model.TransferStatusDataSending:      {Status: model.TransferStatusDataSending},
+		model.TransferStatusPaused:           {Status: model.TransferStatusPaused},
+		model.TransferStatusComplete:         {Status: model.TransferStatusComplete, FinishedAt: finishedAt},
+		model.TransferStatusCancelled:        {Status: model.TransferStatusCancelled},
+	}
+	for _, transfer := range stored {
+		transfer.Id = uuid.New()
+		if err := store.Transfers().Put(transfer.Id, transfer); err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+
+	producerService := NewProducerService(store)
+	transferService, err := NewTransferService(store, nil, producerService, NewWebsocketService(producerService))
+	if err != nil {
+		t.Fatalf("NewTransferService() error: %v", err)
+	}
+
+	for status, want := range map[model.TransferStatus]model.TransferStatus{
+		model.TransferStatusCreated:          model.TransferStatusFailed,
+		model.TransferStatusProducerAccepted: model.TransferStatusFailed,
+		model.TransferStatusQueued:           model.TransferStatusFailed,
+		model.TransferStatusDataSending:      model.TransferStatusFailed,
+		model.TransferStatusPaused:           model.TransferStatusFailed,
+		model.TransferStatusComplete:         model.TransferStatusComplete,
+		model.TransferStatusCancelled:        model.TransferStatusCancelled,
+	} {
+		transfer, err := transferService.GetTransfer(stored[status].Id)
+		if err != nil {
+			t.Fatalf("GetTransfer() error: %v", err)
+		}
+		if transfer.Status != want {
+			t.Errorf("%s transfer status = %s, want %s", status, transfer.Status, want)
+		}
+		if transfer.QueuePosition != 0 {
+			t.Errorf("%s transfer queue position = %d, want 0", status, transfer.QueuePosition)
+		}
+		if transfer.FinishedAt.IsZero() {
+			t.Errorf("%s transfer has no end time", status)
+		}
+	}
+
+	complete, _ := transferService.GetTransfer(stored[model.TransferStatusComplete].Id)
+	if !complete.FinishedAt.Equal(finishedAt) {
+		t.Errorf("complete transfer finished at %v, want %v", complete.FinishedAt, finishedAt)
+	}
+}
+
+func TestTransferService_ExpireTransfers(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	producerService := NewProducerService(store)
+	transferService, err := NewTransferService(store, nil, producerService, NewWebsocketService(producerService))
+	if err != nil {
+		t.Fatalf("NewTransferService() error: %v", err)
+	}
+
+	now := time.Now()
+	transfers := []struct {
+		status     model.TransferStatus
+		finishedAt time.Time
+		kept       bool
+	}{
+		{status: model.TransferStatusComplete, finishedAt: now.Add(-2 * time.Hour), kept: false},
+		{status: model.TransferStatusFailed, finishedAt: now.Add(-time.Hour), kept: false},
+		{status: model.TransferStatusCancelled, finishedAt: now.Add(-time.Minute), kept: true},
+		{status: model.TransferStatusDataSending, kept: true},
+	}
+	ids := make([]uuid.UUID, len(transfers))
+	for i, tt := range transfers {
+		ids[i] = uuid.New()
+		err := store.Transfers().Put(ids[i], &model.Transfer{Id: ids[i], Status: tt.status, FinishedAt: tt.finishedAt})
+		if err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+
+	expired, err := transferService.ExpireTransfers(now, time.Hour)
+	if err != nil {
+		t.Fatalf("ExpireTransfers() error: %v", err)
+	}
+	if expired != 2 {
+		t.Errorf("ExpireTransfers() = %d, want 2", expired)
+	}
+	for i, tt := range transfers {
+		_, err := transferService.GetTransfer(ids[i])
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s transfer kept = %v, want %v", tt.status, kept, tt.kept)
+		}
+	}
+}
+
+func TestTransferService_CountByStatus(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	now := time.Now()
+	ids := make([]uuid.UUID, 3)
+	for i, status := range []model.TransferStatus{
+		model.TransferStatusDataSending, model.TransferStatusComplete, model.TransferStatusComplete,
+	} {
+		ids[i] = uuid.New()
+		err := store.Transfers().Put(ids[i], &model.Transfer{Id: ids[i], Status: status, FinishedAt: now})
+		if err != nil {
+			t.Fatalf("Put() error: %v", err)
+		}
+	}
+
+	producerService := NewProducerService(store)
+	transferService, err := NewTransferService(store, nil, producerService, NewWebsocketService(producerService))
+	if err != nil {
+		t.Fatalf("NewTransferService() error: %v", err)
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   map[model.TransferStatus]int
+	}{
+		{
+			name:   "loaded",
+			change: func() {},
+			want:   map[model.TransferStatus]int{model.TransferStatusFailed: 1, model.TransferStatusComplete: 2},
+		},
+		{
+			name:   "status changed",
+			change: func() { transferService.setStatus(ids[1], model.TransferStatusCancelled) },
+			want: map[model.TransferStatus]int{
+				model.TransferStatusFailed: 1, model.TransferStatusComplete: 1, model.TransferStatusCancelled: 1,
+			},
+		},
+		{
+			name: "expired",
+			change: func() {
+				if _, err := transferService.ExpireTransfers(now.Add(time.Hour), time.Minute); err != nil {
+					t.Fatalf("ExpireTransfers() error: %v", err)
+				}
+			},
+			want: map[model.TransferStatus]int{},
+		},
+	}
+
+	for _, step := range steps {
+		step.change()
+		if got := transferService.CountByStatus(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: CountByStatus() = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
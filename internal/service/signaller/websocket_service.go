@@ -1,57 +1,197 @@
 package signaller
 
 import (
-	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fasthttp/websocket"
 	"github.com/google/uuid"
 
+	"udpie/internal/client"
 	"udpie/internal/model"
 	"udpie/internal/model/contract"
+	"udpie/internal/protocol"
 	"udpie/pkg/logutils"
 )
 
+// HelloTimeout is how long a producer has to send its hello after connecting
+const HelloTimeout = 10 * time.Second
+
+// signallerCapabilities are the features the signaller can relay between producers and consumers
+var signallerCapabilities = protocol.Capabilities{
+	Compression:  client.SupportedCompressions,
+	MaxBlockSize: client.MaxBlockSize,
+	ConsumerIp:   true,
+	Cancel:       true,
+	Pause:        true,
+}
+
 type pendingResponse struct {
-	responseChan chan *contract.WebsocketResponse
+	responseChan chan protocol.Message
 	errorChan    chan error
 }
 
+// fail passes an error to the waiting request, a request answered already keeps its answer
+func (p *pendingResponse) fail(err error) {
+	select {
+	case p.errorChan <- err:
+	default:
+	}
+}
+
+// resolve passes a response to the waiting request, duplicates are dropped
+func (p *pendingResponse) resolve(message protocol.Message) {
+	select {
+	case p.responseChan <- message:
+	default:
+	}
+}
+
 type ProducerConnection struct {
 	ProducerId      uuid.UUID
 	Conn            *websocket.Conn
 	mu              sync.Mutex
 	pendingRequests map[string]*pendingResponse
 	requestsMu      sync.RWMutex
+	ConnectedAt     time.Time
+	Version         int                   // protocol version agreed in the handshake
+	Capabilities    protocol.Capabilities // supported by both the producer and the signaller
+	lastSeen        atomic.Int64          // unix nanoseconds of the last message
+}
+
+// touch records a message from the producer
+func (c *ProducerConnection) touch(now time.Time) {
+	c.lastSeen.Store(now.UnixNano())
+}
+
+// LastSeen returns the time of the last message from the producer
+func (c *ProducerConnection) LastSeen() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// send writes a message, requestId is empty for messages not being requests or responses
+func (c *ProducerConnection) send(requestId string, message protocol.Message) error {
+	data, err := protocol.Encode(requestId, message)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Conn == nil {
+		return errors.New("connection closed")
+	}
+	return c.Conn.WriteMessage(websocket.TextMessage, data)
 }
 
 type WebsocketService struct {
 	mu              sync.RWMutex
 	connections     map[uuid.UUID]*ProducerConnection
+	lastSeen        map[uuid.UUID]time.Time // disconnected producers
+	handlers        map[string]contract.WebsocketMessageHandler
 	producerService contract.SignallerProducerService
 }
 
 func NewWebsocketService(producerService contract.SignallerProducerService) *WebsocketService {
 	return &WebsocketService{
 		connections:     make(map[uuid.UUID]*ProducerConnection),
+		lastSeen:        make(map[uuid.UUID]time.Time),
+		handlers:        make(map[string]contract.WebsocketMessageHandler),
 		producerService: producerService,
 	}
 }
 
+// OnMessage registers a handler for producer messages of the given kind
+func (s *WebsocketService) OnMessage(kind string, handler contract.WebsocketMessageHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[kind] = handler
+}
+
+// dispatchMessage passes a producer message to the handler registered for its kind
+func (s *WebsocketService) dispatchMessage(producerId uuid.UUID, message protocol.Message) bool {
+	s.mu.RLock()
+	handler, exists := s.handlers[message.Kind()]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+
+	if err := handler(producerId, message); err != nil {
+		logutils.WithFields(logutils.Fields{
+			"producer_id": producerId.String(),
+			"type":        message.Kind(),
+		}).WithError(err).Warn("Failed to handle producer message")
+	}
+	return true
+}
+
+// handshake waits for the hello of a producer or consumer and answers with the agreed version and
+// capabilities. sessionId is handed out to consumers.
+func handshake(conn *websocket.Conn, sessionId string) (*protocol.Welcome, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(HelloTimeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+
+	refuse := func(code string, err error) (*protocol.Welcome, error) {
+		data, encodeErr := protocol.Encode("", &protocol.Error{Code: code, Message: err.Error()})
+		if encodeErr == nil {
+			_ = conn.WriteMessage(websocket.TextMessage, data)
+		}
+		return nil, err
+	}
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("no hello received: %w", err)
+	}
+	_, message, err := protocol.Decode(data)
+	if errors.Is(err, protocol.ErrUnsupportedVersion) {
+		return refuse(protocol.CodeUnsupportedVersion, err)
+	}
+	if err != nil {
+		return refuse(protocol.CodeBadMessage, err)
+	}
+	hello, ok := message.(*protocol.Hello)
+	if !ok {
+		return refuse(protocol.CodeHandshakeRequired, fmt.Errorf("expected %s, got %s",
+			protocol.KindHello, message.Kind()))
+	}
+
+	version, err := protocol.Negotiate(hello)
+	if err != nil {
+		return refuse(protocol.CodeUnsupportedVersion, err)
+	}
+
+	welcome := &protocol.Welcome{
+		Version:      version,
+		Capabilities: hello.Capabilities.Intersect(signallerCapabilities),
+		SessionId:    sessionId,
+	}
+	if data, err = protocol.Encode("", welcome); err != nil {
+		return nil, err
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		return nil, err
+	}
+	return welcome, nil
+}
+
 // registerConnection registers a websocket connection for a producer
-func (s *WebsocketService) registerConnection(producerId uuid.UUID, conn *websocket.Conn) error {
+func (s *WebsocketService) registerConnection(producerId uuid.UUID, conn *websocket.Conn,
+	welcome *protocol.Welcome) (*ProducerConnection, error) {
 	// Verify producer exists
 	_, err := s.producerService.GetProducer(producerId)
 	if err != nil {
-		return errors.New("producer not found")
+		return nil, errors.New("producer not found")
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Close existing connection if any
+	// Close existing connection if any, its handler leaves the new one alone
 	if existing, exists := s.connections[producerId]; exists {
 		existing.mu.Lock()
 		if existing.Conn != nil {
@@ -60,140 +200,151 @@ func (s *WebsocketService) registerConnection(producerId uuid.UUID, conn *websoc
 		existing.mu.Unlock()
 	}
 
-	s.connections[producerId] = &ProducerConnection{
+	now := time.Now()
+	producerConn := &ProducerConnection{
 		ProducerId:      producerId,
 		Conn:            conn,
 		pendingRequests: make(map[string]*pendingResponse),
+		ConnectedAt:     now,
+		Version:         welcome.Version,
+		Capabilities:    welcome.Capabilities,
 	}
+	producerConn.touch(now)
+	s.connections[producerId] = producerConn
+	delete(s.lastSeen, producerId)
 
 	logutils.WithFields(logutils.Fields{
 		"producer_id": producerId.String(),
+		"version":     welcome.Version,
 	}).Info("Producer websocket connection registered")
 
-	return nil
+	return producerConn, nil
 }
 
 // removeConnection removes a producer's websocket connection
 func (s *WebsocketService) removeConnection(producerId uuid.UUID) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if conn, exists := s.connections[producerId]; exists {
-		conn.mu.Lock()
-		if conn.Conn != nil {
-			_ = conn.Conn.Close()
-		}
-		conn.mu.Unlock()
-		delete(s.connections, producerId)
+	s.mu.RLock()
+	conn, exists := s.connections[producerId]
+	s.mu.RUnlock()
 
-		logutils.WithFields(logutils.Fields{
-			"producer_id": producerId.String(),
-		}).Info("Producer websocket connection removed")
+	if exists {
+		s.closeConnection(conn)
 	}
 }
 
-// NotifyProducerAboutTransfer notifies a producer about a new transfer
-func (s *WebsocketService) NotifyProducerAboutTransfer(transfer *model.Transfer) error {
-	if transfer.FileMeta == nil || transfer.FileMeta.ProducerId == uuid.Nil {
-		return errors.New("transfer missing file meta or owner")
+// closeConnection closes and removes the connection unless the producer has
+// reconnected meanwhile, a stale handler must not drop the new connection
+func (s *WebsocketService) closeConnection(conn *ProducerConnection) {
+	conn.mu.Lock()
+	if conn.Conn != nil {
+		_ = conn.Conn.Close()
 	}
+	conn.mu.Unlock()
 
-	producerId := transfer.FileMeta.ProducerId
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connections[conn.ProducerId] != conn {
+		return
+	}
+	delete(s.connections, conn.ProducerId)
+	s.lastSeen[conn.ProducerId] = time.Now()
 
-	s.mu.RLock()
-	conn, exists := s.connections[producerId]
-	s.mu.RUnlock()
+	logutils.WithFields(logutils.Fields{
+		"producer_id": conn.ProducerId.String(),
+	}).Info("Producer websocket connection removed")
+}
 
-	if !exists {
-		return errors.New("producer not connected")
-	}
+// Disconnect closes the websocket connection of the producer
+func (s *WebsocketService) Disconnect(producerId uuid.UUID) {
+	s.removeConnection(producerId)
 
-	conn.mu.Lock()
-	defer conn.mu.Unlock()
+	// A deregistered producer is forgotten
+	s.mu.Lock()
+	delete(s.lastSeen, producerId)
+	s.mu.Unlock()
+}
 
-	if conn.Conn == nil {
-		return errors.New("connection closed")
-	}
+// IsOnline reports whether the producer has a websocket connection
+func (s *WebsocketService) IsOnline(producerId uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.connections[producerId]
+	return exists
+}
 
-	// Prepare notification message
-	notification := map[string]any{
-		"type":        "transfer_notification",
-		"transfer_id": transfer.Id.String(),
-		"file_id":     transfer.FileMeta.Id.String(),
-		"file_name":   transfer.FileMeta.Name,
-		"file_size":   transfer.FileMeta.Size,
-		"consumer": map[string]any{
-			"id":          transfer.Consumer.Id.String(),
-			"udp_options": transfer.Consumer.UdpOptions,
-		},
-	}
+// ConnectionCount returns the number of connected producers
+func (s *WebsocketService) ConnectionCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.connections)
+}
 
-	message, err := json.Marshal(notification)
-	if err != nil {
-		return err
+// PendingRequestCount returns the number of requests to producers awaiting a response
+func (s *WebsocketService) PendingRequestCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, conn := range s.connections {
+		conn.requestsMu.RLock()
+		count += len(conn.pendingRequests)
+		conn.requestsMu.RUnlock()
 	}
+	return count
+}
 
-	// Send message via websocket
-	if err := conn.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-		s.removeConnection(producerId)
-		return err
+// Presence returns whether the producer is connected, since when and when it was last heard from
+func (s *WebsocketService) Presence(producerId uuid.UUID) model.Presence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if conn, exists := s.connections[producerId]; exists {
+		return model.Presence{
+			Online:      true,
+			ConnectedAt: conn.ConnectedAt,
+			LastSeen:    conn.LastSeen(),
+		}
 	}
+	return model.Presence{LastSeen: s.lastSeen[producerId]}
+}
 
-	logutils.WithFields(logutils.Fields{
-		"producer_id": producerId.String(),
-		"transfer_id": transfer.Id.String(),
-	}).Info("Notified producer about transfer")
+// Capabilities returns the features agreed with a connected producer
+func (s *WebsocketService) Capabilities(producerId uuid.UUID) (protocol.Capabilities, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return nil
+	conn, exists := s.connections[producerId]
+	if !exists {
+		return protocol.Capabilities{}, false
+	}
+	return conn.Capabilities, true
 }
 
-// MakeClientRequestWithTimeout sends a structured request to producer and waits for structured response.
-// This is a blocking operation that will wait for the producer's response or timeout.
+// MakeClientRequestWithTimeout sends a request to the producer and waits for its response.
+// An error message of the producer is returned as a *protocol.Error.
 //
 // Example usage:
 //
-//	request := contract.WebsocketRequest{
-//		ProducerId: producerId,
-//		Type: "get_status",
-//		Data: map[string]interface{}{
-//			"key": "value",
-//		},
-//	}
-//	response, err := service.MakeClientRequestWithTimeout(request, 5*time.Second)
+//	response, err := service.MakeClientRequestWithTimeout(producerId, &protocol.InitTransfer{...}, 5*time.Second)
 //	if err != nil {
-//		// Handle error (timeout, connection closed, etc.)
+//		// Handle error (timeout, connection closed, refused by the producer, etc.)
 //	}
-//	// Use response.Result or response.Data
-//
-// Producer response format:
-//   - Success: {"request_id": "...", "result": {...}} or {"request_id": "...", "data": {...}}
-//   - Error: {"request_id": "...", "error": "error message"}
-func (s *WebsocketService) MakeClientRequestWithTimeout(request *contract.WebsocketRequest,
-	timeout time.Duration) (*contract.WebsocketResponse, error) {
+//	result, ok := response.(*protocol.InitTransferResult)
+func (s *WebsocketService) MakeClientRequestWithTimeout(producerId uuid.UUID, request protocol.Message,
+	timeout time.Duration) (protocol.Message, error) {
 	s.mu.RLock()
-	conn, exists := s.connections[request.ProducerId]
+	conn, exists := s.connections[producerId]
 	s.mu.RUnlock()
 
 	if !exists {
-		return nil, errors.New("producer not connected")
+		return nil, contract.ErrProducerOffline
 	}
 
-	conn.mu.Lock()
-	if conn.Conn == nil {
-		conn.mu.Unlock()
-		return nil, errors.New("connection closed")
-	}
-	conn.mu.Unlock()
-
-	// Generate request ID if not provided
-	if request.RequestID == "" {
-		request.RequestID = uuid.New().String()
-	}
-	requestId := request.RequestID
+	requestId := uuid.New().String()
 
 	// Create pending response channels
 	pending := &pendingResponse{
-		responseChan: make(chan *contract.WebsocketResponse, 1),
+		responseChan: make(chan protocol.Message, 1),
 		errorChan:    make(chan error, 1),
 	}
 
@@ -209,55 +360,42 @@ func (s *WebsocketService) MakeClientRequestWithTimeout(request *contract.Websoc
 		conn.requestsMu.Unlock()
 	}()
 
-	// Marshal and send message
-	messageBytes, err := json.Marshal(request)
-	if err != nil {
-		return nil, err
-	}
-
-	conn.mu.Lock()
-	if err := conn.Conn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
-		conn.mu.Unlock()
+	if err := conn.send(requestId, request); err != nil {
 		return nil, err
 	}
-	conn.mu.Unlock()
 
 	logutils.WithFields(logutils.Fields{
-		"producer_id": request.ProducerId.String(),
+		"producer_id": producerId.String(),
 		"request_id":  requestId,
-		"type":        request.Type,
+		"type":        request.Kind(),
 	}).Debug("Sent message and waiting for response")
 
 	// Wait for response with timeout
 	select {
 	case response := <-pending.responseChan:
-		response.ProducerId = request.ProducerId
 		return response, nil
 	case err := <-pending.errorChan:
 		return nil, err
 	case <-time.After(timeout):
-		return nil, errors.New("timeout waiting for response")
+		return nil, contract.ErrRequestTimeout
 	}
 }
 
-// HandleConnection processes incoming websocket messages from a producer
+// HandleConnection runs the handshake and processes incoming websocket messages from a producer
 func (s *WebsocketService) HandleConnection(producerId uuid.UUID, conn *websocket.Conn) error {
-	if err := s.registerConnection(producerId, conn); err != nil {
-		return err
+	welcome, err := handshake(conn, "")
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
 	}
 
-	// Get producer connection from map
-	s.mu.RLock()
-	producerConn, exists := s.connections[producerId]
-	s.mu.RUnlock()
-
-	if !exists {
-		return errors.New("producer connection not found after registration")
+	producerConn, err := s.registerConnection(producerId, conn, welcome)
+	if err != nil {
+		return err
 	}
 
 	// Handle incoming messages
 	for {
-		msgType, msg, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			logutils.WithFields(logutils.Fields{
 				"producer_id": producerId.String(),
@@ -265,63 +403,82 @@ func (s *WebsocketService) HandleConnection(producerId uuid.UUID, conn *websocke
 			}).Info("Websocket connection closed")
 			break
 		}
-
-		// Process message
-		if msgType == websocket.TextMessage {
-			// Try to parse as JSON to check for request_id
-			var messageData map[string]any
-			if err := json.Unmarshal(msg, &messageData); err == nil {
-				// Check if this is a response to a pending request
-				if requestId, ok := messageData["request_id"].(string); ok {
-					producerConn.requestsMu.RLock()
-					pending, exists := producerConn.pendingRequests[requestId]
-					producerConn.requestsMu.RUnlock()
-
-					if exists {
-						// Check if this is an error response
-						if errorMsg, hasError := messageData["error"].(string); hasError {
-							pending.errorChan <- errors.New(errorMsg)
-						} else {
-							// Parse as WebsocketResponse
-							var response contract.WebsocketResponse
-							if err := json.Unmarshal(msg, &response); err == nil {
-								pending.responseChan <- &response
-							} else {
-								// Fallback: send error if response parsing failed
-								pending.errorChan <- errors.New("failed to parse response")
-							}
-						}
-
-						logutils.WithFields(logutils.Fields{
-							"producer_id": producerId.String(),
-							"request_id":  requestId,
-						}).Debug("Received response for pending request")
-						continue
-					}
-				}
-			}
-
-			logutils.WithFields(logutils.Fields{
-				"producer_id": producerId.String(),
-				"message":     string(msg),
-			}).Debug("Received websocket message from producer")
-		}
+		producerConn.touch(time.Now())
+		s.handleMessage(producerConn, data)
 	}
 
 	// Clean up all pending requests on disconnect
 	producerConn.requestsMu.Lock()
 	for requestId, pending := range producerConn.pendingRequests {
-		// Non-blocking send - channel is buffered with size 1
-		select {
-		case pending.errorChan <- errors.New("connection closed"):
-		default:
-			// Channel is full, which shouldn't happen, but handle gracefully
-		}
+		pending.fail(errors.New("connection closed"))
 		delete(producerConn.pendingRequests, requestId)
 	}
 	producerConn.requestsMu.Unlock()
 
 	// Clean up on disconnect
-	s.removeConnection(producerId)
+	s.closeConnection(producerConn)
 	return nil
 }
+
+// handleMessage delivers responses to pending requests and other messages to their handlers
+func (s *WebsocketService) handleMessage(producerConn *ProducerConnection, data []byte) {
+	producerId := producerConn.ProducerId
+	envelope, message, err := protocol.Decode(data)
+	if err != nil {
+		logutils.WithFields(logutils.Fields{
+			"producer_id": producerId.String(),
+		}).WithError(err).Warn("Invalid message from producer")
+
+		// A pending request fails instead of waiting for its timeout
+		if envelope != nil && envelope.RequestId != "" {
+			s.respond(producerConn, envelope.RequestId, err)
+		}
+		return
+	}
+
+	if envelope.RequestId != "" {
+		producerConn.requestsMu.RLock()
+		pending, exists := producerConn.pendingRequests[envelope.RequestId]
+		producerConn.requestsMu.RUnlock()
+
+		if exists {
+			if producerErr, isError := message.(*protocol.Error); isError {
+				pending.fail(producerErr)
+			} else {
+				pending.resolve(message)
+			}
+
+			logutils.WithFields(logutils.Fields{
+				"producer_id": producerId.String(),
+				"request_id":  envelope.RequestId,
+			}).Debug("Received response for pending request")
+			return
+		}
+	}
+
+	if s.dispatchMessage(producerId, message) {
+		return
+	}
+
+	logutils.WithFields(logutils.Fields{
+		"producer_id": producerId.String(),
+		"type":        message.Kind(),
+	}).Debug("Received websocket message from producer")
+}
+
+// respond fails the pending request, or tells the producer its request could not be decoded
+func (*WebsocketService) respond(producerConn *ProducerConnection, requestId string, err error) {
+	producerConn.requestsMu.RLock()
+	pending, exists := producerConn.pendingRequests[requestId]
+	producerConn.requestsMu.RUnlock()
+	if exists {
+		pending.fail(err)
+		return
+	}
+
+	code := protocol.CodeBadMessage
+	if errors.Is(err, protocol.ErrUnknownKind) {
+		code = protocol.CodeUnknownKind
+	}
+	_ = producerConn.send(requestId, &protocol.Error{Code: code, Message: err.Error()})
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+)
+
+const (
+	boltFileMode    = 0o600
+	boltOpenTimeout = time.Second // another signaller holding the file fails fast
+)
+
+var (
+	producersBucket = []byte("producers")
+	filesBucket     = []byte("files")
+	transfersBucket = []byte("transfers")
+)
+
+// BoltStorage keeps the state in an embedded bbolt database file, values are stored as JSON
+type BoltStorage struct {
+	db        *bolt.DB
+	producers *boltCollection[model.Producer]
+	files     *boltCollection[model.FileMeta]
+	transfers *boltCollection[model.Transfer]
+}
+
+// NewBoltStorage opens or creates the database file
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, boltFileMode, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{producersBucket, filesBucket, transfersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize storage: %w", err)
+	}
+
+	return &BoltStorage{
+		db:        db,
+		producers: &boltCollection[model.Producer]{db: db, bucket: producersBucket},
+		files:     &boltCollection[model.FileMeta]{db: db, bucket: filesBucket},
+		transfers: &boltCollection[model.Transfer]{db: db, bucket: transfersBucket},
+	}, nil
+}
+
+func (s *BoltStorage) Producers() contract.Collection[model.Producer] {
+	return s.producers
+}
+
+func (s *BoltStorage) Files() contract.Collection[model.FileMeta] {
+	return s.files
+}
+
+func (s *BoltStorage) Transfers() contract.Collection[model.Transfer] {
+	return s.transfers
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+type boltCollection[T any] struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+func (c *boltCollection[T]) Get(id uuid.UUID) (*T, error) {
+	var value *T
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(c.bucket).Get(id[:])
+		if data == nil {
+			return contract.ErrNotFound
+		}
+		value = new(T)
+		return json.Unmarshal(data, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (c *boltCollection[T]) Put(id uuid.UUID, value *T) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", c.bucket, err)
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).Put(id[:], data)
+	})
+}
+
+func (c *boltCollection[T]) Delete(id uuid.UUID) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).Delete(id[:])
+	})
+}
+
+func (c *boltCollection[T]) List() ([]*T, error) {
+	values := make([]*T, 0)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(c.bucket).ForEach(func(_, data []byte) error {
+			value := new(T)
+			if err := json.Unmarshal(data, value); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", c.bucket, err)
+			}
+			values = append(values, value)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+)
+
+// MemoryStorage keeps the state in maps, it is lost on restart
+type MemoryStorage struct {
+	producers *memoryCollection[model.Producer]
+	files     *memoryCollection[model.FileMeta]
+	transfers *memoryCollection[model.Transfer]
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		producers: newMemoryCollection((*model.Producer).Clone),
+		files:     newMemoryCollection((*model.FileMeta).Clone),
+		transfers: newMemoryCollection((*model.Transfer).Clone),
+	}
+}
+
+func (s *MemoryStorage) Producers() contract.Collection[model.Producer] {
+	return s.producers
+}
+
+func (s *MemoryStorage) Files() contract.Collection[model.FileMeta] {
+	return s.files
+}
+
+func (s *MemoryStorage) Transfers() contract.Collection[model.Transfer] {
+	return s.transfers
+}
+
+func (*MemoryStorage) Close() error {
+	return nil
+}
+
+type memoryCollection[T any] struct {
+	mu     sync.RWMutex
+	values map[uuid.UUID]*T
+	clone  func(*T) *T
+}
+
+func newMemoryCollection[T any](clone func(*T) *T) *memoryCollection[T] {
+	return &memoryCollection[T]{
+		values: make(map[uuid.UUID]*T),
+		clone:  clone,
+	}
+}
+
+func (c *memoryCollection[T]) Get(id uuid.UUID) (*T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	value, exists := c.values[id]
+	if !exists {
+		return nil, contract.ErrNotFound
+	}
+	return c.clone(value), nil
+}
+
+func (c *memoryCollection[T]) Put(id uuid.UUID, value *T) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[id] = c.clone(value)
+	return nil
+}
+
+func (c *memoryCollection[T]) Delete(id uuid.UUID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, id)
+	return nil
+}
+
+func (c *memoryCollection[T]) List() ([]*T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values := make([]*T, 0, len(c.values))
+	for _, value := range c.values {
+		values = append(values, c.clone(value))
+	}
+	return values, nil
+}
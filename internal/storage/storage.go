@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"fmt"
+
+	"udpie/internal/config"
+	"udpie/internal/model/contract"
+)
+
+// Storage types of config.StorageConfig.Type
+const (
+	TypeMemory = "memory"
+	TypeBolt   = "bolt"
+)
+
+// New opens the storage selected in the config
+func New(cfg config.StorageConfig) (contract.Storage, error) {
+	switch cfg.Type {
+	case "", TypeMemory:
+		return NewMemoryStorage(), nil
+	case TypeBolt:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("storage path is required for %s storage", TypeBolt)
+		}
+		return NewBoltStorage(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown storage type %q, expected %s or %s", cfg.Type, TypeMemory, TypeBolt)
+	}
+}
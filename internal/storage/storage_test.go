@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/model/contract"
+)
+
+func TestStorage_Collection(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) contract.Storage
+	}{
+		{name: "memory", open: func(*testing.T) contract.Storage { return NewMemoryStorage() }},
+		{name: "bolt", open: func(t *testing.T) contract.Storage {
+			store, err := NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("NewBoltStorage() error: %v", err)
+			}
+			return store
+		}},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			store := backend.open(t)
+			defer store.Close()
+
+			files := store.Files()
+			if _, err := files.Get(uuid.New()); !errors.Is(err, contract.ErrNotFound) {
+				t.Errorf("Get() of unknown ID error = %v, want ErrNotFound", err)
+			}
+
+			file := model.NewFileMeta("disk.iso", 42, []byte{1, 2, 3}, uuid.New())
+			if err := files.Put(file.Id, file); err != nil {
+				t.Fatalf("Put() error: %v", err)
+			}
+
+			// Changes are only kept once put back
+			file.Name = "changed"
+			got, err := files.Get(file.Id)
+			if err != nil {
+				t.Fatalf("Get() error: %v", err)
+			}
+			if got.Name != "disk.iso" || got.Size != 42 || got.ProducerId != file.ProducerId {
+				t.Errorf("Get() = %+v, want the stored file", got)
+			}
+
+			list, err := files.List()
+			if err != nil || len(list) != 1 {
+				t.Fatalf("List() = %d files, %v, want 1, nil", len(list), err)
+			}
+
+			if err := files.Delete(file.Id); err != nil {
+				t.Fatalf("Delete() error: %v", err)
+			}
+			if _, err := files.Get(file.Id); !errors.Is(err, contract.ErrNotFound) {
+				t.Errorf("Get() after Delete() error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestBoltStorage_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	store, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage() error: %v", err)
+	}
+	producer := model.NewProducer(model.UdpOptions{})
+	producer.SecretHash = []byte{4, 5, 6}
+	if err := store.Producers().Put(producer.Id, producer); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	fileMeta := model.NewFileMeta("disk.iso", 42, nil, producer.Id)
+	transfer := model.NewTransfer(fileMeta, &model.Consumer{Id: uuid.New()}, "", fileMeta.Size, 1)
+	if err := store.Transfers().Put(transfer.Id, transfer); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error: %v", err)
+	}
+
+	store, err = NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage() reopen error: %v", err)
+	}
+	defer store.Close()
+
+	got, err := store.Producers().Get(producer.Id)
+	if err != nil {
+		t.Fatalf("Get() after reopen error: %v", err)
+	}
+	if string(got.SecretHash) != string(producer.SecretHash) {
+		t.Errorf("SecretHash = %v, want %v", got.SecretHash, producer.SecretHash)
+	}
+
+	gotTransfer, err := store.Transfers().Get(transfer.Id)
+	if err != nil {
+		t.Fatalf("Get() transfer after reopen error: %v", err)
+	}
+	if gotTransfer.TotalBlocks != transfer.TotalBlocks || gotTransfer.FileMeta.Id != fileMeta.Id {
+		t.Errorf("transfer = %+v, want %+v", gotTransfer, transfer)
+	}
+}
@@ -48,13 +48,20 @@ func SetupLogger(config *LogConfig) error {
 	}
 
 	if config.OutputStd {
-		writers = append(writers, os.Stdout)
+		if config.Stderr {
+			writers = append(writers, os.Stderr)
+		} else {
+			writers = append(writers, os.Stdout)
+		}
 	}
 
 	var multiWriter io.Writer
 	if len(writers) > 0 {
 		multiWriter = io.MultiWriter(writers...)
 		log.SetOutput(multiWriter)
+	} else if config.Stderr {
+		// Command line tools do not log at all without an output
+		multiWriter = io.Discard
 	}
 
 	// Set as global logger
@@ -79,6 +86,7 @@ type LogConfig struct {
 	Format     string
 	OutputFile bool
 	OutputStd  bool
+	Stderr     bool // std output goes to stderr, stdout is left to command output
 	MaxSize    int  // megabytes
 	MaxBackups int  // number of backup files
 	MaxAge     int  // days
@@ -0,0 +1,215 @@
+package udpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/handler"
+	"udpie/internal/model/contract"
+	"udpie/internal/service/consumer"
+)
+
+// ErrDirectory is returned when downloading a directory into a single writer
+var ErrDirectory = errors.New("file is a directory")
+
+// statusPollInterval is how often the signaller is asked whether a transfer ended without the consumer noticing
+const statusPollInterval = 2 * time.Second
+
+// Consumer downloads files shared by producers
+type Consumer struct {
+	opts            *options
+	consumerService *consumer.ConsumerService
+	transferService *consumer.TransferService
+}
+
+// NewConsumer creates a consumer
+func NewConsumer(opts ...Option) (*Consumer, error) {
+	o := newOptions(opts)
+	if err := o.apply(); err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+
+	return &Consumer{
+		opts:            o,
+		consumerService: consumer.NewConsumerService(o.signallerURL, o.token, o.tlsConfig),
+		transferService: consumer.NewTransferService(),
+	}, nil
+}
+
+// Stat describes a file registered on the signaller
+func (c *Consumer) Stat(ctx context.Context, fileId uuid.UUID) (*File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	item, err := c.consumerService.GetManifest(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Id: item.Id, Name: item.Name, Size: item.Size}
+	if item.Manifest != nil {
+		file.Entries = len(item.Manifest.Entries)
+	}
+	return file, nil
+}
+
+// Download downloads a single file into w, blocks are written at their offsets as they arrive.
+// Cancelling ctx stops the transfer and tells the producer. Directories return ErrDirectory.
+func (c *Consumer) Download(ctx context.Context, fileId uuid.UUID, w io.WriterAt) error {
+	d, err := c.initDownload(ctx, fileId)
+	if err != nil {
+		return err
+	}
+
+	transferCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := c.receive(transferCtx, cancel, d, w, nil); err != nil {
+		return err
+	}
+	return c.finish(ctx, d)
+}
+
+// download is a transfer initiated on the signaller
+type download struct {
+	file         *File
+	result       *contract.InitTransferResult
+	producerAddr *net.UDPAddr
+	writer       *blockWriter
+	transfer     *consumer.ActiveTransfer
+	doneChan     chan struct{}
+}
+
+// initDownload asks the signaller to have the producer send a single file
+func (c *Consumer) initDownload(ctx context.Context, fileId uuid.UUID) (*download, error) {
+	file, err := c.Stat(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if file.Entries > 0 {
+		return nil, ErrDirectory
+	}
+
+	udpOptions, err := detectUDPOptions(ctx, c.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := c.consumerService.InitDownload(&handler.InitDownloadRequest{
+		Id:               fileId,
+		ClientUdpOptions: udpOptions,
+		Compression:      c.opts.compression,
+		MaxRate:          c.opts.limits.DownloadRate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initiating download: %w", err)
+	}
+
+	producerAddr, err := net.ResolveUDPAddr("udp", fmt.Sprintf("%s:%d",
+		result.ProducerUdpOptions.ExternalIp,
+		result.ProducerUdpOptions.ExternalPort))
+	if err != nil {
+		return nil, fmt.Errorf("error resolving producer address: %w", err)
+	}
+
+	return &download{file: file, result: result, producerAddr: producerAddr}, nil
+}
+
+// receive starts receiving the blocks into w until ctx is done, cancel stops it when a block can not be written.
+// onBlock is called with every block written.
+func (c *Consumer) receive(ctx context.Context, cancel context.CancelFunc, d *download, w io.WriterAt,
+	onBlock func(blockNum uint64)) error {
+	d.writer = &blockWriter{
+		w:         w,
+		blockSize: d.result.BlockSize,
+		progress:  c.opts.progress,
+		onBlock:   onBlock,
+		current:   Progress{TransferId: d.result.TransferId.String(), Total: d.file.Size},
+		cancel:    cancel,
+	}
+	doneChan, err := c.transferService.StartRangeTransfer(
+		ctx,
+		d.result.TransferId,
+		d.result.BlockSize,
+		d.result.TotalBlocks,
+		d.result.Range,
+		d.producerAddr,
+		d.result.Compression,
+		d.writer.write,
+	)
+	if err != nil {
+		return fmt.Errorf("error starting transfer: %w", err)
+	}
+
+	d.doneChan = doneChan
+	d.transfer, _ = c.transferService.GetTransferStatus(d.result.TransferId)
+	// A producer cancelling the transfer may not reach the receiver over UDP, the signaller knows
+	go c.consumerService.WatchTransfer(ctx, d.transfer, statusPollInterval)
+	return nil
+}
+
+// finish waits for the transfer to end and tells why it did unless it completed.
+// ctx is the one the caller may cancel, not the one the transfer was started with.
+func (c *Consumer) finish(ctx context.Context, d *download) error {
+	// The receiver cancels the transfer when ctx is done or a block can not be written
+	<-d.doneChan
+
+	transferId := d.result.TransferId
+	if d.writer.err != nil || ctx.Err() != nil {
+		// The receiver tells the producer over UDP, the signaller records the cancellation
+		// and reaches the producer when the packet is lost
+		if err := c.consumerService.CancelTransfer(transferId, ""); err != nil {
+			d.writer.err = errors.Join(d.writer.err, fmt.Errorf("error cancelling transfer on the signaller: %w", err))
+		}
+		return errors.Join(ctx.Err(), d.writer.err)
+	}
+
+	status := d.transfer.GetStatus()
+	if status == "cancelled" {
+		return fmt.Errorf("transfer %s was cancelled by the producer", transferId.String())
+	}
+	if status != "complete" {
+		return fmt.Errorf("transfer %s failed", transferId.String())
+	}
+	return nil
+}
+
+// blockWriter writes blocks of a transfer at their offsets and reports progress.
+// It is only called from the receiving goroutine, the fields are read once the transfer is done.
+type blockWriter struct {
+	w         io.WriterAt
+	blockSize uint64
+	progress  ProgressFunc
+	onBlock   func(blockNum uint64)
+	current   Progress
+	cancel    context.CancelFunc // stops the transfer when writing fails
+	err       error
+}
+
+func (b *blockWriter) write(blockNum uint64, data []byte) {
+	if b.err != nil {
+		return
+	}
+
+	// nolint:gosec // offsets of files registered on the signaller are far below the int64 range
+	offset := int64(blockNum * b.blockSize)
+	if _, err := b.w.WriteAt(data, offset); err != nil {
+		b.err = fmt.Errorf("failed to write block %d: %w", blockNum, err)
+		b.cancel()
+		return
+	}
+
+	if b.onBlock != nil {
+		b.onBlock(blockNum)
+	}
+	b.current.Bytes += uint64(len(data))
+	if b.progress != nil {
+		b.progress(b.current)
+	}
+}
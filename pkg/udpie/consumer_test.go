@@ -0,0 +1,102 @@
+package udpie
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// memBuffer keeps written bytes in memory, growing as needed
+type memBuffer struct {
+	data []byte
+	fail bool
+}
+
+func (w *memBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if w.fail {
+		return 0, errors.New("disk full")
+	}
+	if end := int(off) + len(p); end > len(w.data) {
+		w.data = append(w.data, make([]byte, end-len(w.data))...)
+	}
+	return copy(w.data[off:], p), nil
+}
+
+func (w *memBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(w.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestBlockWriter(t *testing.T) {
+	type block struct {
+		num  uint64
+		data string
+	}
+	tests := []struct {
+		name      string
+		blocks    []block
+		fail      bool
+		want      string
+		wantBytes []uint64
+		wantErr   bool
+	}{
+		{
+			name:      "in order",
+			blocks:    []block{{0, "abcd"}, {1, "efgh"}, {2, "ij"}},
+			want:      "abcdefghij",
+			wantBytes: []uint64{4, 8, 10},
+		},
+		{
+			name:      "out of order",
+			blocks:    []block{{2, "ij"}, {0, "abcd"}, {1, "efgh"}},
+			want:      "abcdefghij",
+			wantBytes: []uint64{2, 6, 10},
+		},
+		{
+			name:    "write error stops the transfer",
+			blocks:  []block{{0, "abcd"}, {1, "efgh"}},
+			fail:    true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &memBuffer{fail: tt.fail}
+			cancelled := false
+			var reported []uint64
+			writer := &blockWriter{
+				w:         w,
+				blockSize: 4,
+				progress:  func(progress Progress) { reported = append(reported, progress.Bytes) },
+				current:   Progress{Total: 10},
+				cancel:    func() { cancelled = true },
+			}
+
+			for _, b := range tt.blocks {
+				writer.write(b.num, []byte(b.data))
+			}
+
+			if (writer.err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", writer.err, tt.wantErr)
+			}
+			if cancelled != tt.wantErr {
+				t.Errorf("cancelled = %v, want %v", cancelled, tt.wantErr)
+			}
+			if !bytes.Equal(w.data, []byte(tt.want)) {
+				t.Errorf("data = %q, want %q", w.data, tt.want)
+			}
+			if !reflect.DeepEqual(reported, tt.wantBytes) {
+				t.Errorf("progress = %v, want %v", reported, tt.wantBytes)
+			}
+		})
+	}
+}
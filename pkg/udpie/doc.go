@@ -0,0 +1,30 @@
+// Package udpie embeds udpie producers and consumers into Go programs.
+//
+// A Producer registers local files on the signaller and serves them to consumers:
+//
+//	p, err := udpie.NewProducer(udpie.WithSignaller("https://signaller.example.com"))
+//	file, err := p.Share(ctx, "report.pdf")
+//	err = p.Serve(ctx) // until ctx is done
+//
+// A Consumer downloads a shared file into any io.WriterAt, e.g. an *os.File:
+//
+//	c, err := udpie.NewConsumer(udpie.WithSignaller("https://signaller.example.com"))
+//	err = c.Download(ctx, fileId, out)
+//
+// Consumer.Open returns a Stream instead, an io.ReaderAt and io.ReadSeeker usable while the
+// download is in progress. Reads wait for the bytes they need and the producer is asked to
+// send those blocks first, so a video can play or an archive index be read before the file arrived.
+//
+// Both find their external address via STUN and talk to the signaller over HTTP and
+// websockets, transfers themselves go directly between the peers over UDP.
+// Options not given fall back to the defaults of the command line tools.
+//
+// The module is named udpie, a path the go command can not fetch. Programs embedding it
+// check out the repository and point the module at it with a replace directive in their go.mod:
+//
+//	require udpie v0.0.0
+//
+//	replace udpie => ../udpie // path of the checked out repository
+//
+// The package is then imported as "udpie/pkg/udpie".
+package udpie
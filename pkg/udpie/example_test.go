@@ -0,0 +1,100 @@
+package udpie_test
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/google/uuid"
+
+	"udpie/pkg/logutils"
+	"udpie/pkg/udpie"
+)
+
+func ExampleProducer_Share() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	p, err := udpie.NewProducer(
+		udpie.WithSignaller("https://signaller.example.com"),
+		udpie.WithRegistrationToken(os.Getenv("UDPIE_REGISTRATION_TOKEN")),
+		udpie.WithLimits(udpie.Limits{Rate: 10 << 20, MaxTransfers: 4, QueueSize: 16}),
+		udpie.WithLogging(logutils.LogConfig{Level: "warn", Format: "text", OutputStd: true, Stderr: true}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	file, err := p.Share(ctx, "report.pdf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Sharing", file.Name, "as", file.Id)
+
+	// Consumers can download the file while the producer serves
+	if err := p.Serve(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleConsumer_Download() {
+	ctx := context.Background()
+	fileId := uuid.MustParse("5f0c6a8e-2f6b-4c3e-9a51-7d0e4f1b2c3d")
+
+	c, err := udpie.NewConsumer(
+		udpie.WithSignaller("https://signaller.example.com"),
+		udpie.WithToken(os.Getenv("UDPIE_TOKEN")),
+		udpie.WithProgress(func(progress udpie.Progress) {
+			fmt.Printf("\r%d/%d bytes", progress.Bytes, progress.Total)
+		}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out, err := os.Create("report.pdf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	if err := c.Download(ctx, fileId, out); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleConsumer_Open() {
+	ctx := context.Background()
+	fileId := uuid.MustParse("5f0c6a8e-2f6b-4c3e-9a51-7d0e4f1b2c3d")
+
+	c, err := udpie.NewConsumer(udpie.WithSignaller("https://signaller.example.com"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The blocks are kept in a temporary file while the archive index is parsed
+	buf, err := os.CreateTemp("", "udpie-stream-*")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(buf.Name())
+	defer buf.Close()
+
+	stream, err := c.Open(ctx, fileId, buf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stream.Close()
+
+	// The zip central directory is at the end, ReadAt waits for it and asks the producer to send it first
+	archive, err := zip.NewReader(stream, stream.Size())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, f := range archive.File {
+		fmt.Println(f.Name)
+	}
+}
@@ -0,0 +1,166 @@
+package udpie
+
+import (
+	"crypto/tls"
+	"time"
+
+	"udpie/internal/config"
+	"udpie/pkg/logutils"
+)
+
+// Defaults used when the corresponding option is not given
+const (
+	DefaultSignallerURL = "http://localhost:8080"
+	DefaultStateFile    = ".udpie-producer-state.json"
+	DefaultSTUNPort     = 50000
+	DefaultSTUNTimeout  = 5 * time.Second
+)
+
+// DefaultSTUNServers are asked for the external address of the UDP port
+var DefaultSTUNServers = []string{"stun.nextcloud.com:3478", "global.stun.twilio.com:3478", "stun.l.google.com:19302"}
+
+// Limits caps bandwidth and concurrency. Zero rates are unlimited, zero bursts allow one second of the rate.
+type Limits struct {
+	Rate          uint64 // bytes per second a producer sends to all consumers together
+	Burst         uint64
+	TransferRate  uint64 // bytes per second a producer sends in a single transfer
+	TransferBurst uint64
+	MaxTransfers  int    // transfers a producer serves at once, 0 for unlimited
+	QueueSize     int    // transfers a producer keeps waiting for a free slot, 0 rejects them as busy
+	DownloadRate  uint64 // bytes per second a consumer asks producers to respect
+}
+
+// Progress describes how much of a download has arrived
+type Progress struct {
+	TransferId string
+	Bytes      uint64 // bytes written so far
+	Total      uint64 // size of the file
+}
+
+// ProgressFunc is called from the receiving goroutine every time a block is written, it must not block
+type ProgressFunc func(Progress)
+
+// Option configures a Producer or a Consumer
+type Option func(*options)
+
+type options struct {
+	signallerURL      string
+	token             string
+	registrationToken string
+	tlsConfig         *tls.Config
+	stunServers       []string
+	stunPort          int
+	stunTimeout       time.Duration
+	limits            Limits
+	compression       []string
+	stateFile         string
+	logConfig         *logutils.LogConfig
+	progress          ProgressFunc
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		signallerURL: DefaultSignallerURL,
+		stunServers:  DefaultSTUNServers,
+		stunPort:     DefaultSTUNPort,
+		stunTimeout:  DefaultSTUNTimeout,
+		limits: Limits{
+			MaxTransfers: config.DefaultMaxTransfers,
+			QueueSize:    config.DefaultQueueSize,
+		},
+		compression: config.DefaultCompression,
+		stateFile:   DefaultStateFile,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithSignaller sets the URL of the signaller, https:// URLs use TLS
+func WithSignaller(url string) Option {
+	return func(o *options) {
+		o.signallerURL = url
+	}
+}
+
+// WithToken sets the consumer token the signaller requires for file lookups and downloads
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithRegistrationToken sets the token the signaller requires to register producers
+func WithRegistrationToken(token string) Option {
+	return func(o *options) {
+		o.registrationToken = token
+	}
+}
+
+// WithTLSConfig sets the TLS config of connections to an https:// signaller, e.g. for a private CA
+// or a client certificate. System roots are used without it.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithSTUN sets the STUN servers detecting the external address of the UDP port
+// and the local port used for the query
+func WithSTUN(servers []string, localPort int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.stunServers = servers
+		o.stunPort = localPort
+		o.stunTimeout = timeout
+	}
+}
+
+// WithLimits sets bandwidth and concurrency limits
+func WithLimits(limits Limits) Option {
+	return func(o *options) {
+		o.limits = limits
+	}
+}
+
+// WithCompression sets the accepted block compression codecs in order of preference, none disables compression
+func WithCompression(codecs ...string) Option {
+	return func(o *options) {
+		o.compression = codecs
+	}
+}
+
+// WithStateFile sets where a producer keeps its identity and shared files
+func WithStateFile(path string) Option {
+	return func(o *options) {
+		o.stateFile = path
+	}
+}
+
+// WithLogging configures logging of the services. Logging is shared by the whole process,
+// the last configured Producer or Consumer wins. Without it the logging setup is left alone.
+func WithLogging(logConfig logutils.LogConfig) Option {
+	return func(o *options) {
+		o.logConfig = &logConfig
+	}
+}
+
+// WithProgress sets a callback receiving the progress of downloads
+func WithProgress(progress ProgressFunc) Option {
+	return func(o *options) {
+		o.progress = progress
+	}
+}
+
+// apply sets up logging when configured
+func (o *options) apply() error {
+	if o.logConfig == nil {
+		return nil
+	}
+	return logutils.SetupLogger(o.logConfig)
+}
+
+// stunTimeoutSeconds converts the timeout for the STUN service, which counts whole seconds
+func (o *options) stunTimeoutSeconds() int {
+	return max(int(o.stunTimeout/time.Second), 1)
+}
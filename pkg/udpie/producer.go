@@ -0,0 +1,182 @@
+package udpie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+
+	"udpie/internal/model"
+	"udpie/internal/service/common"
+	"udpie/internal/service/producer"
+)
+
+// File describes a file or directory registered on the signaller
+type File struct {
+	Id      uuid.UUID
+	Name    string
+	Size    uint64
+	Path    string // local path of a shared file, empty for remote files
+	Entries int    // files in a directory, 0 for single files
+}
+
+// Producer shares local files with consumers. Shared files are kept in the state file,
+// Serve has to run for consumers to download them.
+type Producer struct {
+	opts            *options
+	stateService    *producer.StateService
+	producerService *producer.ProducerService
+	transferService *producer.TransferService
+}
+
+// NewProducer creates a producer, the identity and the files saved in the state file are reused
+func NewProducer(opts ...Option) (*Producer, error) {
+	o := newOptions(opts)
+	if err := o.apply(); err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+
+	stateService := producer.NewStateService(o.stateFile)
+	if err := stateService.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load state: %w", err)
+	}
+
+	transferService := producer.NewTransferService(stateService, o.compression, rateLimits(o.limits))
+	transferService.SetQueueLimits(o.limits.MaxTransfers, o.limits.QueueSize)
+
+	return &Producer{
+		opts:            o,
+		stateService:    stateService,
+		producerService: producer.NewProducerService(o.signallerURL, o.registrationToken, o.tlsConfig, stateService),
+		transferService: transferService,
+	}, nil
+}
+
+// Id returns the producer identity, false before the producer is registered
+func (p *Producer) Id() (uuid.UUID, bool) {
+	return p.stateService.GetProducerId()
+}
+
+// Register registers the producer on the signaller unless it already has an identity.
+// The external address consumers send requests to is detected via STUN.
+func (p *Producer) Register(ctx context.Context) (uuid.UUID, error) {
+	if producerId, exists := p.stateService.GetProducerId(); exists {
+		return producerId, nil
+	}
+
+	udpOptions, err := detectUDPOptions(ctx, p.opts)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return uuid.Nil, err
+	}
+	return p.producerService.Register(udpOptions)
+}
+
+// Share registers a file or directory on the signaller, registering the producer first when needed.
+// Directories are hashed entry by entry, which takes a while for large trees.
+func (p *Producer) Share(ctx context.Context, path string) (*File, error) {
+	producerId, err := p.Register(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register producer: %w", err)
+	}
+
+	absPath, name, size, manifest, err := producer.DescribeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	fileId, err := p.producerService.RegisterFile(name, size, producerId, absPath, manifest, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{Id: fileId, Name: name, Size: size, Path: absPath}
+	if manifest != nil {
+		file.Entries = len(manifest.Entries)
+	}
+	return file, nil
+}
+
+// Unshare removes a shared file from the signaller
+func (p *Producer) Unshare(ctx context.Context, fileId uuid.UUID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.producerService.UnregisterFile(fileId)
+}
+
+// Files returns the shared files
+func (p *Producer) Files() []File {
+	files := p.stateService.GetAllFiles()
+	result := make([]File, 0, len(files))
+	for _, info := range files {
+		file := File{Id: info.FileId, Name: info.Name, Size: info.Size, Path: info.FilePath}
+		if info.Manifest != nil {
+			file.Entries = len(info.Manifest.Entries)
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// SetLimits replaces the limits, running transfers pick them up right away
+func (p *Producer) SetLimits(limits Limits) {
+	p.transferService.SetLimits(rateLimits(limits))
+	p.transferService.SetQueueLimits(limits.MaxTransfers, limits.QueueSize)
+}
+
+// ErrProducerRejected is returned by Serve when the signaller refuses the producer, e.g. after it
+// forgot the producer. Register it again, files have to be shared again under the new identity.
+var ErrProducerRejected = producer.ErrProducerRejected
+
+// Serve connects to the signaller and sends shared files to consumers until ctx is done.
+// Lost connections to the signaller are reestablished, transfers keep running meanwhile.
+func (p *Producer) Serve(ctx context.Context) error {
+	producerId, exists := p.stateService.GetProducerId()
+	if !exists {
+		return errors.New("producer is not registered, call Register or Share first")
+	}
+
+	stunService := common.NewSTUNService(p.opts.stunServers, p.opts.stunPort, p.opts.stunTimeoutSeconds())
+	listener := producer.NewWebsocketListener(producerId, p.opts.signallerURL, p.opts.tlsConfig, p.stateService,
+		p.transferService, stunService)
+	return listener.ListenContext(ctx)
+}
+
+func rateLimits(limits Limits) producer.RateLimits {
+	return producer.RateLimits{
+		Rate:          limits.Rate,
+		Burst:         limits.Burst,
+		TransferRate:  limits.TransferRate,
+		TransferBurst: limits.TransferBurst,
+	}
+}
+
+// detectUDPOptions queries STUN servers for the external address UDP traffic arrives at
+func detectUDPOptions(ctx context.Context, o *options) (model.UdpOptions, error) {
+	if err := ctx.Err(); err != nil {
+		return model.UdpOptions{}, err
+	}
+
+	stunService := common.NewSTUNService(o.stunServers, o.stunPort, o.stunTimeoutSeconds())
+	extAddr, err := stunService.Query()
+	if err != nil {
+		return model.UdpOptions{}, fmt.Errorf("failed to detect external address via STUN: %w", err)
+	}
+
+	udpAddr, ok := extAddr.(*net.UDPAddr)
+	if !ok {
+		return model.UdpOptions{}, fmt.Errorf("unexpected STUN address %s", extAddr.String())
+	}
+	return model.UdpOptions{
+		ExternalIp:   udpAddr.IP.String(),
+		ExternalPort: udpAddr.Port,
+	}, nil
+}
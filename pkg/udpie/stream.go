@@ -0,0 +1,239 @@
+package udpie
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"udpie/pkg/logutils"
+	"udpie/utils"
+)
+
+// Timing of asking the producer for the blocks a reader waits for
+const (
+	priorityDelay = 100 * time.Millisecond // blocks arriving in order within the delay are not asked for
+	priorityRetry = time.Second            // the request is repeated while the block does not arrive
+)
+
+// ErrStreamClosed is returned when reading a closed stream
+var ErrStreamClosed = errors.New("stream is closed")
+
+// ReadWriterAt keeps the blocks of a stream, e.g. an *os.File
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Stream is a download which can be read while it is in progress. Reads block until the requested bytes
+// have arrived, the producer is asked to send the blocks readers wait for first. The producer sends
+// the file in order, so sequential readers get the file about as fast as it arrives.
+// ReadAt may be called concurrently, Read and Seek share the offset of the stream.
+type Stream struct {
+	buf        ReadWriterAt
+	size       uint64
+	blockSize  uint64
+	prioritize func(blockNum uint64)
+	cancel     context.CancelFunc
+	done       chan struct{} // closed once the transfer ended
+	err        error         // why the transfer ended, set before done is closed
+
+	mu       sync.Mutex
+	received utils.BitArray
+	arrived  chan struct{} // closed and replaced whenever a block arrives
+	closed   bool
+
+	readMu sync.Mutex
+	offset int64
+}
+
+// Open starts downloading a single file into buf and returns it as a stream right away.
+// Cancelling ctx or closing the stream stops the transfer. Directories return ErrDirectory.
+func (c *Consumer) Open(ctx context.Context, fileId uuid.UUID, buf ReadWriterAt) (*Stream, error) {
+	d, err := c.initDownload(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	transferCtx, cancel := context.WithCancel(ctx)
+	s := newStream(buf, d.file.Size, d.result.BlockSize, d.result.TotalBlocks, cancel)
+	if err := c.receive(transferCtx, cancel, d, buf, s.blockArrived); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s.prioritize = func(blockNum uint64) {
+		if err := d.transfer.Prioritize(blockNum); err != nil {
+			logutils.WithField("transfer_id", d.result.TransferId.String()).WithError(err).Debug("Failed to prioritize block")
+		}
+	}
+	go func() {
+		s.err = c.finish(transferCtx, d)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func newStream(buf ReadWriterAt, size, blockSize, totalBlocks uint64, cancel context.CancelFunc) *Stream {
+	return &Stream{
+		buf:        buf,
+		size:       size,
+		blockSize:  blockSize,
+		prioritize: func(uint64) {},
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		received:   utils.NewBitArray(totalBlocks),
+		arrived:    make(chan struct{}),
+	}
+}
+
+// Size returns the size of the file
+func (s *Stream) Size() int64 {
+	// nolint:gosec // sizes of files registered on the signaller are far below the int64 range
+	return int64(s.size)
+}
+
+// ReadAt reads len(p) bytes at off once they have arrived, fewer only at the end of the file.
+// It returns the error the transfer ended with when it ends before the bytes arrived.
+func (s *Stream) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if s.isClosed() {
+		return 0, ErrStreamClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	start := uint64(off)
+	if start >= s.size {
+		return 0, io.EOF
+	}
+	end := min(start+uint64(len(p)), s.size)
+	if err := s.wait(start, end); err != nil {
+		return 0, err
+	}
+
+	n, err := s.buf.ReadAt(p[:end-start], off)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// Read reads from the offset of the stream
+func (s *Stream) Read(p []byte) (int, error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	n, err := s.ReadAt(p, s.offset)
+	s.offset += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek moves the offset of the stream, the blocks there are asked for once Read waits for them
+func (s *Stream) Seek(offset int64, whence int) (int64, error) {
+	s.readMu.Lock()
+	defer s.readMu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.Size()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	s.offset = offset
+	return offset, nil
+}
+
+// Wait blocks until the transfer ended, it returns nil once the whole file arrived
+func (s *Stream) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// Close stops the transfer when it is still running, the blocks received so far stay in the buffer
+func (s *Stream) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// blockArrived wakes up the readers, it is called once the block is in the buffer
+func (s *Stream) blockArrived(blockNum uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received.Set(blockNum)
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+}
+
+func (s *Stream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// wait blocks until the blocks holding the bytes [start, end) have arrived.
+// The first missing block is asked for when it does not arrive soon, and again while it does not.
+func (s *Stream) wait(start, end uint64) error {
+	first, last := start/s.blockSize, (end-1)/s.blockSize
+	timer := time.NewTimer(priorityDelay)
+	defer timer.Stop()
+
+	for {
+		missing, ok, arrived := s.firstMissing(first, last)
+		if !ok {
+			return nil
+		}
+		first = missing
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			s.prioritize(missing)
+			timer.Reset(priorityRetry)
+		case <-s.done:
+			if _, ok, _ := s.firstMissing(first, last); !ok {
+				return nil
+			}
+			if s.isClosed() {
+				return ErrStreamClosed
+			}
+			if s.err != nil {
+				return s.err
+			}
+			return io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// firstMissing returns the first of the blocks [first, last] which has not arrived,
+// false when all have, and the channel closed when the next block arrives
+func (s *Stream) firstMissing(first, last uint64) (uint64, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for blockNum := first; blockNum <= last; blockNum++ {
+		if !s.received.Get(blockNum) {
+			return blockNum, true, s.arrived
+		}
+	}
+	return 0, false, s.arrived
+}
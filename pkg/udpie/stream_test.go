@@ -0,0 +1,92 @@
+package udpie
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const streamData = "abcdefghij"
+
+// newTestStream returns a stream of streamData in blocks of 4 bytes and a func delivering a block to it
+func newTestStream() (*Stream, func(blockNum uint64)) {
+	const blockSize = 4
+	buf := &memBuffer{data: make([]byte, len(streamData))}
+	s := newStream(buf, uint64(len(streamData)), blockSize, 3, func() {})
+	deliver := func(blockNum uint64) {
+		end := min((blockNum+1)*blockSize, uint64(len(streamData)))
+		_, _ = buf.WriteAt([]byte(streamData[blockNum*blockSize:end]), int64(blockNum*blockSize))
+		s.blockArrived(blockNum)
+	}
+	return s, deliver
+}
+
+func TestStream_ReadAtPrioritizes(t *testing.T) {
+	s, deliver := newTestStream()
+	asked := make(chan uint64, 1)
+	s.prioritize = func(blockNum uint64) { asked <- blockNum }
+
+	// The producer sends what it is asked for
+	go func() {
+		deliver(0)
+		deliver(<-asked)
+	}()
+
+	p := make([]byte, 4)
+	n, err := s.ReadAt(p, 8)
+	if n != 2 || !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadAt() = %d, %v, want 2, EOF", n, err)
+	}
+	if got := string(p[:n]); got != "ij" {
+		t.Errorf("ReadAt() read %q, want %q", got, "ij")
+	}
+}
+
+func TestStream_Read(t *testing.T) {
+	s, deliver := newTestStream()
+	go func() {
+		for blockNum := range uint64(3) {
+			time.Sleep(10 * time.Millisecond)
+			deliver(blockNum)
+		}
+	}()
+
+	data, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll() unexpected error: %v", err)
+	}
+	if string(data) != streamData {
+		t.Errorf("ReadAll() = %q, want %q", data, streamData)
+	}
+
+	if _, err := s.Seek(-3, io.SeekEnd); err != nil {
+		t.Fatalf("Seek() unexpected error: %v", err)
+	}
+	p := make([]byte, 8)
+	if n, err := s.Read(p); n != 3 || err != nil || string(p[:n]) != "hij" {
+		t.Errorf("Read() after Seek() = %q, %v, want %q", p[:n], err, "hij")
+	}
+}
+
+func TestStream_TransferEnds(t *testing.T) {
+	s, deliver := newTestStream()
+	deliver(0)
+	s.err = errors.New("producer went away")
+	close(s.done)
+
+	p := make([]byte, 4)
+	if n, err := s.ReadAt(p, 0); n != 4 || err != nil {
+		t.Errorf("ReadAt() received block = %d, %v, want 4, nil", n, err)
+	}
+	if _, err := s.ReadAt(p, 4); !errors.Is(err, s.err) {
+		t.Errorf("ReadAt() missing block = %v, want %v", err, s.err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+	if _, err := s.ReadAt(p, 0); !errors.Is(err, ErrStreamClosed) {
+		t.Errorf("ReadAt() after Close() = %v, want %v", err, ErrStreamClosed)
+	}
+}
@@ -33,6 +33,14 @@ func NewBitArray(n uint64) BitArray {
 	}
 }
 
+// NewBitArrayFromBytes creates an n bit array from the bytes returned by Array.
+// Missing bytes are zero, extra ones are ignored.
+func NewBitArrayFromBytes(array []byte, n uint64) BitArray {
+	arr := NewBitArray(n).(*bitArray)
+	copy(arr.array, array)
+	return arr
+}
+
 func (arr *bitArray) Array() []byte {
 	return arr.array
 }
@@ -257,6 +257,46 @@ func TestBitArray_And_Or_Boundary(t *testing.T) {
 	}
 }
 
+func TestNewBitArrayFromBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		array []byte
+		size  uint64
+		want  []uint64 // set bits
+	}{
+		{name: "exact", array: []byte{0b00000101, 0b10000000}, size: 16, want: []uint64{0, 2, 15}},
+		{name: "short input", array: []byte{0b00000001}, size: 16, want: []uint64{0}},
+		{name: "long input", array: []byte{0b00000010, 0xFF}, size: 8, want: []uint64{1}},
+		{name: "empty", array: nil, size: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arr := NewBitArrayFromBytes(tt.array, tt.size)
+			if arr.Len() != tt.size {
+				t.Fatalf("Len() = %d, want %d", arr.Len(), tt.size)
+			}
+			set := make(map[uint64]bool)
+			for _, bit := range tt.want {
+				set[bit] = true
+			}
+			for i := range tt.size {
+				if arr.Get(i) != set[i] {
+					t.Errorf("Get(%d) = %v, want %v", i, arr.Get(i), set[i])
+				}
+			}
+		})
+	}
+
+	// The input is copied
+	array := []byte{0}
+	arr := NewBitArrayFromBytes(array, 8)
+	array[0] = 0xFF
+	if arr.Get(0) {
+		t.Error("bit array shares memory with its input")
+	}
+}
+
 func TestBitArray_Clone(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error: %v", err)
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	for file, data := range map[string][]byte{certFile: certPem, keyFile: keyPem} {
+		if err := os.WriteFile(file, data, 0o600); err != nil {
+			t.Fatalf("WriteFile() error: %v", err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes() error: %v", err)
+		}
+	}
+}
+
+func commonName(t *testing.T, r *CertReloader) string {
+	t.Helper()
+	cert, _ := r.GetCertificate(nil)
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	writeTestCert(t, certFile, keyFile, "first", start)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader() error: %v", err)
+	}
+
+	if reloaded, err := reloader.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of unchanged files = %v, %v, want false, nil", reloaded, err)
+	}
+
+	writeTestCert(t, certFile, keyFile, "second", start.Add(time.Second))
+	if reloaded, err := reloader.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() of renewed files = %v, %v, want true, nil", reloaded, err)
+	}
+	if name := commonName(t, reloader); name != "second" {
+		t.Errorf("certificate = %q, want %q", name, "second")
+	}
+
+	// A broken renewal keeps serving the previous certificate
+	if err := os.WriteFile(keyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	if err := os.Chtimes(keyFile, start.Add(2*time.Second), start.Add(2*time.Second)); err != nil {
+		t.Fatalf("Chtimes() error: %v", err)
+	}
+	if _, err := reloader.Reload(); err == nil {
+		t.Error("Reload() of a broken key expected error")
+	}
+	if name := commonName(t, reloader); name != "second" {
+		t.Errorf("certificate after failed reload = %q, want %q", name, "second")
+	}
+}
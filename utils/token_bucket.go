@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenBucket limits throughput to rate tokens (bytes) per second allowing bursts of up to burst tokens.
+// Zero rate means unlimited. The limit can be changed while the bucket is in use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewTokenBucket creates a full bucket. Zero burst defaults to one second worth of tokens.
+func NewTokenBucket(rate, burst uint64) *TokenBucket {
+	b := &TokenBucket{now: time.Now}
+	b.last = b.now()
+	b.SetLimit(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// SetLimit changes rate and burst. Accumulated tokens are capped by the new burst.
+func (b *TokenBucket) SetLimit(rate, burst uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if burst == 0 {
+		burst = rate
+	}
+	b.rate = float64(rate)
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// Limit returns current rate and burst
+func (b *TokenBucket) Limit() (rate, burst uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return uint64(b.rate), uint64(b.burst)
+}
+
+// Wait blocks until n tokens are taken from the bucket or ctx is done.
+// Requests larger than the burst are allowed and put the bucket into debt.
+func (b *TokenBucket) Wait(ctx context.Context, n uint64) error {
+	delay := b.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait for them
+func (b *TokenBucket) reserve(n uint64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate == 0 {
+		return 0
+	}
+
+	b.refill()
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+
+	if b.rate == 0 {
+		b.tokens = b.burst
+		return
+	}
+
+	b.tokens += elapsed * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
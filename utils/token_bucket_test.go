@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestBucket(rate, burst uint64) (*TokenBucket, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	b := &TokenBucket{now: clock.Now, last: clock.now}
+	b.SetLimit(rate, burst)
+	b.tokens = b.burst
+	return b, clock
+}
+
+func TestTokenBucket_Unlimited(t *testing.T) {
+	b, _ := newTestBucket(0, 0)
+	for range 100 {
+		if d := b.reserve(1 << 20); d != 0 {
+			t.Fatalf("reserve() = %v, want 0 for unlimited bucket", d)
+		}
+	}
+}
+
+func TestTokenBucket_Burst(t *testing.T) {
+	b, _ := newTestBucket(1000, 500)
+
+	if d := b.reserve(500); d != 0 {
+		t.Errorf("reserve(burst) = %v, want 0", d)
+	}
+	if d := b.reserve(100); d != 100*time.Millisecond {
+		t.Errorf("reserve() after burst = %v, want 100ms", d)
+	}
+}
+
+func TestTokenBucket_Refill(t *testing.T) {
+	b, clock := newTestBucket(1000, 1000)
+
+	b.reserve(1000)
+	clock.Advance(250 * time.Millisecond)
+	if d := b.reserve(250); d != 0 {
+		t.Errorf("reserve() after refill = %v, want 0", d)
+	}
+
+	// Refill never exceeds the burst
+	clock.Advance(time.Hour)
+	b.reserve(1000)
+	if d := b.reserve(1000); d != time.Second {
+		t.Errorf("reserve() = %v, want 1s", d)
+	}
+}
+
+func TestTokenBucket_DefaultBurst(t *testing.T) {
+	b, _ := newTestBucket(2048, 0)
+	if rate, burst := b.Limit(); rate != 2048 || burst != 2048 {
+		t.Errorf("Limit() = %d, %d, want 2048, 2048", rate, burst)
+	}
+}
+
+func TestTokenBucket_SetLimit(t *testing.T) {
+	b, _ := newTestBucket(1000, 1000)
+
+	b.SetLimit(100, 10)
+	if d := b.reserve(10); d != 0 {
+		t.Errorf("reserve() = %v, want 0", d)
+	}
+	if d := b.reserve(10); d != 100*time.Millisecond {
+		t.Errorf("reserve() = %v, want 100ms", d)
+	}
+
+	b.SetLimit(0, 0)
+	if d := b.reserve(1 << 30); d != 0 {
+		t.Errorf("reserve() = %v, want 0 after removing the limit", d)
+	}
+}
+
+func TestTokenBucket_WaitCanceled(t *testing.T) {
+	b := NewTokenBucket(1, 1)
+	b.reserve(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := b.Wait(ctx, 1000); err == nil {
+		t.Error("Wait() expected error for canceled context")
+	}
+}